@@ -1,22 +1,132 @@
 package main
 
 import (
-	"database/sql"
 	"log"
 )
 
-type action struct{}
+type (
+	action struct{}
+
+	// postDataOptions アップロード時の動作を指定する
+	postDataOptions struct {
+		profile    *timezoneProfile  // サーバー時間の変換に使用するプロファイル
+		resample   bool              // trueの場合、アップロードした時間軸より上位の時間軸を再生成する
+		policy     string            // 既に存在する確定時刻のローソク足の扱い(DuplicatePolicy*)
+		validation validationOptions // アップロードしたローソク足の検証方法
+	}
+
+	// postDataResult アップロードの処理結果
+	postDataResult struct {
+		count      int
+		registered registerResult
+		validation ValidationReport
+		resampled  []PairDetail
+	}
+)
 
 var Action = action{}
 
-func (action) postData(db *db, pairName string, timeType TimeType, candles []Candle) error {
-	err := db.createDataTable(pairName)
-	if err != nil {
-		log.Println(err)
-		return err
+// postDataStream readerから読み込んだローソク足を、ingestBatchSize本ずつ検証・確定時刻に変換して登録する
+// 全件をメモリに保持しないため、途中でエラーが発生した場合はそれまでに登録したローソク足は残る
+// 何も登録せずに失敗させるには、事前にstrictモードはvalidateFileで全件を検証し、
+// fail指定はcheckDuplicateConflictsで全件を既存の行と比較しておくこと
+// progressには登録済みの本数が、バッチを登録するたびに通知される(nilの場合は通知しない)
+func (action) postDataStream(
+	store CandleStore,
+	pairName string,
+	timeType TimeType,
+	reader candleReader,
+	options postDataOptions,
+	progress func(count int)) (postDataResult, error) {
+
+	result := postDataResult{}
+	from, to := maxFixTime, minFixTime
+	validator := newCandleValidator(timeType, options.validation)
+
+	for {
+		candles, err := readCandleBatch(reader, ingestBatchSize)
+		if err != nil {
+			return result, err
+		}
+		if len(candles) == 0 {
+			break
+		}
+
+		accepted := validator.validate(candles)
+		result.validation = validator.report
+		if validator.failed() {
+			return result, ErrValidationFailed{}
+		}
+		if len(accepted) == 0 {
+			continue
+		}
+
+		normalized, batchFrom, batchTo, err := normalizeCandles(accepted, options.profile)
+		if err != nil {
+			return result, err
+		}
+
+		if result.count == 0 {
+			err = store.createDataTable(pairName)
+			if err != nil {
+				log.Println(errorLogMessage(err))
+				return result, err
+			}
+		}
+
+		registered, err := store.registerData(pairName, timeType, normalized, options.policy)
+		result.registered.add(registered)
+		if err != nil {
+			return result, err
+		}
+
+		result.count += len(normalized)
+		if batchFrom < from {
+			from = batchFrom
+		}
+		if batchTo > to {
+			to = batchTo
+		}
+		if progress != nil {
+			progress(result.count)
+		}
+		log.Println(logMessage(logRegistered, pairName, timeType.toInt(), result.count))
+	}
+
+	if result.count == 0 {
+		return result, ErrEmptyCandles{}
+	}
+
+	// report-diffの場合は何も登録していないため、再生成しない
+	if options.resample && options.policy != DuplicatePolicyReportDiff {
+		var err error
+		result.resampled, err = Action.resampleData(store, pairName, timeType, from, to, options.profile)
+		if err != nil {
+			return result, err
+		}
 	}
 
-	return db.begin(func(tx *sql.Tx) error {
-		return db.registerData(tx, pairName, timeType, candles)
-	})
+	return result, nil
+}
+
+// normalizeCandles ローソク足の時刻を確定時刻に変換し、最も古い・新しい確定時刻とともに返却する
+func normalizeCandles(candles []Candle, profile *timezoneProfile) ([]Candle, string, string, error) {
+	normalized := make([]Candle, len(candles))
+	from, to := maxFixTime, minFixTime
+	for i, c := range candles {
+		fixTime, err := Utils.getCandleFixTime(c.Time, profile)
+		if err != nil {
+			return nil, from, to, err
+		}
+		c.Time = fixTime
+		normalized[i] = c
+
+		if fixTime < from {
+			from = fixTime
+		}
+		if fixTime > to {
+			to = fixTime
+		}
+	}
+	return normalized, from, to, nil
 }
@@ -0,0 +1,477 @@
+package main
+
+import (
+	"net/http"
+)
+
+const (
+	// apiBodyCandles ローソク足のデータ(x-formatで指定した形式)
+	apiBodyCandles = "candles"
+	// apiBodyFile MT4/MT5から出力したファイル、もしくはアップロードの分割データ
+	apiBodyFile = "file"
+	// apiBodyOrder OrderPayload形式のJSON
+	apiBodyOrder = "order"
+	// apiBodyModifyPosition ModifyPositionPayload形式のJSON
+	apiBodyModifyPosition = "modify-position"
+)
+
+type (
+	// apiHandler サーバーのハンドラー(メソッド式)
+	apiHandler func(s *server, w http.ResponseWriter, r *http.Request)
+
+	// apiParam 入力パラメータの仕様(名前はv1のヘッダー名)
+	apiParam struct {
+		description string
+		schemaType  string // string, integer, number, boolean
+		enum        []string
+		list        bool // カンマ区切りの一覧(JSONボディでは配列)
+	}
+
+	// apiOperation 1つのAPI操作の仕様
+	// v1・v2のルーティングと、OpenAPIドキュメントの生成の両方に使用する
+	apiOperation struct {
+		summary  string
+		tag      string
+		role     string // 操作に必要なロール(空の場合は認証を行わない)
+		handle   apiHandler
+		required []string // 必須の入力パラメータ
+		optional []string // 任意の入力パラメータ
+		formats  []string // x-formatの選択肢
+		body     string   // リクエストボディの種類(apiBody*、ボディがない場合は空)
+		response interface{}
+		// raw 成功時のContent-Type(未指定の場合はresponseの形式のJSON、エラーは常にresponseの形式で返却する)
+		raw []string
+		// websocket WebSocketに切り替える操作(responseはメッセージの形式)
+		websocket bool
+	}
+
+	// apiRoute v1のパスと、メソッドごとの操作
+	apiRoute struct {
+		path       string
+		handle     apiHandler
+		operations map[string]string // メソッド → apiOperationsのキー
+	}
+)
+
+// timeTypeNames 時間軸の名前の一覧
+var timeTypeNames = []string{"M1", "M5", "M15", "M30", "H1", "H4", "Daily", "Weekly"}
+
+// apiParams 入力パラメータの一覧
+func apiParams() map[string]apiParam {
+	return map[string]apiParam{
+		"x-pair-name":        {description: "通貨ペア名"},
+		"x-time-type":        {description: "時間軸", enum: timeTypeNames},
+		"x-time-types":       {description: "時間軸の一覧", enum: timeTypeNames, list: true},
+		"x-lower-time-type":  {description: "下位足の時間軸", enum: timeTypeNames},
+		"x-upper-time-type":  {description: "上位足の時間軸", enum: timeTypeNames},
+		"x-lower-time":       {description: "下位足の確定時刻(yyyy-MM-dd HH:mm:ss)"},
+		"x-limit":            {description: "取得する本数", schemaType: "integer"},
+		"x-from":             {description: "期間の開始(確定時刻、yyyy-MM-dd HH:mm:ss)"},
+		"x-to":               {description: "期間の終了(確定時刻、yyyy-MM-dd HH:mm:ss)"},
+		"x-timezone-profile": {description: "タイムゾーンのプロファイル名(未指定の場合は既定のプロファイル。RAWはサーバー時間を変換しない)"},
+		"x-format":           {description: "データの形式"},
+		"x-resample":         {description: "trueの場合、登録後に上位足を生成する", schemaType: "boolean"},
+		"x-duplicate-policy": {
+			description: "既に存在する確定時刻の扱い",
+			enum:        []string{DuplicatePolicySkip, DuplicatePolicyOverwrite, DuplicatePolicyFail, DuplicatePolicyReportDiff},
+		},
+		"x-validation": {
+			description: "検証モード",
+			enum:        []string{ValidationModeLenient, ValidationModeStrict},
+		},
+		"x-spike-threshold": {description: "スパイクとみなす直前の終値からの変動率(0の場合は検出しない)", schemaType: "number"},
+		"x-file-name":       {description: "ファイル名(通貨ペア・時間軸・形式の判定に使用する)"},
+		"x-upload-id":       {description: "アップロードセッションのID"},
+		"x-offset":          {description: "分割データの開始位置(受信済みのバイト数)", schemaType: "integer"},
+		"x-holidays":        {description: "設定ファイルに加える休場日(yyyy-MM-dd)", list: true},
+		"x-order":           {description: "並び順", enum: []string{SortOrderAsc, SortOrderDesc}},
+		"x-cursor":          {description: "前のページのnextCursor"},
+		"x-indicators":      {description: "テクニカル指標(sma:20;macd:12,26,9形式、期間は1から1000までの整数)"},
+		"x-replay-time":     {description: "リプレイ時刻(指定した場合は下位足から形成中の足を合成する)"},
+		"x-session-id":      {description: "リプレイセッションのID"},
+		"x-start-time":      {description: "リプレイの開始時刻(確定時刻、yyyy-MM-dd HH:mm:ss)"},
+		"x-steps":           {description: "進める・戻す本数(未指定の場合は1本)", schemaType: "integer"},
+		"x-time":            {description: "移動先の時刻(確定時刻、yyyy-MM-dd HH:mm:ss)"},
+		"x-order-id":        {description: "注文のID", schemaType: "integer"},
+		"x-position-id":     {description: "ポジションのID", schemaType: "integer"},
+		"x-units":           {description: "決済数量(未指定の場合は全量)", schemaType: "number"},
+		"x-initial-balance": {description: "初期資金", schemaType: "number"},
+		"x-dataset": {
+			description: "データセット(privateは認証した利用者ごとのデータ)",
+			enum:        []string{DatasetPublic, DatasetPrivate},
+		},
+	}
+}
+
+// apiOperations API操作の一覧(キーはOpenAPIドキュメントのoperationIdに使用する)
+func apiOperations() map[string]apiOperation {
+	return map[string]apiOperation{
+		"getReplayCandles": {
+			summary:  "下位足の確定時刻までのローソク足を、上位足の形成中の足を含めて取得する",
+			tag:      "candles",
+			role:     RoleReadOnly,
+			handle:   (*server).handleDataGet,
+			required: []string{"x-pair-name", "x-lower-time-type", "x-upper-time-type", "x-lower-time", "x-limit"},
+			optional: []string{"x-dataset"},
+			response: ApiResponseGetData{},
+		},
+		"postCandles": {
+			summary:  "ローソク足を登録する",
+			tag:      "candles",
+			role:     RoleUploader,
+			handle:   (*server).handleDataPost,
+			required: []string{"x-pair-name", "x-time-type"},
+			optional: []string{
+				"x-format", "x-timezone-profile", "x-resample",
+				"x-duplicate-policy", "x-validation", "x-spike-threshold",
+				"x-dataset",
+			},
+			body:     apiBodyCandles,
+			formats:  []string{UploadFormatJSON, UploadFormatNDJSON, UploadFormatCSV},
+			response: ApiResponsePostData{},
+		},
+		"deleteCandles": {
+			summary:  "時間軸ごとにローソク足を全て削除する",
+			tag:      "candles",
+			role:     RoleAdmin,
+			handle:   (*server).handleDataDelete,
+			required: []string{"x-pair-name"},
+			optional: []string{"x-time-type", "x-time-types", "x-dataset"},
+			response: ApiResponseDeleteData{},
+		},
+		"getCandles": {
+			summary:  "1つの時間軸の期間内のローソク足をページ単位で取得する",
+			tag:      "candles",
+			role:     RoleReadOnly,
+			handle:   (*server).handleCandles,
+			required: []string{"x-pair-name", "x-time-type"},
+			optional: []string{"x-order", "x-limit", "x-cursor", "x-from", "x-to", "x-dataset"},
+			response: ApiResponseGetCandles{},
+		},
+		"getSummary": {
+			summary:  "ローソク足の確定時刻とティックボリュームの一覧を取得する",
+			tag:      "candles",
+			role:     RoleReadOnly,
+			handle:   (*server).handleDataSummary,
+			required: []string{"x-pair-name", "x-time-type"},
+			optional: []string{"x-dataset"},
+			response: ApiResponseGetDataSummary{},
+		},
+		"getCoverage": {
+			summary:  "データの網羅状況と欠損期間を取得する",
+			tag:      "candles",
+			role:     RoleReadOnly,
+			handle:   (*server).handleCoverage,
+			required: []string{"x-pair-name", "x-time-type"},
+			optional: []string{"x-timezone-profile", "x-holidays", "x-from", "x-to", "x-dataset"},
+			response: ApiResponseGetCoverage{},
+		},
+		"exportCandles": {
+			summary:  "期間内のローソク足をファイルとして出力する(Accept-Encodingにgzipを含む場合は圧縮する)",
+			tag:      "candles",
+			role:     RoleReadOnly,
+			handle:   (*server).handleExport,
+			required: []string{"x-pair-name", "x-time-type"},
+			optional: []string{"x-format", "x-timezone-profile", "x-from", "x-to", "x-dataset"},
+			formats:  []string{ExportFormatCSV, ExportFormatNDJSON, ExportFormatMT},
+			response: ApiResponseGetExport{},
+			raw:      []string{"text/csv", "application/x-ndjson"},
+		},
+		"getIndicators": {
+			summary:  "テクニカル指標を計算する",
+			tag:      "candles",
+			role:     RoleReadOnly,
+			handle:   (*server).handleIndicators,
+			required: []string{"x-pair-name", "x-time-type", "x-indicators"},
+			optional: []string{"x-from", "x-to", "x-replay-time", "x-lower-time-type", "x-dataset"},
+			response: ApiResponseGetIndicators{},
+		},
+		"resample": {
+			summary:  "下位足から上位足を生成する",
+			tag:      "candles",
+			role:     RoleAdmin,
+			handle:   (*server).handleResample,
+			required: []string{"x-pair-name", "x-time-type"},
+			optional: []string{"x-timezone-profile", "x-from", "x-to", "x-dataset"},
+			response: ApiResponsePostResample{},
+		},
+		"listPairs": {
+			summary:  "登録されている通貨ペアの一覧を取得する",
+			tag:      "pairs",
+			role:     RoleReadOnly,
+			handle:   (*server).handlePairList,
+			optional: []string{"x-dataset"},
+			response: ApiResponseGetPairList{},
+		},
+		"getPair": {
+			summary:  "通貨ペアの時間軸ごとの登録件数を取得する",
+			tag:      "pairs",
+			role:     RoleReadOnly,
+			handle:   (*server).handlePairDetail,
+			required: []string{"x-pair-name"},
+			optional: []string{"x-dataset"},
+			response: ApiResponseGetPairDetail{},
+		},
+		"importFile": {
+			summary: "MT4/MT5から出力したCSV・.hstファイルを登録する",
+			tag:     "uploads",
+			role:    RoleUploader,
+			handle:  (*server).handleImport,
+			optional: []string{
+				"x-file-name", "x-format", "x-pair-name", "x-time-type", "x-timezone-profile",
+				"x-resample", "x-validation", "x-spike-threshold",
+				"x-dataset",
+			},
+			body:     apiBodyFile,
+			formats:  []string{ImportFormatCSV, ImportFormatHST},
+			response: ApiResponsePostImport{},
+		},
+		"createUpload": {
+			summary:  "分割アップロードのセッションを作成する",
+			tag:      "uploads",
+			role:     RoleUploader,
+			handle:   (*server).handleUpload,
+			required: []string{"x-pair-name", "x-time-type"},
+			optional: []string{
+				"x-format", "x-timezone-profile", "x-resample",
+				"x-duplicate-policy", "x-validation", "x-spike-threshold",
+				"x-dataset",
+			},
+			formats:  []string{UploadFormatJSON, UploadFormatNDJSON, UploadFormatCSV},
+			response: ApiResponseUpload{},
+		},
+		"appendUpload": {
+			summary:  "分割データを送信する",
+			tag:      "uploads",
+			role:     RoleUploader,
+			handle:   (*server).handleUpload,
+			required: []string{"x-upload-id", "x-offset"},
+			body:     apiBodyFile,
+			response: ApiResponseUpload{},
+		},
+		"getUpload": {
+			summary:  "アップロードセッションの状態を取得する",
+			tag:      "uploads",
+			role:     RoleUploader,
+			handle:   (*server).handleUpload,
+			required: []string{"x-upload-id"},
+			response: ApiResponseUpload{},
+		},
+		"deleteUpload": {
+			summary:  "アップロードセッションを破棄する",
+			tag:      "uploads",
+			role:     RoleUploader,
+			handle:   (*server).handleUpload,
+			required: []string{"x-upload-id"},
+			response: ApiResponseUpload{},
+		},
+		"completeUpload": {
+			summary:  "送信を完了し、取り込みを開始する",
+			tag:      "uploads",
+			role:     RoleUploader,
+			handle:   (*server).handleUploadComplete,
+			required: []string{"x-upload-id"},
+			response: ApiResponseUpload{},
+		},
+		"createReplay": {
+			summary:  "リプレイセッションを作成する",
+			tag:      "replays",
+			role:     RoleReadOnly,
+			handle:   (*server).handleReplay,
+			required: []string{"x-pair-name", "x-start-time", "x-time-types"},
+			optional: []string{"x-dataset"},
+			response: ApiResponseReplay{},
+		},
+		"getReplay": {
+			summary:  "リプレイセッションの状態を取得する",
+			tag:      "replays",
+			role:     RoleReadOnly,
+			handle:   (*server).handleReplay,
+			required: []string{"x-session-id"},
+			response: ApiResponseReplay{},
+		},
+		"deleteReplay": {
+			summary:  "リプレイセッションを破棄する",
+			tag:      "replays",
+			role:     RoleReadOnly,
+			handle:   (*server).handleReplay,
+			required: []string{"x-session-id"},
+			response: ApiResponseReplay{},
+		},
+		"nextReplay": {
+			summary:  "リプレイを進める",
+			tag:      "replays",
+			role:     RoleReadOnly,
+			handle:   (*server).handleReplayNext,
+			required: []string{"x-session-id"},
+			optional: []string{"x-steps"},
+			response: ApiResponseReplay{},
+		},
+		"prevReplay": {
+			summary:  "リプレイを戻す",
+			tag:      "replays",
+			role:     RoleReadOnly,
+			handle:   (*server).handleReplayPrev,
+			required: []string{"x-session-id"},
+			optional: []string{"x-steps"},
+			response: ApiResponseReplay{},
+		},
+		"seekReplay": {
+			summary:  "リプレイを指定の時刻へ移動する",
+			tag:      "replays",
+			role:     RoleReadOnly,
+			handle:   (*server).handleReplaySeek,
+			required: []string{"x-session-id", "x-time"},
+			response: ApiResponseReplay{},
+		},
+		"placeOrder": {
+			summary:  "注文を発注する",
+			tag:      "replays",
+			role:     RoleReadOnly,
+			handle:   (*server).handleReplayOrders,
+			required: []string{"x-session-id"},
+			body:     apiBodyOrder,
+			response: ApiResponseReplay{},
+		},
+		"cancelOrder": {
+			summary:  "注文を取り消す",
+			tag:      "replays",
+			role:     RoleReadOnly,
+			handle:   (*server).handleReplayOrders,
+			required: []string{"x-session-id", "x-order-id"},
+			response: ApiResponseReplay{},
+		},
+		"modifyPosition": {
+			summary:  "ポジションの決済注文を変更する",
+			tag:      "replays",
+			role:     RoleReadOnly,
+			handle:   (*server).handleReplayPositions,
+			required: []string{"x-session-id"},
+			body:     apiBodyModifyPosition,
+			response: ApiResponseReplay{},
+		},
+		"closePosition": {
+			summary:  "ポジションを決済する",
+			tag:      "replays",
+			role:     RoleReadOnly,
+			handle:   (*server).handleReplayPositions,
+			required: []string{"x-session-id", "x-position-id"},
+			optional: []string{"x-units"},
+			response: ApiResponseReplay{},
+		},
+		"getReport": {
+			summary:  "バックテストのレポートを取得する(x-formatがhtml, csvの場合はファイルとして出力する)",
+			tag:      "replays",
+			role:     RoleReadOnly,
+			handle:   (*server).handleReplayReport,
+			required: []string{"x-session-id"},
+			optional: []string{"x-initial-balance", "x-format"},
+			formats:  []string{"json", "html", "csv"},
+			response: ApiResponseGetReport{},
+			raw:      []string{"application/json", "text/html", "text/csv"},
+		},
+		"streamReplay": {
+			summary:   "WebSocketでリプレイを再生する(ReplayControlMessageを送信し、ReplayStreamMessageを受信する)",
+			tag:       "replays",
+			role:      RoleReadOnly,
+			handle:    (*server).handleReplayStream,
+			optional:  []string{"x-dataset"},
+			response:  ReplayStreamMessage{},
+			websocket: true,
+		},
+		"getOpenAPI": {
+			summary: "このAPIのOpenAPIドキュメントを取得する",
+			tag:     "meta",
+			handle:  (*server).handleOpenAPI,
+			raw:     []string{"application/json"},
+		},
+	}
+}
+
+// operationOf リクエストのメソッドに対応する操作を返却する
+func (route apiRoute) operationOf(r *http.Request) (apiOperation, bool) {
+	id, ok := route.operations[r.Method]
+	if !ok {
+		return apiOperation{}, false
+	}
+	return apiOperations()[id], true
+}
+
+// apiV1Routes v1のルーティング表(server.acceptで登録する)
+// 入力パラメータはヘッダーで受け取る
+func apiV1Routes() []apiRoute {
+	return []apiRoute{
+		{path: "/api/data", handle: (*server).handleData, operations: map[string]string{
+			"POST":   "postCandles",
+			"GET":    "getReplayCandles",
+			"DELETE": "deleteCandles",
+		}},
+		{path: "/api/import", handle: (*server).handleImport, operations: map[string]string{
+			"POST": "importFile",
+		}},
+		{path: "/api/upload", handle: (*server).handleUpload, operations: map[string]string{
+			"POST":   "createUpload",
+			"PUT":    "appendUpload",
+			"GET":    "getUpload",
+			"DELETE": "deleteUpload",
+		}},
+		{path: "/api/upload/complete", handle: (*server).handleUploadComplete, operations: map[string]string{
+			"POST": "completeUpload",
+		}},
+		{path: "/api/export", handle: (*server).handleExport, operations: map[string]string{
+			"GET": "exportCandles",
+		}},
+		{path: "/api/data_summary", handle: (*server).handleDataSummary, operations: map[string]string{
+			"GET": "getSummary",
+		}},
+		{path: "/api/pair_list", handle: (*server).handlePairList, operations: map[string]string{
+			"GET": "listPairs",
+		}},
+		{path: "/api/pair_detail", handle: (*server).handlePairDetail, operations: map[string]string{
+			"GET": "getPair",
+		}},
+		{path: "/api/coverage", handle: (*server).handleCoverage, operations: map[string]string{
+			"GET": "getCoverage",
+		}},
+		{path: "/api/candles", handle: (*server).handleCandles, operations: map[string]string{
+			"GET": "getCandles",
+		}},
+		{path: "/api/resample", handle: (*server).handleResample, operations: map[string]string{
+			"POST": "resample",
+		}},
+		{path: "/api/indicators", handle: (*server).handleIndicators, operations: map[string]string{
+			"GET": "getIndicators",
+		}},
+		{path: "/api/replay", handle: (*server).handleReplay, operations: map[string]string{
+			"POST":   "createReplay",
+			"GET":    "getReplay",
+			"DELETE": "deleteReplay",
+		}},
+		{path: "/api/replay/next", handle: (*server).handleReplayNext, operations: map[string]string{
+			"POST": "nextReplay",
+		}},
+		{path: "/api/replay/prev", handle: (*server).handleReplayPrev, operations: map[string]string{
+			"POST": "prevReplay",
+		}},
+		{path: "/api/replay/seek", handle: (*server).handleReplaySeek, operations: map[string]string{
+			"POST": "seekReplay",
+		}},
+		{path: "/api/replay/orders", handle: (*server).handleReplayOrders, operations: map[string]string{
+			"POST":   "placeOrder",
+			"DELETE": "cancelOrder",
+		}},
+		{path: "/api/replay/positions", handle: (*server).handleReplayPositions, operations: map[string]string{
+			"PUT":    "modifyPosition",
+			"DELETE": "closePosition",
+		}},
+		{path: "/api/replay/report", handle: (*server).handleReplayReport, operations: map[string]string{
+			"GET": "getReport",
+		}},
+		{path: "/api/replay/stream", handle: (*server).handleReplayStream, operations: map[string]string{
+			"GET": "streamReplay",
+		}},
+		{path: openAPIPath, handle: (*server).handleOpenAPI, operations: map[string]string{
+			"GET": "getOpenAPI",
+		}},
+	}
+}
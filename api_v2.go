@@ -0,0 +1,183 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+const apiV2Prefix = "/api/v2"
+
+type (
+	// v2Route v2のリソースパスと、メソッドごとの操作
+	// パスの{}で囲んだ部分は、その名前(v1のヘッダー名)の入力パラメータとして扱う
+	v2Route struct {
+		pattern    string
+		operations map[string]string // メソッド → apiOperationsのキー
+		bodyParams []string          // JSONボディから読み込む入力パラメータ(POSTのみ)
+	}
+)
+
+// apiV2Routes v2のルーティング表
+// 処理はv1と同じ操作を使用し、入力をヘッダーではなくパス・クエリ文字列・JSONボディから受け取る
+func apiV2Routes() []v2Route {
+	return []v2Route{
+		{pattern: "/pairs", operations: map[string]string{
+			"GET": "listPairs",
+		}},
+		{pattern: "/pairs/{x-pair-name}", operations: map[string]string{
+			"GET": "getPair",
+		}},
+		{pattern: "/pairs/{x-pair-name}/timeframes/{x-time-type}/candles", operations: map[string]string{
+			"GET":    "getCandles",
+			"POST":   "postCandles",
+			"DELETE": "deleteCandles",
+		}},
+		{pattern: "/pairs/{x-pair-name}/timeframes/{x-upper-time-type}/replay-candles", operations: map[string]string{
+			"GET": "getReplayCandles",
+		}},
+		{pattern: "/pairs/{x-pair-name}/timeframes/{x-time-type}/summary", operations: map[string]string{
+			"GET": "getSummary",
+		}},
+		{pattern: "/pairs/{x-pair-name}/timeframes/{x-time-type}/coverage", operations: map[string]string{
+			"GET": "getCoverage",
+		}},
+		{pattern: "/pairs/{x-pair-name}/timeframes/{x-time-type}/export", operations: map[string]string{
+			"GET": "exportCandles",
+		}},
+		{pattern: "/pairs/{x-pair-name}/timeframes/{x-time-type}/indicators", operations: map[string]string{
+			"GET": "getIndicators",
+		}},
+		{pattern: "/pairs/{x-pair-name}/timeframes/{x-time-type}/resample", operations: map[string]string{
+			"POST": "resample",
+		}, bodyParams: []string{"x-timezone-profile", "x-from", "x-to"}},
+		{pattern: "/imports", operations: map[string]string{
+			"POST": "importFile",
+		}},
+		{pattern: "/uploads", operations: map[string]string{
+			"POST": "createUpload",
+		}, bodyParams: []string{
+			"x-pair-name", "x-time-type", "x-format", "x-timezone-profile", "x-resample",
+			"x-duplicate-policy", "x-validation", "x-spike-threshold",
+		}},
+		{pattern: "/uploads/{x-upload-id}", operations: map[string]string{
+			"GET":    "getUpload",
+			"PUT":    "appendUpload",
+			"DELETE": "deleteUpload",
+		}},
+		{pattern: "/uploads/{x-upload-id}/complete", operations: map[string]string{
+			"POST": "completeUpload",
+		}},
+		{pattern: "/replays", operations: map[string]string{
+			"POST": "createReplay",
+		}, bodyParams: []string{"x-pair-name", "x-start-time", "x-time-types"}},
+		{pattern: "/replays/stream", operations: map[string]string{
+			"GET": "streamReplay",
+		}},
+		{pattern: "/replays/{x-session-id}", operations: map[string]string{
+			"GET":    "getReplay",
+			"DELETE": "deleteReplay",
+		}},
+		{pattern: "/replays/{x-session-id}/next", operations: map[string]string{
+			"POST": "nextReplay",
+		}, bodyParams: []string{"x-steps"}},
+		{pattern: "/replays/{x-session-id}/prev", operations: map[string]string{
+			"POST": "prevReplay",
+		}, bodyParams: []string{"x-steps"}},
+		{pattern: "/replays/{x-session-id}/seek", operations: map[string]string{
+			"POST": "seekReplay",
+		}, bodyParams: []string{"x-time"}},
+		{pattern: "/replays/{x-session-id}/orders", operations: map[string]string{
+			"POST": "placeOrder",
+		}},
+		{pattern: "/replays/{x-session-id}/orders/{x-order-id}", operations: map[string]string{
+			"DELETE": "cancelOrder",
+		}},
+		{pattern: "/replays/{x-session-id}/positions", operations: map[string]string{
+			"PUT": "modifyPosition",
+		}},
+		{pattern: "/replays/{x-session-id}/positions/{x-position-id}", operations: map[string]string{
+			"DELETE": "closePosition",
+		}},
+		{pattern: "/replays/{x-session-id}/report", operations: map[string]string{
+			"GET": "getReport",
+		}},
+	}
+}
+
+// match パスがパターンと一致する場合に、パスから取り出した入力パラメータを返却する
+func (route v2Route) match(path string) (requestParams, bool) {
+	patternSegments := strings.Split(strings.Trim(route.pattern, "/"), "/")
+	pathSegments := strings.Split(strings.Trim(path, "/"), "/")
+	if len(patternSegments) != len(pathSegments) {
+		return nil, false
+	}
+
+	params := make(requestParams)
+	for i, segment := range patternSegments {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			if pathSegments[i] == "" {
+				return nil, false
+			}
+			params[strings.Trim(segment, "{}")] = pathSegments[i]
+			continue
+		}
+		if segment != pathSegments[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// methods ルートが対応するメソッドの一覧を返却する
+func (route v2Route) methods() []string {
+	methods := make([]string, 0, len(route.operations)+1)
+	for method := range route.operations {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	return append(methods, "OPTIONS")
+}
+
+// handleV2 /api/v2以下のリクエストを、パスに対応するv1と共通の操作に振り分ける
+func (s *server) handleV2(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, apiV2Prefix)
+	for _, route := range apiV2Routes() {
+		params, ok := route.match(path)
+		if !ok {
+			continue
+		}
+
+		if handleCORS(w, r, []string{"*"}, route.methods()) {
+			return
+		}
+
+		operationID, ok := route.operations[r.Method]
+		if !ok {
+			writeErrorResponse(w, r, ErrMethodNotAllowed{})
+			return
+		}
+
+		if r.Method == "POST" && len(route.bodyParams) > 0 {
+			bodyParams, err := decodeBodyParams(r, route.bodyParams)
+			if err != nil {
+				writeErrorResponse(w, r, err)
+				return
+			}
+			for name, value := range bodyParams {
+				if _, ok := params[name]; !ok {
+					params[name] = value
+				}
+			}
+		}
+
+		operation := apiOperations()[operationID]
+		operationOf := func(r *http.Request) (apiOperation, bool) { return operation, true }
+		s.withAuth(operationOf, func(w http.ResponseWriter, r *http.Request) {
+			operation.handle(s, w, r)
+		})(w, withRequestParams(r, params))
+		return
+	}
+
+	writeErrorResponse(w, r, ErrRouteNotFound{})
+}
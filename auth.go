@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// RoleReadOnly データの参照とリプレイのみ
+	RoleReadOnly = "read-only"
+	// RoleUploader 共有データセットへの登録(上書き・上位足の再生成を除く)と、自分のprivateデータセットの全ての操作
+	RoleUploader = "uploader"
+	// RoleAdmin 共有データセットの削除・上書き・再生成を含む全ての操作
+	RoleAdmin = "admin"
+
+	// DatasetPublic 全ての利用者で共有するデータセット(既定値)
+	DatasetPublic = "public"
+	// DatasetPrivate 利用者ごとのデータセット(認証が有効な場合のみ)
+	DatasetPrivate = "private"
+)
+
+type (
+	// apiKeyConfig 設定ファイルに記述するAPIキー
+	apiKeyConfig struct {
+		Key  string
+		User string // 利用者名(英小文字・数字で16文字まで)
+		Role string // read-only, uploader, adminのいずれか
+	}
+
+	// authUser 認証済みの利用者
+	authUser struct {
+		name string
+		role string
+	}
+
+	// authUserKey authUserをリクエストのコンテキストに格納する際のキー
+	authUserKey struct{}
+
+	// authenticator APIキー、もしくはHS256で署名したJWTで利用者を認証する
+	authenticator struct {
+		keys      map[[sha256.Size]byte]authUser // APIキーのハッシュ → 利用者
+		jwtSecret []byte
+		jwtIssuer string
+	}
+
+	// jwtClaims JWTのうち認証に使用するクレーム
+	jwtClaims struct {
+		Subject   string `json:"sub"`  // 利用者名
+		Role      string `json:"role"` // read-only, uploader, adminのいずれか
+		Issuer    string `json:"iss"`
+		ExpiresAt *int64 `json:"exp"`
+		NotBefore *int64 `json:"nbf"`
+	}
+)
+
+// roleLevels ロールの強さ(値が大きいロールは小さいロールの操作を全て行える)
+var roleLevels = map[string]int{
+	RoleReadOnly: 1,
+	RoleUploader: 2,
+	RoleAdmin:    3,
+}
+
+// userNamePattern 利用者名の規則(privateデータセットのテーブル名に使用する)
+var userNamePattern = regexp.MustCompile(`^[a-z0-9]{1,16}$`)
+
+// newAuthenticator 設定ファイルのAPIKeys, JWTSecretからauthenticatorを生成する
+// どちらも未指定の場合は認証を行わない
+func newAuthenticator(c *config) (*authenticator, error) {
+	a := &authenticator{
+		keys:      make(map[[sha256.Size]byte]authUser),
+		jwtSecret: []byte(c.JWTSecret),
+		jwtIssuer: c.JWTIssuer,
+	}
+	for _, key := range c.APIKeys {
+		if key.Key == "" || !userNamePattern.MatchString(key.User) {
+			return nil, ErrInvalidAPIKeyConfig{}
+		}
+		if _, ok := roleLevels[key.Role]; !ok {
+			return nil, ErrInvalidAPIKeyConfig{}
+		}
+		a.keys[sha256.Sum256([]byte(key.Key))] = authUser{name: key.User, role: key.Role}
+	}
+	return a, nil
+}
+
+// enabled 認証が有効かを返却する
+func (a *authenticator) enabled() bool {
+	return len(a.keys) > 0 || len(a.jwtSecret) > 0
+}
+
+// authenticate AuthorizationヘッダーのBearerトークン、もしくはx-api-keyヘッダーで利用者を認証する
+// どちらにもAPIキーとJWTのいずれかを指定できる
+// ヘッダーを指定できないWebSocketへの切り替え(websocketがtrue)の場合のみ、クエリ文字列のapiKeyも使用する
+func (a *authenticator) authenticate(r *http.Request, websocket bool) (*authUser, error) {
+	credential := r.Header.Get("x-api-key")
+	if credential == "" && websocket {
+		credential = r.URL.Query().Get(paramQueryName("x-api-key"))
+	}
+	if value := r.Header.Get("Authorization"); strings.HasPrefix(value, "Bearer ") {
+		credential = strings.TrimPrefix(value, "Bearer ")
+	}
+	if credential == "" {
+		return nil, ErrUnauthorized{}
+	}
+
+	if user, ok := a.keys[sha256.Sum256([]byte(credential))]; ok {
+		return &user, nil
+	}
+	if len(a.jwtSecret) > 0 {
+		return a.verifyJWT(credential)
+	}
+	return nil, ErrUnauthorized{}
+}
+
+// verifyJWT HS256で署名したJWTを検証し、クレームの利用者を返却する
+func (a *authenticator) verifyJWT(token string) (*authUser, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrUnauthorized{}
+	}
+
+	var header struct {
+		Algorithm string `json:"alg"`
+	}
+	if decodeJWTPart(parts[0], &header) != nil || header.Algorithm != "HS256" {
+		return nil, ErrUnauthorized{}
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrUnauthorized{}
+	}
+	mac := hmac.New(sha256.New, a.jwtSecret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return nil, ErrUnauthorized{}
+	}
+
+	var claims jwtClaims
+	if decodeJWTPart(parts[1], &claims) != nil {
+		return nil, ErrUnauthorized{}
+	}
+
+	now := time.Now().Unix()
+	if claims.ExpiresAt != nil && *claims.ExpiresAt <= now {
+		return nil, ErrUnauthorized{}
+	}
+	if claims.NotBefore != nil && now < *claims.NotBefore {
+		return nil, ErrUnauthorized{}
+	}
+	if a.jwtIssuer != "" && claims.Issuer != a.jwtIssuer {
+		return nil, ErrUnauthorized{}
+	}
+	if _, ok := roleLevels[claims.Role]; !ok || !userNamePattern.MatchString(claims.Subject) {
+		return nil, ErrUnauthorized{}
+	}
+	return &authUser{name: claims.Subject, role: claims.Role}, nil
+}
+
+// decodeJWTPart JWTのヘッダー・ペイロードを読み込む
+func decodeJWTPart(part string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// authUserOf 認証済みの利用者を返却する(認証が無効な場合はnil)
+func authUserOf(r *http.Request) *authUser {
+	user, _ := r.Context().Value(authUserKey{}).(*authUser)
+	return user
+}
+
+// ownerOf リプレイ・アップロードのセッションの所有者を返却する(認証が無効な場合は空)
+func ownerOf(r *http.Request) string {
+	if user := authUserOf(r); user != nil {
+		return user.name
+	}
+	return ""
+}
+
+// checkDataset データセットを検証する(未指定の場合はpublic)
+func checkDataset(dataset string) (string, error) {
+	dataset = Utils.getStringOrDefault(dataset, DatasetPublic)
+	if dataset != DatasetPublic && dataset != DatasetPrivate {
+		return "", ErrInvalidDataset{}
+	}
+	return dataset, nil
+}
+
+// requiredRole 操作に必要なロールを返却する
+// 既存の行を上書きする登録(x-duplicate-policyがoverwrite)と、上位足を再生成する登録(x-resampleがtrue)は、
+// 削除と同じくadminの操作とする
+// privateデータセットは利用者本人のデータのため、adminの操作もuploaderで行える
+func (operation apiOperation) requiredRole(r *http.Request, dataset string) string {
+	role := operation.role
+	if role != "" && operation.accepts("x-duplicate-policy") &&
+		requestParam(r, "x-duplicate-policy") == DuplicatePolicyOverwrite {
+		role = RoleAdmin
+	}
+	if role != "" && operation.accepts("x-resample") && requestParam(r, "x-resample") == "true" {
+		role = RoleAdmin
+	}
+	if dataset == DatasetPrivate && role == RoleAdmin {
+		return RoleUploader
+	}
+	return role
+}
+
+// withAuth 利用者を認証し、操作に必要なロールを満たす場合のみハンドラーを呼び出す
+// operationOfで操作を特定できないリクエスト(存在しないパス・メソッド)は、そのままハンドラーに渡す
+func (s *server) withAuth(
+	operationOf func(r *http.Request) (apiOperation, bool),
+	next http.HandlerFunc) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		operation, ok := operationOf(r)
+		if r.Method == "OPTIONS" || !ok {
+			next(w, r)
+			return
+		}
+
+		dataset, err := checkDataset(requestParam(r, "x-dataset"))
+		if err != nil {
+			writeErrorResponse(w, r, err)
+			return
+		}
+
+		role := operation.requiredRole(r, dataset)
+		auth := s.settings().auth
+		if !auth.enabled() {
+			if dataset == DatasetPrivate {
+				writeErrorResponse(w, r, ErrPrivateDatasetUnavailable{})
+				return
+			}
+			next(w, r)
+			return
+		}
+		if role == "" {
+			next(w, r)
+			return
+		}
+
+		user, err := auth.authenticate(r, operation.websocket)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeErrorResponse(w, r, err)
+			return
+		}
+		if roleLevels[user.role] < roleLevels[role] {
+			writeErrorResponse(w, r, ErrForbidden{})
+			return
+		}
+
+		next(w, r.WithContext(context.WithValue(r.Context(), authUserKey{}, user)))
+	}
+}
+
+// storeOf リクエストで指定されたデータセットのCandleStoreを返却する
+// データセットはwithAuthで検証済みのため、ここでは検証しない
+func (s *server) storeOf(r *http.Request) CandleStore {
+	user := authUserOf(r)
+	if user != nil && requestParam(r, "x-dataset") == DatasetPrivate {
+		return newDatasetStore(s.store, privateDatasetPrefix(user.name))
+	}
+	return newDatasetStore(s.store, "")
+}
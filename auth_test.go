@@ -0,0 +1,91 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequiredRole(t *testing.T) {
+	operations := apiOperations()
+	tests := []struct {
+		operation string
+		header    map[string]string
+		dataset   string
+		want      string
+	}{
+		{"postCandles", nil, DatasetPublic, RoleUploader},
+		{"postCandles", map[string]string{"x-duplicate-policy": "skip"}, DatasetPublic, RoleUploader},
+		{"postCandles", map[string]string{"x-duplicate-policy": "overwrite"}, DatasetPublic, RoleAdmin},
+		{"postCandles", map[string]string{"x-duplicate-policy": "overwrite"}, DatasetPrivate, RoleUploader},
+		{"createUpload", map[string]string{"x-duplicate-policy": "overwrite"}, DatasetPublic, RoleAdmin},
+		{"deleteCandles", nil, DatasetPublic, RoleAdmin},
+		{"deleteCandles", nil, DatasetPrivate, RoleUploader},
+		{"resample", nil, DatasetPublic, RoleAdmin},
+		{"resample", nil, DatasetPrivate, RoleUploader},
+		{"postCandles", map[string]string{"x-resample": "true"}, DatasetPublic, RoleAdmin},
+		{"postCandles", map[string]string{"x-resample": "true"}, DatasetPrivate, RoleUploader},
+		{"postCandles", map[string]string{"x-resample": "false"}, DatasetPublic, RoleUploader},
+		{"importFile", map[string]string{"x-resample": "true"}, DatasetPublic, RoleAdmin},
+		{"importFile", map[string]string{"x-resample": "true"}, DatasetPrivate, RoleUploader},
+		{"createUpload", map[string]string{"x-resample": "true"}, DatasetPublic, RoleAdmin},
+		{"getCandles", map[string]string{"x-duplicate-policy": "overwrite"}, DatasetPublic, RoleReadOnly},
+	}
+
+	for _, test := range tests {
+		operation, ok := operations[test.operation]
+		if !ok {
+			t.Fatalf("operation %s is not defined", test.operation)
+		}
+		r := httptest.NewRequest("POST", "/api/data", nil)
+		for name, value := range test.header {
+			r.Header.Set(name, value)
+		}
+		got := operation.requiredRole(r, test.dataset)
+		if got != test.want {
+			t.Errorf("%s %v (%s): requiredRole = %s, want %s", test.operation, test.header, test.dataset, got, test.want)
+		}
+	}
+
+	// v2はクエリ文字列の入力パラメータでも判定する
+	r := withRequestParams(httptest.NewRequest("POST", "/api/v2/pairs/EURUSD/timeframes/M1/candles?resample=true", nil), requestParams{})
+	if got := operations["postCandles"].requiredRole(r, DatasetPublic); got != RoleAdmin {
+		t.Errorf("postCandles with v2 query resample=true: requiredRole = %s, want %s", got, RoleAdmin)
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	auth, err := newAuthenticator(&config{APIKeys: []apiKeyConfig{{Key: "secret", User: "alice", Role: RoleUploader}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		target    string
+		header    map[string]string
+		websocket bool
+		wantErr   error
+	}{
+		{"bearer", "/api/data", map[string]string{"Authorization": "Bearer secret"}, false, nil},
+		{"header", "/api/data", map[string]string{"x-api-key": "secret"}, false, nil},
+		{"query", "/api/data?apiKey=secret", nil, false, ErrUnauthorized{}},
+		{"query on websocket", "/api/replay/stream?apiKey=secret", nil, true, nil},
+		{"wrong key", "/api/data", map[string]string{"x-api-key": "wrong"}, false, ErrUnauthorized{}},
+		{"no credential", "/api/data", nil, true, ErrUnauthorized{}},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", test.target, nil)
+		for name, value := range test.header {
+			r.Header.Set(name, value)
+		}
+		user, err := auth.authenticate(r, test.websocket)
+		if err != test.wantErr {
+			t.Errorf("%s: authenticate returned %v, want %v", test.name, err, test.wantErr)
+			continue
+		}
+		if err == nil && user.name != "alice" {
+			t.Errorf("%s: authenticated as %s, want alice", test.name, user.name)
+		}
+	}
+}
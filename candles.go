@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	SortOrderAsc  = "asc"
+	SortOrderDesc = "desc"
+
+	// defaultCandlePageSize, maxCandlePageSize 範囲取得で1度に返却する本数の既定値・上限
+	defaultCandlePageSize = 1000
+	maxCandlePageSize     = 10000
+)
+
+type (
+	ApiResponseGetCandles struct {
+		Status     ApiResponseStatus `json:"status"`
+		Candles    []Candle          `json:"candles"`
+		NextCursor string            `json:"nextCursor,omitempty"` // 続きがない場合は省略する
+	}
+
+	// candleCursor 次のページの先頭のローソク足の位置
+	candleCursor struct {
+		order   string
+		fixTime string
+	}
+)
+
+// checkSortOrder 並び順を検証する(未指定の場合は昇順)
+func checkSortOrder(order string) (string, error) {
+	order = Utils.getStringOrDefault(order, SortOrderAsc)
+	if order != SortOrderAsc && order != SortOrderDesc {
+		return "", ErrInvalidSortOrder{}
+	}
+	return order, nil
+}
+
+// checkPageSize 1度に返却する本数を検証する(未指定の場合はdefaultCandlePageSize)
+func checkPageSize(limit string) (int, error) {
+	if limit == "" {
+		return defaultCandlePageSize, nil
+	}
+	size, err := strconv.Atoi(limit)
+	if err != nil || size < 1 || maxCandlePageSize < size {
+		return 0, ErrInvalidPageSize{}
+	}
+	return size, nil
+}
+
+// encode カーソルを不透明な文字列に変換する
+func (c candleCursor) encode() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(c.order + "," + c.fixTime))
+}
+
+// parseCandleCursor カーソルの文字列を解析する(並び順がリクエストと異なる場合はエラー)
+func parseCandleCursor(value string, order string) (candleCursor, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return candleCursor{}, ErrInvalidCursor{}
+	}
+
+	cursorOrder, fixTime, ok := strings.Cut(string(decoded), ",")
+	if !ok || cursorOrder != order || Utils.checkFixedTime(fixTime) != nil {
+		return candleCursor{}, ErrInvalidCursor{}
+	}
+	return candleCursor{order: cursorOrder, fixTime: fixTime}, nil
+}
+
+// queryCandlePage 期間(両端を含む)のローソク足を指定の並び順で最大limit件取得し、続きがある場合は次のページのカーソルを返却する
+func (action) queryCandlePage(
+	store CandleStore,
+	pairName string,
+	timeType TimeType,
+	from string,
+	to string,
+	order string,
+	limit int) ([]Candle, string, error) {
+
+	// 1件多く取得し、続きの有無と次のページの先頭を判定する
+	candles, err := store.queryCandleRange(pairName, timeType, from, to, order == SortOrderDesc, limit+1)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(candles) <= limit {
+		return candles, "", nil
+	}
+
+	next := candleCursor{order: order, fixTime: candles[limit].Time}
+	return candles[:limit], next.encode(), nil
+}
+
+// handleCandles 1つの時間軸の期間内のローソク足を返却する(リプレイとは異なり、上位足の組み立ては行わない)
+// x-orderヘッダーで並び順(asc, desc)、x-limitヘッダーで1度に返却する本数を指定する
+// 続きがある場合はnextCursorを返却するため、x-cursorヘッダーに指定して次のページを取得する
+func (s *server) handleCandles(w http.ResponseWriter, r *http.Request) {
+	supportedParams := []string{"*"}
+	supportedMethods := []string{
+		"GET",
+		"OPTIONS",
+	}
+	if handleCORS(w, r, supportedParams, supportedMethods) {
+		return
+	}
+
+	writeResponse := func(err error, candles []Candle, nextCursor string) {
+		status := newApiResponseStatus(r, err)
+		writeApiResponse(w, r, err, ApiResponseGetCandles{Status: status, Candles: candles, NextCursor: nextCursor})
+	}
+
+	pairName := requestParam(r, "x-pair-name")
+	err := Utils.checkPairName(pairName)
+	if err != nil {
+		writeResponse(err, []Candle{}, "")
+		return
+	}
+
+	timeTypeName := requestParam(r, "x-time-type")
+	timeType, err := Utils.getTimeType(timeTypeName)
+	if err != nil {
+		writeResponse(err, []Candle{}, "")
+		return
+	}
+
+	order, err := checkSortOrder(requestParam(r, "x-order"))
+	if err != nil {
+		writeResponse(err, []Candle{}, "")
+		return
+	}
+
+	limit, err := checkPageSize(requestParam(r, "x-limit"))
+	if err != nil {
+		writeResponse(err, []Candle{}, "")
+		return
+	}
+
+	// 期間の指定は任意(未指定の場合は全期間を対象とする)
+	from, to := requestParam(r, "x-from"), requestParam(r, "x-to")
+	for _, fixTime := range []string{from, to} {
+		if fixTime == "" {
+			continue
+		}
+		err = Utils.checkFixedTime(fixTime)
+		if err != nil {
+			writeResponse(err, []Candle{}, "")
+			return
+		}
+	}
+	from = Utils.getStringOrDefault(from, minFixTime)
+	to = Utils.getStringOrDefault(to, maxFixTime)
+
+	if value := requestParam(r, "x-cursor"); value != "" {
+		cursor, err := parseCandleCursor(value, order)
+		if err != nil {
+			writeResponse(err, []Candle{}, "")
+			return
+		}
+
+		// 昇順では期間の開始を、降順では期間の終了をカーソルの位置まで狭める
+		if order == SortOrderAsc && cursor.fixTime > from {
+			from = cursor.fixTime
+		}
+		if order == SortOrderDesc && cursor.fixTime < to {
+			to = cursor.fixTime
+		}
+	}
+
+	candles, nextCursor, err := Action.queryCandlePage(s.storeOf(r), pairName, timeType, from, to, order, limit)
+	if err != nil {
+		writeResponse(err, []Candle{}, "")
+		return
+	}
+
+	writeResponse(nil, candles, nextCursor)
+}
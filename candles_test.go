@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// getTestCandles handleCandlesにヘッダーを指定してリクエストし、レスポンスを返却する
+func getTestCandles(t *testing.T, s *server, header map[string]string) ApiResponseGetCandles {
+	t.Helper()
+	r := httptest.NewRequest("GET", "/api/candles", nil)
+	r.Header.Set("x-pair-name", "EURUSD")
+	r.Header.Set("x-time-type", "M1")
+	for name, value := range header {
+		r.Header.Set(name, value)
+	}
+	recorder := httptest.NewRecorder()
+	s.handleCandles(recorder, r)
+
+	var response ApiResponseGetCandles
+	err := json.NewDecoder(recorder.Body).Decode(&response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return response
+}
+
+// newTestCandlesServer 1分足5本(00:00〜00:04)を登録したメモリのストレージを使用するserverを返却する
+func newTestCandlesServer(t *testing.T) *server {
+	t.Helper()
+	store := newMemoryStore()
+	err := store.createDataTable("EURUSD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = store.registerData("EURUSD", M1, newTestCandles(time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC), 5), DuplicatePolicySkip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &server{store: store}
+}
+
+func TestHandleCandlesPages(t *testing.T) {
+	tests := []struct {
+		name   string
+		header map[string]string
+		want   [][]string // ページごとのローソク足の確定時刻(分)
+	}{
+		{"asc", map[string]string{"x-limit": "2"}, [][]string{{"00", "01"}, {"02", "03"}, {"04"}}},
+		{"desc", map[string]string{"x-limit": "2", "x-order": "desc"}, [][]string{{"04", "03"}, {"02", "01"}, {"00"}}},
+		{"last page is full", map[string]string{"x-limit": "5"}, [][]string{{"00", "01", "02", "03", "04"}}},
+		{"period", map[string]string{"x-limit": "2", "x-from": "2023-01-02 00:01:00", "x-to": "2023-01-02 00:03:00"},
+			[][]string{{"01", "02"}, {"03"}}},
+		{"period desc", map[string]string{"x-limit": "2", "x-order": "desc", "x-to": "2023-01-02 00:02:00"},
+			[][]string{{"02", "01"}, {"00"}}},
+	}
+
+	s := newTestCandlesServer(t)
+	for _, test := range tests {
+		header := make(map[string]string)
+		for name, value := range test.header {
+			header[name] = value
+		}
+
+		pages := make([][]string, 0)
+		for len(pages) <= len(test.want) {
+			response := getTestCandles(t, s, header)
+			if response.Status.ErrorCode != 0 {
+				t.Fatalf("%s: returned %+v", test.name, response.Status)
+			}
+			page := make([]string, 0, len(response.Candles))
+			for _, c := range response.Candles {
+				page = append(page, c.Time[len("2023-01-02 00:"):len("2023-01-02 00:04")])
+			}
+			pages = append(pages, page)
+
+			// 最後のページはカーソルを返却しない
+			if response.NextCursor == "" {
+				break
+			}
+			header["x-cursor"] = response.NextCursor
+		}
+
+		if len(pages) != len(test.want) {
+			t.Errorf("%s: pages %v, want %v", test.name, pages, test.want)
+			continue
+		}
+		for i := range pages {
+			if len(pages[i]) != len(test.want[i]) {
+				t.Errorf("%s: pages %v, want %v", test.name, pages, test.want)
+				break
+			}
+			for j := range pages[i] {
+				if pages[i][j] != test.want[i][j] {
+					t.Errorf("%s: pages %v, want %v", test.name, pages, test.want)
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestHandleCandlesCursorIsStable(t *testing.T) {
+	s := newTestCandlesServer(t)
+	first := getTestCandles(t, s, map[string]string{"x-limit": "2"})
+	if again := getTestCandles(t, s, map[string]string{"x-limit": "2"}); again.NextCursor != first.NextCursor {
+		t.Errorf("next cursor changed from %s to %s", first.NextCursor, again.NextCursor)
+	}
+
+	// 取得済みの範囲にローソク足が追加されても、次のページは前のページの続きから始まる
+	_, err := s.store.registerData("EURUSD", M1, []Candle{{Time: "2023-01-01 23:59:00", Open: 1, High: 1, Low: 1, Close: 1}},
+		DuplicatePolicySkip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := getTestCandles(t, s, map[string]string{"x-limit": "2", "x-cursor": first.NextCursor})
+	if len(next.Candles) != 2 || next.Candles[0].Time != "2023-01-02 00:02:00" {
+		t.Errorf("next page %+v, want to start at 2023-01-02 00:02:00", next.Candles)
+	}
+}
+
+func TestHandleCandlesInvalidCursor(t *testing.T) {
+	s := newTestCandlesServer(t)
+	ascCursor := candleCursor{order: SortOrderAsc, fixTime: "2023-01-02 00:02:00"}.encode()
+	spec, _ := lookupError(ErrInvalidCursor{})
+
+	tests := []struct {
+		name   string
+		header map[string]string
+	}{
+		{"not base64", map[string]string{"x-cursor": "!!!"}},
+		{"no order", map[string]string{"x-cursor": base64.RawURLEncoding.EncodeToString([]byte("2023-01-02 00:02:00"))}},
+		{"invalid time", map[string]string{"x-cursor": candleCursor{order: SortOrderAsc, fixTime: "2023-01-02"}.encode()}},
+		{"different order", map[string]string{"x-cursor": ascCursor, "x-order": SortOrderDesc}},
+	}
+
+	for _, test := range tests {
+		response := getTestCandles(t, s, test.header)
+		if response.Status.ErrorCode != spec.code || len(response.Candles) != 0 || response.NextCursor != "" {
+			t.Errorf("%s: returned %+v, want %s", test.name, response, spec.name)
+		}
+	}
+}
@@ -0,0 +1,602 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type (
+	// cliCommand コマンドラインのサブコマンド
+	cliCommand struct {
+		name    string
+		args    string // フラグ以外の引数の説明
+		summary string
+		run     func(args []string) error
+	}
+
+	// commandOptions データを操作するサブコマンドに共通するフラグ
+	commandOptions struct {
+		loader *configLoader
+		user   string
+	}
+)
+
+// cliCommands サブコマンドの一覧(サブコマンドを指定しない場合はserveを実行する)
+// データを操作するサブコマンドは、APIと同じ処理で実行し、APIのレスポンスと同じJSONを標準出力に書き出す
+func cliCommands() []cliCommand {
+	return []cliCommand{
+		{name: "serve", summary: "HTTPサーバーを起動する", run: runServe},
+		{name: "import", args: "<file>...", summary: "MT4/MT5から出力したCSV・.hstファイルを登録する", run: runImport},
+		{name: "export", summary: "ローソク足をCSV・NDJSON・MT4互換CSVで出力する", run: runExport},
+		{name: "resample", summary: "下位足から上位足を再生成する", run: runResample},
+		{name: "migrate", summary: "データテーブルのスキーマを移行する", run: runMigrate},
+		{name: "list-pairs", summary: "登録されている通貨ペアと、時間軸ごとの本数を出力する", run: runListPairs},
+		{name: "delete", summary: "通貨ペアの指定した時間軸のデータを削除する", run: runDelete},
+		{name: "verify", summary: "登録されているデータの欠損を検査する(欠損がある場合は終了コード1)", run: runVerify},
+		{name: "openapi", summary: "OpenAPIドキュメントとクライアントを生成する", run: runOpenAPI},
+	}
+}
+
+// findCommand コマンドライン引数からサブコマンドと、その引数を返却する
+// 引数がない、もしくはフラグから始まる場合はserveとみなす
+func findCommand(args []string) (*cliCommand, []string) {
+	commands := cliCommands()
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return &commands[0], args
+	}
+	for i := range commands {
+		if commands[i].name == args[0] {
+			return &commands[i], args[1:]
+		}
+	}
+	return nil, args
+}
+
+// printCommands サブコマンドの一覧を標準エラー出力に書き出す
+func printCommands() {
+	name := filepath.Base(os.Args[0])
+	fmt.Fprintf(os.Stderr, "Usage: %s <command> [flags] [args]\n\nCommands:\n", name)
+	for _, command := range cliCommands() {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", command.name, command.summary)
+	}
+	fmt.Fprintf(os.Stderr, "\n各コマンドのフラグは %s <command> -h で確認できます\n", name)
+}
+
+// newCommandFlags サブコマンドのフラグセットを生成し、設定の読み込みに使用するフラグを登録する
+func newCommandFlags(name string, args string) (*flag.FlagSet, *commandOptions) {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s %s [flags] %s\n", filepath.Base(os.Args[0]), name, args)
+		flags.PrintDefaults()
+	}
+	options := &commandOptions{loader: newConfigLoader(flags)}
+	flags.StringVar(&options.user, "user", "", "操作するprivateデータセットの利用者名(未指定の場合は共有データセット)")
+	return flags, options
+}
+
+// openStore 設定を読み込み、ストレージを開いて-userで指定されたデータセットを返却する
+// 開いたストレージは、返却したclose関数で閉じる
+func (options *commandOptions) openStore() (*config, CandleStore, func(), error) {
+	config, err := options.loader.load()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	setLogLanguage(config.Language)
+
+	prefix := ""
+	if options.user != "" {
+		if !userNamePattern.MatchString(options.user) {
+			return nil, nil, nil, ErrInvalidCommand{}
+		}
+		prefix = privateDatasetPrefix(options.user)
+	}
+
+	store, err := newCandleStore(config)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	err = store.open()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return config, newDatasetStore(store, prefix), func() { store.close() }, nil
+}
+
+// writeCommandResult 処理結果をAPIのレスポンスと同じJSONで標準出力に書き出す(1件につき1行)
+func writeCommandResult(response interface{}) {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(response)
+}
+
+// commandStatus 処理結果のステータスをログの言語で生成する
+// APIと異なり操作しているのは管理者のため、登録されていないエラーも元のメッセージを出力する
+func commandStatus(err error) ApiResponseStatus {
+	status := newLocalizedStatus(err, getLogLanguage())
+	if err != nil {
+		status.ErrorMessage = errorLogMessage(err)
+	}
+	return status
+}
+
+// checkPeriod 期間の指定を検証する(未指定の場合は全期間)
+func checkPeriod(from string, to string) (string, string, error) {
+	for _, fixTime := range []string{from, to} {
+		if fixTime == "" {
+			continue
+		}
+		err := Utils.checkFixedTime(fixTime)
+		if err != nil {
+			return "", "", err
+		}
+	}
+	return Utils.getStringOrDefault(from, minFixTime), Utils.getStringOrDefault(to, maxFixTime), nil
+}
+
+// checkTimeTypes カンマ区切りの時間軸を検証する
+func checkTimeTypes(timeTypeNames string) ([]TimeType, error) {
+	timeTypes := make([]TimeType, 0)
+	for _, timeTypeName := range strings.Split(timeTypeNames, ",") {
+		if timeTypeName = strings.TrimSpace(timeTypeName); timeTypeName == "" {
+			continue
+		}
+		timeType, err := Utils.getTimeType(timeTypeName)
+		if err != nil {
+			return nil, err
+		}
+		timeTypes = append(timeTypes, timeType)
+	}
+	if len(timeTypes) <= 0 {
+		return nil, ErrInvalidTimeType{}
+	}
+	return timeTypes, nil
+}
+
+// runImport MT4/MT5から出力したCSV・.hstファイルを登録する(POST /api/importと同じ処理)
+// 通貨ペア・時間軸は-pair, -time-type、.hstファイルのヘッダー、ファイル名の順に決定する
+func runImport(args []string) error {
+	flags, options := newCommandFlags("import", "<file>...")
+	pairName := flags.String("pair", "", "通貨ペア名(未指定の場合はファイルから判別する)")
+	timeTypeName := flags.String("time-type", "", "時間軸(M1, M5, M15, M30, H1, H4, Daily, Weekly。未指定の場合はファイルから判別する)")
+	format := flags.String("format", "", "ファイルの形式(csv, hst。未指定の場合は拡張子から判別する)")
+	profileName := flags.String("timezone-profile", "", "サーバー時間のタイムゾーンプロファイル(未指定の場合はDefaultTimezoneProfile)")
+	policyName := flags.String("duplicate-policy", "", "既に存在する確定時刻の扱い(skip, overwrite, fail, report-diff)")
+	validationMode := flags.String("validation", "", "検証モード(strict, lenient)")
+	spikeThreshold := flags.String("spike-threshold", "", "スパイクとみなす変動率")
+	resample := flags.Bool("resample", false, "登録した時間軸より上位の時間軸を再生成する")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return ErrInvalidCommand{}
+	}
+
+	config, store, closeStore, err := options.openStore()
+	if err != nil {
+		return err
+	}
+	defer closeStore()
+
+	timezones, err := newTimezoneRegistry(config)
+	if err != nil {
+		return err
+	}
+	profile, err := timezones.resolve(*profileName)
+	if err != nil {
+		return err
+	}
+	policy, err := checkDuplicatePolicy(*policyName)
+	if err != nil {
+		return err
+	}
+	validation, err := checkValidationOptions(*validationMode, *spikeThreshold)
+	if err != nil {
+		return err
+	}
+	postOptions := postDataOptions{profile: profile, resample: *resample, policy: policy, validation: validation}
+
+	failed := make([]error, 0)
+	for _, path := range flags.Args() {
+		file, result, err := importFile(store, path, *format, *pairName, *timeTypeName, postOptions)
+		writeCommandResult(ApiResponsePostImport{
+			Status:     commandStatus(err),
+			PairName:   file.pairName,
+			TimeType:   file.timeType.toInt(),
+			CountData:  result.count,
+			Validation: result.validation.orNil(),
+			Resampled:  result.resampled,
+		})
+		if err != nil {
+			failed = append(failed, err)
+		}
+	}
+
+	switch len(failed) {
+	case 0:
+		return nil
+	case 1:
+		return failed[0]
+	}
+	return newErrMultipleCause(failed...)
+}
+
+// importFile ファイルを読み込み、通貨ペア・時間軸を決定して登録する
+func importFile(
+	store CandleStore,
+	path string,
+	format string,
+	pairName string,
+	timeTypeName string,
+	options postDataOptions) (importedFile, postDataResult, error) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return importedFile{timeType: Unknown}, postDataResult{}, err
+	}
+	defer f.Close()
+
+	file, reader, report, err := Action.openImportFile(f, Utils.getStringOrDefault(format, getImportFormat(path)),
+		filepath.Base(path), pairName, timeTypeName, options.validation)
+	if err != nil {
+		return file, postDataResult{validation: report}, err
+	}
+
+	result, err := Action.postDataStream(store, file.pairName, file.timeType, reader, options, nil)
+	return file, result, err
+}
+
+// runExport 指定期間の全てのローソク足を出力する(GET /api/exportと同じ処理)
+// -outputを指定しない場合は標準出力に書き出す
+func runExport(args []string) error {
+	flags, options := newCommandFlags("export", "")
+	pairName := flags.String("pair", "", "通貨ペア名")
+	timeTypeName := flags.String("time-type", "", "時間軸(M1, M5, M15, M30, H1, H4, Daily, Weekly)")
+	formatName := flags.String("format", "", "出力形式(csv, ndjson, mt。未指定の場合はcsv)")
+	profileName := flags.String("timezone-profile", "", "mt形式で出力する際のタイムゾーンプロファイル(未指定の場合はDefaultTimezoneProfile)")
+	from := flags.String("from", "", "出力する期間の開始(確定時刻のyyyy-MM-dd HH:mm:ss)")
+	to := flags.String("to", "", "出力する期間の終了(確定時刻のyyyy-MM-dd HH:mm:ss)")
+	output := flags.String("output", "", "出力先のファイル(未指定の場合は標準出力)")
+	compress := flags.Bool("gzip", false, "gzipで圧縮して出力する")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	err = Utils.checkPairName(*pairName)
+	if err != nil {
+		return err
+	}
+	timeType, err := Utils.getTimeType(*timeTypeName)
+	if err != nil {
+		return err
+	}
+	format, err := checkExportFormat(*formatName)
+	if err != nil {
+		return err
+	}
+	fromTime, toTime, err := checkPeriod(*from, *to)
+	if err != nil {
+		return err
+	}
+
+	config, store, closeStore, err := options.openStore()
+	if err != nil {
+		return err
+	}
+	defer closeStore()
+
+	timezones, err := newTimezoneRegistry(config)
+	if err != nil {
+		return err
+	}
+	profile, err := timezones.resolve(*profileName)
+	if err != nil {
+		return err
+	}
+
+	w := os.Stdout
+	if *output != "" {
+		w, err = os.Create(*output)
+		if err != nil {
+			return err
+		}
+	}
+
+	exporter := &candleExporter{w: w, format: format, compress: *compress, profile: profile}
+	err = store.eachCandle(*pairName, timeType, fromTime, toTime, exporter.write)
+	if err == nil {
+		err = exporter.finish()
+	}
+
+	// 書き込みの失敗はファイルを閉じるまで判明しない場合があるため、閉じた結果も返却する
+	if w != os.Stdout {
+		closeErr := w.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// runResample 下位足のデータから指定期間の上位足を再生成する(POST /api/resampleと同じ処理)
+func runResample(args []string) error {
+	flags, options := newCommandFlags("resample", "")
+	pairName := flags.String("pair", "", "通貨ペア名")
+	timeTypeName := flags.String("time-type", "", "再生成に使用する下位足の時間軸(M1, M5, M15, M30, H1, H4, Daily)")
+	profileName := flags.String("timezone-profile", "", "タイムゾーンプロファイル(未指定の場合はDefaultTimezoneProfile)")
+	from := flags.String("from", "", "再生成する期間の開始(確定時刻のyyyy-MM-dd HH:mm:ss)")
+	to := flags.String("to", "", "再生成する期間の終了(確定時刻のyyyy-MM-dd HH:mm:ss)")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	err = Utils.checkPairName(*pairName)
+	if err != nil {
+		return err
+	}
+	timeType, err := Utils.getTimeType(*timeTypeName)
+	if err != nil {
+		return err
+	}
+	fromTime, toTime, err := checkPeriod(*from, *to)
+	if err != nil {
+		return err
+	}
+
+	config, store, closeStore, err := options.openStore()
+	if err != nil {
+		return err
+	}
+	defer closeStore()
+
+	timezones, err := newTimezoneRegistry(config)
+	if err != nil {
+		return err
+	}
+	profile, err := timezones.resolve(*profileName)
+	if err != nil {
+		return err
+	}
+
+	resampled, err := Action.resampleData(store, *pairName, timeType, fromTime, toTime, profile)
+	if err != nil {
+		return err
+	}
+	writeCommandResult(ApiResponsePostResample{Status: commandStatus(nil), Resampled: resampled})
+	return nil
+}
+
+// runMigrate 全てのデータテーブルのスキーマを指定したバージョンへ移行する
+// 最新より前のバージョンへ戻したデータテーブルは、再び-toに最新バージョンを指定するまで起動時に自動更新しない
+// バージョン0はデータテーブルを削除するため、-forceの指定を必須とする
+func runMigrate(args []string) error {
+	flags, options := newCommandFlags("migrate", "")
+	targetVersion := flags.Int("to", latestSchemaVersion(),
+		"移行先のスキーマバージョン(最新より前へ戻すのは、旧バージョンのバイナリへ戻す直前のみ)")
+	force := flags.Bool("force", false, "-to 0(全てのデータテーブルの削除)を実行する")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	// 全てのデータテーブルが対象のため、データセットは指定できない
+	if options.user != "" {
+		return ErrInvalidCommand{}
+	}
+	if *targetVersion == 0 && !*force {
+		return ErrDropSchemaNotConfirmed{}
+	}
+
+	config, err := options.loader.load()
+	if err != nil {
+		return err
+	}
+	setLogLanguage(config.Language)
+
+	store, err := newCandleStore(config)
+	if err != nil {
+		return err
+	}
+
+	m, ok := store.(schemaMigratable)
+	if !ok {
+		return ErrMigrationNotSupported{}
+	}
+
+	// open時に最新バージョンまで移行されるため、ダウングレードはその後に行う
+	err = store.open()
+	if err != nil {
+		return err
+	}
+	defer store.close()
+
+	log.Println(logMessage(logMigrateSchema, *targetVersion))
+	err = m.migrateTo(*targetVersion)
+	if err != nil {
+		return err
+	}
+
+	log.Println(logMessage(logMigrateSchemaDone))
+	return nil
+}
+
+// runListPairs 登録されている通貨ペアごとに、時間軸ごとの本数を出力する
+func runListPairs(args []string) error {
+	flags, options := newCommandFlags("list-pairs", "")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	_, store, closeStore, err := options.openStore()
+	if err != nil {
+		return err
+	}
+	defer closeStore()
+
+	pairNames, err := store.getUploadedPairNames()
+	if err != nil {
+		return err
+	}
+	for _, pairName := range pairNames {
+		details, err := pairDetailsOf(store, pairName)
+		if err != nil {
+			return err
+		}
+		writeCommandResult(struct {
+			PairName    string       `json:"pairName"`
+			PairDetails []PairDetail `json:"pairDetails"`
+		}{pairName, details})
+	}
+	return nil
+}
+
+// pairDetailsOf 通貨ペアの時間軸ごとの本数を、時間軸の昇順で返却する
+func pairDetailsOf(store CandleStore, pairName string) ([]PairDetail, error) {
+	countTable, err := store.getUploadedPairDetail(pairName)
+	if err != nil {
+		return nil, err
+	}
+	details := make([]PairDetail, 0, len(countTable))
+	for timeType, countData := range countTable {
+		details = append(details, PairDetail{TimeType: timeType, CountData: countData})
+	}
+	sort.Slice(details, func(i, j int) bool { return details[i].TimeType < details[j].TimeType })
+	return details, nil
+}
+
+// runDelete 通貨ペアの指定した時間軸のデータを削除する(DELETE /api/dataと同じ処理)
+// -from, -toを指定した場合は、その期間のみを削除する
+func runDelete(args []string) error {
+	flags, options := newCommandFlags("delete", "")
+	pairName := flags.String("pair", "", "通貨ペア名")
+	timeTypeNames := flags.String("time-types", "", "削除する時間軸(カンマ区切り)")
+	from := flags.String("from", "", "削除する期間の開始(確定時刻のyyyy-MM-dd HH:mm:ss)")
+	to := flags.String("to", "", "削除する期間の終了(確定時刻のyyyy-MM-dd HH:mm:ss)")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	err = Utils.checkPairName(*pairName)
+	if err != nil {
+		return err
+	}
+	timeTypes, err := checkTimeTypes(*timeTypeNames)
+	if err != nil {
+		return err
+	}
+	fromTime, toTime, err := checkPeriod(*from, *to)
+	if err != nil {
+		return err
+	}
+
+	_, store, closeStore, err := options.openStore()
+	if err != nil {
+		return err
+	}
+	defer closeStore()
+
+	if *from == "" && *to == "" {
+		err = store.deleteData(*pairName, timeTypes)
+	} else {
+		for _, timeType := range timeTypes {
+			err = store.deleteDataRange(*pairName, timeType, fromTime, toTime)
+			if err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+	writeCommandResult(ApiResponseDeleteData{Status: commandStatus(nil)})
+	return nil
+}
+
+// runVerify 登録されているデータの網羅状況を時間軸ごとに出力する(GET /api/coverageと同じ処理)
+// 欠損、もしくは休場期間中・時間軸の区切りと一致しない足がある場合はErrIncompleteDataを返却する
+func runVerify(args []string) error {
+	flags, options := newCommandFlags("verify", "")
+	pairName := flags.String("pair", "", "通貨ペア名")
+	timeTypeNames := flags.String("time-types", "", "検査する時間軸(カンマ区切り。未指定の場合は登録されている全ての時間軸)")
+	profileName := flags.String("timezone-profile", "", "タイムゾーンプロファイル(未指定の場合はDefaultTimezoneProfile)")
+	holidayDates := flags.String("holidays", "", "MarketHolidaysに加える休場日(yyyy-MM-ddのカンマ区切り)")
+	from := flags.String("from", "", "検査する期間の開始(確定時刻のyyyy-MM-dd HH:mm:ss)")
+	to := flags.String("to", "", "検査する期間の終了(確定時刻のyyyy-MM-dd HH:mm:ss)")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	err = Utils.checkPairName(*pairName)
+	if err != nil {
+		return err
+	}
+	fromTime, toTime, err := checkPeriod(*from, *to)
+	if err != nil {
+		return err
+	}
+
+	config, store, closeStore, err := options.openStore()
+	if err != nil {
+		return err
+	}
+	defer closeStore()
+
+	timezones, err := newTimezoneRegistry(config)
+	if err != nil {
+		return err
+	}
+	profile, err := timezones.resolve(*profileName)
+	if err != nil {
+		return err
+	}
+	holidays, err := newMarketHolidays(config.MarketHolidays)
+	if err != nil {
+		return err
+	}
+	holidays, err = holidays.with(strings.Split(*holidayDates, ","))
+	if err != nil {
+		return err
+	}
+
+	timeTypes := make([]TimeType, 0)
+	if *timeTypeNames != "" {
+		timeTypes, err = checkTimeTypes(*timeTypeNames)
+		if err != nil {
+			return err
+		}
+	} else {
+		details, err := pairDetailsOf(store, *pairName)
+		if err != nil {
+			return err
+		}
+		for _, detail := range details {
+			timeTypes = append(timeTypes, TimeType(detail.TimeType))
+		}
+	}
+
+	incomplete := false
+	for _, timeType := range timeTypes {
+		coverage, err := Action.analyzeCoverage(store, *pairName, timeType, fromTime, toTime, profile, holidays)
+		if err != nil {
+			return err
+		}
+		incomplete = incomplete || coverage.Missing > 0 || coverage.Unexpected > 0
+		writeCommandResult(ApiResponseGetCoverage{Status: commandStatus(nil), Coverage: coverage})
+	}
+	if incomplete {
+		return ErrIncompleteData{}
+	}
+	return nil
+}
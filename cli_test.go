@@ -0,0 +1,148 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestCommandDB 1分足を登録したSQLiteのデータベースを作成し、サブコマンドに渡すストレージのフラグを返却する
+func newTestCommandDB(t *testing.T, candles []Candle) []string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "cli.db")
+	db := newSQLiteDB(&config{SQLitePath: path})
+	err := db.open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.close()
+
+	err = db.createDataTable("EURUSD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(candles) > 0 {
+		_, err = db.registerData("EURUSD", M1, candles, DuplicatePolicySkip)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return []string{"-store-type", StoreTypeSQLite, "-sqlite-path", path}
+}
+
+func TestFindCommand(t *testing.T) {
+	tests := []struct {
+		args     []string
+		wantName string
+		wantArgs []string
+	}{
+		{nil, "serve", nil},
+		{[]string{"-port", "8081"}, "serve", []string{"-port", "8081"}},
+		{[]string{"export", "-pair", "EURUSD"}, "export", []string{"-pair", "EURUSD"}},
+		{[]string{"migrate"}, "migrate", []string{}},
+		{[]string{"unknown"}, "", []string{"unknown"}},
+	}
+
+	for _, test := range tests {
+		command, args := findCommand(test.args)
+		name := ""
+		if command != nil {
+			name = command.name
+		}
+		if name != test.wantName || strings.Join(args, " ") != strings.Join(test.wantArgs, " ") {
+			t.Errorf("findCommand(%v) = %s %v, want %s %v", test.args, name, args, test.wantName, test.wantArgs)
+		}
+	}
+}
+
+func TestRunExport(t *testing.T) {
+	storeFlags := newTestCommandDB(t, newTestCandles(time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC), 5))
+	dir := t.TempDir()
+
+	tests := []struct {
+		name      string
+		args      []string
+		wantErr   error
+		wantLines int // 出力したファイルの行数
+	}{
+		{"ndjson", []string{"-format", "ndjson"}, nil, 5},
+		{"period", []string{"-format", "ndjson", "-from", "2023-01-02 00:01:00", "-to", "2023-01-02 00:02:00"}, nil, 2},
+		{"invalid format", []string{"-format", "xml"}, ErrInvalidExportFormat{}, -1},
+		{"invalid period", []string{"-from", "2023-01-02"}, ErrInvalidFixTime{}, -1},
+	}
+
+	for _, test := range tests {
+		output := filepath.Join(dir, test.name+".out")
+		args := append(append([]string{"-pair", "EURUSD", "-time-type", "M1", "-output", output}, storeFlags...), test.args...)
+		err := runExport(args)
+		if err != test.wantErr {
+			t.Errorf("%s: runExport returned %v, want %v", test.name, err, test.wantErr)
+			continue
+		}
+
+		data, readErr := os.ReadFile(output)
+		if test.wantLines < 0 {
+			if !os.IsNotExist(readErr) {
+				t.Errorf("%s: output file was created on error", test.name)
+			}
+			continue
+		}
+		if readErr != nil {
+			t.Fatal(readErr)
+		}
+		if lines := strings.Count(string(data), "\n"); lines != test.wantLines {
+			t.Errorf("%s: wrote %d lines, want %d\n%s", test.name, lines, test.wantLines, data)
+		}
+	}
+}
+
+func TestRunExportReportsOutputError(t *testing.T) {
+	storeFlags := newTestCommandDB(t, newTestCandles(time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC), 1))
+	output := filepath.Join(t.TempDir(), "missing", "out.csv")
+
+	err := runExport(append([]string{"-pair", "EURUSD", "-time-type", "M1", "-output", output}, storeFlags...))
+	if !os.IsNotExist(err) {
+		t.Errorf("runExport returned %v, want a not-exist error", err)
+	}
+}
+
+func TestRunMigrateRejectsUser(t *testing.T) {
+	storeFlags := newTestCommandDB(t, nil)
+	err := runMigrate(append([]string{"-user", "alice"}, storeFlags...))
+	if err != (ErrInvalidCommand{}) {
+		t.Errorf("runMigrate with -user returned %v, want ErrInvalidCommand", err)
+	}
+}
+
+func TestCheckTimeTypes(t *testing.T) {
+	tests := []struct {
+		names   string
+		want    []TimeType
+		wantErr error
+	}{
+		{"M1", []TimeType{M1}, nil},
+		{"M1, H1,", []TimeType{M1, H1}, nil},
+		{"", nil, ErrInvalidTimeType{}},
+		{"M1,M2", nil, ErrInvalidTimeType{}},
+	}
+
+	for _, test := range tests {
+		got, err := checkTimeTypes(test.names)
+		if err != test.wantErr {
+			t.Errorf("checkTimeTypes(%q) returned %v, want %v", test.names, err, test.wantErr)
+			continue
+		}
+		if len(got) != len(test.want) {
+			t.Errorf("checkTimeTypes(%q) = %v, want %v", test.names, got, test.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("checkTimeTypes(%q) = %v, want %v", test.names, got, test.want)
+				break
+			}
+		}
+	}
+}
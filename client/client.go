@@ -0,0 +1,987 @@
+// Code generated by "fx-tester-server openapi"; DO NOT EDIT.
+
+// Package client fx-tester-serverのv2 APIのクライアント(openapi.jsonから生成)
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Client APIのクライアント
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	token      string
+}
+
+// New Clientをnewする(httpClientがnilの場合はhttp.DefaultClientを使用する)
+func New(baseURL string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{baseURL: strings.TrimRight(baseURL, "/"), httpClient: httpClient}
+}
+
+// WithToken APIキーもしくはJWTをBearerトークンとして送信するClientを返却する
+func (c *Client) WithToken(token string) *Client {
+	authorized := *c
+	authorized.token = token
+	return &authorized
+}
+
+// Error サーバーがエラーを返却した場合のエラー(レスポンスのstatusの内容)
+// Typeはエラーの名前(openapi.jsonのApiResponseStatus.typeの列挙値)で、Codeとともにエラーの判別に使用できる
+type Error struct {
+	StatusCode int
+	Code       uint16
+	Type       string
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d %s (%s, code: 0x%04X)", e.StatusCode, e.Message, e.Type, e.Code)
+}
+
+// Ptr 任意の入力パラメータに指定する値のポインタを返却する
+func Ptr[T any](value T) *T {
+	return &value
+}
+
+// addParam 指定された入力パラメータのみをクエリ文字列に追加する
+func addParam(query url.Values, name string, value interface{}) {
+	switch v := value.(type) {
+	case string:
+		if v != "" {
+			query.Set(name, v)
+		}
+	case []string:
+		if len(v) > 0 {
+			query.Set(name, strings.Join(v, ","))
+		}
+	case *int:
+		if v != nil {
+			query.Set(name, strconv.Itoa(*v))
+		}
+	case *float64:
+		if v != nil {
+			query.Set(name, strconv.FormatFloat(*v, 'f', -1, 64))
+		}
+	case *bool:
+		if v != nil {
+			query.Set(name, strconv.FormatBool(*v))
+		}
+	}
+}
+
+// addBodyParam 指定された入力パラメータのみをJSONボディに追加する
+func addBodyParam(body map[string]interface{}, name string, value interface{}) {
+	query := make(url.Values)
+	addParam(query, name, value)
+	if _, ok := query[name]; ok {
+		body[name] = value
+	}
+}
+
+// send リクエストを送信する
+func (c *Client) send(ctx context.Context, method string, path string, query url.Values, body io.Reader, contentType string) (*http.Response, error) {
+	u := c.baseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	return c.httpClient.Do(req)
+}
+
+// call リクエストを送信し、JSONのレスポンスをoutに読み込む
+// エラーの場合もレスポンスをoutに読み込んだうえで、Errorを返却する
+func (c *Client) call(ctx context.Context, method string, path string, query url.Values, body io.Reader, contentType string, out interface{}) error {
+	resp, err := c.send(ctx, method, path, query, body, contentType)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(data, out)
+	if resp.StatusCode >= http.StatusBadRequest {
+		return newError(resp.StatusCode, data)
+	}
+	return err
+}
+
+// stream リクエストを送信し、成功した場合はレスポンスのボディを返却する(呼び出し側でCloseする)
+func (c *Client) stream(ctx context.Context, method string, path string, query url.Values, body io.Reader, contentType string) (io.ReadCloser, error) {
+	resp, err := c.send(ctx, method, path, query, body, contentType)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		return nil, newError(resp.StatusCode, data)
+	}
+	return resp.Body, nil
+}
+
+// newError エラーのレスポンスからErrorを生成する
+func newError(statusCode int, data []byte) error {
+	var response struct {
+		Status struct {
+			Code    uint16 `json:"code"`
+			Type    string `json:"type"`
+			Message string `json:"message"`
+		} `json:"status"`
+	}
+	json.Unmarshal(data, &response)
+	return &Error{
+		StatusCode: statusCode,
+		Code:       response.Status.Code,
+		Type:       response.Status.Type,
+		Message:    response.Status.Message,
+	}
+}
+
+// encodeBody JSONボディを生成する
+func encodeBody(body interface{}) (io.Reader, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(data), nil
+}
+
+type AccountState struct {
+	Orders         []Order    `json:"orders"`
+	Positions      []Position `json:"positions"`
+	RealizedProfit float64    `json:"realizedProfit"`
+	Trades         []Trade    `json:"trades"`
+}
+
+type ApiProblem struct {
+	Causes   []ApiProblemCause `json:"causes,omitempty"`
+	Code     int               `json:"code"`
+	Detail   string            `json:"detail"`
+	Instance string            `json:"instance,omitempty"`
+	Status   int               `json:"status"`
+	Title    string            `json:"title"`
+	Type     string            `json:"type"`
+}
+
+type ApiProblemCause struct {
+	Code   int    `json:"code"`
+	Detail string `json:"detail"`
+	Type   string `json:"type"`
+}
+
+type ApiResponseDeleteData struct {
+	Status ApiResponseStatus `json:"status"`
+}
+
+type ApiResponseGetCandles struct {
+	Candles    []Candle          `json:"candles"`
+	NextCursor string            `json:"nextCursor,omitempty"`
+	Status     ApiResponseStatus `json:"status"`
+}
+
+type ApiResponseGetCoverage struct {
+	Coverage *Coverage         `json:"coverage"`
+	Status   ApiResponseStatus `json:"status"`
+}
+
+type ApiResponseGetData struct {
+	Candles []Candle          `json:"candles"`
+	Status  ApiResponseStatus `json:"status"`
+}
+
+type ApiResponseGetDataSummary struct {
+	FixTimes    []string          `json:"fixTimes"`
+	Status      ApiResponseStatus `json:"status"`
+	TickVolumes []int32           `json:"tickVolumes"`
+}
+
+type ApiResponseGetExport struct {
+	Status ApiResponseStatus `json:"status"`
+}
+
+type ApiResponseGetIndicators struct {
+	Series []IndicatorSeries `json:"series"`
+	Status ApiResponseStatus `json:"status"`
+	Times  []string          `json:"times"`
+}
+
+type ApiResponseGetPairDetail struct {
+	Details []PairDetail      `json:"details"`
+	Status  ApiResponseStatus `json:"status"`
+}
+
+type ApiResponseGetPairList struct {
+	Pairs  []string          `json:"pairs"`
+	Status ApiResponseStatus `json:"status"`
+}
+
+type ApiResponseGetReport struct {
+	Report *BacktestReport   `json:"report"`
+	Status ApiResponseStatus `json:"status"`
+}
+
+type ApiResponsePostData struct {
+	CountData  int               `json:"countData"`
+	Diffs      []CandleDiff      `json:"diffs,omitempty"`
+	Inserted   int               `json:"inserted"`
+	Resampled  []PairDetail      `json:"resampled,omitempty"`
+	Status     ApiResponseStatus `json:"status"`
+	Unchanged  int               `json:"unchanged"`
+	Updated    int               `json:"updated"`
+	Validation *ValidationReport `json:"validation,omitempty"`
+}
+
+type ApiResponsePostImport struct {
+	CountData  int               `json:"countData"`
+	PairName   string            `json:"pairName"`
+	Resampled  []PairDetail      `json:"resampled,omitempty"`
+	Status     ApiResponseStatus `json:"status"`
+	TimeType   int               `json:"timeType"`
+	Validation *ValidationReport `json:"validation,omitempty"`
+}
+
+type ApiResponsePostResample struct {
+	Resampled []PairDetail      `json:"resampled"`
+	Status    ApiResponseStatus `json:"status"`
+}
+
+type ApiResponseReplay struct {
+	Session *ReplayState      `json:"session"`
+	Status  ApiResponseStatus `json:"status"`
+}
+
+type ApiResponseStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Type    string `json:"type,omitempty"`
+}
+
+type ApiResponseUpload struct {
+	Status ApiResponseStatus `json:"status"`
+	Upload *UploadState      `json:"upload"`
+}
+
+type BacktestReport struct {
+	AverageRMultiple   float64       `json:"averageRMultiple"`
+	EquityCurve        []EquityPoint `json:"equityCurve"`
+	Expectancy         float64       `json:"expectancy"`
+	FinalBalance       float64       `json:"finalBalance"`
+	GrossLoss          float64       `json:"grossLoss"`
+	GrossProfit        float64       `json:"grossProfit"`
+	InitialBalance     float64       `json:"initialBalance"`
+	LongestLossStreak  int           `json:"longestLossStreak"`
+	LongestWinStreak   int           `json:"longestWinStreak"`
+	MaxDrawdown        float64       `json:"maxDrawdown"`
+	MaxDrawdownPercent float64       `json:"maxDrawdownPercent"`
+	NetProfit          float64       `json:"netProfit"`
+	NumLosses          int           `json:"numLosses"`
+	NumTrades          int           `json:"numTrades"`
+	NumWins            int           `json:"numWins"`
+	ProfitFactor       float64       `json:"profitFactor"`
+	SharpeRatio        float64       `json:"sharpeRatio"`
+	SortinoRatio       float64       `json:"sortinoRatio"`
+	Trades             []Trade       `json:"trades"`
+	WinRate            float64       `json:"winRate"`
+}
+
+type Candle struct {
+	Close      float32 `json:"close"`
+	High       float32 `json:"high"`
+	Low        float32 `json:"low"`
+	Open       float32 `json:"open"`
+	TickVolume int32   `json:"tickVolume"`
+	Time       string  `json:"time"`
+}
+
+type CandleDiff struct {
+	Stored   Candle `json:"stored"`
+	Time     string `json:"time"`
+	Uploaded Candle `json:"uploaded"`
+}
+
+type Coverage struct {
+	Actual        int               `json:"actual"`
+	Expected      int               `json:"expected"`
+	First         string            `json:"first"`
+	Last          string            `json:"last"`
+	Missing       int               `json:"missing"`
+	MissingRanges []MissingRange    `json:"missingRanges"`
+	Months        []MonthlyCoverage `json:"months"`
+	PairName      string            `json:"pairName"`
+	Ratio         float64           `json:"ratio"`
+	TimeType      int               `json:"timeType"`
+	Truncated     bool              `json:"truncated"`
+	Unexpected    int               `json:"unexpected"`
+}
+
+type EquityPoint struct {
+	Equity float64 `json:"equity"`
+	Time   string  `json:"time"`
+}
+
+type IndicatorSeries struct {
+	Lines map[string][]*float64 `json:"lines"`
+	Name  string                `json:"name"`
+}
+
+type MissingRange struct {
+	Count int    `json:"count"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+}
+
+type ModifyPositionPayload struct {
+	PositionID int     `json:"positionId"`
+	StopLoss   float64 `json:"stopLoss"`
+	TakeProfit float64 `json:"takeProfit"`
+}
+
+type MonthlyCoverage struct {
+	Actual   int    `json:"actual"`
+	Expected int    `json:"expected"`
+	Missing  int    `json:"missing"`
+	Month    string `json:"month"`
+}
+
+type Order struct {
+	CreatedAt  string  `json:"createdAt"`
+	ID         int     `json:"id"`
+	Price      float64 `json:"price"`
+	Side       string  `json:"side"`
+	StopLoss   float64 `json:"stopLoss"`
+	TakeProfit float64 `json:"takeProfit"`
+	Type       string  `json:"type"`
+	Units      float64 `json:"units"`
+}
+
+type OrderPayload struct {
+	Price      float64 `json:"price"`
+	Side       string  `json:"side"`
+	StopLoss   float64 `json:"stopLoss"`
+	TakeProfit float64 `json:"takeProfit"`
+	Type       string  `json:"type"`
+	Units      float64 `json:"units"`
+}
+
+type PairDetail struct {
+	CountData int `json:"countData"`
+	TimeType  int `json:"timeType"`
+}
+
+type Position struct {
+	EntryPrice      float64 `json:"entryPrice"`
+	ID              int     `json:"id"`
+	InitialStopLoss float64 `json:"initialStopLoss"`
+	OpenedAt        string  `json:"openedAt"`
+	Side            string  `json:"side"`
+	StopLoss        float64 `json:"stopLoss"`
+	TakeProfit      float64 `json:"takeProfit"`
+	Units           float64 `json:"units"`
+}
+
+type ReplayCandle struct {
+	Candle   Candle `json:"candle"`
+	TimeType int    `json:"timeType"`
+}
+
+type ReplayControlMessage struct {
+	Interval  int      `json:"interval"`
+	PairName  string   `json:"pairName"`
+	SessionID string   `json:"sessionId"`
+	Speed     string   `json:"speed"`
+	StartTime string   `json:"startTime"`
+	Time      string   `json:"time"`
+	TimeTypes []string `json:"timeTypes"`
+	Type      string   `json:"type"`
+}
+
+type ReplayState struct {
+	Account   AccountState   `json:"account"`
+	Candles   []ReplayCandle `json:"candles"`
+	Length    int            `json:"length"`
+	PairName  string         `json:"pairName"`
+	Position  int            `json:"position"`
+	SessionID string         `json:"sessionId"`
+	Time      string         `json:"time"`
+}
+
+type ReplayStreamMessage struct {
+	Session *ReplayState      `json:"session"`
+	Status  ApiResponseStatus `json:"status"`
+	Type    string            `json:"type"`
+}
+
+type Trade struct {
+	ClosedAt        string  `json:"closedAt"`
+	EntryPrice      float64 `json:"entryPrice"`
+	ExitPrice       float64 `json:"exitPrice"`
+	InitialStopLoss float64 `json:"initialStopLoss"`
+	OpenedAt        string  `json:"openedAt"`
+	PositionID      int     `json:"positionId"`
+	Profit          float64 `json:"profit"`
+	Reason          string  `json:"reason"`
+	Side            string  `json:"side"`
+	StopLoss        float64 `json:"stopLoss"`
+	Units           float64 `json:"units"`
+}
+
+type UploadPayload struct {
+	Data []Candle `json:"data"`
+}
+
+type UploadState struct {
+	Diffs         []CandleDiff      `json:"diffs,omitempty"`
+	Error         string            `json:"error,omitempty"`
+	Format        string            `json:"format"`
+	Inserted      int               `json:"inserted"`
+	InsertedRows  int               `json:"insertedRows"`
+	PairName      string            `json:"pairName"`
+	ReceivedBytes int64             `json:"receivedBytes"`
+	Resampled     []PairDetail      `json:"resampled,omitempty"`
+	State         string            `json:"state"`
+	TimeType      int               `json:"timeType"`
+	Unchanged     int               `json:"unchanged"`
+	Updated       int               `json:"updated"`
+	UploadID      string            `json:"uploadId"`
+	Validation    *ValidationReport `json:"validation,omitempty"`
+}
+
+type ValidationIssue struct {
+	Index    int    `json:"index"`
+	Message  string `json:"message"`
+	Rule     string `json:"rule"`
+	Severity string `json:"severity"`
+	Time     string `json:"time"`
+}
+
+type ValidationReport struct {
+	Checked    int               `json:"checked"`
+	Invalid    int               `json:"invalid"`
+	Issues     []ValidationIssue `json:"issues"`
+	Mode       string            `json:"mode"`
+	RuleCounts map[string]int    `json:"ruleCounts"`
+	Truncated  bool              `json:"truncated"`
+	Warned     int               `json:"warned"`
+}
+
+// ImportFileParams ImportFileの入力パラメータ
+type ImportFileParams struct {
+	FileName        string   // ファイル名(通貨ペア・時間軸・形式の判定に使用する)
+	Format          string   // データの形式
+	PairName        string   // 通貨ペア名
+	TimeType        string   // 時間軸
+	TimezoneProfile string   // タイムゾーンのプロファイル名(未指定の場合は既定のプロファイル。RAWはサーバー時間を変換しない)
+	Resample        *bool    // trueの場合、登録後に上位足を生成する
+	Validation      string   // 検証モード
+	SpikeThreshold  *float64 // スパイクとみなす直前の終値からの変動率(0の場合は検出しない)
+	Dataset         string   // データセット(privateは認証した利用者ごとのデータ)
+}
+
+// ImportFile MT4/MT5から出力したCSV・.hstファイルを登録する
+func (c *Client) ImportFile(ctx context.Context, body io.Reader, params *ImportFileParams) (*ApiResponsePostImport, error) {
+	query := make(url.Values)
+	if params != nil {
+		addParam(query, "fileName", params.FileName)
+		addParam(query, "format", params.Format)
+		addParam(query, "pairName", params.PairName)
+		addParam(query, "timeType", params.TimeType)
+		addParam(query, "timezoneProfile", params.TimezoneProfile)
+		addParam(query, "resample", params.Resample)
+		addParam(query, "validation", params.Validation)
+		addParam(query, "spikeThreshold", params.SpikeThreshold)
+		addParam(query, "dataset", params.Dataset)
+	}
+	out := new(ApiResponsePostImport)
+	return out, c.call(ctx, "POST", "/api/v2/imports", query, body, "application/octet-stream", out)
+}
+
+// ListPairsParams ListPairsの入力パラメータ
+type ListPairsParams struct {
+	Dataset string // データセット(privateは認証した利用者ごとのデータ)
+}
+
+// ListPairs 登録されている通貨ペアの一覧を取得する
+func (c *Client) ListPairs(ctx context.Context, params *ListPairsParams) (*ApiResponseGetPairList, error) {
+	query := make(url.Values)
+	if params != nil {
+		addParam(query, "dataset", params.Dataset)
+	}
+	out := new(ApiResponseGetPairList)
+	return out, c.call(ctx, "GET", "/api/v2/pairs", query, nil, "", out)
+}
+
+// GetPairParams GetPairの入力パラメータ
+type GetPairParams struct {
+	Dataset string // データセット(privateは認証した利用者ごとのデータ)
+}
+
+// GetPair 通貨ペアの時間軸ごとの登録件数を取得する
+func (c *Client) GetPair(ctx context.Context, pairName string, params *GetPairParams) (*ApiResponseGetPairDetail, error) {
+	query := make(url.Values)
+	if params != nil {
+		addParam(query, "dataset", params.Dataset)
+	}
+	out := new(ApiResponseGetPairDetail)
+	return out, c.call(ctx, "GET", "/api/v2/pairs/"+url.PathEscape(pairName), query, nil, "", out)
+}
+
+// DeleteCandlesParams DeleteCandlesの入力パラメータ
+type DeleteCandlesParams struct {
+	TimeTypes []string // 時間軸の一覧
+	Dataset   string   // データセット(privateは認証した利用者ごとのデータ)
+}
+
+// DeleteCandles 時間軸ごとにローソク足を全て削除する
+func (c *Client) DeleteCandles(ctx context.Context, pairName string, timeType string, params *DeleteCandlesParams) (*ApiResponseDeleteData, error) {
+	query := make(url.Values)
+	if params != nil {
+		addParam(query, "timeTypes", params.TimeTypes)
+		addParam(query, "dataset", params.Dataset)
+	}
+	out := new(ApiResponseDeleteData)
+	return out, c.call(ctx, "DELETE", "/api/v2/pairs/"+url.PathEscape(pairName)+"/timeframes/"+url.PathEscape(timeType)+"/candles", query, nil, "", out)
+}
+
+// GetCandlesParams GetCandlesの入力パラメータ
+type GetCandlesParams struct {
+	Order   string // 並び順
+	Limit   *int   // 取得する本数
+	Cursor  string // 前のページのnextCursor
+	From    string // 期間の開始(確定時刻、yyyy-MM-dd HH:mm:ss)
+	To      string // 期間の終了(確定時刻、yyyy-MM-dd HH:mm:ss)
+	Dataset string // データセット(privateは認証した利用者ごとのデータ)
+}
+
+// GetCandles 1つの時間軸の期間内のローソク足をページ単位で取得する
+func (c *Client) GetCandles(ctx context.Context, pairName string, timeType string, params *GetCandlesParams) (*ApiResponseGetCandles, error) {
+	query := make(url.Values)
+	if params != nil {
+		addParam(query, "order", params.Order)
+		addParam(query, "limit", params.Limit)
+		addParam(query, "cursor", params.Cursor)
+		addParam(query, "from", params.From)
+		addParam(query, "to", params.To)
+		addParam(query, "dataset", params.Dataset)
+	}
+	out := new(ApiResponseGetCandles)
+	return out, c.call(ctx, "GET", "/api/v2/pairs/"+url.PathEscape(pairName)+"/timeframes/"+url.PathEscape(timeType)+"/candles", query, nil, "", out)
+}
+
+// PostCandlesParams PostCandlesの入力パラメータ
+type PostCandlesParams struct {
+	Format          string   // データの形式
+	TimezoneProfile string   // タイムゾーンのプロファイル名(未指定の場合は既定のプロファイル。RAWはサーバー時間を変換しない)
+	Resample        *bool    // trueの場合、登録後に上位足を生成する
+	DuplicatePolicy string   // 既に存在する確定時刻の扱い
+	Validation      string   // 検証モード
+	SpikeThreshold  *float64 // スパイクとみなす直前の終値からの変動率(0の場合は検出しない)
+	Dataset         string   // データセット(privateは認証した利用者ごとのデータ)
+}
+
+// PostCandles ローソク足を登録する
+func (c *Client) PostCandles(ctx context.Context, pairName string, timeType string, body io.Reader, contentType string, params *PostCandlesParams) (*ApiResponsePostData, error) {
+	query := make(url.Values)
+	if params != nil {
+		addParam(query, "format", params.Format)
+		addParam(query, "timezoneProfile", params.TimezoneProfile)
+		addParam(query, "resample", params.Resample)
+		addParam(query, "duplicatePolicy", params.DuplicatePolicy)
+		addParam(query, "validation", params.Validation)
+		addParam(query, "spikeThreshold", params.SpikeThreshold)
+		addParam(query, "dataset", params.Dataset)
+	}
+	out := new(ApiResponsePostData)
+	return out, c.call(ctx, "POST", "/api/v2/pairs/"+url.PathEscape(pairName)+"/timeframes/"+url.PathEscape(timeType)+"/candles", query, body, contentType, out)
+}
+
+// GetCoverageParams GetCoverageの入力パラメータ
+type GetCoverageParams struct {
+	TimezoneProfile string   // タイムゾーンのプロファイル名(未指定の場合は既定のプロファイル。RAWはサーバー時間を変換しない)
+	Holidays        []string // 設定ファイルに加える休場日(yyyy-MM-dd)
+	From            string   // 期間の開始(確定時刻、yyyy-MM-dd HH:mm:ss)
+	To              string   // 期間の終了(確定時刻、yyyy-MM-dd HH:mm:ss)
+	Dataset         string   // データセット(privateは認証した利用者ごとのデータ)
+}
+
+// GetCoverage データの網羅状況と欠損期間を取得する
+func (c *Client) GetCoverage(ctx context.Context, pairName string, timeType string, params *GetCoverageParams) (*ApiResponseGetCoverage, error) {
+	query := make(url.Values)
+	if params != nil {
+		addParam(query, "timezoneProfile", params.TimezoneProfile)
+		addParam(query, "holidays", params.Holidays)
+		addParam(query, "from", params.From)
+		addParam(query, "to", params.To)
+		addParam(query, "dataset", params.Dataset)
+	}
+	out := new(ApiResponseGetCoverage)
+	return out, c.call(ctx, "GET", "/api/v2/pairs/"+url.PathEscape(pairName)+"/timeframes/"+url.PathEscape(timeType)+"/coverage", query, nil, "", out)
+}
+
+// ExportCandlesParams ExportCandlesの入力パラメータ
+type ExportCandlesParams struct {
+	Format          string // データの形式
+	TimezoneProfile string // タイムゾーンのプロファイル名(未指定の場合は既定のプロファイル。RAWはサーバー時間を変換しない)
+	From            string // 期間の開始(確定時刻、yyyy-MM-dd HH:mm:ss)
+	To              string // 期間の終了(確定時刻、yyyy-MM-dd HH:mm:ss)
+	Dataset         string // データセット(privateは認証した利用者ごとのデータ)
+}
+
+// ExportCandles 期間内のローソク足をファイルとして出力する(Accept-Encodingにgzipを含む場合は圧縮する)
+func (c *Client) ExportCandles(ctx context.Context, pairName string, timeType string, params *ExportCandlesParams) (io.ReadCloser, error) {
+	query := make(url.Values)
+	if params != nil {
+		addParam(query, "format", params.Format)
+		addParam(query, "timezoneProfile", params.TimezoneProfile)
+		addParam(query, "from", params.From)
+		addParam(query, "to", params.To)
+		addParam(query, "dataset", params.Dataset)
+	}
+	return c.stream(ctx, "GET", "/api/v2/pairs/"+url.PathEscape(pairName)+"/timeframes/"+url.PathEscape(timeType)+"/export", query, nil, "")
+}
+
+// GetIndicatorsParams GetIndicatorsの入力パラメータ
+type GetIndicatorsParams struct {
+	Indicators    string // テクニカル指標(sma:20;macd:12,26,9形式、期間は1から1000までの整数)(必須)
+	From          string // 期間の開始(確定時刻、yyyy-MM-dd HH:mm:ss)
+	To            string // 期間の終了(確定時刻、yyyy-MM-dd HH:mm:ss)
+	ReplayTime    string // リプレイ時刻(指定した場合は下位足から形成中の足を合成する)
+	LowerTimeType string // 下位足の時間軸
+	Dataset       string // データセット(privateは認証した利用者ごとのデータ)
+}
+
+// GetIndicators テクニカル指標を計算する
+func (c *Client) GetIndicators(ctx context.Context, pairName string, timeType string, params *GetIndicatorsParams) (*ApiResponseGetIndicators, error) {
+	query := make(url.Values)
+	if params != nil {
+		addParam(query, "indicators", params.Indicators)
+		addParam(query, "from", params.From)
+		addParam(query, "to", params.To)
+		addParam(query, "replayTime", params.ReplayTime)
+		addParam(query, "lowerTimeType", params.LowerTimeType)
+		addParam(query, "dataset", params.Dataset)
+	}
+	out := new(ApiResponseGetIndicators)
+	return out, c.call(ctx, "GET", "/api/v2/pairs/"+url.PathEscape(pairName)+"/timeframes/"+url.PathEscape(timeType)+"/indicators", query, nil, "", out)
+}
+
+// ResampleParams Resampleの入力パラメータ
+type ResampleParams struct {
+	Dataset         string // データセット(privateは認証した利用者ごとのデータ)
+	From            string // 期間の開始(確定時刻、yyyy-MM-dd HH:mm:ss)
+	TimezoneProfile string // タイムゾーンのプロファイル名(未指定の場合は既定のプロファイル。RAWはサーバー時間を変換しない)
+	To              string // 期間の終了(確定時刻、yyyy-MM-dd HH:mm:ss)
+}
+
+// Resample 下位足から上位足を生成する
+func (c *Client) Resample(ctx context.Context, pairName string, timeType string, params *ResampleParams) (*ApiResponsePostResample, error) {
+	query := make(url.Values)
+	paramsBody := make(map[string]interface{})
+	if params != nil {
+		addParam(query, "dataset", params.Dataset)
+		addBodyParam(paramsBody, "from", params.From)
+		addBodyParam(paramsBody, "timezoneProfile", params.TimezoneProfile)
+		addBodyParam(paramsBody, "to", params.To)
+	}
+	body, err := encodeBody(paramsBody)
+	if err != nil {
+		return nil, err
+	}
+	out := new(ApiResponsePostResample)
+	return out, c.call(ctx, "POST", "/api/v2/pairs/"+url.PathEscape(pairName)+"/timeframes/"+url.PathEscape(timeType)+"/resample", query, body, "application/json", out)
+}
+
+// GetSummaryParams GetSummaryの入力パラメータ
+type GetSummaryParams struct {
+	Dataset string // データセット(privateは認証した利用者ごとのデータ)
+}
+
+// GetSummary ローソク足の確定時刻とティックボリュームの一覧を取得する
+func (c *Client) GetSummary(ctx context.Context, pairName string, timeType string, params *GetSummaryParams) (*ApiResponseGetDataSummary, error) {
+	query := make(url.Values)
+	if params != nil {
+		addParam(query, "dataset", params.Dataset)
+	}
+	out := new(ApiResponseGetDataSummary)
+	return out, c.call(ctx, "GET", "/api/v2/pairs/"+url.PathEscape(pairName)+"/timeframes/"+url.PathEscape(timeType)+"/summary", query, nil, "", out)
+}
+
+// GetReplayCandlesParams GetReplayCandlesの入力パラメータ
+type GetReplayCandlesParams struct {
+	LowerTimeType string // 下位足の時間軸(必須)
+	LowerTime     string // 下位足の確定時刻(yyyy-MM-dd HH:mm:ss)(必須)
+	Limit         *int   // 取得する本数(必須)
+	Dataset       string // データセット(privateは認証した利用者ごとのデータ)
+}
+
+// GetReplayCandles 下位足の確定時刻までのローソク足を、上位足の形成中の足を含めて取得する
+func (c *Client) GetReplayCandles(ctx context.Context, pairName string, upperTimeType string, params *GetReplayCandlesParams) (*ApiResponseGetData, error) {
+	query := make(url.Values)
+	if params != nil {
+		addParam(query, "lowerTimeType", params.LowerTimeType)
+		addParam(query, "lowerTime", params.LowerTime)
+		addParam(query, "limit", params.Limit)
+		addParam(query, "dataset", params.Dataset)
+	}
+	out := new(ApiResponseGetData)
+	return out, c.call(ctx, "GET", "/api/v2/pairs/"+url.PathEscape(pairName)+"/timeframes/"+url.PathEscape(upperTimeType)+"/replay-candles", query, nil, "", out)
+}
+
+// CreateReplayParams CreateReplayの入力パラメータ
+type CreateReplayParams struct {
+	Dataset   string   // データセット(privateは認証した利用者ごとのデータ)
+	PairName  string   // 通貨ペア名(必須)
+	StartTime string   // リプレイの開始時刻(確定時刻、yyyy-MM-dd HH:mm:ss)(必須)
+	TimeTypes []string // 時間軸の一覧(必須)
+}
+
+// CreateReplay リプレイセッションを作成する
+func (c *Client) CreateReplay(ctx context.Context, params *CreateReplayParams) (*ApiResponseReplay, error) {
+	query := make(url.Values)
+	paramsBody := make(map[string]interface{})
+	if params != nil {
+		addParam(query, "dataset", params.Dataset)
+		addBodyParam(paramsBody, "pairName", params.PairName)
+		addBodyParam(paramsBody, "startTime", params.StartTime)
+		addBodyParam(paramsBody, "timeTypes", params.TimeTypes)
+	}
+	body, err := encodeBody(paramsBody)
+	if err != nil {
+		return nil, err
+	}
+	out := new(ApiResponseReplay)
+	return out, c.call(ctx, "POST", "/api/v2/replays", query, body, "application/json", out)
+}
+
+// DeleteReplay リプレイセッションを破棄する
+func (c *Client) DeleteReplay(ctx context.Context, sessionId string) (*ApiResponseReplay, error) {
+	query := make(url.Values)
+	out := new(ApiResponseReplay)
+	return out, c.call(ctx, "DELETE", "/api/v2/replays/"+url.PathEscape(sessionId), query, nil, "", out)
+}
+
+// GetReplay リプレイセッションの状態を取得する
+func (c *Client) GetReplay(ctx context.Context, sessionId string) (*ApiResponseReplay, error) {
+	query := make(url.Values)
+	out := new(ApiResponseReplay)
+	return out, c.call(ctx, "GET", "/api/v2/replays/"+url.PathEscape(sessionId), query, nil, "", out)
+}
+
+// NextReplayParams NextReplayの入力パラメータ
+type NextReplayParams struct {
+	Steps *int // 進める・戻す本数(未指定の場合は1本)
+}
+
+// NextReplay リプレイを進める
+func (c *Client) NextReplay(ctx context.Context, sessionId string, params *NextReplayParams) (*ApiResponseReplay, error) {
+	query := make(url.Values)
+	paramsBody := make(map[string]interface{})
+	if params != nil {
+		addBodyParam(paramsBody, "steps", params.Steps)
+	}
+	body, err := encodeBody(paramsBody)
+	if err != nil {
+		return nil, err
+	}
+	out := new(ApiResponseReplay)
+	return out, c.call(ctx, "POST", "/api/v2/replays/"+url.PathEscape(sessionId)+"/next", query, body, "application/json", out)
+}
+
+// PlaceOrder 注文を発注する
+func (c *Client) PlaceOrder(ctx context.Context, sessionId string, payload *OrderPayload) (*ApiResponseReplay, error) {
+	query := make(url.Values)
+	body, err := encodeBody(payload)
+	if err != nil {
+		return nil, err
+	}
+	out := new(ApiResponseReplay)
+	return out, c.call(ctx, "POST", "/api/v2/replays/"+url.PathEscape(sessionId)+"/orders", query, body, "application/json", out)
+}
+
+// CancelOrder 注文を取り消す
+func (c *Client) CancelOrder(ctx context.Context, sessionId string, orderId string) (*ApiResponseReplay, error) {
+	query := make(url.Values)
+	out := new(ApiResponseReplay)
+	return out, c.call(ctx, "DELETE", "/api/v2/replays/"+url.PathEscape(sessionId)+"/orders/"+url.PathEscape(orderId), query, nil, "", out)
+}
+
+// ModifyPosition ポジションの決済注文を変更する
+func (c *Client) ModifyPosition(ctx context.Context, sessionId string, payload *ModifyPositionPayload) (*ApiResponseReplay, error) {
+	query := make(url.Values)
+	body, err := encodeBody(payload)
+	if err != nil {
+		return nil, err
+	}
+	out := new(ApiResponseReplay)
+	return out, c.call(ctx, "PUT", "/api/v2/replays/"+url.PathEscape(sessionId)+"/positions", query, body, "application/json", out)
+}
+
+// ClosePositionParams ClosePositionの入力パラメータ
+type ClosePositionParams struct {
+	Units *float64 // 決済数量(未指定の場合は全量)
+}
+
+// ClosePosition ポジションを決済する
+func (c *Client) ClosePosition(ctx context.Context, sessionId string, positionId string, params *ClosePositionParams) (*ApiResponseReplay, error) {
+	query := make(url.Values)
+	if params != nil {
+		addParam(query, "units", params.Units)
+	}
+	out := new(ApiResponseReplay)
+	return out, c.call(ctx, "DELETE", "/api/v2/replays/"+url.PathEscape(sessionId)+"/positions/"+url.PathEscape(positionId), query, nil, "", out)
+}
+
+// PrevReplayParams PrevReplayの入力パラメータ
+type PrevReplayParams struct {
+	Steps *int // 進める・戻す本数(未指定の場合は1本)
+}
+
+// PrevReplay リプレイを戻す
+func (c *Client) PrevReplay(ctx context.Context, sessionId string, params *PrevReplayParams) (*ApiResponseReplay, error) {
+	query := make(url.Values)
+	paramsBody := make(map[string]interface{})
+	if params != nil {
+		addBodyParam(paramsBody, "steps", params.Steps)
+	}
+	body, err := encodeBody(paramsBody)
+	if err != nil {
+		return nil, err
+	}
+	out := new(ApiResponseReplay)
+	return out, c.call(ctx, "POST", "/api/v2/replays/"+url.PathEscape(sessionId)+"/prev", query, body, "application/json", out)
+}
+
+// GetReportParams GetReportの入力パラメータ
+type GetReportParams struct {
+	InitialBalance *float64 // 初期資金
+	Format         string   // データの形式
+}
+
+// GetReport バックテストのレポートを取得する(x-formatがhtml, csvの場合はファイルとして出力する)
+func (c *Client) GetReport(ctx context.Context, sessionId string, params *GetReportParams) (*ApiResponseGetReport, error) {
+	query := make(url.Values)
+	if params != nil {
+		addParam(query, "initialBalance", params.InitialBalance)
+		addParam(query, "format", params.Format)
+	}
+	out := new(ApiResponseGetReport)
+	return out, c.call(ctx, "GET", "/api/v2/replays/"+url.PathEscape(sessionId)+"/report", query, nil, "", out)
+}
+
+// SeekReplayParams SeekReplayの入力パラメータ
+type SeekReplayParams struct {
+	Time string // 移動先の時刻(確定時刻、yyyy-MM-dd HH:mm:ss)(必須)
+}
+
+// SeekReplay リプレイを指定の時刻へ移動する
+func (c *Client) SeekReplay(ctx context.Context, sessionId string, params *SeekReplayParams) (*ApiResponseReplay, error) {
+	query := make(url.Values)
+	paramsBody := make(map[string]interface{})
+	if params != nil {
+		addBodyParam(paramsBody, "time", params.Time)
+	}
+	body, err := encodeBody(paramsBody)
+	if err != nil {
+		return nil, err
+	}
+	out := new(ApiResponseReplay)
+	return out, c.call(ctx, "POST", "/api/v2/replays/"+url.PathEscape(sessionId)+"/seek", query, body, "application/json", out)
+}
+
+// CreateUploadParams CreateUploadの入力パラメータ
+type CreateUploadParams struct {
+	Dataset         string   // データセット(privateは認証した利用者ごとのデータ)
+	DuplicatePolicy string   // 既に存在する確定時刻の扱い
+	Format          string   // データの形式
+	PairName        string   // 通貨ペア名(必須)
+	Resample        *bool    // trueの場合、登録後に上位足を生成する
+	SpikeThreshold  *float64 // スパイクとみなす直前の終値からの変動率(0の場合は検出しない)
+	TimeType        string   // 時間軸(必須)
+	TimezoneProfile string   // タイムゾーンのプロファイル名(未指定の場合は既定のプロファイル。RAWはサーバー時間を変換しない)
+	Validation      string   // 検証モード
+}
+
+// CreateUpload 分割アップロードのセッションを作成する
+func (c *Client) CreateUpload(ctx context.Context, params *CreateUploadParams) (*ApiResponseUpload, error) {
+	query := make(url.Values)
+	paramsBody := make(map[string]interface{})
+	if params != nil {
+		addParam(query, "dataset", params.Dataset)
+		addBodyParam(paramsBody, "duplicatePolicy", params.DuplicatePolicy)
+		addBodyParam(paramsBody, "format", params.Format)
+		addBodyParam(paramsBody, "pairName", params.PairName)
+		addBodyParam(paramsBody, "resample", params.Resample)
+		addBodyParam(paramsBody, "spikeThreshold", params.SpikeThreshold)
+		addBodyParam(paramsBody, "timeType", params.TimeType)
+		addBodyParam(paramsBody, "timezoneProfile", params.TimezoneProfile)
+		addBodyParam(paramsBody, "validation", params.Validation)
+	}
+	body, err := encodeBody(paramsBody)
+	if err != nil {
+		return nil, err
+	}
+	out := new(ApiResponseUpload)
+	return out, c.call(ctx, "POST", "/api/v2/uploads", query, body, "application/json", out)
+}
+
+// DeleteUpload アップロードセッションを破棄する
+func (c *Client) DeleteUpload(ctx context.Context, uploadId string) (*ApiResponseUpload, error) {
+	query := make(url.Values)
+	out := new(ApiResponseUpload)
+	return out, c.call(ctx, "DELETE", "/api/v2/uploads/"+url.PathEscape(uploadId), query, nil, "", out)
+}
+
+// GetUpload アップロードセッションの状態を取得する
+func (c *Client) GetUpload(ctx context.Context, uploadId string) (*ApiResponseUpload, error) {
+	query := make(url.Values)
+	out := new(ApiResponseUpload)
+	return out, c.call(ctx, "GET", "/api/v2/uploads/"+url.PathEscape(uploadId), query, nil, "", out)
+}
+
+// AppendUploadParams AppendUploadの入力パラメータ
+type AppendUploadParams struct {
+	Offset *int // 分割データの開始位置(受信済みのバイト数)(必須)
+}
+
+// AppendUpload 分割データを送信する
+func (c *Client) AppendUpload(ctx context.Context, uploadId string, body io.Reader, params *AppendUploadParams) (*ApiResponseUpload, error) {
+	query := make(url.Values)
+	if params != nil {
+		addParam(query, "offset", params.Offset)
+	}
+	out := new(ApiResponseUpload)
+	return out, c.call(ctx, "PUT", "/api/v2/uploads/"+url.PathEscape(uploadId), query, body, "application/octet-stream", out)
+}
+
+// CompleteUpload 送信を完了し、取り込みを開始する
+func (c *Client) CompleteUpload(ctx context.Context, uploadId string) (*ApiResponseUpload, error) {
+	query := make(url.Values)
+	out := new(ApiResponseUpload)
+	return out, c.call(ctx, "POST", "/api/v2/uploads/"+url.PathEscape(uploadId)+"/complete", query, nil, "", out)
+}
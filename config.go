@@ -0,0 +1,313 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// configEnvPrefix 設定を上書きする環境変数の接頭辞(続けて各項目のenvタグの名前を付ける)
+	configEnvPrefix = "FX_TESTER_"
+
+	// configPathEnv 設定ファイルのパスを指定する環境変数
+	configPathEnv = configEnvPrefix + "CONFIG"
+
+	// defaultConfigPath 設定ファイルの既定のパス(存在しない場合は既定値と環境変数・フラグのみで起動する)
+	defaultConfigPath = "config.json"
+)
+
+// config 設定ファイルの内容を管理する構造体
+// 既定値、設定ファイル(JSON, YAML, TOML)、環境変数、コマンドラインフラグの順に上書きする
+// 環境変数はFX_TESTER_とenvタグの名前、フラグはenvタグの名前を小文字・ハイフン区切りにしたもの(-server-port)
+type config struct {
+	DBUserName     string `env:"DB_USER_NAME"`
+	DBUserPass     string `env:"DB_USER_PASS"`
+	DBUserPassFile string `env:"DB_USER_PASS_FILE"` // DBUserPassを読み込むファイル(Docker secretsなど)。指定した場合はDBUserPassより優先する
+	DBAddress      string `env:"DB_ADDRESS"`
+	DBPort         int    `env:"DB_PORT"`
+	DatabaseName   string `env:"DATABASE_NAME"`
+	ServerPort     int    `env:"SERVER_PORT"`
+	StoreType      string `env:"STORE_TYPE"`  // mysql(既定値), sqlite, memoryのいずれか
+	SQLitePath     string `env:"SQLITE_PATH"` // StoreTypeがsqliteの場合に使用するDBファイルのパス
+	UploadDir      string `env:"UPLOAD_DIR"`  // 分割アップロードの一時ファイルの保存先(未指定の場合はOSの一時ディレクトリ)
+
+	MySQLLoadDataThreshold int `env:"MYSQL_LOAD_DATA_THRESHOLD"` // この行数以上の登録にLOAD DATA LOCAL INFILEを使用する(0の場合は使用しない)
+
+	TimezoneProfiles       []timezoneProfile `env:"TIMEZONE_PROFILES"`        // ブローカーごとのサーバー時間の仕様(未指定の場合は組み込みのプロファイル)
+	DefaultTimezoneProfile string            `env:"DEFAULT_TIMEZONE_PROFILE"` // アップロード時に使用する既定のプロファイル名
+	StorageTimezone        string            `env:"STORAGE_TIMEZONE"`         // 確定時刻を保存する際のタイムゾーン(IANA形式)
+
+	MarketHolidays []string `env:"MARKET_HOLIDAYS"` // 週末以外の休場日(サーバー時間のyyyy-MM-dd)。網羅状況の集計で欠損とみなさない
+
+	APIKeys       []apiKeyConfig `env:"API_KEYS"`        // 認証に使用するAPIキー(APIKeys, JWTSecretがどちらも未指定の場合は認証を行わない)
+	JWTSecret     string         `env:"JWT_SECRET"`      // HS256で署名したJWTを検証する共通鍵
+	JWTSecretFile string         `env:"JWT_SECRET_FILE"` // JWTSecretを読み込むファイル。指定した場合はJWTSecretより優先する
+	JWTIssuer     string         `env:"JWT_ISSUER"`      // 指定した場合、JWTのissが一致することを検証する
+
+	Language string `env:"LANGUAGE"` // エラーメッセージの言語(ja, en)。ログに使用し、APIではAccept-Languageで指定がない場合に使用する
+
+	AllowedOrigins []string `env:"ALLOWED_ORIGINS"` // WebSocketの接続を許可する他のオリジン(https://example.com形式、*は全て)。未指定の場合は同一オリジンのみ
+}
+
+type (
+	// configLoader コマンドライン引数・環境変数・設定ファイルから設定を読み込む
+	// SIGHUPで再読み込みする際も、起動時と同じ引数で読み込み直す
+	configLoader struct {
+		path  string            // -configで指定された設定ファイルのパス
+		flags []configFlagValue // コマンドラインで指定された値(指定された順)
+	}
+
+	// configFlagValue コマンドラインで指定された設定の値
+	configFlagValue struct {
+		field string
+		value string
+	}
+)
+
+// defaultConfig 既定値の設定を返却する
+func defaultConfig() *config {
+	return &config{
+		DBAddress:              "localhost",
+		DBPort:                 3306,
+		ServerPort:             8080,
+		StoreType:              StoreTypeMySQL,
+		SQLitePath:             defaultSQLitePath,
+		DefaultTimezoneProfile: defaultTimezoneProfile,
+		StorageTimezone:        defaultStorageTimezone,
+		Language:               LanguageJapanese,
+	}
+}
+
+// newConfigLoader 設定の各項目のフラグと-configをフラグセットに登録し、configLoaderをnewする
+// サブコマンドは自身のフラグを同じフラグセットに登録したうえでParseする
+func newConfigLoader(flags *flag.FlagSet) *configLoader {
+	loader := &configLoader{}
+	flags.StringVar(&loader.path, "config", "",
+		fmt.Sprintf("設定ファイルのパス(.json, .yaml, .yml, .toml)。未指定の場合は環境変数%s、%s", configPathEnv, defaultConfigPath))
+
+	t := reflect.TypeOf(config{})
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		env := field.Tag.Get("env")
+		flags.Func(configFlagName(env), fmt.Sprintf("%s(環境変数%s%s)", field.Name, configEnvPrefix, env), func(value string) error {
+			loader.flags = append(loader.flags, configFlagValue{field: field.Name, value: value})
+			return nil
+		})
+	}
+	return loader
+}
+
+// configFlagName envタグの名前をフラグ名に変換する(SERVER_PORT → server-port)
+func configFlagName(env string) string {
+	return strings.ToLower(strings.ReplaceAll(env, "_", "-"))
+}
+
+// load 既定値、設定ファイル、環境変数、コマンドラインフラグの順に読み込み、検証した設定を返却する
+func (loader *configLoader) load() (*config, error) {
+	c := defaultConfig()
+	problems := make([]string, 0)
+
+	path, required := loader.path, true
+	if path == "" {
+		path, required = os.Getenv(configPathEnv), true
+	}
+	if path == "" {
+		path, required = defaultConfigPath, false
+	}
+	err := c.readFile(path)
+	if errors.Is(err, os.ErrNotExist) && !required {
+		err = nil
+	}
+	if err != nil {
+		return nil, ErrInvalidConfig{problems: []string{fmt.Sprintf("%s: %v", path, err)}}
+	}
+
+	t := reflect.TypeOf(*c)
+	for i := 0; i < t.NumField(); i++ {
+		name := configEnvPrefix + t.Field(i).Tag.Get("env")
+		if value, ok := os.LookupEnv(name); ok {
+			if err := c.set(t.Field(i).Name, value); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %v", name, err))
+			}
+		}
+	}
+
+	for _, flagValue := range loader.flags {
+		if err := c.set(flagValue.field, flagValue.value); err != nil {
+			env := configFlagName(reflectField(flagValue.field).Tag.Get("env"))
+			problems = append(problems, fmt.Sprintf("-%s: %v", env, err))
+		}
+	}
+
+	problems = append(problems, c.readSecrets()...)
+	problems = append(problems, c.validate()...)
+	if len(problems) > 0 {
+		return nil, ErrInvalidConfig{problems: problems}
+	}
+	return c, nil
+}
+
+// readFile 設定ファイルを読み込む(形式は拡張子で判別し、JSON以外はJSONに変換してから読み込む)
+// 項目名の大文字・小文字は区別せず、存在しない項目はエラーとする
+func (c *config) readFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var values map[string]interface{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &values)
+	case ".toml":
+		err = toml.Unmarshal(data, &values)
+	case ".json":
+		err = json.Unmarshal(data, &values)
+	default:
+		return fmt.Errorf("対応していない形式です。拡張子には.json, .yaml, .yml, .tomlのいずれかを指定してください")
+	}
+	if err != nil {
+		return err
+	}
+
+	data, err = json.Marshal(normalizeConfigValue(values))
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(c)
+}
+
+// normalizeConfigValue YAML・TOMLで日付として読み込まれた値を、文字列(yyyy-MM-dd)に戻す
+// (MarketHolidaysを引用符なしの2024-01-01で記述できるようにする)
+func normalizeConfigValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, element := range v {
+			v[key] = normalizeConfigValue(element)
+		}
+	case []interface{}:
+		for i, element := range v {
+			v[i] = normalizeConfigValue(element)
+		}
+	case time.Time:
+		return v.Format(holidayLayout)
+	}
+	return value
+}
+
+// set 環境変数・フラグで指定された文字列を項目の型に変換して設定する
+// 一覧はカンマ区切り、構造体の一覧(TimezoneProfiles, APIKeys)はJSONで指定する
+func (c *config) set(fieldName string, value string) error {
+	field := reflect.ValueOf(c).Elem().FieldByName(fieldName)
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+
+	case reflect.Int:
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("整数を指定してください")
+		}
+		field.SetInt(int64(n))
+
+	case reflect.Slice:
+		if field.Type().Elem().Kind() == reflect.String {
+			values := make([]string, 0)
+			for _, v := range strings.Split(value, ",") {
+				if v = strings.TrimSpace(v); v != "" {
+					values = append(values, v)
+				}
+			}
+			field.Set(reflect.ValueOf(values))
+			return nil
+		}
+		decoded := reflect.New(field.Type())
+		if err := json.Unmarshal([]byte(value), decoded.Interface()); err != nil {
+			return fmt.Errorf("JSONの配列を指定してください")
+		}
+		field.Set(decoded.Elem())
+	}
+	return nil
+}
+
+// readSecrets *Fileで指定されたファイルから秘密情報を読み込む(末尾の改行は除く)
+func (c *config) readSecrets() []string {
+	problems := make([]string, 0)
+	secrets := []struct {
+		name  string
+		path  string
+		value *string
+	}{
+		{"DBUserPassFile", c.DBUserPassFile, &c.DBUserPass},
+		{"JWTSecretFile", c.JWTSecretFile, &c.JWTSecret},
+	}
+	for _, secret := range secrets {
+		if secret.path == "" {
+			continue
+		}
+		data, err := os.ReadFile(secret.path)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", secret.name, err))
+			continue
+		}
+		*secret.value = strings.TrimRight(string(data), "\r\n")
+	}
+	return problems
+}
+
+// validate 設定を検証し、問題の一覧を返却する
+// タイムゾーンプロファイル・休場日・APIキーの内容は、それぞれを生成する際に検証する
+func (c *config) validate() []string {
+	problems := make([]string, 0)
+	if c.ServerPort < 1 || 65535 < c.ServerPort {
+		problems = append(problems, "ServerPort: 1〜65535の範囲で指定してください")
+	}
+
+	switch c.StoreType {
+	case StoreTypeMySQL:
+		if c.DBPort < 1 || 65535 < c.DBPort {
+			problems = append(problems, "DBPort: 1〜65535の範囲で指定してください")
+		}
+		if c.DBAddress == "" || c.DBUserName == "" || c.DatabaseName == "" {
+			problems = append(problems, "DBAddress, DBUserName, DatabaseName: StoreTypeがmysqlの場合は必ず指定してください")
+		}
+	case StoreTypeSQLite:
+		if c.SQLitePath == "" {
+			problems = append(problems, "SQLitePath: StoreTypeがsqliteの場合は必ず指定してください")
+		}
+	case StoreTypeMemory:
+	default:
+		problems = append(problems, "StoreType: "+ErrInvalidStoreType{}.Error())
+	}
+
+	if c.MySQLLoadDataThreshold < 0 {
+		problems = append(problems, "MySQLLoadDataThreshold: 0以上の整数を指定してください")
+	}
+	if _, err := time.LoadLocation(c.StorageTimezone); err != nil {
+		problems = append(problems, "StorageTimezone: IANA形式のタイムゾーン名を指定してください")
+	}
+	if _, err := checkLanguage(c.Language); err != nil {
+		problems = append(problems, "Language: "+err.Error())
+	}
+	return problems
+}
+
+// reflectField config構造体の項目を返却する
+func reflectField(name string) reflect.StructField {
+	field, _ := reflect.TypeOf(config{}).FieldByName(name)
+	return field
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"flag"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// loadTestConfig 一時ディレクトリに書き出した設定ファイルと、コマンドライン引数から設定を読み込む
+func loadTestConfig(t *testing.T, fileName string, content string, args ...string) (*config, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), fileName)
+	err := os.WriteFile(path, []byte(content), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	loader := newConfigLoader(flags)
+	err = flags.Parse(append([]string{"-config", path}, args...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loader.load()
+}
+
+func TestConfigLoaderLayering(t *testing.T) {
+	t.Setenv(configEnvPrefix+"DB_PORT", "3308")
+	t.Setenv(configEnvPrefix+"SERVER_PORT", "9001")
+	t.Setenv(configEnvPrefix+"MARKET_HOLIDAYS", "2023-12-25, 2024-01-01")
+
+	files := []struct {
+		name    string
+		content string
+	}{
+		{"config.json", `{"ServerPort": 9000, "DBPort": 3307, "DBUserName": "file", "Language": "en", "storetype": "memory"}`},
+		{"config.yaml", "ServerPort: 9000\nDBPort: 3307\nDBUserName: file\nLanguage: en\nStoreType: memory\n"},
+		{"config.toml", "ServerPort = 9000\nDBPort = 3307\nDBUserName = \"file\"\nLanguage = \"en\"\nStoreType = \"memory\"\n"},
+	}
+
+	for _, file := range files {
+		c, err := loadTestConfig(t, file.name, file.content, "-server-port", "9002", "-db-user-name", "flag")
+		if err != nil {
+			t.Fatalf("%s: load returned %v", file.name, err)
+		}
+
+		tests := []struct {
+			field string
+			got   interface{}
+			want  interface{}
+		}{
+			{"DBAddress", c.DBAddress, "localhost"},                                    // 既定値
+			{"Language", c.Language, LanguageEnglish},                                  // 設定ファイル
+			{"StoreType", c.StoreType, StoreTypeMemory},                                // 設定ファイル(項目名の大文字・小文字は区別しない)
+			{"DBPort", c.DBPort, 3308},                                                 // 環境変数が設定ファイルより優先
+			{"ServerPort", c.ServerPort, 9002},                                         // フラグが環境変数・設定ファイルより優先
+			{"DBUserName", c.DBUserName, "flag"},                                       // フラグが設定ファイルより優先
+			{"MarketHolidays", c.MarketHolidays, []string{"2023-12-25", "2024-01-01"}}, // カンマ区切り
+		}
+		for _, test := range tests {
+			if !reflect.DeepEqual(test.got, test.want) {
+				t.Errorf("%s: %s = %v, want %v", file.name, test.field, test.got, test.want)
+			}
+		}
+	}
+}
+
+func TestConfigLoaderReadsSecretFiles(t *testing.T) {
+	dir := t.TempDir()
+	secretPath := filepath.Join(dir, "jwt_secret")
+	err := os.WriteFile(secretPath, []byte("from-file\r\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(configEnvPrefix+"JWT_SECRET_FILE", secretPath)
+
+	// *_FILEを指定した場合は、ファイルの内容(末尾の改行を除く)を優先する
+	c, err := loadTestConfig(t, "config.json", `{"StoreType": "memory", "JWTSecret": "from-config"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.JWTSecret != "from-file" {
+		t.Errorf("JWTSecret = %q, want %q", c.JWTSecret, "from-file")
+	}
+
+	_, err = loadTestConfig(t, "config.json", `{"StoreType": "memory"}`,
+		"-db-user-pass-file", filepath.Join(dir, "missing"))
+	problems := configProblems(t, err)
+	if len(problems) != 1 || !strings.HasPrefix(problems[0], "DBUserPassFile: ") {
+		t.Errorf("problems = %q, want a DBUserPassFile problem", problems)
+	}
+}
+
+func TestConfigLoaderReportsProblems(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		args    []string
+		env     map[string]string
+		want    []string // 各問題に含まれる文字列(順序も検証する)
+	}{
+		{"valid", "config.json", `{"StoreType": "memory"}`, nil, nil, nil},
+		{"unknown field", "config.json", `{"StoreType": "memory", "Port": 1}`, nil, nil, []string{"config.json: "}},
+		{"unsupported format", "config.ini", "StoreType=memory", nil, nil, []string{"config.ini: "}},
+		{"all problems at once", "config.json", `{"StoreType": "memory"}`,
+			[]string{"-server-port", "0", "-language", "fr", "-mysql-load-data-threshold", "-1"},
+			map[string]string{configEnvPrefix + "STORAGE_TIMEZONE": "Nowhere/City"},
+			[]string{"ServerPort: ", "MySQLLoadDataThreshold: ", "StorageTimezone: ", "Language: "}},
+		{"invalid integer", "config.json", `{"StoreType": "memory"}`, []string{"-db-port", "abc"}, nil,
+			[]string{"-db-port: "}},
+		{"invalid list", "config.json", `{"StoreType": "memory"}`, nil,
+			map[string]string{configEnvPrefix + "API_KEYS": "secret"}, []string{configEnvPrefix + "API_KEYS: "}},
+		{"mysql requires connection", "config.json", `{"StoreType": "mysql", "DBPort": 70000}`, nil, nil,
+			[]string{"DBPort: ", "DBAddress, DBUserName, DatabaseName: "}},
+		{"sqlite requires path", "config.json", `{"StoreType": "sqlite", "SQLitePath": ""}`, nil, nil,
+			[]string{"SQLitePath: "}},
+		{"unknown store", "config.json", `{"StoreType": "redis"}`, nil, nil, []string{"StoreType: "}},
+	}
+
+	for _, test := range tests {
+		for name, value := range test.env {
+			t.Setenv(name, value)
+		}
+		_, err := loadTestConfig(t, test.file, test.content, test.args...)
+		for name := range test.env {
+			os.Unsetenv(name)
+		}
+
+		if test.want == nil {
+			if err != nil {
+				t.Errorf("%s: load returned %v", test.name, err)
+			}
+			continue
+		}
+		problems := configProblems(t, err)
+		if len(problems) != len(test.want) {
+			t.Errorf("%s: problems = %q, want %d problems", test.name, problems, len(test.want))
+			continue
+		}
+		for i, want := range test.want {
+			if !strings.Contains(problems[i], want) {
+				t.Errorf("%s: problem %q, want %q", test.name, problems[i], want)
+			}
+		}
+	}
+}
+
+// configProblems ErrInvalidConfigに含まれる問題の一覧を返却する
+func configProblems(t *testing.T, err error) []string {
+	t.Helper()
+	invalid, ok := err.(ErrInvalidConfig)
+	if !ok {
+		t.Fatalf("load returned %v, want ErrInvalidConfig", err)
+	}
+	return invalid.problems
+}
+
+func TestServerReload(t *testing.T) {
+	defer setLogLanguage(getLogLanguage())
+
+	started := defaultConfig()
+	settings, err := newRuntimeSettings(started)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &server{}
+	s.runtime.Store(settings)
+
+	// 実行中に変更できる項目を反映し、認証の有効・無効は切り替えない
+	reloaded := defaultConfig()
+	reloaded.Language = LanguageEnglish
+	reloaded.AllowedOrigins = []string{"https://app.example"}
+	reloaded.APIKeys = []apiKeyConfig{{Key: "secret", User: "alice", Role: RoleUploader}}
+	reloaded.ServerPort = 9000
+	err = s.reload(started, reloaded)
+	if err != nil {
+		t.Fatalf("reload returned %v", err)
+	}
+
+	current := s.settings()
+	if current == settings {
+		t.Fatal("reload did not replace the runtime settings")
+	}
+	if current.language != LanguageEnglish || getLogLanguage() != LanguageEnglish {
+		t.Errorf("language = %s, log language = %s, want en", current.language, getLogLanguage())
+	}
+	r := httptest.NewRequest("GET", "http://localhost:8080/api/replay/stream", nil)
+	r.Header.Set("Origin", "https://app.example")
+	if !current.origins.check(r) {
+		t.Error("reloaded origins do not allow https://app.example")
+	}
+	if current.auth != settings.auth {
+		t.Error("reload switched authentication without a restart")
+	}
+
+	// 不正な設定の場合は、置き換えずにエラーを返却する
+	invalid := defaultConfig()
+	invalid.AllowedOrigins = []string{"app.example"}
+	err = s.reload(started, invalid)
+	if _, ok := err.(ErrInvalidConfig); !ok {
+		t.Errorf("reload with an invalid origin returned %v, want ErrInvalidConfig", err)
+	}
+	if s.settings() != current {
+		t.Error("reload replaced the runtime settings with an invalid config")
+	}
+}
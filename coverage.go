@@ -0,0 +1,358 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// holidayLayout 休場日の指定形式(サーバー時間の日付)
+	holidayLayout = "2006-01-02"
+
+	// marketCloseHour 週末の休場の開始(金曜日)・終了(日曜日)時刻(ニューヨーク時間)
+	marketCloseHour = 17
+
+	// maxReportedMissingRanges レスポンスに含める欠損期間の最大件数
+	maxReportedMissingRanges = 1000
+)
+
+// marketLocation 週末の休場の基準とする地域
+var marketLocation = mustLoadLocation("America/New_York")
+
+type (
+	// marketHolidays 週末以外の休場日(サーバー時間の日付)
+	marketHolidays map[string]struct{}
+
+	// MissingRange 連続して欠損しているローソク足の期間(両端は欠損している足の確定時刻)
+	// 途中の休場期間は期間を区切らない
+	MissingRange struct {
+		From  string `json:"from"`
+		To    string `json:"to"`
+		Count int    `json:"count"`
+	}
+
+	// MonthlyCoverage サーバー時間の月ごとの本数
+	MonthlyCoverage struct {
+		Month    string `json:"month"` // yyyy-MM
+		Expected int    `json:"expected"`
+		Actual   int    `json:"actual"`
+		Missing  int    `json:"missing"`
+	}
+
+	// Coverage 通貨ペア・時間軸ごとのデータの網羅状況
+	Coverage struct {
+		PairName      string            `json:"pairName"`
+		TimeType      int               `json:"timeType"`
+		First         string            `json:"first"`         // 最も古い確定時刻
+		Last          string            `json:"last"`          // 最も新しい確定時刻
+		Expected      int               `json:"expected"`      // 休場期間を除いて、FirstからLastまでに存在するはずの本数
+		Actual        int               `json:"actual"`        // 実際に登録されている本数
+		Missing       int               `json:"missing"`       // 存在するはずだが登録されていない本数
+		Unexpected    int               `json:"unexpected"`    // 休場期間中、もしくは時間軸の区切りと一致しない本数
+		Ratio         float64           `json:"ratio"`         // 網羅率(Expectedのうち登録されている割合)
+		MissingRanges []MissingRange    `json:"missingRanges"` // 最大maxReportedMissingRanges件
+		Truncated     bool              `json:"truncated"`     // 件数の上限によりMissingRangesを省略した場合はtrue
+		Months        []MonthlyCoverage `json:"months"`
+	}
+
+	ApiResponseGetCoverage struct {
+		Status   ApiResponseStatus `json:"status"`
+		Coverage *Coverage         `json:"coverage"`
+	}
+
+	// coverageCounter 確定時刻の昇順に並んだローソク足から、網羅状況を集計する
+	coverageCounter struct {
+		coverage *Coverage
+		timeType TimeType
+		duration time.Duration
+		profile  *timezoneProfile
+		holidays marketHolidays
+		cursor   time.Time // 次に存在するはずの足の開始時刻(サーバー時間)
+		started  bool
+		missing  *MissingRange
+		months   map[string]int
+	}
+)
+
+// mustLoadLocation タイムゾーンを読み込む(組み込みのtzdataを使用するため失敗しない)
+func mustLoadLocation(name string) *time.Location {
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		panic(err)
+	}
+	return location
+}
+
+// newMarketHolidays 休場日の一覧を検証し、marketHolidaysを生成する
+func newMarketHolidays(dates []string) (marketHolidays, error) {
+	holidays := make(marketHolidays)
+	return holidays, holidays.add(dates)
+}
+
+// add 休場日を追加する
+func (h marketHolidays) add(dates []string) error {
+	for _, date := range dates {
+		date = strings.TrimSpace(date)
+		if date == "" {
+			continue
+		}
+		_, err := time.Parse(holidayLayout, date)
+		if err != nil {
+			return ErrInvalidHoliday{}
+		}
+		h[date] = struct{}{}
+	}
+	return nil
+}
+
+// with 休場日を追加した写しを返却する
+func (h marketHolidays) with(dates []string) (marketHolidays, error) {
+	holidays := make(marketHolidays)
+	for date := range h {
+		holidays[date] = struct{}{}
+	}
+	return holidays, holidays.add(dates)
+}
+
+// inWeekendClosure 指定した期間全体が週末の休場期間(金曜日17時〜日曜日17時 ニューヨーク時間)に含まれるかを返却する
+func inWeekendClosure(open time.Time, end time.Time) bool {
+	local := open.In(marketLocation)
+	daysSinceFriday := (int(local.Weekday()) - int(time.Friday) + 7) % 7
+	closeTime := time.Date(local.Year(), local.Month(), local.Day()-daysSinceFriday, marketCloseHour, 0, 0, 0, marketLocation)
+	if closeTime.After(local) {
+		closeTime = closeTime.AddDate(0, 0, -7)
+	}
+	reopenTime := closeTime.AddDate(0, 0, 2)
+	return !end.After(reopenTime)
+}
+
+// newCoverageCounter coverageCounterをnewする
+func newCoverageCounter(
+	pairName string,
+	timeType TimeType,
+	profile *timezoneProfile,
+	holidays marketHolidays) (*coverageCounter, error) {
+
+	duration, err := timeType.getDuration()
+	if err != nil {
+		return nil, err
+	}
+
+	return &coverageCounter{
+		coverage: &Coverage{
+			PairName:      pairName,
+			TimeType:      timeType.toInt(),
+			MissingRanges: make([]MissingRange, 0),
+			Months:        make([]MonthlyCoverage, 0),
+		},
+		timeType: timeType,
+		duration: duration,
+		profile:  profile,
+		holidays: holidays,
+		months:   make(map[string]int),
+	}, nil
+}
+
+// serverWallTime 保存用タイムゾーンの時刻を、サーバー時間の壁時計の時刻(UTCとして表現)に変換する
+func (c *coverageCounter) serverWallTime(t time.Time) time.Time {
+	server := c.profile.toServerTime(t)
+	return time.Date(server.Year(), server.Month(), server.Day(), server.Hour(), server.Minute(), 0, 0, time.UTC)
+}
+
+// next サーバー時間で次の足の開始時刻を返却する
+func (c *coverageCounter) next(wall time.Time) time.Time {
+	switch c.timeType {
+	case Daily:
+		return wall.AddDate(0, 0, 1)
+	case Weekly:
+		return wall.AddDate(0, 0, 7)
+	}
+	return wall.Add(c.duration)
+}
+
+// expected サーバー時間のwallから始まる足が存在するはずかを返却する
+func (c *coverageCounter) expected(wall time.Time) bool {
+	if _, ok := c.holidays[wall.Format(holidayLayout)]; ok && c.timeType != Weekly {
+		return false
+	}
+	open := c.profile.toStorageTime(wall)
+	return !inWeekendClosure(open, open.Add(c.next(wall).Sub(wall)))
+}
+
+// month サーバー時間の月の集計を返却する
+func (c *coverageCounter) month(wall time.Time) *MonthlyCoverage {
+	key := wall.Format("2006-01")
+	index, ok := c.months[key]
+	if !ok {
+		index = len(c.coverage.Months)
+		c.months[key] = index
+		c.coverage.Months = append(c.coverage.Months, MonthlyCoverage{Month: key})
+	}
+	return &c.coverage.Months[index]
+}
+
+// closeMissing 集計中の欠損期間を確定する
+func (c *coverageCounter) closeMissing() {
+	if c.missing == nil {
+		return
+	}
+	if len(c.coverage.MissingRanges) < maxReportedMissingRanges {
+		c.coverage.MissingRanges = append(c.coverage.MissingRanges, *c.missing)
+	} else {
+		c.coverage.Truncated = true
+	}
+	c.missing = nil
+}
+
+// add 確定時刻の昇順に、登録されているローソク足を1本ずつ集計する
+func (c *coverageCounter) add(candle Candle) error {
+	fixTime, err := c.profile.parseFixTime(candle.Time)
+	if err != nil {
+		return err
+	}
+	wall := c.serverWallTime(fixTime)
+
+	if !c.started {
+		c.started = true
+		c.cursor = wall
+		c.coverage.First = candle.Time
+	}
+	c.coverage.Last = candle.Time
+	c.coverage.Actual++
+
+	// 登録されている足までの間で、存在するはずの足を欠損として数える
+	for c.cursor.Before(wall) {
+		if c.expected(c.cursor) {
+			fixTime := c.profile.toStorageTime(c.cursor).Format(fixTimeLayout)
+			if c.missing == nil {
+				c.missing = &MissingRange{From: fixTime}
+			}
+			c.missing.To = fixTime
+			c.missing.Count++
+
+			c.coverage.Expected++
+			c.coverage.Missing++
+			month := c.month(c.cursor)
+			month.Expected++
+			month.Missing++
+		}
+		c.cursor = c.next(c.cursor)
+	}
+
+	month := c.month(wall)
+	month.Actual++
+	if !c.cursor.Equal(wall) || !c.expected(wall) {
+		// 時間軸の区切りと一致しない足は、次に存在するはずの足の位置を進めない
+		c.coverage.Unexpected++
+		if c.cursor.Equal(wall) {
+			c.cursor = c.next(c.cursor)
+		}
+		return nil
+	}
+
+	c.closeMissing()
+	c.coverage.Expected++
+	month.Expected++
+	c.cursor = c.next(c.cursor)
+	return nil
+}
+
+// finish 集計を終了し、網羅状況を返却する
+func (c *coverageCounter) finish() *Coverage {
+	c.closeMissing()
+	if c.coverage.Expected > 0 {
+		c.coverage.Ratio = float64(c.coverage.Expected-c.coverage.Missing) / float64(c.coverage.Expected)
+	}
+	return c.coverage
+}
+
+// analyzeCoverage 指定期間(両端を含む)に登録されているローソク足の網羅状況を集計する
+// 期待する本数は、期間内で最も古い足から最も新しい足までの間で、週末と休場日を除いて数える
+func (action) analyzeCoverage(
+	store CandleStore,
+	pairName string,
+	timeType TimeType,
+	from string,
+	to string,
+	profile *timezoneProfile,
+	holidays marketHolidays) (*Coverage, error) {
+
+	counter, err := newCoverageCounter(pairName, timeType, profile, holidays)
+	if err != nil {
+		return nil, err
+	}
+
+	err = store.eachCandle(pairName, timeType, from, to, counter.add)
+	if err != nil {
+		return nil, err
+	}
+	return counter.finish(), nil
+}
+
+// handleCoverage 通貨ペア・時間軸ごとの最初と最後の確定時刻、期待する本数と実際の本数、欠損期間を返却する
+// x-holidaysヘッダーで、設定ファイルのMarketHolidaysに加える休場日(yyyy-MM-dd)をカンマ区切りで指定できる
+func (s *server) handleCoverage(w http.ResponseWriter, r *http.Request) {
+	supportedParams := []string{"*"}
+	supportedMethods := []string{
+		"GET",
+		"OPTIONS",
+	}
+	if handleCORS(w, r, supportedParams, supportedMethods) {
+		return
+	}
+
+	writeResponse := func(err error, coverage *Coverage) {
+		status := newApiResponseStatus(r, err)
+		writeApiResponse(w, r, err, ApiResponseGetCoverage{Status: status, Coverage: coverage})
+	}
+
+	pairName := requestParam(r, "x-pair-name")
+	err := Utils.checkPairName(pairName)
+	if err != nil {
+		writeResponse(err, nil)
+		return
+	}
+
+	timeTypeName := requestParam(r, "x-time-type")
+	timeType, err := Utils.getTimeType(timeTypeName)
+	if err != nil {
+		writeResponse(err, nil)
+		return
+	}
+
+	profile, err := s.timezones.resolve(requestParam(r, "x-timezone-profile"))
+	if err != nil {
+		writeResponse(err, nil)
+		return
+	}
+
+	holidays, err := s.settings().holidays.with(strings.Split(requestParam(r, "x-holidays"), ","))
+	if err != nil {
+		writeResponse(err, nil)
+		return
+	}
+
+	// 期間の指定は任意(未指定の場合は全期間を集計する)
+	from, to := requestParam(r, "x-from"), requestParam(r, "x-to")
+	for _, fixTime := range []string{from, to} {
+		if fixTime == "" {
+			continue
+		}
+		err = Utils.checkFixedTime(fixTime)
+		if err != nil {
+			writeResponse(err, nil)
+			return
+		}
+	}
+	from = Utils.getStringOrDefault(from, minFixTime)
+	to = Utils.getStringOrDefault(to, maxFixTime)
+
+	coverage, err := Action.analyzeCoverage(s.storeOf(r), pairName, timeType, from, to, profile, holidays)
+	if err != nil {
+		writeResponse(err, nil)
+		return
+	}
+
+	writeResponse(nil, coverage)
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestInWeekendClosure(t *testing.T) {
+	// 2023-01-06は金曜日(ニューヨークは冬時間のため、17時はUTCの22時)
+	utc := func(day int, hour int, minute int) time.Time {
+		return time.Date(2023, 1, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name string
+		open time.Time
+		end  time.Time
+		want bool
+	}{
+		{"before friday close", utc(6, 21, 0), utc(6, 22, 0), false},
+		{"straddles friday close", utc(6, 21, 30), utc(6, 22, 30), false},
+		{"at friday close", utc(6, 22, 0), utc(6, 23, 0), true},
+		{"saturday", utc(7, 0, 0), utc(8, 0, 0), true},
+		{"ends at sunday reopen", utc(8, 21, 0), utc(8, 22, 0), true},
+		{"at sunday reopen", utc(8, 22, 0), utc(8, 23, 0), false},
+		{"straddles sunday reopen", utc(8, 21, 30), utc(8, 22, 30), false},
+		{"whole weekend and more", utc(6, 22, 0), utc(9, 0, 0), false},
+		{"wednesday", utc(4, 12, 0), utc(4, 13, 0), false},
+		// ニューヨークの夏時間開始後(2023-03-12以降)は、17時がUTCの21時になる
+		{"friday close in summer time", time.Date(2023, 3, 17, 21, 0, 0, 0, time.UTC), time.Date(2023, 3, 17, 22, 0, 0, 0, time.UTC), true},
+		{"before friday close in summer time", time.Date(2023, 3, 17, 20, 0, 0, 0, time.UTC), time.Date(2023, 3, 17, 21, 0, 0, 0, time.UTC), false},
+	}
+
+	for _, test := range tests {
+		got := inWeekendClosure(test.open, test.end)
+		if got != test.want {
+			t.Errorf("%s: inWeekendClosure(%v, %v) = %t, want %t", test.name, test.open, test.end, got, test.want)
+		}
+	}
+}
+
+func TestCoverageCounter(t *testing.T) {
+	registry := newTestTimezoneRegistry(t)
+	profile := resolveTestProfile(t, registry, "XM")
+	// サーバー時間(yyyy-MM-dd HH:mm)の足を、保存用タイムゾーンの確定時刻のローソク足にする
+	candles := func(serverTimes ...string) []Candle {
+		result := make([]Candle, len(serverTimes))
+		for i, serverTime := range serverTimes {
+			wall, err := time.Parse("2006-01-02 15:04", serverTime)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result[i] = Candle{Time: profile.toStorageTime(wall).Format(fixTimeLayout)}
+		}
+		return result
+	}
+	storage := func(serverTime string) string { return candles(serverTime)[0].Time }
+
+	tests := []struct {
+		name          string
+		timeType      TimeType
+		holidays      []string
+		candles       []Candle
+		expected      int
+		missing       int
+		unexpected    int
+		missingRanges []MissingRange
+	}{
+		{
+			// XMのサーバー時間の0時は、ニューヨークの17時と一致する
+			name:     "weekend is not missing",
+			timeType: H1,
+			candles: candles("2023-01-06 22:00", "2023-01-06 23:00",
+				"2023-01-09 00:00", "2023-01-09 01:00"),
+			expected:      4,
+			missingRanges: []MissingRange{},
+		},
+		{
+			name:     "missing ranges are not split by the weekend",
+			timeType: H1,
+			candles:  candles("2023-01-06 22:00", "2023-01-09 01:00"),
+			expected: 4,
+			missing:  2,
+			missingRanges: []MissingRange{
+				{From: storage("2023-01-06 23:00"), To: storage("2023-01-09 00:00"), Count: 2},
+			},
+		},
+		{
+			name:          "candle inside the weekend",
+			timeType:      H1,
+			candles:       candles("2023-01-06 23:00", "2023-01-07 10:00", "2023-01-09 00:00"),
+			expected:      2,
+			unexpected:    1,
+			missingRanges: []MissingRange{},
+		},
+		{
+			// 欧州より先にニューヨークが夏時間になる期間は、サーバー時間の23時に休場が始まる
+			name:          "closure shifted by daylight saving time",
+			timeType:      H1,
+			candles:       candles("2023-03-17 22:00", "2023-03-19 23:00", "2023-03-20 00:00"),
+			expected:      3,
+			missingRanges: []MissingRange{},
+		},
+		{
+			name:          "daily candles skip weekend",
+			timeType:      Daily,
+			candles:       candles("2023-01-06 00:00", "2023-01-09 00:00"),
+			expected:      2,
+			missingRanges: []MissingRange{},
+		},
+		{
+			name:          "holiday is not missing",
+			timeType:      Daily,
+			holidays:      []string{"2023-01-09"},
+			candles:       candles("2023-01-06 00:00", "2023-01-10 00:00"),
+			expected:      2,
+			missingRanges: []MissingRange{},
+		},
+		{
+			name:     "missing day without holiday",
+			timeType: Daily,
+			candles:  candles("2023-01-06 00:00", "2023-01-10 00:00"),
+			expected: 3,
+			missing:  1,
+			missingRanges: []MissingRange{
+				{From: storage("2023-01-09 00:00"), To: storage("2023-01-09 00:00"), Count: 1},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		holidays, err := newMarketHolidays(test.holidays)
+		if err != nil {
+			t.Fatal(err)
+		}
+		counter, err := newCoverageCounter("EURUSD", test.timeType, profile, holidays)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, c := range test.candles {
+			err = counter.add(c)
+			if err != nil {
+				t.Fatalf("%s: add returned %v", test.name, err)
+			}
+		}
+
+		got := counter.finish()
+		if got.Expected != test.expected || got.Missing != test.missing || got.Unexpected != test.unexpected {
+			t.Errorf("%s: expected %d, missing %d, unexpected %d, want %d, %d, %d", test.name,
+				got.Expected, got.Missing, got.Unexpected, test.expected, test.missing, test.unexpected)
+		}
+		if got.Actual != len(test.candles) {
+			t.Errorf("%s: actual %d, want %d", test.name, got.Actual, len(test.candles))
+		}
+		if !reflect.DeepEqual(got.MissingRanges, test.missingRanges) {
+			t.Errorf("%s: missing ranges %+v, want %+v", test.name, got.MissingRanges, test.missingRanges)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// dataTableNamePattern データテーブル名の規則(共有データセットは通貨ペア名、privateデータセットはP_利用者名_通貨ペア名)
+var dataTableNamePattern = regexp.MustCompile(`^(P_[A-Z0-9]{1,16}_)?[A-Z]{6}$`)
+
+// datasetStore 通貨ペア名に接頭辞を付けて、データセットごとにテーブルを分けるCandleStore
+// 接頭辞が空の場合は共有データセットとして、privateデータセットのテーブルを一覧から除外する
+type datasetStore struct {
+	CandleStore
+	prefix string
+}
+
+// privateDatasetPrefix 利用者のprivateデータセットのテーブル名の接頭辞を返却する
+func privateDatasetPrefix(userName string) string {
+	return "P_" + strings.ToUpper(userName) + "_"
+}
+
+// isDataTableName テーブル名がデータテーブルの規則に一致するかを返却する
+func isDataTableName(tableName string) bool {
+	return dataTableNamePattern.MatchString(tableName)
+}
+
+// newDatasetStore datasetStoreをnewする
+func newDatasetStore(store CandleStore, prefix string) *datasetStore {
+	return &datasetStore{CandleStore: store, prefix: prefix}
+}
+
+func (s *datasetStore) createDataTable(pairName string) error {
+	return s.CandleStore.createDataTable(s.prefix + pairName)
+}
+
+func (s *datasetStore) registerData(pairName string, timeType TimeType, candles []Candle, policy string) (registerResult, error) {
+	return s.CandleStore.registerData(s.prefix+pairName, timeType, candles, policy)
+}
+
+func (s *datasetStore) deleteData(pairName string, timeTypes []TimeType) error {
+	return s.CandleStore.deleteData(s.prefix+pairName, timeTypes)
+}
+
+func (s *datasetStore) deleteDataRange(pairName string, timeType TimeType, from string, to string) error {
+	return s.CandleStore.deleteDataRange(s.prefix+pairName, timeType, from, to)
+}
+
+func (s *datasetStore) replaceDataRange(pairName string, timeType TimeType, from string, to string, candles []Candle) error {
+	return s.CandleStore.replaceDataRange(s.prefix+pairName, timeType, from, to, candles)
+}
+
+func (s *datasetStore) queryCandles(pairName string, timeType TimeType, from string, to string) ([]Candle, error) {
+	return s.CandleStore.queryCandles(s.prefix+pairName, timeType, from, to)
+}
+
+func (s *datasetStore) eachCandle(pairName string, timeType TimeType, from string, to string, fn func(c Candle) error) error {
+	return s.CandleStore.eachCandle(s.prefix+pairName, timeType, from, to, fn)
+}
+
+func (s *datasetStore) queryCandleRange(pairName string, timeType TimeType, from string, to string, descending bool, limit int) ([]Candle, error) {
+	return s.CandleStore.queryCandleRange(s.prefix+pairName, timeType, from, to, descending, limit)
+}
+
+func (s *datasetStore) queryLatestCandles(pairName string, timeType TimeType, before string, limit int) ([]Candle, error) {
+	return s.CandleStore.queryLatestCandles(s.prefix+pairName, timeType, before, limit)
+}
+
+func (s *datasetStore) countCandles(pairName string, timeType TimeType, from string, to string) (int, error) {
+	return s.CandleStore.countCandles(s.prefix+pairName, timeType, from, to)
+}
+
+func (s *datasetStore) queryData(
+	pairName string,
+	lowerTimeType TimeType,
+	lowerFixTime string,
+	upperTimeType TimeType,
+	limit int) ([]Candle, error) {
+
+	return s.CandleStore.queryData(s.prefix+pairName, lowerTimeType, lowerFixTime, upperTimeType, limit)
+}
+
+func (s *datasetStore) queryDataSummary(pairName string, timeType TimeType) ([]string, []int32, error) {
+	return s.CandleStore.queryDataSummary(s.prefix+pairName, timeType)
+}
+
+func (s *datasetStore) getUploadedPairDetail(pairName string) (map[int]int, error) {
+	return s.CandleStore.getUploadedPairDetail(s.prefix + pairName)
+}
+
+// getUploadedPairNames このデータセットの通貨ペア名の一覧を、接頭辞を除いて返却する
+func (s *datasetStore) getUploadedPairNames() ([]string, error) {
+	tableNames, err := s.CandleStore.getUploadedPairNames()
+	if err != nil {
+		return nil, err
+	}
+
+	pairNames := make([]string, 0, len(tableNames))
+	for _, tableName := range tableNames {
+		if !strings.HasPrefix(tableName, s.prefix) {
+			continue
+		}
+		pairName := strings.TrimPrefix(tableName, s.prefix)
+		if Utils.checkPairName(pairName) != nil {
+			continue
+		}
+		pairNames = append(pairNames, pairName)
+	}
+	return pairNames, nil
+}
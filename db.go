@@ -1,28 +1,15 @@
 package main
 
 import (
+	"bufio"
 	"database/sql"
 	"fmt"
-	"log"
-	"strconv"
-	"strings"
+	"io"
 
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
 )
 
 const (
-	SQL_CREATE_DATA_TABLE = `
-		CREATE TABLE IF NOT EXISTS %s (
-			TIME_TYPE DECIMAL(1, 0),
-			FIX_TIME DATETIME,
-			HIGH_PRICE DECIMAL(8, 5),
-			OPEN_PRICE DECIMAL(8, 5),
-			CLOSE_PRICE DECIMAL(8, 5),
-			LOW_PRICE DECIMAL(8, 5),
-			PRIMARY KEY(TIME_TYPE,FIX_TIME)
-		)
-	`
-
 	SQL_INSERT_DATA = `
 		INSERT INTO %s (
 			TIME_TYPE,
@@ -30,21 +17,46 @@ const (
 			HIGH_PRICE,
 			OPEN_PRICE,
 			CLOSE_PRICE,
-			LOW_PRICE
+			LOW_PRICE,
+			TICK_VOLUME
 		) VALUES
 	`
 
-	SQL_DATA_TABLE_ON_DUPLICATE_KEY_UPDATE = `
-	  ON DUPLICATE KEY UPDATE
-		    TIME_TYPE = VALUES(TIME_TYPE),
-				FIX_TIME = VALUES(FIX_TIME)
+	// SQL_DATA_TABLE_ON_DUPLICATE_KEY_IGNORE 既に存在する確定時刻の行を変更しない(SQLiteのON CONFLICT DO NOTHINGに相当)
+	// 既存の行の更新は、重複の扱い(DuplicatePolicy*)に従ってSQL_UPDATE_DATAで明示的に行う
+	// (INSERT IGNOREは型変換などの他のエラーも警告に変えてしまうため使用しない)
+	SQL_DATA_TABLE_ON_DUPLICATE_KEY_IGNORE = `
+		ON DUPLICATE KEY UPDATE
+			TIME_TYPE = TIME_TYPE
+	`
+
+	SQL_UPDATE_DATA = `
+		UPDATE %s SET
+			HIGH_PRICE = ?,
+			OPEN_PRICE = ?,
+			CLOSE_PRICE = ?,
+			LOW_PRICE = ?,
+			TICK_VOLUME = ?
+		WHERE TIME_TYPE = ?
+			AND FIX_TIME = ?
+	`
+
+	SQL_LOAD_DATA = `
+		LOAD DATA LOCAL INFILE 'Reader::%s'
+		IGNORE INTO TABLE %s
+		FIELDS TERMINATED BY ','
+		LINES TERMINATED BY '\n'
+		(TIME_TYPE, FIX_TIME, HIGH_PRICE, OPEN_PRICE, CLOSE_PRICE, LOW_PRICE, TICK_VOLUME)
 	`
 
+	// mysqlMaxPlaceholders 1つの文に含められるプレースホルダーの最大数
+	mysqlMaxPlaceholders = 65535
+
 	SQL_QUERY_UPLOADED_PAIR_NAMES = `
 		SELECT TABLE_NAME FROM information_schema.tables
 		WHERE 1 = 1
 			AND TABLE_SCHEMA = 'fx_tester_db'
-			AND TABLE_NAME REGEXP '^[A-Z]{6}$'
+			AND TABLE_NAME REGEXP '^(P_[A-Z0-9]{1,16}_)?[A-Z]{6}$'
 	`
 
 	SQL_QUERY_UPLOADED_PAIR_DETAIL = `
@@ -59,8 +71,47 @@ const (
 			DELETE FROM %s WHERE TIME_TYPE in (%s)
 	`
 
+	SQL_DELETE_DATA_RANGE = `
+		DELETE FROM %s
+		WHERE TIME_TYPE = ?
+			AND FIX_TIME >= ?
+			AND FIX_TIME <= ?
+	`
+
+	SQL_QUERY_CANDLES = `
+		SELECT FIX_TIME, HIGH_PRICE, OPEN_PRICE, CLOSE_PRICE, LOW_PRICE, TICK_VOLUME FROM %s
+		WHERE TIME_TYPE = ?
+			AND FIX_TIME >= ?
+			AND FIX_TIME <= ?
+		ORDER BY FIX_TIME ASC
+	`
+
+	SQL_QUERY_CANDLE_RANGE = `
+		SELECT FIX_TIME, HIGH_PRICE, OPEN_PRICE, CLOSE_PRICE, LOW_PRICE, TICK_VOLUME FROM %s
+		WHERE TIME_TYPE = ?
+			AND FIX_TIME >= ?
+			AND FIX_TIME <= ?
+		ORDER BY FIX_TIME %s
+		LIMIT ?
+	`
+
+	SQL_QUERY_LATEST_CANDLES = `
+		SELECT FIX_TIME, HIGH_PRICE, OPEN_PRICE, CLOSE_PRICE, LOW_PRICE, TICK_VOLUME FROM %s
+		WHERE TIME_TYPE = ?
+			AND FIX_TIME < ?
+		ORDER BY FIX_TIME DESC
+		LIMIT ?
+	`
+
+	SQL_COUNT_CANDLES = `
+		SELECT COUNT(*) FROM %s
+		WHERE TIME_TYPE = ?
+			AND FIX_TIME >= ?
+			AND FIX_TIME <= ?
+	`
+
 	SQL_DATA_SUMMARY = `
-		SELECT FIX_TIME FROM %s
+		SELECT FIX_TIME, TICK_VOLUME FROM %s
 		WHERE TIME_TYPE = ?
 		ORDER BY FIX_TIME ASC
 	`
@@ -112,6 +163,7 @@ const (
 			, UDL.OPEN_PRICE
 			, (SELECT CLOSE_PRICE FROM LATEST_CALC_TARGETS ORDER BY FIX_TIME DESC LIMIT 1) AS CLOSE_PRICE
 			, (SELECT MAX(HIGH_PRICE) from LATEST_CALC_TARGETS) AS HIGH_PRICE
+			, (SELECT SUM(TICK_VOLUME) from LATEST_CALC_TARGETS) AS TICK_VOLUME
 		FROM UPPER_DATA_LATEST UDL
 		UNION ALL
 		SELECT
@@ -119,7 +171,8 @@ const (
 			LOW_PRICE,
 			OPEN_PRICE,
 			CLOSE_PRICE,
-			HIGH_PRICE
+			HIGH_PRICE,
+			TICK_VOLUME
 		FROM UPPER_DATA_LEGACY
 	`
 )
@@ -130,7 +183,8 @@ type (
 	db struct {
 		config           *config
 		impl             *sql.DB
-		maxAllowedPacket int
+		migrator         *migrator
+		maxAllowedPacket int // max_allowed_packet(バイト数)
 	}
 )
 
@@ -168,7 +222,7 @@ func (db *db) open() error {
 		return err
 	}
 
-	// バルクインサートの最大数を取得
+	// 1回に送信できるパケットの最大バイト数を取得
 	res, err := impl.Query("show variables like 'max_allowed_packet'")
 	if err != nil {
 		return err
@@ -184,15 +238,25 @@ func (db *db) open() error {
 		return err
 	}
 
-	// バルクインサートの最大数の不正値チェック
+	// パケットの最大バイト数の不正値チェック
 	if maxAllowedPacket <= 0 {
 		return ErrCannotGetMaxAllowedPacket{}
 	}
 
 	db.impl = impl
+	db.migrator = newMigrator(impl, StoreTypeMySQL)
 	db.maxAllowedPacket = maxAllowedPacket
 
-	return nil
+	// 既存のデータテーブルを最新のスキーマに更新(migrateコマンドで固定されたデータテーブルを除く)
+	err = db.migrator.prepare()
+	if err != nil {
+		return err
+	}
+	pairNames, err := db.getUploadedPairNames()
+	if err != nil {
+		return err
+	}
+	return db.migrator.upgradeAll(pairNames)
 }
 
 // close DBをクローズする
@@ -208,61 +272,77 @@ func (db *db) close() error {
 
 // begin トランザクションを開始する
 func (db *db) begin(transaction func(tx *sql.Tx) error) error {
-	log.Println("transaction started..")
-	tx, err := db.impl.Begin()
-	if err != nil {
-		return err
-	}
-
-	defer func() {
-		if res := recover(); res != nil {
-			tx.Rollback()
-			log.Println("transaction failed... ", res)
-		} else if err != nil {
-			tx.Rollback()
-			log.Println("transaction failed... ", err)
-		} else {
-			tx.Commit()
-			log.Println("transaction successed!!")
-		}
-	}()
-
-	err = transaction(tx)
-	return err
+	return beginTransaction(db.impl, transaction)
 }
 
 // createDataTable データテーブルを作成する
 func (db *db) createDataTable(pairName string) error {
-	sql := fmt.Sprintf(SQL_CREATE_DATA_TABLE, pairName)
-	_, err := db.impl.Exec(sql)
-	return err
+	return db.migrator.upgrade(pairName)
+}
+
+// migrateTo 全てのデータテーブルを指定したスキーマバージョンへ移行する
+func (db *db) migrateTo(targetVersion int) error {
+	pairNames, err := db.getUploadedPairNames()
+	if err != nil {
+		return err
+	}
+	return db.migrator.migrateAll(pairNames, targetVersion)
 }
 
 // registerData データテーブルにデータを挿入する
-func (db *db) registerData(tx *sql.Tx, pairName string, timeType TimeType, candles []Candle) error {
+// 新規に挿入する行数がMySQLLoadDataThreshold以上の場合はLOAD DATA LOCAL INFILEを使用する
+func (db *db) registerData(pairName string, timeType TimeType, candles []Candle, policy string) (registerResult, error) {
 	if timeType == Unknown {
-		return ErrInvalidTimeType{}
+		return registerResult{}, ErrInvalidTimeType{}
 	}
 
-	for i := 0; ; i += db.maxAllowedPacket {
-		numInsert := Utils.minInt(db.maxAllowedPacket, len(candles)-i)
-		if numInsert <= 0 {
-			break
-		}
+	var result registerResult
+	err := db.begin(func(tx *sql.Tx) error {
+		var err error
+		result, err = sqlRegisterData(tx, pairName, timeType, candles, policy, func(inserts []Candle) error {
+			if 0 < db.config.MySQLLoadDataThreshold && db.config.MySQLLoadDataThreshold <= len(inserts) {
+				return db.loadData(tx, pairName, timeType, inserts)
+			}
+			return sqlInsertData(tx, pairName, timeType, inserts, SQL_DATA_TABLE_ON_DUPLICATE_KEY_IGNORE, db.insertLimit())
+		})
+		return err
+	})
+	return result, err
+}
 
-		slice := candles[i : i+numInsert]
-		sql, err := makeInsertDataSql(pairName, timeType, slice)
-		if err != nil {
-			return err
-		}
+// insertLimit max_allowed_packetとプレースホルダー数の上限から、1回のINSERT文の上限を返却する
+func (db *db) insertLimit() insertBatchLimit {
+	return insertBatchLimit{
+		// パケットのヘッダー等の余裕を見て9割までとする
+		maxBytes: db.maxAllowedPacket / 10 * 9,
+		maxRows:  mysqlMaxPlaceholders / insertParamsPerRow,
+	}
+}
 
-		_, err = tx.Exec(sql)
-		if err != nil {
-			return err
-		}
+// loadData ローソク足をCSVとしてストリーミングし、LOAD DATA LOCAL INFILEで一括登録する
+// 既に存在する確定時刻の行はINSERTの場合と同様に登録しない
+func (db *db) loadData(tx *sql.Tx, pairName string, timeType TimeType, candles []Candle) error {
+	id, err := newSessionID()
+	if err != nil {
+		return err
 	}
 
-	return nil
+	reader, writer := io.Pipe()
+	go func() {
+		w := bufio.NewWriter(writer)
+		for _, c := range candles {
+			fmt.Fprintf(w, "%d,%s,%s,%s,%s,%s,%d\n", int(timeType), c.Time,
+				formatPrice(c.High), formatPrice(c.Open), formatPrice(c.Close), formatPrice(c.Low), c.TickVolume)
+		}
+		writer.CloseWithError(w.Flush())
+	}()
+
+	mysql.RegisterReaderHandler(id, func() io.Reader { return reader })
+	defer mysql.DeregisterReaderHandler(id)
+	defer reader.Close()
+
+	_, err = tx.Exec(fmt.Sprintf(SQL_LOAD_DATA, id, pairName))
+	return err
 }
 
 // getUploadedPairNames データがアップロードされている通貨ペア名の一覧を返却する
@@ -288,65 +368,50 @@ func (db *db) getUploadedPairNames() ([]string, error) {
 }
 
 func (db *db) getUploadedPairDetail(pairName string) (map[int]int, error) {
-	sql := fmt.Sprintf(SQL_QUERY_UPLOADED_PAIR_DETAIL, pairName)
-	res, err := db.impl.Query(sql)
-	if err != nil {
-		return nil, err
-	}
-	defer res.Close()
-
-	countTable := make(map[int]int)
-	for res.Next() {
-		var timeType int
-		var countData int
-		res.Scan(&timeType, &countData)
-
-		countTable[timeType] = countData
-	}
+	return sqlGetUploadedPairDetail(db.impl, pairName)
+}
 
-	return countTable, nil
+func (db *db) deleteData(pairName string, timeTypes []TimeType) error {
+	return db.begin(func(tx *sql.Tx) error {
+		return sqlDeleteData(tx, pairName, timeTypes)
+	})
 }
 
-func (db *db) deleteData(tx *sql.Tx, pairName string, timeTypes []TimeType) error {
+func (db *db) deleteDataRange(pairName string, timeType TimeType, from string, to string) error {
+	return db.begin(func(tx *sql.Tx) error {
+		return sqlDeleteDataRange(tx, pairName, timeType, from, to)
+	})
+}
 
-	inStatement := strings.Join(mapArray(timeTypes, func(v TimeType) string {
-		return strconv.FormatInt(int64(v), 10)
-	}), ",")
+// replaceDataRange 期間内の行の削除とローソク足の登録を、1つのトランザクションで行う
+func (db *db) replaceDataRange(pairName string, timeType TimeType, from string, to string, candles []Candle) error {
+	return db.begin(func(tx *sql.Tx) error {
+		return sqlReplaceDataRange(tx, pairName, timeType, from, to, candles, SQL_DATA_TABLE_ON_DUPLICATE_KEY_IGNORE, db.insertLimit())
+	})
+}
 
-	deleteDataSql := fmt.Sprintf(SQL_DELETE_DATA, pairName, inStatement)
-	_, err := tx.Exec(deleteDataSql)
-	if err != nil {
-		return err
-	}
+func (db *db) queryCandles(pairName string, timeType TimeType, from string, to string) ([]Candle, error) {
+	return sqlQueryCandles(db.impl, pairName, timeType, from, to)
+}
 
-	return nil
+func (db *db) eachCandle(pairName string, timeType TimeType, from string, to string, fn func(c Candle) error) error {
+	return sqlEachCandle(db.impl, pairName, timeType, from, to, fn)
 }
 
-func (db *db) queryDataSummary(pairName string, timeType TimeType) ([]string, error) {
-	sql := fmt.Sprintf(SQL_DATA_SUMMARY, pairName)
-	stmt, err := db.impl.Prepare(sql)
-	if err != nil {
-		return nil, err
-	}
-	defer stmt.Close()
+func (db *db) queryCandleRange(pairName string, timeType TimeType, from string, to string, descending bool, limit int) ([]Candle, error) {
+	return sqlQueryCandleRange(db.impl, pairName, timeType, from, to, descending, limit)
+}
 
-	row, err := stmt.Query(int(timeType))
-	if err != nil {
-		return nil, err
-	}
-	defer row.Close()
+func (db *db) queryLatestCandles(pairName string, timeType TimeType, before string, limit int) ([]Candle, error) {
+	return sqlQueryLatestCandles(db.impl, pairName, timeType, before, limit)
+}
 
-	fixTimes := make([]string, 0)
-	for row.Next() {
-		var fixTime string
-		err = row.Scan(&fixTime)
-		if err != nil {
-			return nil, err
-		}
-		fixTimes = append(fixTimes, fixTime)
-	}
+func (db *db) countCandles(pairName string, timeType TimeType, from string, to string) (int, error) {
+	return sqlCountCandles(db.impl, pairName, timeType, from, to)
+}
 
-	return fixTimes, nil
+func (db *db) queryDataSummary(pairName string, timeType TimeType) ([]string, []int32, error) {
+	return sqlQueryDataSummary(db.impl, pairName, timeType)
 }
 
 func (db *db) queryData(
@@ -355,62 +420,5 @@ func (db *db) queryData(
 	lowerFixTime string,
 	upperTimeType TimeType,
 	limit int) ([]Candle, error) {
-
-	sql := fmt.Sprintf(SQL_DATA, pairName, pairName)
-
-	stmt, err := db.impl.Prepare(sql)
-	if err != nil {
-		return nil, err
-	}
-	defer stmt.Close()
-	rows, err := stmt.Query(int(upperTimeType), lowerFixTime, limit, int(lowerTimeType), lowerFixTime)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	candles := make([]Candle, 0)
-	for rows.Next() {
-		var c Candle
-		err := rows.Scan(&c.Time, &c.Low, &c.Open, &c.Close, &c.High)
-		if err != nil {
-			rowId := len(candles)
-			if rowId == 0 {
-				return nil, ErrNoEnoughUpperData{}
-			}
-			return nil, err
-		}
-		candles = append(candles, c)
-	}
-
-	if len(candles) < 2 {
-		return nil, ErrInvalidData{}
-	}
-
-	return candles, nil
-}
-
-// makeInsertDataSql データテーブルへの挿入用SQLを作成し返却する
-func makeInsertDataSql(pairName string, timeType TimeType, candles []Candle) (string, error) {
-	sqlBase := fmt.Sprintf(SQL_INSERT_DATA, pairName)
-
-	valueStatements := []string{}
-
-	for k := 0; k < len(candles); k++ {
-
-		c := candles[k]
-		t, err := Utils.getCandleFixTime(c.Time, timeType)
-		if err != nil {
-			return "", err
-		}
-
-		valueStatement := fmt.Sprintf(
-			"(%d, '%s', %f, %f, %f, %f)",
-			int(timeType),
-			t, c.High, c.Open, c.Close, c.Low)
-
-		valueStatements = append(valueStatements, valueStatement)
-	}
-
-	return sqlBase + strings.Join(valueStatements, ",") + SQL_DATA_TABLE_ON_DUPLICATE_KEY_UPDATE, nil
+	return sqlQueryData(db.impl, pairName, lowerTimeType, lowerFixTime, upperTimeType, limit)
 }
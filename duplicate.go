@@ -0,0 +1,273 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"os"
+)
+
+const (
+	// DuplicatePolicySkip 既存の確定時刻の行は変更しない(既定値)
+	DuplicatePolicySkip = "skip"
+	// DuplicatePolicyOverwrite 既存の確定時刻の行を、アップロードした値で上書きする
+	DuplicatePolicyOverwrite = "overwrite"
+	// DuplicatePolicyFail 既存の行と値が異なるローソク足が含まれる場合は、何も登録せずに失敗する
+	// 分割して登録する場合は、登録前にcheckDuplicateConflictsで全件を比較すること
+	DuplicatePolicyFail = "fail"
+	// DuplicatePolicyReportDiff 何も登録せず、上書きした場合の件数と差分のみを返却する
+	DuplicatePolicyReportDiff = "report-diff"
+
+	// maxReportedDiffs レスポンスに含める差分の最大件数
+	maxReportedDiffs = 1000
+
+	// priceTolerance 価格が同じとみなす差(保存時の精度である小数点以下5桁の半分)
+	priceTolerance = 0.000005
+)
+
+type (
+	// CandleDiff 既存の行とアップロードしたローソク足の差分
+	CandleDiff struct {
+		Time     string `json:"time"`
+		Stored   Candle `json:"stored"`
+		Uploaded Candle `json:"uploaded"`
+	}
+
+	// registerResult 登録時の件数の内訳
+	registerResult struct {
+		inserted  int
+		updated   int
+		unchanged int
+		diffs     []CandleDiff
+	}
+
+	// classifiedCandles 既存の行との比較結果
+	classifiedCandles struct {
+		inserts   []Candle     // 既存の行がないローソク足
+		changes   []Candle     // 既存の行と値が異なるローソク足
+		unchanged int          // 既存の行と値が同じローソク足の本数
+		diffs     []CandleDiff // 既存の行と値が異なるローソク足の差分
+	}
+)
+
+// checkDuplicatePolicy 重複時の動作を検証する(未指定の場合はskip)
+func checkDuplicatePolicy(policy string) (string, error) {
+	policy = Utils.getStringOrDefault(policy, DuplicatePolicySkip)
+	switch policy {
+	case DuplicatePolicySkip, DuplicatePolicyOverwrite, DuplicatePolicyFail, DuplicatePolicyReportDiff:
+		return policy, nil
+	}
+	return "", ErrInvalidDuplicatePolicy{}
+}
+
+// add 別のバッチの結果を合算する(差分はmaxReportedDiffs件まで保持する)
+func (r *registerResult) add(other registerResult) {
+	r.inserted += other.inserted
+	r.updated += other.updated
+	r.unchanged += other.unchanged
+	for _, diff := range other.diffs {
+		if len(r.diffs) >= maxReportedDiffs {
+			break
+		}
+		r.diffs = append(r.diffs, diff)
+	}
+}
+
+// sameCandle 2つのローソク足の値が保存時の精度で同じかを返却する
+func sameCandle(a Candle, b Candle) bool {
+	samePrice := func(x float32, y float32) bool { return math.Abs(toPrice(x)-toPrice(y)) < priceTolerance }
+	return samePrice(a.High, b.High) &&
+		samePrice(a.Open, b.Open) &&
+		samePrice(a.Close, b.Close) &&
+		samePrice(a.Low, b.Low) &&
+		a.TickVolume == b.TickVolume
+}
+
+// classifyCandles 既存の行(確定時刻がキー)と比較し、新規・変更・変更なしに分類する
+func classifyCandles(existing map[string]Candle, candles []Candle) classifiedCandles {
+	result := classifiedCandles{inserts: make([]Candle, 0), changes: make([]Candle, 0), diffs: make([]CandleDiff, 0)}
+	for _, c := range candles {
+		stored, ok := existing[c.Time]
+		switch {
+		case !ok:
+			result.inserts = append(result.inserts, c)
+			existing[c.Time] = c
+		case sameCandle(stored, c):
+			result.unchanged++
+		default:
+			result.changes = append(result.changes, c)
+			if len(result.diffs) < maxReportedDiffs {
+				result.diffs = append(result.diffs, CandleDiff{Time: c.Time, Stored: stored, Uploaded: c})
+			}
+		}
+	}
+	return result
+}
+
+// apply 重複時の動作に応じて登録・更新を行い、件数の内訳を返却する
+// insert, updateは書き込みが必要な場合のみ呼び出される
+func (classified classifiedCandles) apply(
+	policy string,
+	insert func(candles []Candle) error,
+	update func(candles []Candle) error) (registerResult, error) {
+
+	result := registerResult{unchanged: classified.unchanged}
+
+	switch policy {
+	case DuplicatePolicyFail:
+		if len(classified.changes) > 0 {
+			result.diffs = classified.diffs
+			return result, ErrDuplicateConflict{}
+		}
+
+	case DuplicatePolicyReportDiff:
+		result.inserted = len(classified.inserts)
+		result.updated = len(classified.changes)
+		result.diffs = classified.diffs
+		return result, nil
+
+	case DuplicatePolicySkip:
+		result.unchanged += len(classified.changes)
+	}
+
+	if len(classified.inserts) > 0 {
+		err := insert(classified.inserts)
+		if err != nil {
+			return registerResult{}, err
+		}
+		result.inserted = len(classified.inserts)
+	}
+
+	if policy == DuplicatePolicyOverwrite && len(classified.changes) > 0 {
+		err := update(classified.changes)
+		if err != nil {
+			return registerResult{}, err
+		}
+		result.updated = len(classified.changes)
+	}
+
+	return result, nil
+}
+
+// sqlRegisterData 既存の行と比較したうえで、重複時の動作に応じて登録・更新する
+// 比較と書き込みは同じトランザクション内で行う
+func sqlRegisterData(
+	tx *sql.Tx,
+	pairName string,
+	timeType TimeType,
+	candles []Candle,
+	policy string,
+	insert func(candles []Candle) error) (registerResult, error) {
+
+	if len(candles) == 0 {
+		return registerResult{}, nil
+	}
+
+	from, to := candles[0].Time, candles[0].Time
+	for _, c := range candles {
+		if c.Time < from {
+			from = c.Time
+		}
+		if c.Time > to {
+			to = c.Time
+		}
+	}
+
+	existing := make(map[string]Candle)
+	err := sqlEachCandle(tx, pairName, timeType, from, to, func(c Candle) error {
+		existing[c.Time] = c
+		return nil
+	})
+	if err != nil {
+		return registerResult{}, err
+	}
+
+	return classifyCandles(existing, candles).apply(policy, insert, func(changes []Candle) error {
+		stmt, err := tx.Prepare(fmt.Sprintf(SQL_UPDATE_DATA, pairName))
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		for _, c := range changes {
+			_, err = stmt.Exec(
+				toPrice(c.High), toPrice(c.Open), toPrice(c.Close), toPrice(c.Low), c.TickVolume, int(timeType), c.Time)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// checkDuplicateConflicts ファイルの全てのローソク足を既存の行と比較し、値が異なるものがあればErrDuplicateConflictを返却する
+// 登録は行わない。fail指定のアップロードをバッチに分けて登録する前に、何も登録せずに失敗させるために使用する
+// (比較から登録までの間に他のリクエストで登録された行との衝突は、登録時のバッチ単位でのみ検出する)
+func (action) checkDuplicateConflicts(
+	store CandleStore,
+	pairName string,
+	timeType TimeType,
+	path string,
+	format string,
+	options postDataOptions) (registerResult, error) {
+
+	result := registerResult{}
+
+	// データテーブルがない場合は、衝突する行も存在しない
+	pairNames, err := store.getUploadedPairNames()
+	if err != nil {
+		return result, err
+	}
+	exists := false
+	for _, name := range pairNames {
+		exists = exists || name == pairName
+	}
+	if !exists {
+		return result, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return result, err
+	}
+	defer f.Close()
+
+	reader, err := newCandleReader(f, format)
+	if err != nil {
+		return result, err
+	}
+
+	// 登録時と同じく、検証で除外されるローソク足は比較しない
+	validator := newCandleValidator(timeType, options.validation)
+	conflicts := 0
+	for {
+		candles, err := readCandleBatch(reader, ingestBatchSize)
+		if err != nil {
+			return result, err
+		}
+		if len(candles) == 0 {
+			break
+		}
+
+		normalized, _, _, err := normalizeCandles(validator.validate(candles), options.profile)
+		if err != nil {
+			return result, err
+		}
+		if len(normalized) == 0 {
+			continue
+		}
+
+		registered, err := store.registerData(pairName, timeType, normalized, DuplicatePolicyReportDiff)
+		if err != nil {
+			return result, err
+		}
+		// 何も登録しないため、新規・変更の件数は返却しない(registerDataのfail指定と同じ内訳)
+		result.add(registerResult{unchanged: registered.unchanged, diffs: registered.diffs})
+		conflicts += registered.updated
+	}
+
+	if conflicts > 0 {
+		return result, ErrDuplicateConflict{}
+	}
+	return registerResult{}, nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestClassifiedCandlesApply(t *testing.T) {
+	stored := Candle{Time: "2023-01-02 00:00:00", Open: 1.1, High: 1.2, Low: 1.0, Close: 1.15, TickVolume: 1}
+	changed := Candle{Time: "2023-01-02 00:00:00", Open: 1.1, High: 1.3, Low: 1.0, Close: 1.15, TickVolume: 1}
+	same := Candle{Time: "2023-01-02 00:01:00", Open: 1.1, High: 1.2, Low: 1.0, Close: 1.15, TickVolume: 2}
+	added := Candle{Time: "2023-01-02 00:02:00", Open: 1.1, High: 1.2, Low: 1.0, Close: 1.15, TickVolume: 3}
+	diffs := []CandleDiff{{Time: changed.Time, Stored: stored, Uploaded: changed}}
+
+	tests := []struct {
+		policy   string
+		want     registerResult
+		wantErr  error
+		inserted []Candle
+		updated  []Candle
+	}{
+		{DuplicatePolicySkip, registerResult{inserted: 1, unchanged: 2}, nil, []Candle{added}, nil},
+		{DuplicatePolicyOverwrite, registerResult{inserted: 1, updated: 1, unchanged: 1}, nil, []Candle{added}, []Candle{changed}},
+		{DuplicatePolicyFail, registerResult{unchanged: 1, diffs: diffs}, ErrDuplicateConflict{}, nil, nil},
+		{DuplicatePolicyReportDiff, registerResult{inserted: 1, updated: 1, unchanged: 1, diffs: diffs}, nil, nil, nil},
+	}
+
+	for _, test := range tests {
+		existing := map[string]Candle{stored.Time: stored, same.Time: same}
+		var inserted, updated []Candle
+		got, err := classifyCandles(existing, []Candle{changed, same, added}).apply(test.policy,
+			func(candles []Candle) error { inserted = append(inserted, candles...); return nil },
+			func(candles []Candle) error { updated = append(updated, candles...); return nil })
+
+		if err != test.wantErr {
+			t.Errorf("%s: apply returned %v, want %v", test.policy, err, test.wantErr)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: apply = %+v, want %+v", test.policy, got, test.want)
+		}
+		if !reflect.DeepEqual(inserted, test.inserted) || !reflect.DeepEqual(updated, test.updated) {
+			t.Errorf("%s: inserted %+v, updated %+v, want %+v, %+v", test.policy, inserted, updated, test.inserted, test.updated)
+		}
+	}
+}
+
+// writeTestNDJSON ローソク足の時刻をサーバー時間の書式にしてNDJSONファイルに書き出す
+func writeTestNDJSON(t *testing.T, candles []Candle) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "upload.ndjson")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	encoder := json.NewEncoder(f)
+	for _, c := range candles {
+		fixTime, err := time.Parse(fixTimeLayout, c.Time)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Time = fixTime.Format(serverTimeLayout)
+		err = encoder.Encode(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return path
+}
+
+func TestCheckDuplicateConflicts(t *testing.T) {
+	start := time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC)
+	// 衝突するローソク足が2つ目のバッチにのみ含まれるアップロード
+	uploaded := newTestCandles(start, ingestBatchSize+10)
+	conflicting := uploaded[ingestBatchSize+5]
+	conflicting.Close += 0.01
+
+	tests := []struct {
+		name      string
+		stored    []Candle
+		wantErr   error
+		wantDiffs int
+	}{
+		{"no data table", nil, nil, 0},
+		{"identical rows", uploaded[ingestBatchSize:], nil, 0},
+		{"conflict in the last batch", []Candle{conflicting}, ErrDuplicateConflict{}, 1},
+	}
+
+	for _, test := range tests {
+		store := newMemoryStore()
+		if test.stored != nil {
+			err := store.createDataTable("EURUSD")
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = store.registerData("EURUSD", M1, test.stored, DuplicatePolicyOverwrite)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		options := postDataOptions{
+			profile:    resolveTestProfile(t, newTestTimezoneRegistry(t), rawTimezoneProfile),
+			policy:     DuplicatePolicyFail,
+			validation: validationOptions{mode: ValidationModeLenient},
+		}
+		path := writeTestNDJSON(t, uploaded)
+		got, err := Action.checkDuplicateConflicts(store, "EURUSD", M1, path, UploadFormatNDJSON, options)
+		if err != test.wantErr {
+			t.Errorf("%s: checkDuplicateConflicts returned %v, want %v", test.name, err, test.wantErr)
+		}
+		if len(got.diffs) != test.wantDiffs {
+			t.Errorf("%s: %d diffs, want %d", test.name, len(got.diffs), test.wantDiffs)
+		}
+
+		// 比較のみで、何も登録しないこと
+		detail, err := store.getUploadedPairDetail("EURUSD")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if detail[M1.toInt()] != len(test.stored) {
+			t.Errorf("%s: %d rows stored after checkDuplicateConflicts, want %d", test.name, detail[M1.toInt()], len(test.stored))
+		}
+	}
+}
@@ -2,68 +2,296 @@ package main
 
 import (
 	"fmt"
+	"net/http"
+	"reflect"
 	"strings"
 )
 
 type (
-	ErrCannotGetMaxAllowedPacket struct{}
-	ErrInvalidDateTimeFormat     struct{}
-	ErrInvalidTimeType           struct{}
-	ErrMultipleCause             struct{ errors []error }
-	ErrInvalidPairName           struct{}
-	ErrEmptyCandles              struct{}
-	ErrInvalidData               struct{}
-	ErrInvalidLimit              struct{}
-	ErrInvalidFixTime            struct{}
-	ErrNoEnoughUpperData         struct{}
-)
-
-func getErrorStatus(err error) (uint16, string) {
-	if err == nil {
-		return 0, "OK"
+	ErrCannotGetMaxAllowedPacket struct {
+		catalogError[ErrCannotGetMaxAllowedPacket]
 	}
-
-	if _, ok := err.(ErrCannotGetMaxAllowedPacket); ok {
-		return 0x8001, err.Error()
+	ErrInvalidDateTimeFormat struct {
+		catalogError[ErrInvalidDateTimeFormat]
 	}
-
-	if _, ok := err.(ErrInvalidDateTimeFormat); ok {
-		return 0x8002, err.Error()
+	ErrInvalidTimeType struct {
+		catalogError[ErrInvalidTimeType]
 	}
-
-	if _, ok := err.(ErrInvalidTimeType); ok {
-		return 0x8003, err.Error()
+	ErrMultipleCause   struct{ errors []error }
+	ErrInvalidPairName struct {
+		catalogError[ErrInvalidPairName]
 	}
-
-	if _, ok := err.(ErrMultipleCause); ok {
-		return 0x8004, err.Error()
+	ErrEmptyCandles struct {
+		catalogError[ErrEmptyCandles]
 	}
-
-	if _, ok := err.(ErrInvalidPairName); ok {
-		return 0x8005, err.Error()
+	ErrInvalidData struct {
+		catalogError[ErrInvalidData]
+		cause error
+	}
+	ErrInvalidLimit struct {
+		catalogError[ErrInvalidLimit]
+	}
+	ErrInvalidFixTime struct {
+		catalogError[ErrInvalidFixTime]
+	}
+	ErrNoEnoughUpperData struct {
+		catalogError[ErrNoEnoughUpperData]
+	}
+	ErrInvalidStoreType struct {
+		catalogError[ErrInvalidStoreType]
+	}
+	ErrInvalidSchemaVersion struct {
+		catalogError[ErrInvalidSchemaVersion]
+	}
+	ErrMigrationNotSupported struct {
+		catalogError[ErrMigrationNotSupported]
+	}
+	ErrInvalidTimezoneProfile struct {
+		catalogError[ErrInvalidTimezoneProfile]
+	}
+	ErrUnknownTimezoneProfile struct {
+		catalogError[ErrUnknownTimezoneProfile]
+	}
+	ErrReplaySessionNotFound struct {
+		catalogError[ErrReplaySessionNotFound]
+	}
+	ErrReplayOutOfRange struct {
+		catalogError[ErrReplayOutOfRange]
+	}
+	ErrInvalidSteps struct {
+		catalogError[ErrInvalidSteps]
+	}
+	ErrReplayTradingInProgress struct {
+		catalogError[ErrReplayTradingInProgress]
+	}
+	ErrInvalidOrder struct {
+		catalogError[ErrInvalidOrder]
+	}
+	ErrOrderNotFound struct {
+		catalogError[ErrOrderNotFound]
+	}
+	ErrPositionNotFound struct {
+		catalogError[ErrPositionNotFound]
+	}
+	ErrInvalidInitialBalance struct {
+		catalogError[ErrInvalidInitialBalance]
+	}
+	ErrInvalidReportFormat struct {
+		catalogError[ErrInvalidReportFormat]
+	}
+	ErrInvalidIndicator struct {
+		catalogError[ErrInvalidIndicator]
+	}
+	ErrInvalidReplayControl struct {
+		catalogError[ErrInvalidReplayControl]
+	}
+	ErrInvalidReplaySpeed struct {
+		catalogError[ErrInvalidReplaySpeed]
+	}
+	ErrInvalidImportFormat struct {
+		catalogError[ErrInvalidImportFormat]
+	}
+	ErrInvalidImportFile struct {
+		catalogError[ErrInvalidImportFile]
+		cause error
+	}
+	ErrInvalidExportFormat struct {
+		catalogError[ErrInvalidExportFormat]
+	}
+	ErrInvalidUploadFormat struct {
+		catalogError[ErrInvalidUploadFormat]
+	}
+	ErrUploadSessionNotFound struct {
+		catalogError[ErrUploadSessionNotFound]
+	}
+	ErrUploadOffsetMismatch struct {
+		catalogError[ErrUploadOffsetMismatch]
+	}
+	ErrUploadInProgress struct {
+		catalogError[ErrUploadInProgress]
+	}
+	ErrInvalidDuplicatePolicy struct {
+		catalogError[ErrInvalidDuplicatePolicy]
+	}
+	ErrDuplicateConflict struct {
+		catalogError[ErrDuplicateConflict]
+	}
+	ErrInvalidValidationMode struct {
+		catalogError[ErrInvalidValidationMode]
+	}
+	ErrInvalidSpikeThreshold struct {
+		catalogError[ErrInvalidSpikeThreshold]
+	}
+	ErrValidationFailed struct {
+		catalogError[ErrValidationFailed]
 	}
+	ErrInvalidHoliday struct {
+		catalogError[ErrInvalidHoliday]
+	}
+	ErrInvalidSortOrder struct {
+		catalogError[ErrInvalidSortOrder]
+	}
+	ErrInvalidPageSize struct {
+		catalogError[ErrInvalidPageSize]
+	}
+	ErrInvalidCursor struct {
+		catalogError[ErrInvalidCursor]
+	}
+	ErrRouteNotFound struct {
+		catalogError[ErrRouteNotFound]
+	}
+	ErrMethodNotAllowed struct {
+		catalogError[ErrMethodNotAllowed]
+	}
+	ErrInvalidRequestBody struct {
+		catalogError[ErrInvalidRequestBody]
+		cause error
+	}
+	ErrUnauthorized struct {
+		catalogError[ErrUnauthorized]
+	}
+	ErrForbidden struct {
+		catalogError[ErrForbidden]
+	}
+	ErrInvalidDataset struct {
+		catalogError[ErrInvalidDataset]
+	}
+	ErrPrivateDatasetUnavailable struct {
+		catalogError[ErrPrivateDatasetUnavailable]
+	}
+	ErrInvalidAPIKeyConfig struct {
+		catalogError[ErrInvalidAPIKeyConfig]
+	}
+	ErrInternal struct {
+		catalogError[ErrInternal]
+		cause error
+	}
+	ErrInvalidLanguage struct {
+		catalogError[ErrInvalidLanguage]
+	}
+	ErrInvalidConfig  struct{ problems []string }
+	ErrInvalidCommand struct {
+		catalogError[ErrInvalidCommand]
+	}
+	ErrIncompleteData struct {
+		catalogError[ErrIncompleteData]
+	}
+	ErrDropSchemaNotConfirmed struct {
+		catalogError[ErrDropSchemaNotConfirmed]
+	}
+)
 
-	return 0x8FFF, err.Error()
-}
+// catalogError 埋め込んだエラーのError()で、Eのメッセージを日本語のカタログから返却する
+// Eのゼロ値でメッセージを引くため、フィールドの値をメッセージに埋め込むエラーは独自にError()を定義する
+type catalogError[E error] struct{}
 
-func (ErrCannotGetMaxAllowedPacket) Error() string {
-	return "max_allowed_packetの取得に失敗しました"
+func (catalogError[E]) Error() string {
+	var e E
+	return catalogMessage(e, LanguageJapanese)
 }
 
-func (ErrInvalidDateTimeFormat) Error() string {
-	return "予期しない日付フォーマットが指定されました"
+// errorSpec エラーをAPIのレスポンスに変換する際の仕様
+type errorSpec struct {
+	code       uint16 // レスポンスのstatus.code(一度割り当てた値は変更しない)
+	httpStatus int
+	name       string // レスポンスのstatus.type、application/problem+jsonのtypeに使用する(一度割り当てた値は変更しない)
 }
 
-func (ErrInvalidTimeType) Error() string {
-	return "不正な時間軸が指定されました"
+// errorSpecs エラーの型ごとのエラーコード・HTTPステータス・名前
+// 新しいエラーを追加する場合は、ここに未使用のコードで登録し、japaneseMessages・englishMessagesにメッセージを追加する
+var errorSpecs = map[reflect.Type]errorSpec{
+	reflect.TypeOf(ErrCannotGetMaxAllowedPacket{}): {0x8001, http.StatusInternalServerError, "max-allowed-packet-unavailable"},
+	reflect.TypeOf(ErrInvalidDateTimeFormat{}):     {0x8002, http.StatusBadRequest, "invalid-date-time-format"},
+	reflect.TypeOf(ErrInvalidTimeType{}):           {0x8003, http.StatusBadRequest, "invalid-time-type"},
+	reflect.TypeOf(ErrMultipleCause{}):             {0x8004, http.StatusInternalServerError, "multiple-causes"},
+	reflect.TypeOf(ErrInvalidPairName{}):           {0x8005, http.StatusBadRequest, "invalid-pair-name"},
+	reflect.TypeOf(ErrEmptyCandles{}):              {0x8006, http.StatusBadRequest, "empty-candles"},
+	reflect.TypeOf(ErrInvalidData{}):               {0x8007, http.StatusBadRequest, "invalid-data"},
+	reflect.TypeOf(ErrInvalidLimit{}):              {0x8008, http.StatusBadRequest, "invalid-limit"},
+	reflect.TypeOf(ErrInvalidFixTime{}):            {0x8009, http.StatusBadRequest, "invalid-fix-time"},
+	reflect.TypeOf(ErrNoEnoughUpperData{}):         {0x800A, http.StatusNotFound, "not-enough-upper-data"},
+	reflect.TypeOf(ErrInvalidStoreType{}):          {0x800B, http.StatusInternalServerError, "invalid-store-type"},
+	reflect.TypeOf(ErrInvalidSchemaVersion{}):      {0x800C, http.StatusBadRequest, "invalid-schema-version"},
+	reflect.TypeOf(ErrMigrationNotSupported{}):     {0x800D, http.StatusInternalServerError, "migration-not-supported"},
+	reflect.TypeOf(ErrInvalidTimezoneProfile{}):    {0x800E, http.StatusInternalServerError, "invalid-timezone-profile"},
+	reflect.TypeOf(ErrUnknownTimezoneProfile{}):    {0x800F, http.StatusBadRequest, "unknown-timezone-profile"},
+	reflect.TypeOf(ErrReplaySessionNotFound{}):     {0x8010, http.StatusNotFound, "replay-session-not-found"},
+	reflect.TypeOf(ErrReplayOutOfRange{}):          {0x8011, http.StatusBadRequest, "replay-out-of-range"},
+	reflect.TypeOf(ErrInvalidSteps{}):              {0x8012, http.StatusBadRequest, "invalid-steps"},
+	reflect.TypeOf(ErrReplayTradingInProgress{}):   {0x8013, http.StatusConflict, "replay-trading-in-progress"},
+	reflect.TypeOf(ErrInvalidOrder{}):              {0x8014, http.StatusBadRequest, "invalid-order"},
+	reflect.TypeOf(ErrOrderNotFound{}):             {0x8015, http.StatusNotFound, "order-not-found"},
+	reflect.TypeOf(ErrPositionNotFound{}):          {0x8016, http.StatusNotFound, "position-not-found"},
+	reflect.TypeOf(ErrInvalidInitialBalance{}):     {0x8017, http.StatusBadRequest, "invalid-initial-balance"},
+	reflect.TypeOf(ErrInvalidReportFormat{}):       {0x8018, http.StatusBadRequest, "invalid-report-format"},
+	reflect.TypeOf(ErrInvalidIndicator{}):          {0x8019, http.StatusBadRequest, "invalid-indicator"},
+	reflect.TypeOf(ErrInvalidReplayControl{}):      {0x801A, http.StatusBadRequest, "invalid-replay-control"},
+	reflect.TypeOf(ErrInvalidReplaySpeed{}):        {0x801B, http.StatusBadRequest, "invalid-replay-speed"},
+	reflect.TypeOf(ErrInvalidImportFormat{}):       {0x801C, http.StatusBadRequest, "invalid-import-format"},
+	reflect.TypeOf(ErrInvalidImportFile{}):         {0x801D, http.StatusBadRequest, "invalid-import-file"},
+	reflect.TypeOf(ErrInvalidExportFormat{}):       {0x801E, http.StatusBadRequest, "invalid-export-format"},
+	reflect.TypeOf(ErrInvalidUploadFormat{}):       {0x801F, http.StatusBadRequest, "invalid-upload-format"},
+	reflect.TypeOf(ErrUploadSessionNotFound{}):     {0x8020, http.StatusNotFound, "upload-session-not-found"},
+	reflect.TypeOf(ErrUploadOffsetMismatch{}):      {0x8021, http.StatusConflict, "upload-offset-mismatch"},
+	reflect.TypeOf(ErrUploadInProgress{}):          {0x8022, http.StatusConflict, "upload-in-progress"},
+	reflect.TypeOf(ErrInvalidDuplicatePolicy{}):    {0x8023, http.StatusBadRequest, "invalid-duplicate-policy"},
+	reflect.TypeOf(ErrDuplicateConflict{}):         {0x8024, http.StatusConflict, "duplicate-conflict"},
+	reflect.TypeOf(ErrInvalidValidationMode{}):     {0x8025, http.StatusBadRequest, "invalid-validation-mode"},
+	reflect.TypeOf(ErrInvalidSpikeThreshold{}):     {0x8026, http.StatusBadRequest, "invalid-spike-threshold"},
+	reflect.TypeOf(ErrValidationFailed{}):          {0x8027, http.StatusUnprocessableEntity, "validation-failed"},
+	reflect.TypeOf(ErrInvalidHoliday{}):            {0x8028, http.StatusBadRequest, "invalid-holiday"},
+	reflect.TypeOf(ErrInvalidSortOrder{}):          {0x8029, http.StatusBadRequest, "invalid-sort-order"},
+	reflect.TypeOf(ErrInvalidPageSize{}):           {0x802A, http.StatusBadRequest, "invalid-page-size"},
+	reflect.TypeOf(ErrInvalidCursor{}):             {0x802B, http.StatusBadRequest, "invalid-cursor"},
+	reflect.TypeOf(ErrRouteNotFound{}):             {0x802C, http.StatusNotFound, "route-not-found"},
+	reflect.TypeOf(ErrMethodNotAllowed{}):          {0x802D, http.StatusMethodNotAllowed, "method-not-allowed"},
+	reflect.TypeOf(ErrInvalidRequestBody{}):        {0x802E, http.StatusBadRequest, "invalid-request-body"},
+	reflect.TypeOf(ErrUnauthorized{}):              {0x8030, http.StatusUnauthorized, "unauthorized"},
+	reflect.TypeOf(ErrForbidden{}):                 {0x8031, http.StatusForbidden, "forbidden"},
+	reflect.TypeOf(ErrInvalidDataset{}):            {0x8032, http.StatusBadRequest, "invalid-dataset"},
+	reflect.TypeOf(ErrPrivateDatasetUnavailable{}): {0x8033, http.StatusBadRequest, "private-dataset-unavailable"},
+	reflect.TypeOf(ErrInvalidAPIKeyConfig{}):       {0x8034, http.StatusInternalServerError, "invalid-api-key-config"},
+	reflect.TypeOf(ErrInvalidLanguage{}):           {0x8035, http.StatusInternalServerError, "invalid-language"},
+	reflect.TypeOf(ErrInvalidConfig{}):             {0x8036, http.StatusInternalServerError, "invalid-config"},
+	reflect.TypeOf(ErrInvalidCommand{}):            {0x8037, http.StatusBadRequest, "invalid-command"},
+	reflect.TypeOf(ErrIncompleteData{}):            {0x8038, http.StatusUnprocessableEntity, "incomplete-data"},
+	reflect.TypeOf(ErrDropSchemaNotConfirmed{}):    {0x8039, http.StatusBadRequest, "drop-schema-not-confirmed"},
 }
 
-func (ErrEmptyCandles) Error() string {
-	return "ローソク足は必ず1件以上指定してください"
+// internalErrorSpec 登録されていないエラー(データベース・ファイルの読み書きなど)
+// 内部の詳細をレスポンスに含めないよう、メッセージはErrInternalの内容に置き換える
+var internalErrorSpec = errorSpec{0x8FFF, http.StatusInternalServerError, "internal"}
+
+// lookupError エラーの仕様を返却する
+// ラップされたエラーは、登録されたエラーが見つかるまでfindErrorSpecで原因をたどる
+func lookupError(err error) (errorSpec, error) {
+	if spec, cause, ok := findErrorSpec(err); ok {
+		return spec, cause
+	}
+	return internalErrorSpec, ErrInternal{cause: err}
 }
 
-func (ErrNoEnoughUpperData) Error() string {
-	return "上位足に指定時刻のデータが存在しない可能性があります。\nアップロードしたデータを確認してください。"
+// findErrorSpec 登録されたエラーを、errにラップされた原因から深さ優先で探す
+// ErrMultipleCauseのように複数の原因を持つエラー(Unwrap() []error)は、先頭の原因から順にたどる
+func findErrorSpec(err error) (errorSpec, error, bool) {
+	if err == nil {
+		return errorSpec{}, nil, false
+	}
+	if spec, ok := errorSpecs[reflect.TypeOf(err)]; ok {
+		return spec, err, true
+	}
+
+	switch wrapped := err.(type) {
+	case interface{ Unwrap() error }:
+		return findErrorSpec(wrapped.Unwrap())
+	case interface{ Unwrap() []error }:
+		for _, cause := range wrapped.Unwrap() {
+			if spec, found, ok := findErrorSpec(cause); ok {
+				return spec, found, true
+			}
+		}
+	}
+	return errorSpec{}, nil, false
 }
 
 func (e ErrMultipleCause) Error() string {
@@ -84,20 +312,17 @@ func (e ErrMultipleCause) Error() string {
 				errors = append(errors, err.Error())
 			}
 		}
-		return fmt.Sprintf("複数のエラーが発生しました: %s", strings.Join(errors, ","))
+		return fmt.Sprintf(japaneseMessages[0x8004], strings.Join(errors, ","))
 	}
 }
 
-func (ErrInvalidData) Error() string {
-	return "アップロードデータの不足、もしくは不正パラメータの指定によりデータの取得に失敗しました。"
-}
-
-func (ErrInvalidLimit) Error() string {
-	return "リミットパラーメータが不正です。1〜100までの数値を指定してください(TODO:要調整)"
+func (e ErrInvalidData) Unwrap() error {
+	return e.cause
 }
 
-func (ErrInvalidFixTime) Error() string {
-	return "時刻が不正です。yyyy-MM-dd HH:mm:dd形式で指定してください"
+// Unwrap errors.Is, errors.Asで全ての原因を参照できるようにする
+func (e ErrMultipleCause) Unwrap() []error {
+	return e.errors
 }
 
 func newErrMultipleCause(arguments ...error) error {
@@ -108,6 +333,26 @@ func newErrMultipleCause(arguments ...error) error {
 	return ErrMultipleCause{errors: errors}
 }
 
-func (ErrInvalidPairName) Error() string {
-	return "通貨ペア名が不正です。通貨ペア名に使用できる文字は大文字の英字で6文字までです"
+func (ErrInvalidSchemaVersion) messageArgs() []interface{} {
+	return []interface{}{latestSchemaVersion()}
+}
+
+func (e ErrInvalidImportFile) Unwrap() error {
+	return e.cause
+}
+
+func (e ErrInvalidRequestBody) Unwrap() error {
+	return e.cause
+}
+
+func (e ErrInvalidConfig) Error() string {
+	return catalogMessage(e, LanguageJapanese)
+}
+
+func (e ErrInvalidConfig) messageArgs() []interface{} {
+	return []interface{}{strings.Join(e.problems, "\n  ")}
+}
+
+func (e ErrInternal) Unwrap() error {
+	return e.cause
 }
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestLookupError(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		wantCode  uint16
+		wantCause error
+	}{
+		{"registered", ErrInvalidLimit{}, 0x8008, ErrInvalidLimit{}},
+		{"wrapped", fmt.Errorf("read: %w", ErrInvalidFixTime{}), 0x8009, ErrInvalidFixTime{}},
+		{"multiple causes", newErrMultipleCause(io.EOF, ErrInvalidLimit{}), 0x8004, nil},
+		{"wrapped multiple causes", fmt.Errorf("close: %w", newErrMultipleCause(io.EOF)), 0x8004, nil},
+		{"joined", errors.Join(io.EOF, ErrInvalidLimit{}), 0x8008, ErrInvalidLimit{}},
+		{"first registered cause", fmt.Errorf("%w: %w", ErrInvalidFixTime{}, ErrInvalidLimit{}), 0x8009, ErrInvalidFixTime{}},
+		{"registered behind a registered wrapper", ErrInvalidData{cause: ErrInvalidFixTime{}}, 0x8007, nil},
+		{"joined and wrapped", fmt.Errorf("ingest: %w", errors.Join(io.EOF, ErrInvalidData{})), 0x8007, nil},
+		{"unregistered", io.EOF, internalErrorSpec.code, ErrInternal{cause: io.EOF}},
+		{"unregistered joined", errors.Join(io.EOF, io.ErrUnexpectedEOF), internalErrorSpec.code, nil},
+	}
+
+	for _, test := range tests {
+		spec, cause := lookupError(test.err)
+		if spec.code != test.wantCode {
+			t.Errorf("%s: lookupError code = %#x, want %#x", test.name, spec.code, test.wantCode)
+		}
+		if test.wantCause != nil && cause != test.wantCause {
+			t.Errorf("%s: lookupError cause = %#v, want %#v", test.name, cause, test.wantCause)
+		}
+	}
+}
+
+func TestErrMultipleCauseUnwrap(t *testing.T) {
+	err := fmt.Errorf("import: %w", newErrMultipleCause(io.EOF, ErrInvalidFixTime{}))
+
+	var fixTimeErr ErrInvalidFixTime
+	if !errors.As(err, &fixTimeErr) {
+		t.Errorf("errors.As did not find ErrInvalidFixTime in %v", err)
+	}
+	if !errors.Is(err, io.EOF) {
+		t.Errorf("errors.Is did not find io.EOF in %v", err)
+	}
+}
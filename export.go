@@ -0,0 +1,226 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	ExportFormatCSV    = "csv"
+	ExportFormatNDJSON = "ndjson"
+	ExportFormatMT     = "mt"
+)
+
+type (
+	ApiResponseGetExport struct {
+		Status ApiResponseStatus `json:"status"`
+	}
+
+	// candleExporter ローソク足を1本ずつ指定の形式でレスポンス(CLIの場合はファイル)に書き込む
+	// 最初の1本を書き込むまでレスポンスヘッダーを確定させないため、それまでに発生したエラーはJSONで返却できる
+	candleExporter struct {
+		w        io.Writer
+		header   http.Header // レスポンスヘッダー(CLIの場合はnil)
+		format   string
+		fileName string
+		compress bool
+		profile  *timezoneProfile
+		started  bool
+		out      io.Writer
+		gzip     *gzip.Writer
+		csv      *csv.Writer
+		json     *json.Encoder
+	}
+)
+
+// checkExportFormat 出力形式を検証する(未指定の場合はCSV)
+func checkExportFormat(format string) (string, error) {
+	format = Utils.getStringOrDefault(format, ExportFormatCSV)
+	switch format {
+	case ExportFormatCSV, ExportFormatNDJSON, ExportFormatMT:
+		return format, nil
+	}
+	return "", ErrInvalidExportFormat{}
+}
+
+// start レスポンスヘッダーを書き込み、出力を開始する
+func (e *candleExporter) start() error {
+	e.started = true
+	e.out = e.w
+
+	extension := "csv"
+	contentType := "text/csv; charset=utf-8"
+	if e.format == ExportFormatNDJSON {
+		extension = "ndjson"
+		contentType = "application/x-ndjson"
+	}
+	if e.header != nil {
+		e.header.Set("Content-Type", contentType)
+		e.header.Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.%s\"", e.fileName, extension))
+	}
+
+	if e.compress {
+		if e.header != nil {
+			e.header.Set("Content-Encoding", "gzip")
+		}
+		e.gzip = gzip.NewWriter(e.w)
+		e.out = e.gzip
+	}
+
+	switch e.format {
+	case ExportFormatNDJSON:
+		e.json = json.NewEncoder(e.out)
+	case ExportFormatCSV:
+		e.csv = csv.NewWriter(e.out)
+		return e.csv.Write([]string{"time", "open", "high", "low", "close", "tickVolume"})
+	case ExportFormatMT:
+		// MT4のヒストリーセンターで取り込める、ヘッダーなしの形式
+		e.csv = csv.NewWriter(e.out)
+	}
+	return nil
+}
+
+// write ローソク足1本を書き込む
+func (e *candleExporter) write(c Candle) error {
+	if !e.started {
+		err := e.start()
+		if err != nil {
+			return err
+		}
+	}
+
+	switch e.format {
+	case ExportFormatNDJSON:
+		return e.json.Encode(c)
+
+	case ExportFormatCSV:
+		return e.csv.Write([]string{
+			c.Time, formatPrice(c.Open), formatPrice(c.High), formatPrice(c.Low), formatPrice(c.Close),
+			strconv.Itoa(int(c.TickVolume)),
+		})
+
+	case ExportFormatMT:
+		fixTime, err := e.profile.parseFixTime(c.Time)
+		if err != nil {
+			return err
+		}
+		date, clock, _ := strings.Cut(e.profile.toServerTime(fixTime).Format(serverTimeLayout), " ")
+		return e.csv.Write([]string{
+			date, clock, formatPrice(c.Open), formatPrice(c.High), formatPrice(c.Low), formatPrice(c.Close),
+			strconv.Itoa(int(c.TickVolume)),
+		})
+	}
+	return nil
+}
+
+// finish バッファに残ったデータを書き出す
+// 1本も出力しなかった場合でも、ヘッダーのみのファイルを出力する
+func (e *candleExporter) finish() error {
+	if !e.started {
+		err := e.start()
+		if err != nil {
+			return err
+		}
+	}
+
+	if e.csv != nil {
+		e.csv.Flush()
+		err := e.csv.Error()
+		if err != nil {
+			return err
+		}
+	}
+	if e.gzip != nil {
+		return e.gzip.Close()
+	}
+	return nil
+}
+
+// handleExport 指定期間の全てのローソク足を、CSV・NDJSON・MT4互換CSVのいずれかで出力する
+// Accept-Encodingにgzipが含まれる場合は圧縮して出力する
+func (s *server) handleExport(w http.ResponseWriter, r *http.Request) {
+	supportedParams := []string{"*"}
+	supportedMethods := []string{
+		"GET",
+		"OPTIONS",
+	}
+	if handleCORS(w, r, supportedParams, supportedMethods) {
+		return
+	}
+
+	writeResponse := func(err error) {
+		status := newApiResponseStatus(r, err)
+		writeApiResponse(w, r, err, ApiResponseGetExport{Status: status})
+	}
+
+	pairName := requestParam(r, "x-pair-name")
+	err := Utils.checkPairName(pairName)
+	if err != nil {
+		writeResponse(err)
+		return
+	}
+
+	timeTypeName := requestParam(r, "x-time-type")
+	timeType, err := Utils.getTimeType(timeTypeName)
+	if err != nil {
+		writeResponse(err)
+		return
+	}
+
+	format, err := checkExportFormat(requestParam(r, "x-format"))
+	if err != nil {
+		writeResponse(err)
+		return
+	}
+
+	profile, err := s.timezones.resolve(requestParam(r, "x-timezone-profile"))
+	if err != nil {
+		writeResponse(err)
+		return
+	}
+
+	// 期間の指定は任意(未指定の場合は全期間を出力する)
+	from, to := requestParam(r, "x-from"), requestParam(r, "x-to")
+	for _, fixTime := range []string{from, to} {
+		if fixTime == "" {
+			continue
+		}
+		err = Utils.checkFixedTime(fixTime)
+		if err != nil {
+			writeResponse(err)
+			return
+		}
+	}
+	from = Utils.getStringOrDefault(from, minFixTime)
+	to = Utils.getStringOrDefault(to, maxFixTime)
+
+	exporter := &candleExporter{
+		w:        w,
+		header:   w.Header(),
+		format:   format,
+		fileName: fmt.Sprintf("%s_%s", pairName, timeTypeName),
+		compress: strings.Contains(r.Header.Get("Accept-Encoding"), "gzip"),
+		profile:  profile,
+	}
+
+	err = s.storeOf(r).eachCandle(pairName, timeType, from, to, exporter.write)
+	if err == nil {
+		err = exporter.finish()
+	}
+	if err != nil {
+		if exporter.started {
+			// 出力の途中ではステータスを変更できないため、接続を打ち切ることで失敗を伝える
+			log.Println(errorLogMessage(err))
+			panic(http.ErrAbortHandler)
+		}
+		writeResponse(err)
+		return
+	}
+}
@@ -1,9 +1,16 @@
 module fx-tester-server
 
-go 1.19
+go 1.20
+
+require (
+	github.com/BurntSushi/toml v1.3.2
+	github.com/go-sql-driver/mysql v1.7.1
+	github.com/gorilla/websocket v1.5.0
+	github.com/mattn/go-sqlite3 v1.14.22
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require (
-	github.com/go-sql-driver/mysql v1.7.1 // indirect
 	github.com/sqs/goreturns v0.0.0-20181028201513-538ac6014518 // indirect
 	github.com/yuin/goldmark v1.4.13 // indirect
 	golang.org/x/mod v0.12.0 // indirect
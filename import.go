@@ -0,0 +1,384 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/csv"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ImportFormatCSV = "csv"
+	ImportFormatHST = "hst"
+
+	// serverTimeLayout ブローカーのサーバー時間の書式(アップロードデータと同じ形式)
+	serverTimeLayout = "2006.01.02 15:04"
+)
+
+type (
+	// hstHeader MT4の.hstファイルのヘッダー(148バイト)
+	hstHeader struct {
+		Version   int32
+		Copyright [64]byte
+		Symbol    [12]byte
+		Period    int32
+		Digits    int32
+		TimeSign  int32
+		LastSync  int32
+		Unused    [13]int32
+	}
+
+	// hstRecord400 バージョン400(ビルド509以前)の.hstファイルのレコード(44バイト)
+	hstRecord400 struct {
+		Time   int32
+		Open   float64
+		Low    float64
+		High   float64
+		Close  float64
+		Volume float64
+	}
+
+	// hstRecord401 バージョン401の.hstファイルのレコード(60バイト)
+	hstRecord401 struct {
+		Time       int64
+		Open       float64
+		High       float64
+		Low        float64
+		Close      float64
+		TickVolume int64
+		Spread     int32
+		RealVolume int64
+	}
+
+	// mtCSVReader MT4/MT5形式のCSVを1行ずつローソク足に変換する
+	mtCSVReader struct {
+		records *csv.Reader
+		columns map[string]int
+	}
+
+	// hstCandleReader MT4の.hstファイルのレコードを1件ずつローソク足に変換する
+	hstCandleReader struct {
+		r       io.Reader
+		version int32
+	}
+
+	// importedFile ファイルから検出した通貨ペア・時間軸
+	importedFile struct {
+		pairName string
+		timeType TimeType
+	}
+)
+
+// getImportFormat ファイル名の拡張子から形式を判定する(判定できない場合はCSVとして扱う)
+func getImportFormat(fileName string) string {
+	if strings.EqualFold(filepath.Ext(fileName), ".hst") {
+		return ImportFormatHST
+	}
+	return ImportFormatCSV
+}
+
+// detectPairAndTimeType ファイル名から通貨ペアと時間軸を検出する
+// MT4形式(EURUSD60.csv, EURUSD240.hst)とMT5形式(EURUSD_M1_202301020000_202301312359.csv)に対応する
+func detectPairAndTimeType(fileName string) (string, TimeType) {
+	base := filepath.Base(fileName)
+	base = strings.TrimSuffix(base, filepath.Ext(base))
+	if len(base) < 6 || Utils.checkPairName(strings.ToUpper(base[:6])) != nil {
+		return "", Unknown
+	}
+	pairName := strings.ToUpper(base[:6])
+
+	separators := "_-., "
+	rest := strings.TrimLeft(base[6:], separators)
+	if index := strings.IndexAny(rest, separators); index >= 0 {
+		rest = rest[:index]
+	}
+
+	if minutes, err := strconv.Atoi(rest); err == nil {
+		return pairName, timeTypeOfMinutes(minutes)
+	}
+
+	switch strings.ToUpper(rest) {
+	case "D1":
+		return pairName, Daily
+	case "W1":
+		return pairName, Weekly
+	}
+	return pairName, timeTypeOf(strings.ToUpper(rest))
+}
+
+// timeTypeOfMinutes MetaTraderの期間(分)を時間軸に変換する
+func timeTypeOfMinutes(minutes int) TimeType {
+	for timeType := M1; timeType < NumTimeType; timeType++ {
+		duration, _ := timeType.getDuration()
+		if int(duration/time.Minute) == minutes {
+			return timeType
+		}
+	}
+	return Unknown
+}
+
+// newImportReader ファイルの形式に応じて、ローソク足を1本ずつ読み込むcandleReaderを生成する
+// 時刻はブローカーのサーバー時間のまま、アップロードデータと同じ書式で返却する
+// .hstファイルはヘッダーを読み込み、記録された通貨ペア・時間軸を返却する(CSVは不明のまま返却する)
+func newImportReader(r io.Reader, format string) (importedFile, candleReader, error) {
+	switch format {
+	case ImportFormatCSV:
+		return importedFile{timeType: Unknown}, newMTCSVReader(r), nil
+	case ImportFormatHST:
+		return newHSTReader(r)
+	}
+	return importedFile{timeType: Unknown}, nil, ErrInvalidImportFormat{}
+}
+
+// openImportFile ファイルを読み込むcandleReaderを生成し、通貨ペア・時間軸を決定する
+// 通貨ペア・時間軸は指定された値、.hstファイルのヘッダー、ファイル名の順に決定する
+// strictモードの場合は、問題があれば何も登録しないよう全件を検証してから先頭に戻す(rはio.ReadSeekerであること)
+func (action) openImportFile(
+	r io.Reader,
+	format string,
+	fileName string,
+	pairName string,
+	timeTypeName string,
+	validation validationOptions) (importedFile, candleReader, ValidationReport, error) {
+
+	file, reader, err := newImportReader(r, format)
+	if err != nil {
+		return importedFile{timeType: Unknown}, nil, ValidationReport{}, err
+	}
+
+	detectedPairName, detectedTimeType := detectPairAndTimeType(fileName)
+	if file.pairName == "" {
+		file.pairName = detectedPairName
+	}
+	if file.timeType == Unknown {
+		file.timeType = detectedTimeType
+	}
+	file.pairName = Utils.getStringOrDefault(pairName, file.pairName)
+	if timeTypeName != "" {
+		file.timeType = timeTypeOf(timeTypeName)
+	}
+
+	err = Utils.checkPairName(file.pairName)
+	if err != nil {
+		return file, nil, ValidationReport{}, err
+	}
+	if file.timeType == Unknown {
+		return file, nil, ValidationReport{}, ErrInvalidTimeType{}
+	}
+	if validation.mode != ValidationModeStrict {
+		return file, reader, ValidationReport{}, nil
+	}
+
+	seeker, ok := r.(io.ReadSeeker)
+	if !ok {
+		return file, nil, ValidationReport{}, ErrInternal{}
+	}
+	report, err := Action.validateStream(reader, file.timeType, validation)
+	if err != nil {
+		return file, nil, report, err
+	}
+	_, err = seeker.Seek(0, io.SeekStart)
+	if err != nil {
+		return file, nil, report, err
+	}
+	_, reader, err = newImportReader(seeker, format)
+	return file, reader, report, err
+}
+
+// newMTCSVReader MT4/MT5形式のCSVを1行ずつ読み込むmtCSVReaderをnewする
+// ヘッダーの有無、カンマ区切り・タブ区切りのいずれにも対応する
+func newMTCSVReader(r io.Reader) *mtCSVReader {
+	reader := bufio.NewReader(r)
+	head, _ := reader.Peek(reader.Size())
+
+	records := csv.NewReader(reader)
+	records.FieldsPerRecord = -1
+	records.LazyQuotes = true
+	records.TrimLeadingSpace = true
+	records.ReuseRecord = true
+	if firstLine, _, _ := bytes.Cut(head, []byte("\n")); bytes.ContainsRune(firstLine, '\t') {
+		records.Comma = '\t'
+	}
+
+	return &mtCSVReader{records: records}
+}
+
+// read 次のローソク足を読み込む(終端ではio.EOFを返却する)
+func (reader *mtCSVReader) read() (Candle, error) {
+	for {
+		record, err := reader.records.Read()
+		if err == io.EOF {
+			return Candle{}, err
+		}
+		if err != nil {
+			return Candle{}, ErrInvalidImportFile{cause: err}
+		}
+		if len(record) == 1 && strings.TrimSpace(record[0]) == "" {
+			continue
+		}
+
+		if reader.columns == nil {
+			reader.columns = csvHeaderColumns(record)
+			if reader.columns != nil {
+				continue
+			}
+			reader.columns = csvDefaultColumns(record)
+		}
+
+		return csvRecordToCandle(record, reader.columns)
+	}
+}
+
+// csvHeaderColumns ヘッダー行から列の位置を取得する(ヘッダー行でない場合はnil)
+func csvHeaderColumns(record []string) map[string]int {
+	if _, err := strconv.ParseFloat(strings.TrimSpace(record[len(record)-1]), 64); err == nil {
+		return nil
+	}
+
+	columns := make(map[string]int)
+	for i, name := range record {
+		name = strings.ToLower(strings.Trim(strings.TrimSpace(name), "<>"))
+		switch name {
+		case "tickvol", "tick_volume", "tickvolume":
+			columns["volume"] = i
+		case "vol", "volume":
+			if _, ok := columns["volume"]; !ok {
+				columns["volume"] = i
+			}
+		case "date", "time", "open", "high", "low", "close":
+			columns[name] = i
+		}
+	}
+
+	// 日付・四本値の列名がない行は、値の誤りとして扱うためヘッダー行とみなさない
+	for _, name := range []string{"date", "open", "high", "low", "close"} {
+		if _, ok := columns[name]; !ok {
+			return nil
+		}
+	}
+	return columns
+}
+
+// csvDefaultColumns ヘッダーがない場合に、1行目の内容から列の位置を推定する
+// 日付・時刻が別の列(MT4の標準)か、同じ列か、時刻がない(日足以上)かを判定する
+func csvDefaultColumns(record []string) map[string]int {
+	first := strings.TrimSpace(record[0])
+	if strings.ContainsAny(first, " T") {
+		return map[string]int{"date": 0, "open": 1, "high": 2, "low": 3, "close": 4, "volume": 5}
+	}
+	if len(record) > 1 && strings.Contains(record[1], ":") {
+		return map[string]int{"date": 0, "time": 1, "open": 2, "high": 3, "low": 4, "close": 5, "volume": 6}
+	}
+	return map[string]int{"date": 0, "open": 1, "high": 2, "low": 3, "close": 4, "volume": 5}
+}
+
+// csvRecordToCandle CSVの1行をローソク足に変換する
+func csvRecordToCandle(record []string, columns map[string]int) (Candle, error) {
+	field := func(name string) string {
+		index, ok := columns[name]
+		if !ok || len(record) <= index {
+			return ""
+		}
+		return strings.TrimSpace(record[index])
+	}
+
+	dateTime := strings.NewReplacer("-", ".", "/", ".", "T", " ").Replace(field("date"))
+	if t := field("time"); t != "" {
+		dateTime += " " + t
+	}
+	// 秒は切り捨てる(yyyy.MM.dd HH:mm形式に揃える)
+	if date, clock, ok := strings.Cut(dateTime, " "); ok && len(clock) > 5 {
+		dateTime = date + " " + clock[:5]
+	}
+
+	prices := make([]float32, 4)
+	for i, name := range []string{"open", "high", "low", "close"} {
+		price, err := strconv.ParseFloat(field(name), 32)
+		if err != nil {
+			return Candle{}, ErrInvalidImportFile{cause: err}
+		}
+		prices[i] = float32(price)
+	}
+
+	volume := 0.0
+	if value := field("volume"); value != "" {
+		var err error
+		volume, err = strconv.ParseFloat(value, 64)
+		if err != nil {
+			return Candle{}, ErrInvalidImportFile{cause: err}
+		}
+	}
+
+	return Candle{
+		Time:       dateTime,
+		Open:       prices[0],
+		High:       prices[1],
+		Low:        prices[2],
+		Close:      prices[3],
+		TickVolume: int32(volume),
+	}, nil
+}
+
+// newHSTReader MT4の.hstファイル(バージョン400, 401)のヘッダーを読み込み、レコードを読み込むhstCandleReaderを生成する
+// 通貨ペアと時間軸はヘッダーに記録されたものを返却する
+func newHSTReader(r io.Reader) (importedFile, candleReader, error) {
+	var header hstHeader
+	err := binary.Read(r, binary.LittleEndian, &header)
+	if err != nil {
+		return importedFile{timeType: Unknown}, nil, ErrInvalidImportFile{cause: err}
+	}
+	if header.Version != 400 && header.Version != 401 {
+		return importedFile{timeType: Unknown}, nil, ErrInvalidImportFile{}
+	}
+
+	symbol := strings.ToUpper(string(bytes.TrimRight(header.Symbol[:], "\x00")))
+	file := importedFile{timeType: timeTypeOfMinutes(int(header.Period))}
+	if len(symbol) >= 6 && Utils.checkPairName(symbol[:6]) == nil {
+		file.pairName = symbol[:6]
+	}
+	return file, &hstCandleReader{r: r, version: header.Version}, nil
+}
+
+// read 次のレコードを読み込む(終端ではio.EOFを返却する)
+// 読み込むのは1レコード分のみのため、ファイル全体をメモリに保持しない
+func (reader *hstCandleReader) read() (Candle, error) {
+	var c Candle
+	var err error
+	switch reader.version {
+	case 400:
+		var record hstRecord400
+		err = binary.Read(reader.r, binary.LittleEndian, &record)
+		c = Candle{
+			Time:       time.Unix(int64(record.Time), 0).UTC().Format(serverTimeLayout),
+			Open:       float32(record.Open),
+			High:       float32(record.High),
+			Low:        float32(record.Low),
+			Close:      float32(record.Close),
+			TickVolume: int32(record.Volume),
+		}
+	case 401:
+		var record hstRecord401
+		err = binary.Read(reader.r, binary.LittleEndian, &record)
+		c = Candle{
+			Time:       time.Unix(record.Time, 0).UTC().Format(serverTimeLayout),
+			Open:       float32(record.Open),
+			High:       float32(record.High),
+			Low:        float32(record.Low),
+			Close:      float32(record.Close),
+			TickVolume: int32(record.TickVolume),
+		}
+	}
+
+	if err == io.EOF {
+		return Candle{}, err
+	}
+	if err != nil {
+		return Candle{}, ErrInvalidImportFile{cause: err}
+	}
+	return c, nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"os"
+)
+
+type ApiResponsePostImport struct {
+	Status     ApiResponseStatus `json:"status"`
+	PairName   string            `json:"pairName"`
+	TimeType   int               `json:"timeType"`
+	CountData  int               `json:"countData"`
+	Validation *ValidationReport `json:"validation,omitempty"`
+	Resampled  []PairDetail      `json:"resampled,omitempty"`
+}
+
+// handleImport MT4/MT5から出力したCSV・.hstファイルをリクエストボディで受け取り登録する
+// 通貨ペア・時間軸はx-pair-name, x-time-typeヘッダー、.hstファイルのヘッダー、x-file-nameヘッダーのファイル名の順に決定する
+func (s *server) handleImport(w http.ResponseWriter, r *http.Request) {
+	supportedParams := []string{"*"}
+	supportedMethods := []string{
+		"POST",
+		"OPTIONS",
+	}
+	if handleCORS(w, r, supportedParams, supportedMethods) {
+		return
+	}
+
+	writeResponse := func(err error, file importedFile, result postDataResult) {
+		status := newApiResponseStatus(r, err)
+		writeApiResponse(w, r, err, ApiResponsePostImport{
+			Status:     status,
+			PairName:   file.pairName,
+			TimeType:   file.timeType.toInt(),
+			CountData:  result.count,
+			Validation: result.validation.orNil(),
+			Resampled:  result.resampled,
+		})
+	}
+
+	fileName := requestParam(r, "x-file-name")
+	format := Utils.getStringOrDefault(requestParam(r, "x-format"), getImportFormat(fileName))
+
+	profile, err := s.timezones.resolve(requestParam(r, "x-timezone-profile"))
+	if err != nil {
+		writeResponse(err, importedFile{timeType: Unknown}, postDataResult{})
+		return
+	}
+
+	validation, err := checkValidationOptions(requestParam(r, "x-validation"), requestParam(r, "x-spike-threshold"))
+	if err != nil {
+		writeResponse(err, importedFile{timeType: Unknown}, postDataResult{})
+		return
+	}
+
+	// リクエストボディは1本ずつ読み込みながら登録する
+	// strictモードでは登録前に全件を検証するため、一時ファイルに書き出してから読み込む
+	body := io.Reader(r.Body)
+	if validation.mode == ValidationModeStrict {
+		path, err := spoolBody(s.uploads.dir, r.Body)
+		if err != nil {
+			writeResponse(err, importedFile{timeType: Unknown}, postDataResult{})
+			return
+		}
+		defer os.Remove(path)
+
+		f, err := os.Open(path)
+		if err != nil {
+			writeResponse(err, importedFile{timeType: Unknown}, postDataResult{})
+			return
+		}
+		defer f.Close()
+		body = f
+	}
+
+	file, reader, report, err := Action.openImportFile(
+		body, format, fileName, requestParam(r, "x-pair-name"), requestParam(r, "x-time-type"), validation)
+	if err != nil {
+		writeResponse(err, file, postDataResult{validation: report})
+		return
+	}
+
+	options := postDataOptions{
+		profile:    profile,
+		resample:   requestParam(r, "x-resample") == "true",
+		validation: validation,
+	}
+	result, err := Action.postDataStream(s.storeOf(r), file.pairName, file.timeType, reader, options, nil)
+	if err != nil {
+		writeResponse(err, file, result)
+		return
+	}
+
+	writeResponse(nil, file, result)
+}
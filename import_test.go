@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDetectPairAndTimeType(t *testing.T) {
+	tests := []struct {
+		fileName string
+		pairName string
+		timeType TimeType
+	}{
+		{"EURUSD60.csv", "EURUSD", H1},
+		{"eurusd1.csv", "EURUSD", M1},
+		{"EURUSD240.hst", "EURUSD", H4},
+		{"EURUSD1440.csv", "EURUSD", Daily},
+		{"EURUSD10080.csv", "EURUSD", Weekly},
+		{"/tmp/GBPUSD_M5_202301020000_202301020005.csv", "GBPUSD", M5},
+		{"USDJPY_H4_202301020000_202301312359.csv", "USDJPY", H4},
+		{"USDJPY_D1_202301020000_202301312359.csv", "USDJPY", Daily},
+		{"USDJPY_W1_202301010000_202312310000.csv", "USDJPY", Weekly},
+		{"USDJPY-M15.csv", "USDJPY", M15},
+		{"EURUSD.csv", "EURUSD", Unknown},
+		{"EURUSD_H2.csv", "EURUSD", Unknown},
+		{"EURUSD7.csv", "EURUSD", Unknown},
+		{"EUR.csv", "", Unknown},
+	}
+
+	for _, test := range tests {
+		pairName, timeType := detectPairAndTimeType(test.fileName)
+		if pairName != test.pairName || timeType != test.timeType {
+			t.Errorf("detectPairAndTimeType(%q) = %q, %d, want %q, %d",
+				test.fileName, pairName, timeType.toInt(), test.pairName, test.timeType.toInt())
+		}
+	}
+}
+
+// readTestImportFile ファイルの内容を全て読み込み、検出した通貨ペア・時間軸とローソク足を返却する
+func readTestImportFile(data []byte, format string) (importedFile, []Candle, error) {
+	file, reader, err := newImportReader(bytes.NewReader(data), format)
+	if err != nil {
+		return file, nil, err
+	}
+
+	candles := make([]Candle, 0)
+	for {
+		batch, err := readCandleBatch(reader, ingestBatchSize)
+		if err != nil {
+			return file, nil, err
+		}
+		if len(batch) == 0 {
+			return file, candles, nil
+		}
+		candles = append(candles, batch...)
+	}
+}
+
+func TestMTCSVReader(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []Candle
+	}{
+		{
+			name: "MT5 export with header and tabs",
+			content: "<DATE>\t<TIME>\t<OPEN>\t<HIGH>\t<LOW>\t<CLOSE>\t<TICKVOL>\t<VOL>\t<SPREAD>\n" +
+				"2023.01.02\t00:00:00\t1.1\t1.2\t1.0\t1.15\t10\t0\t5\n" +
+				"2023.01.02\t00:05:00\t1.15\t1.25\t1.1\t1.2\t11\t0\t5\n",
+			want: []Candle{
+				{Time: "2023.01.02 00:00", Open: 1.1, High: 1.2, Low: 1.0, Close: 1.15, TickVolume: 10},
+				{Time: "2023.01.02 00:05", Open: 1.15, High: 1.25, Low: 1.1, Close: 1.2, TickVolume: 11},
+			},
+		},
+		{
+			name: "MT4 export without header",
+			content: "2023.01.02,00:00,1.06990,1.07020,1.06970,1.07000,123\n" +
+				"\n" +
+				"2023.01.02,01:00,1.07000,1.07100,1.06900,1.07050,200\n",
+			want: []Candle{
+				{Time: "2023.01.02 00:00", Open: 1.0699, High: 1.0702, Low: 1.0697, Close: 1.07, TickVolume: 123},
+				{Time: "2023.01.02 01:00", Open: 1.07, High: 1.071, Low: 1.069, Close: 1.0705, TickVolume: 200},
+			},
+		},
+		{
+			name:    "date and time in one column",
+			content: "2023-01-02T00:00:00,1.1,1.2,1.0,1.15,10\n",
+			want:    []Candle{{Time: "2023.01.02 00:00", Open: 1.1, High: 1.2, Low: 1.0, Close: 1.15, TickVolume: 10}},
+		},
+		{
+			name:    "daily bars without time",
+			content: "2023/01/02,1.1,1.2,1.0,1.15,10\n",
+			want:    []Candle{{Time: "2023.01.02", Open: 1.1, High: 1.2, Low: 1.0, Close: 1.15, TickVolume: 10}},
+		},
+		{
+			name: "header with volume before tick volume",
+			content: "Date,Time,Open,High,Low,Close,Volume,TickVol\n" +
+				"2023.01.02,00:00,1.1,1.2,1.0,1.15,0,42\n",
+			want: []Candle{{Time: "2023.01.02 00:00", Open: 1.1, High: 1.2, Low: 1.0, Close: 1.15, TickVolume: 42}},
+		},
+		{
+			name:    "no volume column",
+			content: "Date,Time,Open,High,Low,Close\n2023.01.02,00:00,1.1,1.2,1.0,1.15\n",
+			want:    []Candle{{Time: "2023.01.02 00:00", Open: 1.1, High: 1.2, Low: 1.0, Close: 1.15}},
+		},
+	}
+
+	for _, test := range tests {
+		_, got, err := readTestImportFile([]byte(test.content), ImportFormatCSV)
+		if err != nil {
+			t.Errorf("%s: read returned %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: read %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestMTCSVReaderRejectsInvalidRows(t *testing.T) {
+	for _, content := range []string{
+		"2023.01.02,00:00,1.1,abc,1.0,1.15,10\n",
+		"2023.01.02,00:00,1.1,1.2,1.0,1.15,many\n",
+		"Date,Time,Open,High,Low,Close\n2023.01.02,00:00,1.1,1.2\n",
+		"Date,Time,Price,Size\n2023.01.02,00:00,1.1,10\n",
+	} {
+		_, _, err := readTestImportFile([]byte(content), ImportFormatCSV)
+		if _, ok := err.(ErrInvalidImportFile); !ok {
+			t.Errorf("read %q returned %v, want ErrInvalidImportFile", content, err)
+		}
+	}
+}
+
+// newTestHST ヘッダーとレコードから.hstファイルの内容を作成する
+func newTestHST(t *testing.T, version int32, symbol string, period int32, records ...interface{}) []byte {
+	t.Helper()
+	header := hstHeader{Version: version, Period: period, Digits: 5}
+	copy(header.Symbol[:], symbol)
+
+	var buffer bytes.Buffer
+	for _, data := range append([]interface{}{header}, records...) {
+		err := binary.Write(&buffer, binary.LittleEndian, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buffer.Bytes()
+}
+
+func TestHSTReader(t *testing.T) {
+	open := time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		data        []byte
+		want        importedFile
+		wantCandles []Candle
+	}{
+		{
+			name: "version 400",
+			data: newTestHST(t, 400, "EURUSD", 60,
+				hstRecord400{Time: int32(open.Unix()), Open: 1.1, Low: 1.0, High: 1.2, Close: 1.15, Volume: 10},
+				hstRecord400{Time: int32(open.Add(time.Hour).Unix()), Open: 1.15, Low: 1.1, High: 1.25, Close: 1.2, Volume: 11}),
+			want: importedFile{pairName: "EURUSD", timeType: H1},
+			wantCandles: []Candle{
+				{Time: "2023.01.02 00:00", Open: 1.1, High: 1.2, Low: 1.0, Close: 1.15, TickVolume: 10},
+				{Time: "2023.01.02 01:00", Open: 1.15, High: 1.25, Low: 1.1, Close: 1.2, TickVolume: 11},
+			},
+		},
+		{
+			name: "version 401 with broker suffix",
+			data: newTestHST(t, 401, "gbpusd.m", 5,
+				hstRecord401{Time: open.Unix(), Open: 1.1, High: 1.2, Low: 1.0, Close: 1.15, TickVolume: 10, Spread: 3}),
+			want: importedFile{pairName: "GBPUSD", timeType: M5},
+			wantCandles: []Candle{
+				{Time: "2023.01.02 00:00", Open: 1.1, High: 1.2, Low: 1.0, Close: 1.15, TickVolume: 10},
+			},
+		},
+		{
+			name:        "no records and unknown period",
+			data:        newTestHST(t, 401, "XAUUSD", 2),
+			want:        importedFile{pairName: "XAUUSD", timeType: Unknown},
+			wantCandles: []Candle{},
+		},
+	}
+
+	for _, test := range tests {
+		got, candles, err := readTestImportFile(test.data, ImportFormatHST)
+		if err != nil {
+			t.Errorf("%s: read returned %v", test.name, err)
+			continue
+		}
+		if got != test.want || !reflect.DeepEqual(candles, test.wantCandles) {
+			t.Errorf("%s: read %+v %+v, want %+v %+v", test.name, got, candles, test.want, test.wantCandles)
+		}
+	}
+}
+
+func TestHSTReaderRejectsInvalidFile(t *testing.T) {
+	valid := newTestHST(t, 401, "EURUSD", 60, hstRecord401{Time: 1672617600, Open: 1.1, High: 1.2, Low: 1.0, Close: 1.15})
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"unsupported version", newTestHST(t, 500, "EURUSD", 60)},
+		{"truncated header", valid[:100]},
+		{"truncated record", valid[:len(valid)-1]},
+	}
+
+	for _, test := range tests {
+		_, _, err := readTestImportFile(test.data, ImportFormatHST)
+		if _, ok := err.(ErrInvalidImportFile); !ok {
+			t.Errorf("%s: read returned %v, want ErrInvalidImportFile", test.name, err)
+		}
+	}
+}
+
+func TestHandleImport(t *testing.T) {
+	rows := "2023.01.02,00:00,1.1,1.2,1.0,1.15,10\n" +
+		"2023.01.02,00:01,1.1,1.0,1.2,1.15,10\n" + // 高値が安値より低い
+		"2023.01.02,00:02,1.1,1.2,1.0,1.15,10\n"
+	open := time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC)
+	hst := newTestHST(t, 401, "EURUSD", 60,
+		hstRecord401{Time: open.Unix(), Open: 1.1, High: 1.2, Low: 1.0, Close: 1.15},
+		hstRecord401{Time: open.Add(time.Hour).Unix(), Open: 1.15, High: 1.16, Low: 1.14, Close: 1.15})
+
+	tests := []struct {
+		name        string
+		body        []byte
+		header      map[string]string
+		wantErr     error
+		wantType    TimeType
+		wantCount   int // レスポンスの登録した本数
+		wantStored  int // 登録されている本数
+		wantInvalid int
+	}{
+		{"csv", []byte(rows), map[string]string{"x-file-name": "EURUSD1.csv"}, nil, M1, 2, 2, 1},
+		{"strict registers nothing", []byte(rows), map[string]string{"x-file-name": "EURUSD1.csv", "x-validation": "strict"},
+			ErrValidationFailed{}, M1, 0, 0, 1},
+		{"hst", hst, map[string]string{"x-format": "hst"}, nil, H1, 2, 2, 0},
+		{"hst strict", hst, map[string]string{"x-file-name": "EURUSD60.hst", "x-validation": "strict"}, nil, H1, 2, 2, 0},
+		{"unknown time type", []byte(rows), map[string]string{"x-file-name": "EURUSD.csv"}, ErrInvalidTimeType{}, M1, 0, 0, 0},
+	}
+
+	for _, test := range tests {
+		uploads, err := newUploadManager(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := &server{store: newMemoryStore(), timezones: newTestTimezoneRegistry(t), uploads: uploads}
+
+		r := httptest.NewRequest("POST", "/api/import", bytes.NewReader(test.body))
+		r.Header.Set("x-pair-name", "EURUSD")
+		for name, value := range test.header {
+			r.Header.Set(name, value)
+		}
+		recorder := httptest.NewRecorder()
+		s.handleImport(recorder, r)
+
+		var response ApiResponsePostImport
+		err = json.NewDecoder(recorder.Body).Decode(&response)
+		if err != nil {
+			t.Fatal(err)
+		}
+		spec, _ := lookupError(test.wantErr)
+		if test.wantErr == nil {
+			spec = errorSpec{}
+		}
+		if response.Status.ErrorCode != spec.code || response.CountData != test.wantCount {
+			t.Errorf("%s: status %+v, count %d, want %s, %d", test.name, response.Status, response.CountData, spec.name, test.wantCount)
+		}
+		if invalid := response.Validation; test.wantInvalid > 0 && (invalid == nil || invalid.Invalid != test.wantInvalid) {
+			t.Errorf("%s: validation %+v, want %d invalid", test.name, invalid, test.wantInvalid)
+		}
+
+		stored, err := s.store.countCandles("EURUSD", test.wantType, minFixTime, maxFixTime)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stored != test.wantStored {
+			t.Errorf("%s: %d candles stored, want %d", test.name, stored, test.wantStored)
+		}
+	}
+}
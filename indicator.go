@@ -0,0 +1,354 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// maxIndicatorPeriod 指標の期間として指定できるローソク足の最大本数
+const maxIndicatorPeriod = 1000
+
+type (
+	// IndicatorSeries 1つの指標の計算結果(値が未確定の箇所はnull)
+	IndicatorSeries struct {
+		Name  string                `json:"name"`
+		Lines map[string][]*float64 `json:"lines"`
+	}
+
+	// indicatorSpec 計算する指標の種類とパラメータ
+	indicatorSpec struct {
+		name   string
+		kind   string
+		params []float64
+	}
+)
+
+// parseIndicatorSpecs "sma:20;macd:12,26,9"形式の指定を解析する
+func parseIndicatorSpecs(value string) ([]indicatorSpec, error) {
+	specs := make([]indicatorSpec, 0)
+	for _, item := range strings.Split(value, ";") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		kind, rawParams, _ := strings.Cut(item, ":")
+		params := make([]float64, 0)
+		if rawParams != "" {
+			for _, rawParam := range strings.Split(rawParams, ",") {
+				param, err := strconv.ParseFloat(strings.TrimSpace(rawParam), 64)
+				if err != nil || !(param > 0) || math.IsInf(param, 1) {
+					return nil, ErrInvalidIndicator{}
+				}
+				params = append(params, param)
+			}
+		}
+
+		spec := indicatorSpec{name: item, kind: strings.ToLower(kind), params: params}
+		if !spec.isValid() || !spec.hasValidPeriods() {
+			return nil, ErrInvalidIndicator{}
+		}
+		specs = append(specs, spec)
+	}
+
+	if len(specs) == 0 {
+		return nil, ErrInvalidIndicator{}
+	}
+	return specs, nil
+}
+
+// isValid 指標の種類に対してパラメータの数が正しいかを返却する
+func (spec indicatorSpec) isValid() bool {
+	switch spec.kind {
+	case "sma", "ema", "rsi", "atr":
+		return len(spec.params) == 1
+	case "bb":
+		return len(spec.params) == 2
+	case "macd":
+		return len(spec.params) == 3
+	}
+	return false
+}
+
+// hasValidPeriods 期間を表すパラメータが1からmaxIndicatorPeriodまでの整数かを返却する
+// ボリンジャーバンドの偏差(2番目のパラメータ)は期間ではないため、小数を許容する
+func (spec indicatorSpec) hasValidPeriods() bool {
+	for i, param := range spec.params {
+		if spec.kind == "bb" && i == 1 {
+			continue
+		}
+		if param != math.Trunc(param) || param < 1 || param > maxIndicatorPeriod {
+			return false
+		}
+	}
+	return true
+}
+
+// period パラメータをローソク足の本数として返却する
+func (spec indicatorSpec) period(index int) int {
+	return int(spec.params[index])
+}
+
+// warmup 計算に必要な、表示期間より前のローソク足の本数を返却する
+// 指数平滑を用いる指標は、初期値の影響が十分に小さくなるまで遡る
+func (spec indicatorSpec) warmup() int {
+	switch spec.kind {
+	case "sma", "bb":
+		return spec.period(0)
+	case "ema", "rsi", "atr":
+		return spec.period(0) * 4
+	case "macd":
+		return spec.period(1)*4 + spec.period(2)
+	}
+	return 0
+}
+
+// compute ローソク足の系列から指標を計算する
+func (spec indicatorSpec) compute(candles []Candle) map[string][]float64 {
+	closes := make([]float64, len(candles))
+	for i, c := range candles {
+		closes[i] = toPrice(c.Close)
+	}
+
+	switch spec.kind {
+	case "sma":
+		return map[string][]float64{"value": sma(closes, spec.period(0))}
+	case "ema":
+		return map[string][]float64{"value": ema(closes, spec.period(0))}
+	case "rsi":
+		return map[string][]float64{"value": rsi(closes, spec.period(0))}
+	case "atr":
+		return map[string][]float64{"value": atr(candles, spec.period(0))}
+	case "bb":
+		upper, middle, lower := bollinger(closes, spec.period(0), spec.params[1])
+		return map[string][]float64{"upper": upper, "middle": middle, "lower": lower}
+	case "macd":
+		line, signal, histogram := macd(closes, spec.period(0), spec.period(1), spec.period(2))
+		return map[string][]float64{"macd": line, "signal": signal, "histogram": histogram}
+	}
+	return map[string][]float64{}
+}
+
+// newNaNSeries 全ての値が未確定(NaN)の系列を作成する
+func newNaNSeries(length int) []float64 {
+	values := make([]float64, length)
+	for i := range values {
+		values[i] = math.NaN()
+	}
+	return values
+}
+
+// sma 単純移動平均
+func sma(values []float64, period int) []float64 {
+	results := newNaNSeries(len(values))
+	sum := 0.0
+	for i, v := range values {
+		sum += v
+		if i >= period {
+			sum -= values[i-period]
+		}
+		if i >= period-1 {
+			results[i] = sum / float64(period)
+		}
+	}
+	return results
+}
+
+// ema 指数平滑移動平均(最初の値は単純移動平均)
+// 先頭の未確定(NaN)の値は読み飛ばす
+func ema(values []float64, period int) []float64 {
+	results := newNaNSeries(len(values))
+	alpha := 2 / float64(period+1)
+
+	start := 0
+	for start < len(values) && math.IsNaN(values[start]) {
+		start++
+	}
+
+	sum := 0.0
+	for i := start; i < len(values); i++ {
+		switch {
+		case i < start+period-1:
+			sum += values[i]
+		case i == start+period-1:
+			sum += values[i]
+			results[i] = sum / float64(period)
+		default:
+			results[i] = results[i-1] + alpha*(values[i]-results[i-1])
+		}
+	}
+	return results
+}
+
+// wilder ワイルダーの平滑化(最初の値は単純移動平均)
+func wilder(values []float64, period int, start int) []float64 {
+	results := newNaNSeries(len(values))
+	sum := 0.0
+	for i := start; i < len(values); i++ {
+		switch {
+		case i < start+period-1:
+			sum += values[i]
+		case i == start+period-1:
+			sum += values[i]
+			results[i] = sum / float64(period)
+		default:
+			results[i] = (results[i-1]*float64(period-1) + values[i]) / float64(period)
+		}
+	}
+	return results
+}
+
+// rsi 相対力指数(ワイルダー方式)
+func rsi(closes []float64, period int) []float64 {
+	gains := make([]float64, len(closes))
+	losses := make([]float64, len(closes))
+	for i := 1; i < len(closes); i++ {
+		change := closes[i] - closes[i-1]
+		if change > 0 {
+			gains[i] = change
+		} else {
+			losses[i] = -change
+		}
+	}
+
+	averageGains := wilder(gains, period, 1)
+	averageLosses := wilder(losses, period, 1)
+
+	results := newNaNSeries(len(closes))
+	for i := range closes {
+		if math.IsNaN(averageGains[i]) {
+			continue
+		}
+		if averageLosses[i] == 0 {
+			results[i] = 100
+			continue
+		}
+		results[i] = 100 - 100/(1+averageGains[i]/averageLosses[i])
+	}
+	return results
+}
+
+// macd MACD・シグナル・ヒストグラム
+func macd(closes []float64, fast int, slow int, signal int) ([]float64, []float64, []float64) {
+	fastEma := ema(closes, fast)
+	slowEma := ema(closes, slow)
+
+	line := newNaNSeries(len(closes))
+	for i := range closes {
+		line[i] = fastEma[i] - slowEma[i]
+	}
+
+	signalLine := ema(line, signal)
+	histogram := make([]float64, len(closes))
+	for i := range closes {
+		histogram[i] = line[i] - signalLine[i]
+	}
+	return line, signalLine, histogram
+}
+
+// bollinger ボリンジャーバンド(標準偏差は母集団の標準偏差)
+func bollinger(closes []float64, period int, deviation float64) ([]float64, []float64, []float64) {
+	middle := sma(closes, period)
+	upper := newNaNSeries(len(closes))
+	lower := newNaNSeries(len(closes))
+
+	for i := period - 1; i < len(closes); i++ {
+		variance := 0.0
+		for _, v := range closes[i-period+1 : i+1] {
+			variance += (v - middle[i]) * (v - middle[i])
+		}
+		stddev := math.Sqrt(variance / float64(period))
+		upper[i] = middle[i] + deviation*stddev
+		lower[i] = middle[i] - deviation*stddev
+	}
+	return upper, middle, lower
+}
+
+// atr アベレージ・トゥルー・レンジ(ワイルダー方式)
+func atr(candles []Candle, period int) []float64 {
+	trueRanges := make([]float64, len(candles))
+	for i, c := range candles {
+		high, low := toPrice(c.High), toPrice(c.Low)
+		trueRanges[i] = high - low
+		if i > 0 {
+			prevClose := toPrice(candles[i-1].Close)
+			trueRanges[i] = math.Max(trueRanges[i], math.Max(math.Abs(high-prevClose), math.Abs(low-prevClose)))
+		}
+	}
+	return wilder(trueRanges, period, 0)
+}
+
+// computeIndicators 指定期間のローソク足に対して指標を計算する
+// replayTimeを指定した場合、その時刻以降のローソク足は含めず、形成中の足は下位足から合成する
+func (action) computeIndicators(
+	store CandleStore,
+	pairName string,
+	timeType TimeType,
+	from string,
+	to string,
+	specs []indicatorSpec,
+	lowerTimeType TimeType,
+	replayTime string) ([]string, []IndicatorSeries, error) {
+
+	if replayTime != "" && replayTime < to {
+		to = replayTime
+	}
+
+	candles, err := store.queryCandles(pairName, timeType, from, to)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if replayTime != "" && len(candles) > 0 {
+		last := &candles[len(candles)-1]
+		lowers, err := store.queryCandles(pairName, lowerTimeType, last.Time, replayTime)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(lowers) > 0 {
+			partial := lowers[0]
+			partial.Time = last.Time
+			for _, lower := range lowers[1:] {
+				mergeCandle(&partial, lower)
+			}
+			*last = partial
+		}
+	}
+
+	warmup := 0
+	for _, spec := range specs {
+		if warmup < spec.warmup() {
+			warmup = spec.warmup()
+		}
+	}
+
+	history, err := store.queryLatestCandles(pairName, timeType, from, warmup)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	all := append(history, candles...)
+	times := make([]string, len(candles))
+	for i, c := range candles {
+		times[i] = c.Time
+	}
+
+	series := make([]IndicatorSeries, 0, len(specs))
+	for _, spec := range specs {
+		lines := make(map[string][]*float64)
+		for lineName, values := range spec.compute(all) {
+			aligned := make([]*float64, len(candles))
+			for i, v := range values[len(history):] {
+				if !math.IsNaN(v) {
+					value := v
+					aligned[i] = &value
+				}
+			}
+			lines[lineName] = aligned
+		}
+		series = append(series, IndicatorSeries{Name: spec.name, Lines: lines})
+	}
+
+	return times, series, nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import "testing"
+
+func TestParseIndicatorSpecs(t *testing.T) {
+	tests := []struct {
+		value string
+		valid bool
+	}{
+		{"sma:20", true},
+		{"sma:20;macd:12,26,9", true},
+		{"bb:20,2.5", true},
+		{"sma:1000", true},
+		{"ema:0.5", false},
+		{"sma:20.5", false},
+		{"sma:0", false},
+		{"sma:1001", false},
+		{"sma:1e12", false},
+		{"rsi:NaN", false},
+		{"bb:20,Inf", false},
+		{"bb:20.5,2", false},
+		{"macd:12,26", false},
+		{"unknown:10", false},
+		{"", false},
+	}
+
+	for _, test := range tests {
+		_, err := parseIndicatorSpecs(test.value)
+		if test.valid && err != nil {
+			t.Errorf("parseIndicatorSpecs(%q) returned %v", test.value, err)
+		}
+		if !test.valid && err != (ErrInvalidIndicator{}) {
+			t.Errorf("parseIndicatorSpecs(%q) returned %v, want ErrInvalidIndicator", test.value, err)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+)
+
+const (
+	UploadFormatJSON   = "json"
+	UploadFormatNDJSON = "ndjson"
+	UploadFormatCSV    = "csv"
+
+	// ingestBatchSize ストリーミングでの取り込み時に、1度に登録するローソク足の本数
+	ingestBatchSize = 5000
+)
+
+type (
+	// candleReader ローソク足を1本ずつ読み込む(終端ではio.EOFを返却する)
+	candleReader interface {
+		read() (Candle, error)
+	}
+
+	// payloadCandleReader UploadPayload形式のJSONを、dataの配列の要素ごとに読み込む
+	payloadCandleReader struct {
+		decoder *json.Decoder
+		started bool
+	}
+
+	// ndjsonCandleReader 1行に1本のローソク足を記述したNDJSONを読み込む
+	ndjsonCandleReader struct {
+		decoder *json.Decoder
+	}
+)
+
+// checkUploadFormat アップロード形式を検証する(未指定の場合はJSON)
+func checkUploadFormat(format string) (string, error) {
+	format = Utils.getStringOrDefault(format, UploadFormatJSON)
+	switch format {
+	case UploadFormatJSON, UploadFormatNDJSON, UploadFormatCSV:
+		return format, nil
+	}
+	return "", ErrInvalidUploadFormat{}
+}
+
+// newCandleReader アップロード形式に応じたcandleReaderを生成する
+func newCandleReader(r io.Reader, format string) (candleReader, error) {
+	format, err := checkUploadFormat(format)
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case UploadFormatNDJSON:
+		return &ndjsonCandleReader{decoder: json.NewDecoder(r)}, nil
+	case UploadFormatCSV:
+		return newMTCSVReader(r), nil
+	}
+	return &payloadCandleReader{decoder: json.NewDecoder(r)}, nil
+}
+
+func (reader *payloadCandleReader) read() (Candle, error) {
+	if !reader.started {
+		err := reader.seekData()
+		if err != nil {
+			return Candle{}, err
+		}
+		reader.started = true
+	}
+
+	if !reader.decoder.More() {
+		return Candle{}, io.EOF
+	}
+
+	var c Candle
+	err := reader.decoder.Decode(&c)
+	if err != nil {
+		return Candle{}, ErrInvalidData{cause: err}
+	}
+	return c, nil
+}
+
+// seekData dataの配列の先頭まで読み進める(それ以外のキーの値は読み飛ばす)
+func (reader *payloadCandleReader) seekData() error {
+	token, err := reader.decoder.Token()
+	if err != nil || token != json.Delim('{') {
+		return ErrInvalidData{cause: err}
+	}
+
+	for reader.decoder.More() {
+		key, err := reader.decoder.Token()
+		if err != nil {
+			return ErrInvalidData{cause: err}
+		}
+
+		if key != "data" {
+			var skipped json.RawMessage
+			err = reader.decoder.Decode(&skipped)
+			if err != nil {
+				return ErrInvalidData{cause: err}
+			}
+			continue
+		}
+
+		token, err = reader.decoder.Token()
+		if err != nil || token != json.Delim('[') {
+			return ErrInvalidData{cause: err}
+		}
+		return nil
+	}
+
+	return io.EOF
+}
+
+func (reader *ndjsonCandleReader) read() (Candle, error) {
+	var c Candle
+	err := reader.decoder.Decode(&c)
+	if err == io.EOF {
+		return Candle{}, err
+	}
+	if err != nil {
+		return Candle{}, ErrInvalidData{cause: err}
+	}
+	return c, nil
+}
+
+// readCandleBatch 最大でsize本のローソク足を読み込む(終端に達した場合は読み込めた分のみ返却する)
+func readCandleBatch(reader candleReader, size int) ([]Candle, error) {
+	candles := make([]Candle, 0, size)
+	for len(candles) < size {
+		c, err := reader.read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		candles = append(candles, c)
+	}
+	return candles, nil
+}
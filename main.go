@@ -3,68 +3,96 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
+	"flag"
 	"log"
 	"os"
 	"os/signal"
+	"syscall"
 	"time"
 )
 
-// config 設定ファイルの内容を管理する構造体
-type config struct {
-	DBUserName   string
-	DBUserPass   string
-	DBAddress    string
-	DBPort       int
-	DatabaseName string
-	ServerPort   int
-}
-
-// loadConfig　設定ファイルの読み込み
-func loadConfig() (*config, error) {
-	f, err := os.Open("config.json")
-	if err != nil {
-		return nil, err
-	}
-	config := config{}
-	err = json.NewDecoder(f).Decode(&config)
+// runServe 設定を読み込み、HTTPサーバーを起動する
+// SIGHUPを受信した場合は、起動時と同じ引数で設定を読み込み直し、実行中に変更できる設定のみ反映する
+func runServe(args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	loader := newConfigLoader(flags)
+	err := flags.Parse(args)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	return &config, nil
-}
 
-// main プログラムのエントリーポイント
-func main() {
-	log.Println("設定ファイルを読み込んでいます")
-	config, err := loadConfig()
+	log.Println(logMessage(logLoadConfig))
+	config, err := loader.load()
 	if err != nil {
-		log.Println("Failed to load config.json", err)
-		return
+		return err
 	}
+	setLogLanguage(config.Language)
 
 	s, err := newServer(config)
 	if err != nil {
-		log.Println("Failed to initialize server", err)
-		return
+		return err
 	}
 
 	go func() {
 		s.accept()
-		log.Println("サーバーの受信待ちを終了しました")
+		log.Println(logMessage(logServerStopped))
 	}()
 
-	quit := make(chan os.Signal)
+	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt)
 
-	<-quit
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
 
-	log.Println("終了処理を開始します")
+wait:
+	for {
+		select {
+		case <-hup:
+			log.Println(logMessage(logReloadConfig))
+			reloaded, err := loader.load()
+			if err == nil {
+				err = s.reload(config, reloaded)
+			}
+			if err != nil {
+				log.Println("Failed to reload config", errorLogMessage(err))
+			}
+		case <-quit:
+			break wait
+		}
+	}
+
+	log.Println(logMessage(logShutdown))
 
-	ctx, _ := context.WithTimeout(context.Background(), 5*time.Second)
-	if err := s.shutdown(ctx); err != nil {
-		log.Print(err)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = s.shutdown(ctx)
+	if err != nil {
+		return err
 	}
 
-	log.Println("システムを終了します")
+	log.Println(logMessage(logExit))
+	return nil
+}
+
+// main プログラムのエントリーポイント
+// 第1引数のサブコマンドを実行する(サブコマンドの一覧はcliCommandsを参照)
+func main() {
+	command, args := findCommand(os.Args[1:])
+	if command == nil {
+		printCommands()
+		if os.Args[1] != "help" {
+			os.Exit(2)
+		}
+		return
+	}
+
+	err := command.run(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to %s: %s\n", command.name, errorLogMessage(err))
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"sort"
+	"sync"
+)
+
+type (
+	// memoryTable 1つの通貨ペアのデータを時間軸・確定時刻ごとに保持する
+	memoryTable map[TimeType]map[string]Candle
+
+	// memoryStore プロセス内のメモリにデータを保持するストレージの実装
+	memoryStore struct {
+		mutex  sync.RWMutex
+		tables map[string]memoryTable
+	}
+)
+
+// newMemoryStore memoryStoreをnewする
+func newMemoryStore() *memoryStore {
+	return &memoryStore{tables: make(map[string]memoryTable)}
+}
+
+func (s *memoryStore) open() error {
+	return nil
+}
+
+func (s *memoryStore) close() error {
+	return nil
+}
+
+// createDataTable データテーブルを作成する
+func (s *memoryStore) createDataTable(pairName string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.tables[pairName]; !ok {
+		s.tables[pairName] = make(memoryTable)
+	}
+	return nil
+}
+
+// registerData データテーブルにデータを挿入する
+func (s *memoryStore) registerData(pairName string, timeType TimeType, candles []Candle, policy string) (registerResult, error) {
+	if timeType == Unknown {
+		return registerResult{}, ErrInvalidTimeType{}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	table, ok := s.tables[pairName]
+	if !ok {
+		return registerResult{}, ErrInvalidPairName{}
+	}
+
+	rows, ok := table[timeType]
+	if !ok {
+		rows = make(map[string]Candle)
+		table[timeType] = rows
+	}
+
+	// 比較用の写しを作成する(分類の途中で既存データを書き換えないため)
+	existing := make(map[string]Candle)
+	for _, c := range candles {
+		if stored, exists := rows[c.Time]; exists {
+			existing[c.Time] = stored
+		}
+	}
+
+	write := func(candles []Candle) error {
+		for _, c := range candles {
+			rows[c.Time] = c
+		}
+		return nil
+	}
+	return classifyCandles(existing, candles).apply(policy, write, write)
+}
+
+// getUploadedPairNames データがアップロードされている通貨ペア名の一覧を返却する
+func (s *memoryStore) getUploadedPairNames() ([]string, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	pairNames := make([]string, 0, len(s.tables))
+	for pairName := range s.tables {
+		pairNames = append(pairNames, pairName)
+	}
+	sort.Strings(pairNames)
+	return pairNames, nil
+}
+
+func (s *memoryStore) getUploadedPairDetail(pairName string) (map[int]int, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	countTable := make(map[int]int)
+	for timeType, rows := range s.tables[pairName] {
+		if len(rows) > 0 {
+			countTable[timeType.toInt()] = len(rows)
+		}
+	}
+	return countTable, nil
+}
+
+func (s *memoryStore) deleteData(pairName string, timeTypes []TimeType) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	table, ok := s.tables[pairName]
+	if !ok {
+		return nil
+	}
+
+	for _, timeType := range timeTypes {
+		delete(table, timeType)
+	}
+	return nil
+}
+
+func (s *memoryStore) deleteDataRange(pairName string, timeType TimeType, from string, to string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	rows := s.tables[pairName][timeType]
+	for fixTime := range rows {
+		if from <= fixTime && fixTime <= to {
+			delete(rows, fixTime)
+		}
+	}
+	return nil
+}
+
+// replaceDataRange 期間内の行の削除とローソク足の登録を、1回のロックの中で行う
+func (s *memoryStore) replaceDataRange(pairName string, timeType TimeType, from string, to string, candles []Candle) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	table, ok := s.tables[pairName]
+	if !ok {
+		return ErrInvalidPairName{}
+	}
+	rows, ok := table[timeType]
+	if !ok {
+		rows = make(map[string]Candle)
+		table[timeType] = rows
+	}
+
+	for fixTime := range rows {
+		if from <= fixTime && fixTime <= to {
+			delete(rows, fixTime)
+		}
+	}
+	for _, c := range candles {
+		rows[c.Time] = c
+	}
+	return nil
+}
+
+func (s *memoryStore) queryCandles(pairName string, timeType TimeType, from string, to string) ([]Candle, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	candles := make([]Candle, 0)
+	for _, c := range s.sortedCandles(pairName, timeType) {
+		if from <= c.Time && c.Time <= to {
+			candles = append(candles, c)
+		}
+	}
+	return candles, nil
+}
+
+// eachCandle 期間内のローソク足を確定時刻の昇順にfnに渡す
+// fnの処理中に書き込みを妨げないよう、対象のローソク足を複製してからロックを解放する
+func (s *memoryStore) eachCandle(pairName string, timeType TimeType, from string, to string, fn func(c Candle) error) error {
+	candles, err := s.queryCandles(pairName, timeType, from, to)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range candles {
+		err = fn(c)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) queryCandleRange(pairName string, timeType TimeType, from string, to string, descending bool, limit int) ([]Candle, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	candles := s.sortedCandles(pairName, timeType)
+	start := sort.Search(len(candles), func(i int) bool { return candles[i].Time >= from })
+	end := sort.Search(len(candles), func(i int) bool { return candles[i].Time > to })
+	if end < start {
+		end = start
+	}
+
+	page := make([]Candle, 0, Utils.minInt(limit, end-start))
+	for i := 0; i < end-start && len(page) < limit; i++ {
+		if descending {
+			page = append(page, candles[end-1-i])
+		} else {
+			page = append(page, candles[start+i])
+		}
+	}
+	return page, nil
+}
+
+func (s *memoryStore) queryLatestCandles(pairName string, timeType TimeType, before string, limit int) ([]Candle, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	candles := s.sortedCandles(pairName, timeType)
+	end := sort.Search(len(candles), func(i int) bool { return candles[i].Time >= before })
+	start := end - limit
+	if start < 0 {
+		start = 0
+	}
+	return candles[start:end], nil
+}
+
+func (s *memoryStore) countCandles(pairName string, timeType TimeType, from string, to string) (int, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	candles := s.sortedCandles(pairName, timeType)
+	start := sort.Search(len(candles), func(i int) bool { return candles[i].Time >= from })
+	end := sort.Search(len(candles), func(i int) bool { return candles[i].Time > to })
+	if end < start {
+		return 0, nil
+	}
+	return end - start, nil
+}
+
+func (s *memoryStore) queryDataSummary(pairName string, timeType TimeType) ([]string, []int32, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	candles := s.sortedCandles(pairName, timeType)
+	fixTimes := make([]string, 0, len(candles))
+	tickVolumes := make([]int32, 0, len(candles))
+	for _, c := range candles {
+		fixTimes = append(fixTimes, c.Time)
+		tickVolumes = append(tickVolumes, c.TickVolume)
+	}
+	return fixTimes, tickVolumes, nil
+}
+
+// queryData SQL_DATAと同じ規則で、下位足の時刻を基準に上位足のローソク足を取得する
+func (s *memoryStore) queryData(
+	pairName string,
+	lowerTimeType TimeType,
+	lowerFixTime string,
+	upperTimeType TimeType,
+	limit int) ([]Candle, error) {
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	// 処理対象の上位足(新しい順)
+	uppers := make([]Candle, 0, limit)
+	upperCandles := s.sortedCandles(pairName, upperTimeType)
+	for i := len(upperCandles) - 1; i >= 0 && len(uppers) < limit; i-- {
+		if upperCandles[i].Time <= lowerFixTime {
+			uppers = append(uppers, upperCandles[i])
+		}
+	}
+
+	if len(uppers) < 2 {
+		return nil, ErrInvalidData{}
+	}
+
+	// 最も新しい上位足に、それ以降の下位足を合成する
+	latest := uppers[0]
+	latestTime := latest.Time
+	for _, c := range s.sortedCandles(pairName, lowerTimeType) {
+		if c.Time <= uppers[0].Time || lowerFixTime < c.Time {
+			continue
+		}
+		if c.High > latest.High {
+			latest.High = c.High
+		}
+		if c.Low < latest.Low {
+			latest.Low = c.Low
+		}
+		if c.Time > latestTime {
+			latest.Close = c.Close
+			latestTime = c.Time
+		}
+		latest.TickVolume += c.TickVolume
+	}
+
+	candles := make([]Candle, 0, len(uppers))
+	candles = append(candles, latest)
+	candles = append(candles, uppers[1:]...)
+	return candles, nil
+}
+
+// sortedCandles 指定した時間軸のローソク足を確定時刻の昇順で返却する
+func (s *memoryStore) sortedCandles(pairName string, timeType TimeType) []Candle {
+	rows := s.tables[pairName][timeType]
+	candles := make([]Candle, 0, len(rows))
+	for _, c := range rows {
+		candles = append(candles, c)
+	}
+	sort.Slice(candles, func(i, j int) bool { return candles[i].Time < candles[j].Time })
+	return candles
+}
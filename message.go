@@ -0,0 +1,376 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	// LanguageJapanese 日本語(japaneseMessagesのメッセージを使用する)
+	LanguageJapanese = "ja"
+	// LanguageEnglish 英語(englishMessagesのメッセージを使用する)
+	LanguageEnglish = "en"
+)
+
+// ログのメッセージコード(エラーコードと重複しないよう0x9000番台を使用する)
+// 追加する場合は末尾に追加し、japaneseMessages・englishMessagesにもメッセージを追加する
+const (
+	// logMigrateSchema スキーマの移行の開始
+	logMigrateSchema uint16 = 0x9001 + iota
+	// logMigrateSchemaDone スキーマの移行の完了
+	logMigrateSchemaDone
+	// logLoadConfig 設定の読み込み
+	logLoadConfig
+	// logServerStopped 受信待ちの終了
+	logServerStopped
+	// logReloadConfig 設定の再読み込みの開始
+	logReloadConfig
+	// logShutdown 終了処理の開始
+	logShutdown
+	// logExit 終了
+	logExit
+	// logSchemaPinned 固定されたスキーマの更新の省略
+	logSchemaPinned
+	// logSchemaUpgrade スキーマの更新
+	logSchemaUpgrade
+	// logSchemaDowngrade スキーマの巻き戻し
+	logSchemaDowngrade
+	// logRegistered ローソク足の登録
+	logRegistered
+	// logResampled ローソク足の再生成
+	logResampled
+	// logFileWritten ファイルの書き出し
+	logFileWritten
+	// logAuthDisabled 認証の無効化
+	logAuthDisabled
+	// logAuthRestartRequired 認証の切り替えの保留
+	logAuthRestartRequired
+	// logRestartRequired 設定の変更の保留
+	logRestartRequired
+	// logConfigReloaded 設定の再読み込みの完了
+	logConfigReloaded
+	// logServerShutdown サーバーのシャットダウン
+	logServerShutdown
+	// logDatabaseClose データベースのクローズ
+	logDatabaseClose
+	// logResourcesReleased リソースの解放の完了
+	logResourcesReleased
+)
+
+type (
+	// languageKey リクエストの言語をコンテキストに格納する際のキー
+	languageKey struct{}
+
+	// formattedError カタログのメッセージにfmt.Sprintfで値を埋め込むエラー
+	formattedError interface {
+		messageArgs() []interface{}
+	}
+)
+
+// japaneseMessages エラーコード・ログのメッセージコードごとの日本語のメッセージ
+// エラーのError()もこのメッセージを使用する。エラーを追加する場合はenglishMessagesにも追加する
+var japaneseMessages = map[uint16]string{
+	0x8001: "max_allowed_packetの取得に失敗しました",
+	0x8002: "予期しない日付フォーマットが指定されました",
+	0x8003: "不正な時間軸が指定されました",
+	0x8004: "複数のエラーが発生しました: %s",
+	0x8005: "通貨ペア名が不正です。通貨ペア名に使用できる文字は大文字の英字で6文字までです",
+	0x8006: "ローソク足は必ず1件以上指定してください",
+	0x8007: "アップロードデータの不足、もしくは不正パラメータの指定によりデータの取得に失敗しました。",
+	0x8008: "リミットパラーメータが不正です。1〜100の数値を指定してください",
+	0x8009: "時刻が不正です。yyyy-MM-dd HH:mm:ss形式で指定してください",
+	0x800A: "上位足に指定時刻のデータが存在しない可能性があります。\nアップロードしたデータを確認してください。",
+	0x800B: "StoreTypeにはmysql, sqlite, memoryのいずれかを指定してください",
+	0x800C: "スキーマバージョンは0〜%dの範囲で指定してください",
+	0x800D: "指定されたストレージはスキーマの移行に対応していません",
+	0x800E: "タイムゾーンプロファイルの設定が不正です",
+	0x800F: "指定されたタイムゾーンプロファイルは登録されていません",
+	0x8010: "リプレイセッションが存在しません。セッションを作成し直してください",
+	0x8011: "リプレイ可能な範囲を超えています",
+	0x8012: "ステップ数が不正です。1以上の数値を指定してください",
+	0x8013: "取引を開始したセッションでは時刻を戻すことはできません",
+	0x8014: "注文内容が不正です",
+	0x8015: "指定された注文が存在しません",
+	0x8016: "指定されたポジションが存在しません",
+	0x8017: "初期資金が不正です。0より大きい数値を指定してください",
+	0x8018: "出力形式にはjson, html, csvのいずれかを指定してください",
+	0x8019: "指標の指定が不正です。sma:20;macd:12,26,9のように種類とパラメータを指定してください",
+	0x801A: "制御メッセージの種類にはsubscribe, play, pause, seek, speedのいずれかを指定してください",
+	0x801B: "再生速度には1x, 10xなどの倍率(1000xまで)、もしくはbarを指定してください",
+	0x801C: "取り込み形式にはcsv, hstのいずれかを指定してください",
+	0x801D: "ファイルの内容を読み込めませんでした。MT4/MT5から出力したファイルを指定してください",
+	0x801E: "出力形式にはcsv, ndjson, mtのいずれかを指定してください",
+	0x801F: "アップロード形式にはjson, ndjson, csvのいずれかを指定してください",
+	0x8020: "アップロードセッションが存在しません。セッションを作成し直してください",
+	0x8021: "チャンクの開始位置が受信済みのサイズと一致しません。receivedBytesの位置から送信し直してください",
+	0x8022: "アップロードは既に取り込み中、もしくは完了しています",
+	0x8023: "重複時の動作にはskip, overwrite, fail, report-diffのいずれかを指定してください",
+	0x8024: "既に登録されているローソク足と値が異なるデータが含まれているため、登録を中止しました",
+	0x8025: "検証モードにはstrict, lenientのいずれかを指定してください",
+	0x8026: "スパイクの閾値には0以上の数値を指定してください",
+	0x8027: "アップロードしたデータに問題が含まれているため、登録を中止しました。validationの内容を確認してください",
+	0x8028: "休場日はyyyy-MM-dd形式で指定してください",
+	0x8029: "並び順にはasc, descのいずれかを指定してください",
+	0x802A: "取得件数には1〜10000の整数を指定してください",
+	0x802B: "カーソルが不正です。前のページのレスポンスのnextCursorを、同じ並び順で指定してください",
+	0x802C: "指定されたパスのAPIは存在しません",
+	0x802D: "指定されたパスは、このメソッドに対応していません",
+	0x802E: "リクエストボディをJSONのオブジェクトとして読み込めませんでした",
+	0x8030: "認証に失敗しました。AuthorizationヘッダーにAPIキーもしくはJWTをBearerトークンとして指定してください",
+	0x8031: "この操作を行う権限がありません",
+	0x8032: "データセットにはpublic, privateのいずれかを指定してください",
+	0x8033: "認証が無効なため、privateデータセットは使用できません",
+	0x8034: "APIKeysの設定が不正です。Keyを指定し、Userには英小文字・数字で16文字まで、Roleにはread-only, uploader, adminのいずれかを指定してください",
+	0x8035: "Languageにはja, enのいずれかを指定してください",
+	0x8036: "設定が不正です\n  %s",
+	0x8037: "コマンドの指定が不正です。-hで引数とフラグ(-userには英小文字・数字で16文字まで)を確認してください",
+	0x8038: "欠損、もしくは休場期間中・時間軸の区切りと一致しないローソク足があります",
+	0x8039: "スキーマバージョン0への移行は全てのデータテーブルを削除します。実行する場合は-forceを指定してください",
+	0x8FFF: "サーバー内部でエラーが発生しました",
+
+	0x9001: "スキーマをv%dへ移行します",
+	0x9002: "スキーマの移行が完了しました",
+	0x9003: "設定を読み込んでいます",
+	0x9004: "サーバーの受信待ちを終了しました",
+	0x9005: "設定を再読み込みしています",
+	0x9006: "終了処理を開始します",
+	0x9007: "システムを終了します",
+	0x9008: "%sのスキーマはmigrateコマンドで固定されているため、更新しません",
+	0x9009: "%sのスキーマを更新します(v%d: %s)",
+	0x900A: "%sのスキーマを戻します(v%d: %s)",
+	0x900B: "%sの時間軸%dを%d件登録しました",
+	0x900C: "%sの時間軸%dを%d件再生成しました",
+	0x900D: "%sを書き出しました",
+	0x900E: "APIKeys, JWTSecretが未指定のため、認証を行いません",
+	0x900F: "認証の有効・無効は再起動するまで反映されません",
+	0x9010: "%sの変更は再起動するまで反映されません",
+	0x9011: "設定を再読み込みしました",
+	0x9012: "サーバーをシャットダウン中です",
+	0x9013: "データベースをクローズ中です",
+	0x9014: "サーバーリソースの解放に成功しました",
+}
+
+// englishMessages エラーコード・ログのメッセージコードごとの英語のメッセージ
+var englishMessages = map[uint16]string{
+	0x8001: "failed to get max_allowed_packet",
+	0x8002: "an unexpected date format was specified",
+	0x8003: "an invalid time type was specified",
+	0x8004: "multiple errors occurred: %s",
+	0x8005: "invalid pair name. A pair name must be up to 6 uppercase letters",
+	0x8006: "specify at least one candle",
+	0x8007: "failed to get the data because the uploaded data is insufficient or a parameter is invalid",
+	0x8008: "invalid limit. Specify a number from 1 to 100",
+	0x8009: "invalid time. Use the yyyy-MM-dd HH:mm:ss format",
+	0x800A: "the upper time type may have no data at the specified time.\nCheck the uploaded data",
+	0x800B: "StoreType must be one of mysql, sqlite, memory",
+	0x800C: "specify a schema version from 0 to %d",
+	0x800D: "the configured storage does not support schema migration",
+	0x800E: "invalid timezone profile configuration",
+	0x800F: "the specified timezone profile is not registered",
+	0x8010: "the replay session does not exist. Create a new session",
+	0x8011: "out of the replayable range",
+	0x8012: "invalid steps. Specify a number of 1 or more",
+	0x8013: "cannot move back in time in a session that has started trading",
+	0x8014: "invalid order",
+	0x8015: "the specified order does not exist",
+	0x8016: "the specified position does not exist",
+	0x8017: "invalid initial balance. Specify a number greater than 0",
+	0x8018: "the report format must be one of json, html, csv",
+	0x8019: "invalid indicator. Specify types and parameters such as sma:20;macd:12,26,9",
+	0x801A: "the control message type must be one of subscribe, play, pause, seek, speed",
+	0x801B: "the replay speed must be a multiplier such as 1x, 10x (up to 1000x), or bar",
+	0x801C: "the import format must be one of csv, hst",
+	0x801D: "could not read the file. Specify a file exported from MT4/MT5",
+	0x801E: "the export format must be one of csv, ndjson, mt",
+	0x801F: "the upload format must be one of json, ndjson, csv",
+	0x8020: "the upload session does not exist. Create a new session",
+	0x8021: "the chunk offset does not match the received size. Resend from receivedBytes",
+	0x8022: "the upload is already being ingested or has completed",
+	0x8023: "the duplicate policy must be one of skip, overwrite, fail, report-diff",
+	0x8024: "registration was aborted because the data contains candles that differ from the registered ones",
+	0x8025: "the validation mode must be one of strict, lenient",
+	0x8026: "the spike threshold must be a number of 0 or more",
+	0x8027: "registration was aborted because the uploaded data has problems. See validation for details",
+	0x8028: "market holidays must use the yyyy-MM-dd format",
+	0x8029: "the order must be one of asc, desc",
+	0x802A: "the page size must be an integer from 1 to 10000",
+	0x802B: "invalid cursor. Specify nextCursor of the previous page with the same order",
+	0x802C: "no API exists at the specified path",
+	0x802D: "the specified path does not support this method",
+	0x802E: "could not read the request body as a JSON object",
+	0x8030: "authentication failed. Specify an API key or JWT as a Bearer token in the Authorization header",
+	0x8031: "you do not have permission to perform this operation",
+	0x8032: "the dataset must be one of public, private",
+	0x8033: "the private dataset is unavailable because authentication is disabled",
+	0x8034: "invalid APIKeys configuration. Specify Key, a User of up to 16 lowercase letters or digits, " +
+		"and a Role of read-only, uploader or admin",
+	0x8035: "Language must be one of ja, en",
+	0x8036: "invalid configuration\n  %s",
+	0x8037: "invalid command. Check the arguments and flags with -h (-user must be up to 16 lowercase letters or digits)",
+	0x8038: "some candles are missing, or fall in market closures or off the time frame boundaries",
+	0x8039: "migrating to schema version 0 drops every data table. Specify -force to proceed",
+	0x8FFF: "an internal server error occurred",
+
+	0x9001: "migrating the schema to v%d",
+	0x9002: "schema migration completed",
+	0x9003: "loading the configuration",
+	0x9004: "the server stopped listening",
+	0x9005: "reloading the configuration",
+	0x9006: "shutting down",
+	0x9007: "exiting",
+	0x9008: "the schema of %s is pinned by the migrate command and is not upgraded",
+	0x9009: "upgrading the schema of %s (v%d: %s)",
+	0x900A: "downgrading the schema of %s (v%d: %s)",
+	0x900B: "registered %[3]d candles of %[1]s time type %[2]d",
+	0x900C: "regenerated %[3]d candles of %[1]s time type %[2]d",
+	0x900D: "wrote %s",
+	0x900E: "authentication is disabled because neither APIKeys nor JWTSecret is set",
+	0x900F: "enabling or disabling authentication takes effect after a restart",
+	0x9010: "changes to %s take effect after a restart",
+	0x9011: "configuration reloaded",
+	0x9012: "shutting down the server",
+	0x9013: "closing the database",
+	0x9014: "released server resources",
+}
+
+// logLanguage ログに出力するメッセージの言語(設定ファイルのLanguage)
+// SIGHUPによる再読み込みで変更されるため、atomic.Valueで保持する
+var logLanguage atomic.Value
+
+// setLogLanguage ログに出力するメッセージの言語を設定する
+func setLogLanguage(language string) {
+	logLanguage.Store(language)
+}
+
+// getLogLanguage ログに出力するメッセージの言語を返却する(未設定の場合は日本語)
+func getLogLanguage() string {
+	if language, ok := logLanguage.Load().(string); ok {
+		return language
+	}
+	return LanguageJapanese
+}
+
+// checkLanguage 言語を検証する(未指定の場合は日本語)
+func checkLanguage(language string) (string, error) {
+	language = Utils.getStringOrDefault(language, LanguageJapanese)
+	if language != LanguageJapanese && language != LanguageEnglish {
+		return "", ErrInvalidLanguage{}
+	}
+	return language, nil
+}
+
+// messageCatalog 言語のメッセージの一覧を返却する(英語以外は日本語)
+func messageCatalog(language string) map[uint16]string {
+	if language == LanguageEnglish {
+		return englishMessages
+	}
+	return japaneseMessages
+}
+
+// catalogMessage 登録されたエラーのメッセージを、指定した言語のカタログから返却する
+// 登録されていないエラー(ErrInternal)は、0x8FFFのメッセージを返却する
+func catalogMessage(err error, language string) string {
+	spec, ok := errorSpecs[reflect.TypeOf(err)]
+	if !ok {
+		spec = internalErrorSpec
+	}
+	message := messageCatalog(language)[spec.code]
+	if formatted, ok := err.(formattedError); ok {
+		return fmt.Sprintf(message, formatted.messageArgs()...)
+	}
+	return message
+}
+
+// localizeError エラーのメッセージを指定した言語で返却する
+// 登録されていないエラーは、内部の詳細を含めないようErrInternalのメッセージを返却する
+func localizeError(err error, language string) string {
+	_, cause := lookupError(err)
+	if multiple, ok := cause.(ErrMultipleCause); ok {
+		messages := make([]string, 0, len(multiple.errors))
+		for _, err := range multiple.errors {
+			if err != nil {
+				messages = append(messages, localizeError(err, language))
+			}
+		}
+		if len(messages) == 1 {
+			return messages[0]
+		}
+		return fmt.Sprintf(messageCatalog(language)[0x8004], strings.Join(messages, ","))
+	}
+	return catalogMessage(cause, language)
+}
+
+// logMessage ログのメッセージを、設定ファイルのLanguageの言語で返却する
+func logMessage(code uint16, args ...interface{}) string {
+	return fmt.Sprintf(messageCatalog(getLogLanguage())[code], args...)
+}
+
+// errorLogMessage エラーをログに出力する際のメッセージを返却する
+// 登録されていないエラー(データベースなど)は、調査のために元のメッセージをそのまま出力する
+func errorLogMessage(err error) string {
+	if spec, _ := lookupError(err); spec == internalErrorSpec {
+		return err.Error()
+	}
+	return localizeError(err, getLogLanguage())
+}
+
+// negotiateLanguage Accept-Languageヘッダーから対応する言語を選択する(対応する言語がない場合はfallback)
+func negotiateLanguage(acceptLanguage string, fallback string) string {
+	type candidate struct {
+		language string
+		quality  float64
+	}
+
+	candidates := make([]candidate, 0)
+	for _, value := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(value), ";")
+		quality := 1.0
+		if params = strings.TrimSpace(params); strings.HasPrefix(params, "q=") {
+			parsed, err := strconv.ParseFloat(strings.TrimPrefix(params, "q="), 64)
+			if err != nil {
+				continue
+			}
+			quality = parsed
+		}
+		language, _, _ := strings.Cut(strings.ToLower(tag), "-")
+		if language == "" || quality <= 0 {
+			continue
+		}
+		candidates = append(candidates, candidate{language: language, quality: quality})
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].quality > candidates[j].quality })
+
+	for _, c := range candidates {
+		switch c.language {
+		case LanguageJapanese, LanguageEnglish:
+			return c.language
+		case "*":
+			return fallback
+		}
+	}
+	return fallback
+}
+
+// languageOf リクエストの言語を返却する(withLanguageを経由しない場合は日本語)
+func languageOf(r *http.Request) string {
+	if language, ok := r.Context().Value(languageKey{}).(string); ok {
+		return language
+	}
+	return LanguageJapanese
+}
+
+// withLanguage Accept-Language、もしくは設定ファイルのLanguageからレスポンスの言語を選択する
+func (s *server) withLanguage(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		language := negotiateLanguage(r.Header.Get("Accept-Language"), s.settings().language)
+		w.Header().Set("Content-Language", language)
+		w.Header().Add("Vary", "Accept-Language")
+		next(w, r.WithContext(context.WithValue(r.Context(), languageKey{}, language)))
+	}
+}
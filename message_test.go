@@ -0,0 +1,85 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+)
+
+// messageVerbPattern メッセージに値を埋め込む書式指定(%%を除く)
+var messageVerbPattern = regexp.MustCompile(`%(\[\d+\])?[dsvf]`)
+
+func TestMessageCatalogsCoverEveryCode(t *testing.T) {
+	codes := []uint16{internalErrorSpec.code}
+	for _, spec := range errorSpecs {
+		codes = append(codes, spec.code)
+	}
+	for code := logMigrateSchema; code <= logResourcesReleased; code++ {
+		codes = append(codes, code)
+	}
+
+	for _, code := range codes {
+		japanese, ok := japaneseMessages[code]
+		if !ok || japanese == "" {
+			t.Errorf("%#x: japaneseMessages has no message", code)
+		}
+		english, ok := englishMessages[code]
+		if !ok || english == "" {
+			t.Errorf("%#x: englishMessages has no message", code)
+		}
+		if len(messageVerbPattern.FindAllString(japanese, -1)) != len(messageVerbPattern.FindAllString(english, -1)) {
+			t.Errorf("%#x: %q and %q embed a different number of values", code, japanese, english)
+		}
+	}
+
+	if len(japaneseMessages) != len(codes) || len(englishMessages) != len(codes) {
+		t.Errorf("catalogs have %d (ja) and %d (en) messages, want %d: remove messages for unused codes",
+			len(japaneseMessages), len(englishMessages), len(codes))
+	}
+}
+
+func TestLocalizeError(t *testing.T) {
+	tests := []struct {
+		err      error
+		language string
+		want     string
+	}{
+		{ErrInvalidLimit{}, LanguageJapanese, "リミットパラーメータが不正です。1〜100の数値を指定してください"},
+		{ErrInvalidLimit{}, LanguageEnglish, "invalid limit. Specify a number from 1 to 100"},
+		{ErrInvalidConfig{problems: []string{"a", "b"}}, LanguageJapanese, "設定が不正です\n  a\n  b"},
+		{ErrInvalidConfig{problems: []string{"a", "b"}}, LanguageEnglish, "invalid configuration\n  a\n  b"},
+		{newErrMultipleCause(ErrInvalidLimit{}, ErrForbidden{}), LanguageEnglish,
+			"multiple errors occurred: invalid limit. Specify a number from 1 to 100,you do not have permission to perform this operation"},
+		{ErrInternal{}, LanguageJapanese, "サーバー内部でエラーが発生しました"},
+		{ErrInternal{}, LanguageEnglish, "an internal server error occurred"},
+	}
+
+	for _, test := range tests {
+		got := localizeError(test.err, test.language)
+		if got != test.want {
+			t.Errorf("localizeError(%#v, %s) = %q, want %q", test.err, test.language, got, test.want)
+		}
+		if test.language == LanguageJapanese && test.err.Error() != test.want {
+			t.Errorf("%#v.Error() = %q, want %q", test.err, test.err.Error(), test.want)
+		}
+	}
+}
+
+func TestLogMessage(t *testing.T) {
+	defer setLogLanguage(getLogLanguage())
+
+	tests := []struct {
+		language string
+		want     string
+	}{
+		{LanguageJapanese, "EURUSDの時間軸0を10件登録しました"},
+		{LanguageEnglish, "registered 10 candles of EURUSD time type 0"},
+	}
+
+	for _, test := range tests {
+		setLogLanguage(test.language)
+		got := logMessage(logRegistered, "EURUSD", 0, 10)
+		if got != test.want {
+			t.Errorf("%s: logMessage = %q, want %q", test.language, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+)
+
+const (
+	SQL_CREATE_SCHEMA_VERSION_TABLE = `
+		CREATE TABLE IF NOT EXISTS SCHEMA_VERSION (
+			TABLE_NAME VARCHAR(64) NOT NULL,
+			VERSION INT NOT NULL,
+			PRIMARY KEY(TABLE_NAME)
+		)
+	`
+
+	SQL_QUERY_SCHEMA_VERSION = `
+		SELECT VERSION FROM SCHEMA_VERSION WHERE TABLE_NAME = ?
+	`
+
+	SQL_DELETE_SCHEMA_VERSION = `
+		DELETE FROM SCHEMA_VERSION WHERE TABLE_NAME = ?
+	`
+
+	SQL_INSERT_SCHEMA_VERSION = `
+		INSERT INTO SCHEMA_VERSION (TABLE_NAME, VERSION) VALUES (?, ?)
+	`
+
+	// SCHEMA_VERSION_PIN migrateコマンドで最新より前のバージョンへ戻したデータテーブル
+	// 起動時・登録時の自動更新の対象から除外する
+	SQL_CREATE_SCHEMA_VERSION_PIN_TABLE = `
+		CREATE TABLE IF NOT EXISTS SCHEMA_VERSION_PIN (
+			TABLE_NAME VARCHAR(64) NOT NULL,
+			PRIMARY KEY(TABLE_NAME)
+		)
+	`
+
+	SQL_QUERY_SCHEMA_VERSION_PIN = `
+		SELECT COUNT(*) FROM SCHEMA_VERSION_PIN WHERE TABLE_NAME = ?
+	`
+
+	SQL_DELETE_SCHEMA_VERSION_PIN = `
+		DELETE FROM SCHEMA_VERSION_PIN WHERE TABLE_NAME = ?
+	`
+
+	SQL_INSERT_SCHEMA_VERSION_PIN = `
+		INSERT INTO SCHEMA_VERSION_PIN (TABLE_NAME) VALUES (?)
+	`
+
+	// データテーブルの初期スキーマ(バージョン1)
+	SQL_CREATE_DATA_TABLE = `
+		CREATE TABLE IF NOT EXISTS %s (
+			TIME_TYPE DECIMAL(1, 0),
+			FIX_TIME DATETIME,
+			HIGH_PRICE DECIMAL(8, 5),
+			OPEN_PRICE DECIMAL(8, 5),
+			CLOSE_PRICE DECIMAL(8, 5),
+			LOW_PRICE DECIMAL(8, 5),
+			PRIMARY KEY(TIME_TYPE,FIX_TIME)
+		)
+	`
+
+	// SQLiteではDATETIME型がtime.Timeに変換されてしまうため、確定時刻を文字列で保持する
+	SQL_SQLITE_CREATE_DATA_TABLE = `
+		CREATE TABLE IF NOT EXISTS %s (
+			TIME_TYPE DECIMAL(1, 0),
+			FIX_TIME TEXT,
+			HIGH_PRICE DECIMAL(8, 5),
+			OPEN_PRICE DECIMAL(8, 5),
+			CLOSE_PRICE DECIMAL(8, 5),
+			LOW_PRICE DECIMAL(8, 5),
+			PRIMARY KEY(TIME_TYPE,FIX_TIME)
+		)
+	`
+
+	SQL_DROP_DATA_TABLE = `
+		DROP TABLE IF EXISTS %s
+	`
+
+	SQL_QUERY_COLUMN_EXISTS = `
+		SELECT COUNT(*) FROM information_schema.columns
+		WHERE 1 = 1
+			AND TABLE_SCHEMA = DATABASE()
+			AND TABLE_NAME = ?
+			AND COLUMN_NAME = ?
+	`
+
+	SQL_SQLITE_QUERY_COLUMN_EXISTS = `
+		SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?
+	`
+
+	SQL_ADD_TICK_VOLUME_COLUMN = `
+		ALTER TABLE %s ADD COLUMN TICK_VOLUME INT NOT NULL DEFAULT 0
+	`
+
+	SQL_DROP_TICK_VOLUME_COLUMN = `
+		ALTER TABLE %s DROP COLUMN TICK_VOLUME
+	`
+)
+
+type (
+	// schemaMigratable スキーマの移行に対応したストレージが実装するインターフェース
+	// migrateToで最新より前のバージョンへ戻したデータテーブルは、最新バージョンへ移行するまで自動更新しない
+	// (ダウングレードは、旧バージョンのバイナリへ戻す直前のロールバックにのみ使用すること)
+	schemaMigratable interface {
+		migrateTo(targetVersion int) error
+	}
+
+	// schemaMigration データテーブルのスキーマ変更を1段階分表す
+	schemaMigration struct {
+		version     int
+		description string
+		up          func(m *migrator, tx *sql.Tx, pairName string) error
+		down        func(m *migrator, tx *sql.Tx, pairName string) error
+	}
+
+	// migrator 通貨ペアごとのデータテーブルのスキーマバージョンを管理する
+	migrator struct {
+		impl    *sql.DB
+		dialect string
+	}
+)
+
+// schemaMigrations バージョンの昇順に並べたスキーマ変更の一覧
+// スキーマを変更する場合は、既存の要素を書き換えず末尾に追加すること
+var schemaMigrations = []schemaMigration{
+	{
+		version:     1,
+		description: "データテーブルの作成",
+		up: func(m *migrator, tx *sql.Tx, pairName string) error {
+			createSql := SQL_CREATE_DATA_TABLE
+			if m.dialect == StoreTypeSQLite {
+				createSql = SQL_SQLITE_CREATE_DATA_TABLE
+			}
+			_, err := tx.Exec(fmt.Sprintf(createSql, pairName))
+			return err
+		},
+		down: func(m *migrator, tx *sql.Tx, pairName string) error {
+			_, err := tx.Exec(fmt.Sprintf(SQL_DROP_DATA_TABLE, pairName))
+			return err
+		},
+	},
+	{
+		version:     2,
+		description: "出来高カラムの追加",
+		up: func(m *migrator, tx *sql.Tx, pairName string) error {
+			// バージョン管理の導入前に出来高カラムを追加済みのテーブルが存在する
+			exists, err := m.hasColumn(tx, pairName, "TICK_VOLUME")
+			if err != nil || exists {
+				return err
+			}
+			_, err = tx.Exec(fmt.Sprintf(SQL_ADD_TICK_VOLUME_COLUMN, pairName))
+			return err
+		},
+		down: func(m *migrator, tx *sql.Tx, pairName string) error {
+			_, err := tx.Exec(fmt.Sprintf(SQL_DROP_TICK_VOLUME_COLUMN, pairName))
+			return err
+		},
+	},
+}
+
+// latestSchemaVersion 最新のスキーマバージョンを返却する
+func latestSchemaVersion() int {
+	return schemaMigrations[len(schemaMigrations)-1].version
+}
+
+// newMigrator migratorをnewする
+func newMigrator(impl *sql.DB, dialect string) *migrator {
+	return &migrator{impl: impl, dialect: dialect}
+}
+
+// prepare スキーマバージョン管理テーブルを作成する
+func (m *migrator) prepare() error {
+	_, err := m.impl.Exec(SQL_CREATE_SCHEMA_VERSION_TABLE)
+	if err != nil {
+		return err
+	}
+	_, err = m.impl.Exec(SQL_CREATE_SCHEMA_VERSION_PIN_TABLE)
+	return err
+}
+
+// pinned データテーブルがmigrateコマンドで最新より前のバージョンに固定されているかを返却する
+func (m *migrator) pinned(pairName string) (bool, error) {
+	var count int
+	err := m.impl.QueryRow(SQL_QUERY_SCHEMA_VERSION_PIN, pairName).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// upgrade データテーブルを最新バージョンへ自動更新する(起動時・データテーブルの作成時)
+// migrateコマンドで固定されたデータテーブルは更新しない
+func (m *migrator) upgrade(pairName string) error {
+	pinned, err := m.pinned(pairName)
+	if err != nil {
+		return err
+	}
+	if pinned {
+		log.Println(logMessage(logSchemaPinned, pairName))
+		return nil
+	}
+	return m.migrate(pairName, latestSchemaVersion())
+}
+
+// upgradeAll 全てのデータテーブルを最新バージョンへ自動更新する
+func (m *migrator) upgradeAll(pairNames []string) error {
+	for _, pairName := range pairNames {
+		err := m.upgrade(pairName)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// currentVersion データテーブルの現在のスキーマバージョンを返却する(未管理の場合は0)
+func (m *migrator) currentVersion(pairName string) (int, error) {
+	var version int
+	err := m.impl.QueryRow(SQL_QUERY_SCHEMA_VERSION, pairName).Scan(&version)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return version, err
+}
+
+// migrateAll 全てのデータテーブルを指定したバージョンへ移行する(migrateコマンド)
+// 最新より前のバージョン(データテーブルを削除する0を除く)へ移行した場合は、自動更新しないよう固定する
+func (m *migrator) migrateAll(pairNames []string, targetVersion int) error {
+	for _, pairName := range pairNames {
+		err := m.migrate(pairName, targetVersion)
+		if err != nil {
+			return err
+		}
+
+		_, err = m.impl.Exec(SQL_DELETE_SCHEMA_VERSION_PIN, pairName)
+		if err != nil {
+			return err
+		}
+		if 0 < targetVersion && targetVersion < latestSchemaVersion() {
+			_, err = m.impl.Exec(SQL_INSERT_SCHEMA_VERSION_PIN, pairName)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// migrate データテーブルを指定したバージョンへ移行する
+func (m *migrator) migrate(pairName string, targetVersion int) error {
+	if targetVersion < 0 || latestSchemaVersion() < targetVersion {
+		return ErrInvalidSchemaVersion{}
+	}
+
+	version, err := m.currentVersion(pairName)
+	if err != nil {
+		return err
+	}
+
+	// アップグレード
+	for _, migration := range schemaMigrations {
+		if migration.version <= version || targetVersion < migration.version {
+			continue
+		}
+
+		log.Println(logMessage(logSchemaUpgrade, pairName, migration.version, migration.description))
+		err = m.apply(pairName, migration.version, migration.up)
+		if err != nil {
+			return err
+		}
+	}
+
+	// ダウングレード
+	for i := len(schemaMigrations) - 1; i >= 0; i-- {
+		migration := schemaMigrations[i]
+		if version < migration.version || migration.version <= targetVersion {
+			continue
+		}
+
+		log.Println(logMessage(logSchemaDowngrade, pairName, migration.version, migration.description))
+		err = m.apply(pairName, migration.version-1, migration.down)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// apply スキーマ変更を実行し、適用後のバージョンを記録する
+func (m *migrator) apply(pairName string, version int, step func(m *migrator, tx *sql.Tx, pairName string) error) error {
+	return beginTransaction(m.impl, func(tx *sql.Tx) error {
+		err := step(m, tx, pairName)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(SQL_DELETE_SCHEMA_VERSION, pairName)
+		if err != nil {
+			return err
+		}
+
+		if version <= 0 {
+			return nil
+		}
+
+		_, err = tx.Exec(SQL_INSERT_SCHEMA_VERSION, pairName, version)
+		return err
+	})
+}
+
+// hasColumn データテーブルに指定したカラムが存在するかを返却する
+func (m *migrator) hasColumn(tx *sql.Tx, pairName string, columnName string) (bool, error) {
+	query := SQL_QUERY_COLUMN_EXISTS
+	if m.dialect == StoreTypeSQLite {
+		query = SQL_SQLITE_QUERY_COLUMN_EXISTS
+	}
+
+	var numColumns int
+	err := tx.QueryRow(query, pairName, columnName).Scan(&numColumns)
+	if err != nil {
+		return false, err
+	}
+	return numColumns > 0, nil
+}
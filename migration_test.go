@@ -0,0 +1,196 @@
+package main
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+// testSchemaState データテーブルの現在のスキーマバージョン、テーブル・出来高カラムの有無、固定の有無
+type testSchemaState struct {
+	version    int
+	table      bool
+	tickVolume bool
+	pinned     bool
+}
+
+// querySchemaState SQLiteのデータテーブルのスキーマの状態を返却する
+func querySchemaState(t *testing.T, db *sqliteDB, pairName string) testSchemaState {
+	t.Helper()
+	state := testSchemaState{}
+
+	var err error
+	state.version, err = db.migrator.currentVersion(pairName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state.pinned, err = db.migrator.pinned(pairName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var count int
+	err = db.impl.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", pairName).Scan(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state.table = count > 0
+	if state.table {
+		err = db.impl.QueryRow(SQL_SQLITE_QUERY_COLUMN_EXISTS, pairName, "TICK_VOLUME").Scan(&count)
+		if err != nil {
+			t.Fatal(err)
+		}
+		state.tickVolume = count > 0
+	}
+	return state
+}
+
+func TestMigratorMigrate(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []int // 順に移行するバージョン
+		want  testSchemaState
+	}{
+		{"latest", nil, testSchemaState{version: 2, table: true, tickVolume: true}},
+		{"down to 1", []int{1}, testSchemaState{version: 1, table: true}},
+		{"down to 1 and up to 2", []int{1, 2}, testSchemaState{version: 2, table: true, tickVolume: true}},
+		{"drop with version 0", []int{0}, testSchemaState{}},
+		{"recreate after drop", []int{0, 2}, testSchemaState{version: 2, table: true, tickVolume: true}},
+		{"up to 1 after drop", []int{0, 1}, testSchemaState{version: 1, table: true}},
+	}
+
+	for _, test := range tests {
+		db := newTestSQLiteDB(t, "EURUSD")
+		for _, version := range test.steps {
+			err := db.migrator.migrate("EURUSD", version)
+			if err != nil {
+				t.Fatalf("%s: migrate(%d) returned %v", test.name, version, err)
+			}
+		}
+
+		got := querySchemaState(t, db, "EURUSD")
+		if got != test.want {
+			t.Errorf("%s: schema state %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestMigratorMigrateInvalidVersion(t *testing.T) {
+	db := newTestSQLiteDB(t, "EURUSD")
+	for _, version := range []int{-1, latestSchemaVersion() + 1} {
+		err := db.migrator.migrate("EURUSD", version)
+		if err != (ErrInvalidSchemaVersion{}) {
+			t.Errorf("migrate(%d) returned %v, want ErrInvalidSchemaVersion", version, err)
+		}
+	}
+}
+
+func TestMigratorMigrateAllPinsOlderVersions(t *testing.T) {
+	tests := []struct {
+		name    string
+		version int
+		want    testSchemaState // migrateAllの後にupgradeした状態
+	}{
+		// 最新より前へ戻したデータテーブルは、upgradeで更新しない
+		{"pinned at 1", 1, testSchemaState{version: 1, table: true, pinned: true}},
+		{"latest is not pinned", 2, testSchemaState{version: 2, table: true, tickVolume: true}},
+		// 削除したデータテーブルは固定せず、作成時に最新バージョンで作り直す
+		{"dropped is not pinned", 0, testSchemaState{version: 2, table: true, tickVolume: true}},
+	}
+
+	for _, test := range tests {
+		db := newTestSQLiteDB(t, "EURUSD")
+		err := db.migrateTo(test.version)
+		if err != nil {
+			t.Fatalf("%s: migrateTo returned %v", test.name, err)
+		}
+		err = db.migrator.upgrade("EURUSD")
+		if err != nil {
+			t.Fatalf("%s: upgrade returned %v", test.name, err)
+		}
+
+		got := querySchemaState(t, db, "EURUSD")
+		if got != test.want {
+			t.Errorf("%s: schema state %+v, want %+v", test.name, got, test.want)
+		}
+	}
+
+	// 最新バージョンへ移行すると固定を解除する
+	db := newTestSQLiteDB(t, "EURUSD")
+	for _, version := range []int{1, latestSchemaVersion()} {
+		err := db.migrateTo(version)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	got := querySchemaState(t, db, "EURUSD")
+	if want := (testSchemaState{version: 2, table: true, tickVolume: true}); got != want {
+		t.Errorf("schema state after migrating back %+v, want %+v", got, want)
+	}
+}
+
+func TestMigratorUpgradeExistingTickVolumeColumn(t *testing.T) {
+	// バージョン管理の導入前に、出来高カラムを追加済みのテーブル
+	db := newTestSQLiteDB(t, "USDJPY")
+	_, err := db.impl.Exec("CREATE TABLE EURUSD (TIME_TYPE DECIMAL(1, 0), FIX_TIME TEXT, HIGH_PRICE DECIMAL(8, 5), " +
+		"OPEN_PRICE DECIMAL(8, 5), CLOSE_PRICE DECIMAL(8, 5), LOW_PRICE DECIMAL(8, 5), " +
+		"TICK_VOLUME INT NOT NULL DEFAULT 0, PRIMARY KEY(TIME_TYPE,FIX_TIME))")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.migrator.upgrade("EURUSD")
+	if err != nil {
+		t.Fatalf("upgrade returned %v", err)
+	}
+	got := querySchemaState(t, db, "EURUSD")
+	if want := (testSchemaState{version: 2, table: true, tickVolume: true}); got != want {
+		t.Errorf("schema state %+v, want %+v", got, want)
+	}
+}
+
+func TestRunMigrateRequiresForceToDrop(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr error
+		want    testSchemaState
+	}{
+		{"to 1", []string{"-to", "1"}, nil, testSchemaState{version: 1, table: true, pinned: true}},
+		{"to 0 without force", []string{"-to", "0"}, ErrDropSchemaNotConfirmed{},
+			testSchemaState{version: 2, table: true, tickVolume: true}},
+		{"to 0 with force", []string{"-to", "0", "-force"}, nil, testSchemaState{}},
+	}
+
+	for _, test := range tests {
+		path := filepath.Join(t.TempDir(), "migrate.db")
+		db := newSQLiteDB(&config{SQLitePath: path})
+		err := db.open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = db.createDataTable("EURUSD")
+		if err != nil {
+			t.Fatal(err)
+		}
+		db.close()
+
+		err = runMigrate(append([]string{"-store-type", StoreTypeSQLite, "-sqlite-path", path}, test.args...))
+		if err != test.wantErr {
+			t.Errorf("%s: runMigrate returned %v, want %v", test.name, err, test.wantErr)
+		}
+
+		// 確認用に開き直す(固定されていないデータテーブルはopen時に更新されるため、migratorを直接使う)
+		db = newSQLiteDB(&config{SQLitePath: path})
+		impl, err := sql.Open("sqlite3", path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		db.impl, db.migrator = impl, newMigrator(impl, StoreTypeSQLite)
+		got := querySchemaState(t, db, "EURUSD")
+		db.close()
+		if got != test.want {
+			t.Errorf("%s: schema state %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,563 @@
+package main
+
+//go:generate go run . openapi -spec openapi.json -client client/client.go
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+const (
+	openAPIVersion = "3.0.3"
+
+	// openAPIPath OpenAPIドキュメントを返却するパス
+	openAPIPath = "/api/openapi.json"
+
+	// openAPISchemaPrefix components/schemasへの参照の接頭辞
+	openAPISchemaPrefix = "#/components/schemas/"
+)
+
+type (
+	openAPIDocument struct {
+		OpenAPI    string                                  `json:"openapi"`
+		Info       openAPIInfo                             `json:"info"`
+		Paths      map[string]map[string]*openAPIOperation `json:"paths"` // パス → メソッド(小文字) → 操作
+		Components openAPIComponents                       `json:"components"`
+		Security   []openAPISecurityRequirement            `json:"security,omitempty"` // 既定の認証方式(いずれか1つ)
+	}
+
+	openAPIInfo struct {
+		Title       string `json:"title"`
+		Description string `json:"description"`
+		Version     string `json:"version"`
+	}
+
+	openAPIComponents struct {
+		Schemas         map[string]*openAPISchema        `json:"schemas"`
+		SecuritySchemes map[string]openAPISecurityScheme `json:"securitySchemes,omitempty"`
+	}
+
+	openAPISecurityScheme struct {
+		Type         string `json:"type"` // http, apiKey
+		Description  string `json:"description,omitempty"`
+		Scheme       string `json:"scheme,omitempty"`       // http
+		BearerFormat string `json:"bearerFormat,omitempty"` // http
+		Name         string `json:"name,omitempty"`         // apiKey
+		In           string `json:"in,omitempty"`           // apiKey
+	}
+
+	// openAPISecurityRequirement 認証方式の名前 → スコープ(常に空)
+	openAPISecurityRequirement map[string][]string
+
+	openAPIOperation struct {
+		OperationID string                        `json:"operationId"`
+		Summary     string                        `json:"summary"`
+		Description string                        `json:"description,omitempty"`
+		Tags        []string                      `json:"tags,omitempty"`
+		Parameters  []openAPIParameter            `json:"parameters,omitempty"`
+		RequestBody *openAPIRequestBody           `json:"requestBody,omitempty"`
+		Responses   map[string]openAPIResponse    `json:"responses"`
+		Security    *[]openAPISecurityRequirement `json:"security,omitempty"` // 空の場合は認証を行わない
+	}
+
+	openAPIParameter struct {
+		Name        string         `json:"name"`
+		In          string         `json:"in"` // path, query, header
+		Description string         `json:"description,omitempty"`
+		Required    bool           `json:"required,omitempty"`
+		Schema      *openAPISchema `json:"schema"`
+		Explode     *bool          `json:"explode,omitempty"` // 一覧をカンマ区切りで指定する場合はfalse
+	}
+
+	openAPIRequestBody struct {
+		Required bool                        `json:"required"`
+		Content  map[string]openAPIMediaType `json:"content"`
+	}
+
+	openAPIResponse struct {
+		Description string                      `json:"description"`
+		Content     map[string]openAPIMediaType `json:"content,omitempty"`
+	}
+
+	openAPIMediaType struct {
+		Schema *openAPISchema `json:"schema,omitempty"`
+	}
+
+	openAPISchema struct {
+		Ref                  string                    `json:"$ref,omitempty"`
+		AllOf                []*openAPISchema          `json:"allOf,omitempty"`
+		Type                 string                    `json:"type,omitempty"`
+		Format               string                    `json:"format,omitempty"`
+		Description          string                    `json:"description,omitempty"`
+		Enum                 []string                  `json:"enum,omitempty"`
+		Items                *openAPISchema            `json:"items,omitempty"`
+		Properties           map[string]*openAPISchema `json:"properties,omitempty"`
+		Required             []string                  `json:"required,omitempty"`
+		AdditionalProperties *openAPISchema            `json:"additionalProperties,omitempty"`
+		Nullable             bool                      `json:"nullable,omitempty"`
+	}
+
+	// openAPISchemas Goの型から生成したcomponents/schemas
+	openAPISchemas map[string]*openAPISchema
+)
+
+// schemaOf Goの型のJSON表現をスキーマに変換する(名前のある構造体はcomponents/schemasに登録して参照する)
+func (schemas openAPISchemas) schemaOf(t reflect.Type) *openAPISchema {
+	switch t.Kind() {
+	case reflect.Ptr:
+		schema := schemas.schemaOf(t.Elem())
+		if schema.Ref != "" {
+			// $refと同じ階層の指定は無視されるため、allOfで包んでnullableを指定する
+			return &openAPISchema{AllOf: []*openAPISchema{schema}, Nullable: true}
+		}
+		nullable := *schema
+		nullable.Nullable = true
+		return &nullable
+
+	case reflect.Struct:
+		if t.Name() == "" {
+			return schemas.objectOf(t)
+		}
+		if _, ok := schemas[t.Name()]; !ok {
+			schemas[t.Name()] = nil // 再帰的な型のために先に登録する
+			schemas[t.Name()] = schemas.objectOf(t)
+		}
+		return &openAPISchema{Ref: openAPISchemaPrefix + t.Name()}
+
+	case reflect.Slice, reflect.Array:
+		return &openAPISchema{Type: "array", Items: schemas.schemaOf(t.Elem())}
+
+	case reflect.Map:
+		return &openAPISchema{Type: "object", AdditionalProperties: schemas.schemaOf(t.Elem())}
+
+	case reflect.String:
+		return &openAPISchema{Type: "string"}
+
+	case reflect.Bool:
+		return &openAPISchema{Type: "boolean"}
+
+	case reflect.Int32, reflect.Uint32:
+		return &openAPISchema{Type: "integer", Format: "int32"}
+
+	case reflect.Int64, reflect.Uint64:
+		return &openAPISchema{Type: "integer", Format: "int64"}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Uint, reflect.Uint8, reflect.Uint16:
+		return &openAPISchema{Type: "integer"}
+
+	case reflect.Float32:
+		return &openAPISchema{Type: "number", Format: "float"}
+
+	case reflect.Float64:
+		return &openAPISchema{Type: "number", Format: "double"}
+	}
+	return &openAPISchema{}
+}
+
+// objectOf 構造体の公開フィールドを、jsonタグの名前のプロパティに変換する
+// omitemptyを指定していないフィールドは常に出力されるため必須とする
+func (schemas openAPISchemas) objectOf(t reflect.Type) *openAPISchema {
+	schema := &openAPISchema{Type: "object", Properties: make(map[string]*openAPISchema)}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		schema.Properties[name] = schemas.schemaOf(field.Type)
+		if !strings.Contains(options, "omitempty") {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+	sort.Strings(schema.Required)
+	return schema
+}
+
+// paramSchema 入力パラメータのスキーマを返却する(x-formatの選択肢は操作ごとに指定する)
+func (p apiParam) paramSchema(formats []string) *openAPISchema {
+	schema := &openAPISchema{Type: Utils.getStringOrDefault(p.schemaType, "string"), Enum: p.enum}
+	if formats != nil {
+		schema.Enum = formats
+	}
+	if p.list {
+		return &openAPISchema{Type: "array", Items: schema}
+	}
+	return schema
+}
+
+// v2Path v2のパターンを、パスの入力パラメータをクエリ文字列と同じ名前にしたOpenAPIのパスに変換する
+func (route v2Route) v2Path() (string, []string) {
+	segments := strings.Split(route.pattern, "/")
+	pathParams := make([]string, 0)
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			name := strings.Trim(segment, "{}")
+			pathParams = append(pathParams, name)
+			segments[i] = "{" + paramQueryName(name) + "}"
+		}
+	}
+	return apiV2Prefix + strings.Join(segments, "/"), pathParams
+}
+
+// buildOpenAPIDocument ルーティング表と入力パラメータ・レスポンスの型から、OpenAPIドキュメントを生成する
+func buildOpenAPIDocument() *openAPIDocument {
+	schemas := make(openAPISchemas)
+	doc := &openAPIDocument{
+		OpenAPI: openAPIVersion,
+		Info: openAPIInfo{
+			Title: "fx-tester-server",
+			Description: "v1(/api)は入力パラメータをx-で始まるヘッダーで、" +
+				"v2(/api/v2)はパス・クエリ文字列・JSONボディで受け取る。処理とレスポンスはv1とv2で共通。" +
+				"エラーの場合もレスポンスの形式は変わらず、statusにエラーコード・名前とメッセージを格納し、" +
+				"エラーに対応するHTTPステータスを返却する。エラーメッセージの言語はAccept-Language(ja, en)で指定できる。" +
+				"設定ファイルでAPIKeysもしくはJWTSecretを指定した場合は認証が必要になり、" +
+				"x-datasetにprivateを指定すると利用者ごとのデータセットを使用できる。",
+			Version: "2.0.0",
+		},
+		Paths: make(map[string]map[string]*openAPIOperation),
+		Components: openAPIComponents{
+			Schemas: schemas,
+			SecuritySchemes: map[string]openAPISecurityScheme{
+				"bearer": {
+					Type:         "http",
+					Description:  "APIキー、もしくは設定ファイルのJWTSecretでHS256の署名をしたJWT(sub: 利用者名, role: ロール)",
+					Scheme:       "bearer",
+					BearerFormat: "JWT",
+				},
+				"apiKeyHeader": {Type: "apiKey", Description: "APIキー", Name: "x-api-key", In: "header"},
+				"apiKeyQuery":  {Type: "apiKey", Description: "APIキー(WebSocketへの切り替えのみ)", Name: "apiKey", In: "query"},
+			},
+		},
+		Security: []openAPISecurityRequirement{{"bearer": {}}, {"apiKeyHeader": {}}},
+	}
+
+	operations := apiOperations()
+	params := apiParams()
+	add := func(path string, method string, operation *openAPIOperation) {
+		if _, ok := doc.Paths[path]; !ok {
+			doc.Paths[path] = make(map[string]*openAPIOperation)
+		}
+		doc.Paths[path][strings.ToLower(method)] = operation
+	}
+
+	for _, route := range apiV1Routes() {
+		for method, id := range route.operations {
+			spec := operations[id]
+			operation := spec.openAPIOperation(id+"V1", schemas)
+			for _, name := range append(append([]string{}, spec.required...), spec.optional...) {
+				operation.Parameters = append(operation.Parameters, openAPIParameter{
+					Name:        name,
+					In:          "header",
+					Description: params[name].description,
+					Required:    spec.isRequired(name),
+					Schema:      params[name].paramSchema(spec.formatsOf(name)),
+				})
+			}
+			add(route.path, method, operation)
+		}
+	}
+
+	for _, route := range apiV2Routes() {
+		path, pathParams := route.v2Path()
+		for method, id := range route.operations {
+			spec := operations[id]
+			operation := spec.openAPIOperation(id, schemas)
+
+			inPath := make(map[string]bool)
+			for _, name := range pathParams {
+				inPath[name] = true
+				operation.Parameters = append(operation.Parameters, openAPIParameter{
+					Name:        paramQueryName(name),
+					In:          "path",
+					Description: params[name].description,
+					Required:    true,
+					Schema:      params[name].paramSchema(spec.formatsOf(name)),
+				})
+			}
+
+			inBody := make(map[string]bool)
+			if method == "POST" {
+				for _, name := range route.bodyParams {
+					inBody[name] = !inPath[name]
+				}
+			}
+
+			var body *openAPISchema
+			for _, name := range append(append([]string{}, spec.required...), spec.optional...) {
+				if inPath[name] {
+					continue
+				}
+				if inBody[name] {
+					if body == nil {
+						body = &openAPISchema{Type: "object", Properties: make(map[string]*openAPISchema)}
+					}
+					schema := params[name].paramSchema(spec.formatsOf(name))
+					schema.Description = params[name].description
+					body.Properties[paramQueryName(name)] = schema
+					if spec.isRequired(name) {
+						body.Required = append(body.Required, paramQueryName(name))
+					}
+					continue
+				}
+
+				parameter := openAPIParameter{
+					Name:        paramQueryName(name),
+					In:          "query",
+					Description: params[name].description,
+					Required:    spec.isRequired(name),
+					Schema:      params[name].paramSchema(spec.formatsOf(name)),
+				}
+				if params[name].list {
+					explode := false
+					parameter.Explode = &explode
+				}
+				operation.Parameters = append(operation.Parameters, parameter)
+			}
+
+			if body != nil {
+				operation.RequestBody = &openAPIRequestBody{
+					Required: len(body.Required) > 0,
+					Content:  map[string]openAPIMediaType{"application/json": {Schema: body}},
+				}
+			}
+			add(path, method, operation)
+		}
+	}
+
+	// WebSocketで送信する制御メッセージはレスポンスから参照されないため、個別に登録する
+	schemas.schemaOf(reflect.TypeOf(ReplayControlMessage{}))
+
+	// エラーの名前はエラーの登録表から列挙する
+	schemas["ApiResponseStatus"].Properties["type"].Enum = errorNames()
+	schemas["ApiResponseStatus"].Properties["type"].Description = "エラーの名前(成功した場合は省略する)。" +
+		"codeとともに、一度割り当てた値は変更しない"
+	return doc
+}
+
+// errorNames 登録されたエラーの名前を、エラーコードの順に返却する
+func errorNames() []string {
+	specs := make([]errorSpec, 0, len(errorSpecs)+1)
+	for _, spec := range errorSpecs {
+		specs = append(specs, spec)
+	}
+	specs = append(specs, internalErrorSpec)
+	sort.Slice(specs, func(i, j int) bool { return specs[i].code < specs[j].code })
+
+	names := make([]string, 0, len(specs))
+	for _, spec := range specs {
+		names = append(names, spec.name)
+	}
+	return names
+}
+
+// isRequired 入力パラメータが必須かを返却する
+func (spec apiOperation) isRequired(name string) bool {
+	for _, required := range spec.required {
+		if required == name {
+			return true
+		}
+	}
+	return false
+}
+
+// accepts 入力パラメータを受け取るかを返却する
+func (spec apiOperation) accepts(name string) bool {
+	for _, optional := range spec.optional {
+		if optional == name {
+			return true
+		}
+	}
+	return spec.isRequired(name)
+}
+
+// formatsOf x-formatの場合に、操作ごとの選択肢を返却する
+func (spec apiOperation) formatsOf(name string) []string {
+	if name != "x-format" {
+		return nil
+	}
+	return spec.formats
+}
+
+// openAPIOperation 入力パラメータ以外の操作の仕様(リクエストボディ・レスポンス)を変換する
+func (spec apiOperation) openAPIOperation(id string, schemas openAPISchemas) *openAPIOperation {
+	operation := &openAPIOperation{
+		OperationID: id,
+		Summary:     spec.summary,
+		Tags:        []string{spec.tag},
+		Responses:   make(map[string]openAPIResponse),
+	}
+	switch spec.role {
+	case "":
+		operation.Security = &[]openAPISecurityRequirement{}
+	case RoleAdmin:
+		operation.Description = "必要なロール: " + RoleAdmin + "(privateデータセットの場合は" + RoleUploader + ")"
+	default:
+		operation.Description = "必要なロール: " + spec.role
+	}
+	adminParams := make([]string, 0)
+	if spec.role != "" && spec.accepts("x-duplicate-policy") {
+		adminParams = append(adminParams, "x-duplicate-policyがoverwrite")
+	}
+	if spec.role != "" && spec.accepts("x-resample") {
+		adminParams = append(adminParams, "x-resampleがtrue")
+	}
+	if len(adminParams) > 0 {
+		operation.Description += "(" + strings.Join(adminParams, "、もしくは") + "の場合は" + RoleAdmin +
+			"、privateデータセットの場合は" + RoleUploader + ")"
+	}
+
+	binary := &openAPISchema{Type: "string", Format: "binary"}
+	switch spec.body {
+	case apiBodyCandles:
+		operation.RequestBody = &openAPIRequestBody{Required: true, Content: map[string]openAPIMediaType{
+			"application/json":     {Schema: schemas.schemaOf(reflect.TypeOf(UploadPayload{}))},
+			"application/x-ndjson": {Schema: binary},
+			"text/csv":             {Schema: binary},
+		}}
+	case apiBodyFile:
+		operation.RequestBody = &openAPIRequestBody{Required: true, Content: map[string]openAPIMediaType{
+			"application/octet-stream": {Schema: binary},
+		}}
+	case apiBodyOrder:
+		operation.RequestBody = &openAPIRequestBody{Required: true, Content: map[string]openAPIMediaType{
+			"application/json": {Schema: schemas.schemaOf(reflect.TypeOf(OrderPayload{}))},
+		}}
+	case apiBodyModifyPosition:
+		operation.RequestBody = &openAPIRequestBody{Required: true, Content: map[string]openAPIMediaType{
+			"application/json": {Schema: schemas.schemaOf(reflect.TypeOf(ModifyPositionPayload{}))},
+		}}
+	}
+
+	response := &openAPISchema{Type: "object"}
+	if spec.response != nil {
+		response = schemas.schemaOf(reflect.TypeOf(spec.response))
+	}
+	if spec.websocket {
+		// ヘッダーを指定できない場合に備え、クエリ文字列のAPIキーも受け付ける
+		if spec.role != "" {
+			operation.Security = &[]openAPISecurityRequirement{{"bearer": {}}, {"apiKeyHeader": {}}, {"apiKeyQuery": {}}}
+		}
+		operation.Responses["101"] = openAPIResponse{
+			Description: "WebSocketに切り替える(サーバーから送信するメッセージの形式)",
+			Content:     map[string]openAPIMediaType{"application/json": {Schema: response}},
+		}
+		return operation
+	}
+
+	success := openAPIResponse{Description: "成功", Content: make(map[string]openAPIMediaType)}
+	contentTypes := spec.raw
+	if len(contentTypes) == 0 {
+		contentTypes = []string{"application/json"}
+	}
+	for _, contentType := range contentTypes {
+		if contentType == "application/json" {
+			success.Content[contentType] = openAPIMediaType{Schema: response}
+		} else {
+			success.Content[contentType] = openAPIMediaType{Schema: binary}
+		}
+	}
+	operation.Responses["200"] = success
+	if spec.response == nil {
+		return operation
+	}
+	operation.Responses["default"] = openAPIResponse{
+		Description: "エラー(statusにエラーコードとメッセージを格納する)。" +
+			"Acceptヘッダーにapplication/problem+jsonを指定した場合は、RFC 7807の形式で返却する",
+		Content: map[string]openAPIMediaType{
+			"application/json": {Schema: response},
+			problemContentType: {Schema: schemas.schemaOf(reflect.TypeOf(ApiProblem{}))},
+		},
+	}
+	return operation
+}
+
+// encode ドキュメントを整形したJSONに変換する
+func (doc *openAPIDocument) encode() ([]byte, error) {
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	err := encoder.Encode(doc)
+	if err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// handleOpenAPI ルーティング表から生成したOpenAPIドキュメントを返却する
+func (s *server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	supportedParams := []string{"*"}
+	supportedMethods := []string{
+		"GET",
+		"OPTIONS",
+	}
+	if handleCORS(w, r, supportedParams, supportedMethods) {
+		return
+	}
+
+	data, err := buildOpenAPIDocument().encode()
+	if err != nil {
+		log.Println(errorLogMessage(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Write(data)
+}
+
+// runOpenAPI OpenAPIドキュメントとクライアントを生成する
+// ルーティング表・レスポンスの型と生成済みのファイルとの差分は、openapi_test.goで検査する
+func runOpenAPI(args []string) error {
+	flags := flag.NewFlagSet("openapi", flag.ContinueOnError)
+	specPath := flags.String("spec", "openapi.json", "OpenAPIドキュメントのパス")
+	clientPath := flags.String("client", "", "生成するGoのクライアントのパス(未指定の場合は生成しない)")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	spec, err := buildOpenAPIDocument().encode()
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(*specPath, spec, 0644)
+	if err != nil {
+		return err
+	}
+	log.Println(logMessage(logFileWritten, *specPath))
+
+	if *clientPath == "" {
+		return nil
+	}
+
+	// クライアントは書き出したドキュメントから生成する
+	spec, err = os.ReadFile(*specPath)
+	if err != nil {
+		return err
+	}
+	client, err := generateOpenAPIClient(spec)
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(*clientPath, client, 0644)
+	if err != nil {
+		return err
+	}
+	log.Println(logMessage(logFileWritten, *clientPath))
+	return nil
+}
@@ -0,0 +1,509 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/format"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+type (
+	// clientGenerator OpenAPIドキュメントからGoのクライアントを生成する
+	// v2(/api/v2)の操作のみを対象とし、WebSocketの操作は生成しない
+	clientGenerator struct {
+		doc *openAPIDocument
+		out bytes.Buffer
+	}
+
+	// clientField 操作ごとのParams構造体のフィールド
+	clientField struct {
+		name        string // JSON・クエリ文字列での名前
+		goName      string
+		goType      string
+		description string
+		required    bool
+		inBody      bool
+	}
+)
+
+// initialismPattern Go の命名規則に合わせて大文字にする略語(sessionId → SessionID)
+var initialismPattern = regexp.MustCompile(`(Id|Url)([A-Z]|$)`)
+
+// goName JSONの名前をGoの公開された識別子に変換する
+func goName(name string) string {
+	parts := strings.FieldsFunc(name, func(r rune) bool { return r == '-' || r == '_' || r == '.' })
+	for i, part := range parts {
+		parts[i] = strings.ToUpper(part[:1]) + part[1:]
+	}
+	return initialismPattern.ReplaceAllStringFunc(strings.Join(parts, ""), strings.ToUpper)
+}
+
+// generateOpenAPIClient OpenAPIドキュメント(JSON)からGoのクライアントのソースを生成する
+func generateOpenAPIClient(spec []byte) ([]byte, error) {
+	doc := &openAPIDocument{}
+	err := json.Unmarshal(spec, doc)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &clientGenerator{doc: doc}
+	g.header()
+	g.schemas()
+	g.operations()
+
+	source, err := format.Source(g.out.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("生成したクライアントを整形できませんでした: %w", err)
+	}
+	return source, nil
+}
+
+func (g *clientGenerator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.out, format, args...)
+}
+
+// goType スキーマに対応するGoの型を返却する
+func (g *clientGenerator) goType(schema *openAPISchema) string {
+	if schema == nil {
+		return "interface{}"
+	}
+	if schema.Ref != "" {
+		return strings.TrimPrefix(schema.Ref, openAPISchemaPrefix)
+	}
+	if len(schema.AllOf) == 1 {
+		if schema.Nullable {
+			return "*" + g.goType(schema.AllOf[0])
+		}
+		return g.goType(schema.AllOf[0])
+	}
+
+	var goType string
+	switch schema.Type {
+	case "string":
+		goType = "string"
+	case "boolean":
+		goType = "bool"
+	case "integer":
+		switch schema.Format {
+		case "int32":
+			goType = "int32"
+		case "int64":
+			goType = "int64"
+		default:
+			goType = "int"
+		}
+	case "number":
+		if schema.Format == "float" {
+			goType = "float32"
+		} else {
+			goType = "float64"
+		}
+	case "array":
+		return "[]" + g.goType(schema.Items)
+	case "object":
+		if schema.AdditionalProperties != nil {
+			return "map[string]" + g.goType(schema.AdditionalProperties)
+		}
+		return "map[string]interface{}"
+	default:
+		return "interface{}"
+	}
+
+	if schema.Nullable {
+		return "*" + goType
+	}
+	return goType
+}
+
+// paramType 入力パラメータのGoの型を返却する(文字列・一覧以外は、未指定を表すためにポインタにする)
+func (g *clientGenerator) paramType(schema *openAPISchema) string {
+	switch schema.Type {
+	case "string":
+		return "string"
+	case "array":
+		return "[]" + g.paramType(schema.Items)
+	}
+	return "*" + g.goType(schema)
+}
+
+func (g *clientGenerator) header() {
+	g.printf(`// Code generated by "fx-tester-server openapi"; DO NOT EDIT.
+
+// Package client fx-tester-serverのv2 APIのクライアント(openapi.jsonから生成)
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Client APIのクライアント
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	token      string
+}
+
+// New Clientをnewする(httpClientがnilの場合はhttp.DefaultClientを使用する)
+func New(baseURL string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{baseURL: strings.TrimRight(baseURL, "/"), httpClient: httpClient}
+}
+
+// WithToken APIキーもしくはJWTをBearerトークンとして送信するClientを返却する
+func (c *Client) WithToken(token string) *Client {
+	authorized := *c
+	authorized.token = token
+	return &authorized
+}
+
+// Error サーバーがエラーを返却した場合のエラー(レスポンスのstatusの内容)
+// Typeはエラーの名前(openapi.jsonのApiResponseStatus.typeの列挙値)で、Codeとともにエラーの判別に使用できる
+type Error struct {
+	StatusCode int
+	Code       uint16
+	Type       string
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%%d %%s (%%s, code: 0x%%04X)", e.StatusCode, e.Message, e.Type, e.Code)
+}
+
+// Ptr 任意の入力パラメータに指定する値のポインタを返却する
+func Ptr[T any](value T) *T {
+	return &value
+}
+
+// addParam 指定された入力パラメータのみをクエリ文字列に追加する
+func addParam(query url.Values, name string, value interface{}) {
+	switch v := value.(type) {
+	case string:
+		if v != "" {
+			query.Set(name, v)
+		}
+	case []string:
+		if len(v) > 0 {
+			query.Set(name, strings.Join(v, ","))
+		}
+	case *int:
+		if v != nil {
+			query.Set(name, strconv.Itoa(*v))
+		}
+	case *float64:
+		if v != nil {
+			query.Set(name, strconv.FormatFloat(*v, 'f', -1, 64))
+		}
+	case *bool:
+		if v != nil {
+			query.Set(name, strconv.FormatBool(*v))
+		}
+	}
+}
+
+// addBodyParam 指定された入力パラメータのみをJSONボディに追加する
+func addBodyParam(body map[string]interface{}, name string, value interface{}) {
+	query := make(url.Values)
+	addParam(query, name, value)
+	if _, ok := query[name]; ok {
+		body[name] = value
+	}
+}
+
+// send リクエストを送信する
+func (c *Client) send(ctx context.Context, method string, path string, query url.Values, body io.Reader, contentType string) (*http.Response, error) {
+	u := c.baseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	return c.httpClient.Do(req)
+}
+
+// call リクエストを送信し、JSONのレスポンスをoutに読み込む
+// エラーの場合もレスポンスをoutに読み込んだうえで、Errorを返却する
+func (c *Client) call(ctx context.Context, method string, path string, query url.Values, body io.Reader, contentType string, out interface{}) error {
+	resp, err := c.send(ctx, method, path, query, body, contentType)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(data, out)
+	if resp.StatusCode >= http.StatusBadRequest {
+		return newError(resp.StatusCode, data)
+	}
+	return err
+}
+
+// stream リクエストを送信し、成功した場合はレスポンスのボディを返却する(呼び出し側でCloseする)
+func (c *Client) stream(ctx context.Context, method string, path string, query url.Values, body io.Reader, contentType string) (io.ReadCloser, error) {
+	resp, err := c.send(ctx, method, path, query, body, contentType)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		return nil, newError(resp.StatusCode, data)
+	}
+	return resp.Body, nil
+}
+
+// newError エラーのレスポンスからErrorを生成する
+func newError(statusCode int, data []byte) error {
+	var response struct {
+		Status struct {
+			Code    uint16 ` + "`json:\"code\"`" + `
+			Type    string ` + "`json:\"type\"`" + `
+			Message string ` + "`json:\"message\"`" + `
+		} ` + "`json:\"status\"`" + `
+	}
+	json.Unmarshal(data, &response)
+	return &Error{
+		StatusCode: statusCode,
+		Code:       response.Status.Code,
+		Type:       response.Status.Type,
+		Message:    response.Status.Message,
+	}
+}
+
+// encodeBody JSONボディを生成する
+func encodeBody(body interface{}) (io.Reader, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(data), nil
+}
+`)
+}
+
+// schemas components/schemasを構造体として出力する
+func (g *clientGenerator) schemas() {
+	names := make([]string, 0, len(g.doc.Components.Schemas))
+	for name := range g.doc.Components.Schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		schema := g.doc.Components.Schemas[name]
+		required := make(map[string]bool)
+		for _, property := range schema.Required {
+			required[property] = true
+		}
+
+		properties := make([]string, 0, len(schema.Properties))
+		for property := range schema.Properties {
+			properties = append(properties, property)
+		}
+		sort.Strings(properties)
+
+		g.printf("\ntype %s struct {\n", name)
+		for _, property := range properties {
+			tag := property
+			if !required[property] {
+				tag += ",omitempty"
+			}
+			g.printf("\t%s %s `json:\"%s\"`\n", goName(property), g.goType(schema.Properties[property]), tag)
+		}
+		g.printf("}\n")
+	}
+}
+
+// operations v2の操作ごとにメソッドを出力する
+func (g *clientGenerator) operations() {
+	paths := make([]string, 0, len(g.doc.Paths))
+	for path := range g.doc.Paths {
+		if strings.HasPrefix(path, apiV2Prefix+"/") {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		methods := make([]string, 0, len(g.doc.Paths[path]))
+		for method := range g.doc.Paths[path] {
+			methods = append(methods, method)
+		}
+		sort.Strings(methods)
+
+		for _, method := range methods {
+			operation := g.doc.Paths[path][method]
+			if _, ok := operation.Responses["200"]; !ok {
+				continue
+			}
+			g.operation(path, strings.ToUpper(method), operation)
+		}
+	}
+}
+
+// operation 1つの操作のParams構造体とメソッドを出力する
+func (g *clientGenerator) operation(path string, method string, operation *openAPIOperation) {
+	name := goName(operation.OperationID)
+
+	args := []string{"ctx context.Context"}
+	pathExpr := fmt.Sprintf("%q", path)
+	fields := make([]clientField, 0)
+	for _, param := range operation.Parameters {
+		if param.In == "path" {
+			args = append(args, param.Name+" string")
+			pathExpr = strings.Replace(pathExpr, "{"+param.Name+"}", fmt.Sprintf(`" + url.PathEscape(%s) + "`, param.Name), 1)
+			continue
+		}
+		fields = append(fields, clientField{
+			name:        param.Name,
+			goName:      goName(param.Name),
+			goType:      g.paramType(param.Schema),
+			description: param.Description,
+			required:    param.Required,
+		})
+	}
+	pathExpr = strings.TrimSuffix(strings.TrimPrefix(pathExpr, `"" + `), ` + ""`)
+
+	// JSONボディの入力パラメータはParamsに、それ以外のボディは引数にする
+	bodyExpr, contentType := "nil", ""
+	if operation.RequestBody != nil {
+		contentTypes := make([]string, 0, len(operation.RequestBody.Content))
+		for contentType := range operation.RequestBody.Content {
+			contentTypes = append(contentTypes, contentType)
+		}
+		sort.Strings(contentTypes)
+
+		schema := operation.RequestBody.Content["application/json"].Schema
+		switch {
+		case len(contentTypes) == 1 && schema != nil && schema.Ref == "":
+			required := make(map[string]bool)
+			for _, property := range schema.Required {
+				required[property] = true
+			}
+			properties := make([]string, 0, len(schema.Properties))
+			for property := range schema.Properties {
+				properties = append(properties, property)
+			}
+			sort.Strings(properties)
+			for _, property := range properties {
+				fields = append(fields, clientField{
+					name:        property,
+					goName:      goName(property),
+					goType:      g.paramType(schema.Properties[property]),
+					description: schema.Properties[property].Description,
+					required:    required[property],
+					inBody:      true,
+				})
+			}
+			bodyExpr, contentType = "body", "application/json"
+
+		case len(contentTypes) == 1 && schema != nil:
+			args = append(args, "payload *"+g.goType(schema))
+			bodyExpr, contentType = "body", "application/json"
+
+		case len(contentTypes) == 1:
+			args = append(args, "body io.Reader")
+			bodyExpr, contentType = "body", contentTypes[0]
+
+		default:
+			args = append(args, "body io.Reader", "contentType string")
+			bodyExpr, contentType = "body", ""
+		}
+	}
+
+	paramsType := name + "Params"
+	if len(fields) > 0 {
+		g.printf("\n// %s %sの入力パラメータ\ntype %s struct {\n", paramsType, name, paramsType)
+		for _, field := range fields {
+			description := field.description
+			if field.required {
+				description += "(必須)"
+			}
+			g.printf("\t%s %s // %s\n", field.goName, field.goType, description)
+		}
+		g.printf("}\n")
+		args = append(args, "params *"+paramsType)
+	}
+
+	success := operation.Responses["200"]
+	result := "io.ReadCloser"
+	if media, ok := success.Content["application/json"]; ok && media.Schema != nil && media.Schema.Ref != "" {
+		result = "*" + g.goType(media.Schema)
+	}
+
+	g.printf("\n// %s %s\n", name, operation.Summary)
+	g.printf("func (c *Client) %s(%s) (%s, error) {\n", name, strings.Join(args, ", "), result)
+	g.printf("\tquery := make(url.Values)\n")
+	if len(fields) > 0 {
+		inBody := false
+		for _, field := range fields {
+			inBody = inBody || field.inBody
+		}
+		if inBody {
+			g.printf("\tparamsBody := make(map[string]interface{})\n")
+		}
+		g.printf("\tif params != nil {\n")
+		for _, field := range fields {
+			if field.inBody {
+				g.printf("\t\taddBodyParam(paramsBody, %q, params.%s)\n", field.name, field.goName)
+			} else {
+				g.printf("\t\taddParam(query, %q, params.%s)\n", field.name, field.goName)
+			}
+		}
+		g.printf("\t}\n")
+		if inBody {
+			g.printf("\tbody, err := encodeBody(paramsBody)\n\tif err != nil {\n\t\treturn nil, err\n\t}\n")
+		}
+	}
+	if containsArg(args, "payload ") {
+		g.printf("\tbody, err := encodeBody(payload)\n\tif err != nil {\n\t\treturn nil, err\n\t}\n")
+	}
+
+	contentTypeExpr := fmt.Sprintf("%q", contentType)
+	if containsArg(args, "contentType ") {
+		contentTypeExpr = "contentType"
+	}
+
+	if result == "io.ReadCloser" {
+		g.printf("\treturn c.stream(ctx, %q, %s, query, %s, %s)\n}\n", method, pathExpr, bodyExpr, contentTypeExpr)
+		return
+	}
+	g.printf("\tout := new(%s)\n", strings.TrimPrefix(result, "*"))
+	g.printf("\treturn out, c.call(ctx, %q, %s, query, %s, %s, out)\n}\n", method, pathExpr, bodyExpr, contentTypeExpr)
+}
+
+// containsArg 引数の一覧に指定した名前の引数が含まれるかを返却する
+func containsArg(args []string, prefix string) bool {
+	for _, arg := range args {
+		if strings.HasPrefix(arg, prefix) {
+			return true
+		}
+	}
+	return false
+}
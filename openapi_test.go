@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// checkAPIRoutes ルーティング表と操作の一覧の整合性を検査する
+// v1のハンドラーが実際に受け付けるメソッド(CORSのプリフライトで返却する一覧)とも照合する
+func checkAPIRoutes() []string {
+	problems := make([]string, 0)
+	operations := apiOperations()
+	params := apiParams()
+	referenced := make(map[string]bool)
+	v1Methods := make(map[string]string)
+
+	for _, route := range apiV1Routes() {
+		websocket := false
+		for method, id := range route.operations {
+			operation, ok := operations[id]
+			if !ok {
+				problems = append(problems, fmt.Sprintf("%s %s: 操作%sが定義されていません", method, route.path, id))
+				continue
+			}
+			referenced[id] = true
+			v1Methods[id] = method
+			websocket = websocket || operation.websocket
+		}
+		if websocket {
+			continue
+		}
+
+		recorder := httptest.NewRecorder()
+		route.handle(&server{}, recorder, httptest.NewRequest("OPTIONS", route.path, nil))
+		allowed := strings.Split(recorder.Header().Get("Access-Control-Allow-Methods"), ",")
+		documented := make([]string, 0, len(route.operations)+1)
+		for method := range route.operations {
+			documented = append(documented, method)
+		}
+		documented = append(documented, "OPTIONS")
+		sort.Strings(allowed)
+		sort.Strings(documented)
+		if !reflect.DeepEqual(allowed, documented) {
+			problems = append(problems, fmt.Sprintf("%s: ハンドラーのメソッド%vとルーティング表のメソッド%vが一致しません",
+				route.path, allowed, documented))
+		}
+	}
+
+	for _, route := range apiV2Routes() {
+		_, pathParams := route.v2Path()
+		for method, id := range route.operations {
+			operation, ok := operations[id]
+			if !ok {
+				problems = append(problems, fmt.Sprintf("%s %s: 操作%sが定義されていません", method, route.pattern, id))
+				continue
+			}
+			referenced[id] = true
+			if v1Methods[id] != method {
+				problems = append(problems, fmt.Sprintf("%s %s: 操作%sのメソッドがv1(%s)と異なります",
+					method, route.pattern, id, v1Methods[id]))
+			}
+			for _, name := range append(append([]string{}, pathParams...), route.bodyParams...) {
+				if !operation.accepts(name) {
+					problems = append(problems, fmt.Sprintf("%s %s: 操作%sは入力パラメータ%sを受け取りません",
+						method, route.pattern, id, name))
+				}
+			}
+		}
+	}
+
+	for id, operation := range operations {
+		if !referenced[id] {
+			problems = append(problems, fmt.Sprintf("操作%sがルーティング表に登録されていません", id))
+		}
+		for _, name := range append(append([]string{}, operation.required...), operation.optional...) {
+			if _, ok := params[name]; !ok {
+				problems = append(problems, fmt.Sprintf("操作%s: 入力パラメータ%sが定義されていません", id, name))
+			}
+		}
+	}
+
+	sort.Strings(problems)
+	return problems
+}
+
+func TestAPIRoutes(t *testing.T) {
+	for _, problem := range checkAPIRoutes() {
+		t.Error(problem)
+	}
+}
+
+func TestGeneratedFilesUpToDate(t *testing.T) {
+	spec, err := buildOpenAPIDocument().encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := generateOpenAPIClient(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path      string
+		generated []byte
+	}{
+		{"openapi.json", spec},
+		{"client/client.go", client},
+	}
+
+	for _, test := range tests {
+		data, err := os.ReadFile(test.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, test.generated) {
+			t.Errorf("%s: ルーティング表・レスポンスの型と一致しません(go generateで再生成してください)", test.path)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type (
+	// requestParams v2のパスやJSONボディから取り出した入力パラメータ(キーはv1のヘッダー名)
+	requestParams map[string]string
+
+	// requestParamsKey requestParamsをリクエストのコンテキストに格納する際のキー
+	requestParamsKey struct{}
+)
+
+// withRequestParams 入力パラメータをリクエストのコンテキストに追加する
+// v2のルートのみが追加するため、requestParamはこれをクエリ文字列を参照するv2のリクエストの目印として使う
+func withRequestParams(r *http.Request, params requestParams) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), requestParamsKey{}, params))
+}
+
+// paramQueryName v1のヘッダー名に対応する、クエリ文字列・JSONボディでの名前を返却する
+// (x-pair-name → pairName, x-time-type-0 → timeType0)
+func paramQueryName(name string) string {
+	parts := strings.Split(strings.TrimPrefix(name, "x-"), "-")
+	for i := 1; i < len(parts); i++ {
+		if parts[i] != "" {
+			parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
+
+// requestParam 入力パラメータを読み込む
+// v2はパス・JSONボディ、クエリ文字列、ヘッダーの順に参照し、最初に見つかった値を返却する
+// v1はヘッダーのみを参照する
+func requestParam(r *http.Request, name string) string {
+	params, v2 := r.Context().Value(requestParamsKey{}).(requestParams)
+	if v2 {
+		if value, ok := params[name]; ok {
+			return value
+		}
+		if values, ok := r.URL.Query()[paramQueryName(name)]; ok && len(values) > 0 {
+			return strings.Join(values, ",")
+		}
+	}
+	return r.Header.Get(name)
+}
+
+// decodeBodyParams JSONボディのオブジェクトを、v1のヘッダー名をキーとする入力パラメータに変換する
+// 配列はカンマ区切りの文字列に変換する(文字列・数値・真偽値以外の値は無視する)
+func decodeBodyParams(r *http.Request, names []string) (requestParams, error) {
+	params := make(requestParams)
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		return params, nil
+	}
+
+	body := make(map[string]interface{})
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		return nil, ErrInvalidRequestBody{cause: err}
+	}
+
+	for _, name := range names {
+		value, ok := body[paramQueryName(name)]
+		if !ok {
+			continue
+		}
+		if text, ok := paramString(value); ok {
+			params[name] = text
+		}
+	}
+	return params, nil
+}
+
+// paramString JSONの値を入力パラメータの文字列に変換する
+func paramString(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(v), true
+	case []interface{}:
+		texts := make([]string, 0, len(v))
+		for _, element := range v {
+			text, ok := paramString(element)
+			if !ok {
+				return "", false
+			}
+			texts = append(texts, text)
+		}
+		return strings.Join(texts, ","), true
+	}
+	return "", false
+}
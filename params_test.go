@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequestParam(t *testing.T) {
+	tests := []struct {
+		name   string
+		v2     bool
+		params requestParams // v2のパス・JSONボディの入力パラメータ
+		target string
+		header string
+		want   string
+	}{
+		{"v2 path over query and header", true, requestParams{"x-pair-name": "EURUSD"}, "/?pairName=USDJPY", "GBPUSD", "EURUSD"},
+		{"v2 query over header", true, requestParams{}, "/?pairName=USDJPY", "GBPUSD", "USDJPY"},
+		{"v2 header", true, requestParams{}, "/", "GBPUSD", "GBPUSD"},
+		{"v2 repeated query", true, requestParams{}, "/?pairName=USDJPY&pairName=EURUSD", "", "USDJPY,EURUSD"},
+		{"v2 missing", true, requestParams{}, "/", "", ""},
+		{"v1 header", false, nil, "/", "GBPUSD", "GBPUSD"},
+		{"v1 ignores query", false, nil, "/?pairName=USDJPY", "GBPUSD", "GBPUSD"},
+		{"v1 query only", false, nil, "/?pairName=USDJPY", "", ""},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", test.target, nil)
+		if test.header != "" {
+			r.Header.Set("x-pair-name", test.header)
+		}
+		if test.v2 {
+			r = withRequestParams(r, test.params)
+		}
+		if got := requestParam(r, "x-pair-name"); got != test.want {
+			t.Errorf("%s: requestParam = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestParamQueryName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"x-pair-name", "pairName"},
+		{"x-time-type-0", "timeType0"},
+		{"x-api-key", "apiKey"},
+		{"x-steps", "steps"},
+	}
+
+	for _, test := range tests {
+		if got := paramQueryName(test.name); got != test.want {
+			t.Errorf("paramQueryName(%q) = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+const (
+	// problemContentType RFC 7807のエラーレスポンスの形式
+	problemContentType = "application/problem+json"
+
+	// problemTypePrefix application/problem+jsonのtypeの接頭辞(続けてエラーの名前を付ける)
+	problemTypePrefix = "urn:fx-tester-server:error:"
+)
+
+type (
+	// ApiProblem application/problem+jsonのエラーレスポンス
+	// 通常のレスポンスのstatus以外の項目(検証結果など)は、拡張メンバーとして同じ階層に出力する
+	ApiProblem struct {
+		Type     string            `json:"type"`
+		Title    string            `json:"title"`
+		Status   int               `json:"status"` // HTTPステータス
+		Detail   string            `json:"detail"`
+		Instance string            `json:"instance,omitempty"`
+		Code     uint16            `json:"code"` // 通常のレスポンスのstatus.codeと同じ値
+		Causes   []ApiProblemCause `json:"causes,omitempty"`
+	}
+
+	// ApiProblemCause 複数のエラーが発生した場合の、それぞれのエラー
+	ApiProblemCause struct {
+		Type   string `json:"type"`
+		Detail string `json:"detail"`
+		Code   uint16 `json:"code"`
+	}
+
+	// ApiResponseError 処理に入る前に失敗したリクエスト(ルーティング・認証)のレスポンス
+	ApiResponseError struct {
+		Status ApiResponseStatus `json:"status"`
+	}
+)
+
+// acceptsProblem AcceptヘッダーでRFC 7807の形式が要求されているかを返却する
+func acceptsProblem(r *http.Request) bool {
+	for _, value := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(value))
+		if err == nil && mediaType == problemContentType {
+			return true
+		}
+	}
+	return false
+}
+
+// errorHTTPStatus エラーに対応するHTTPステータスを返却する
+func errorHTTPStatus(err error) int {
+	spec, _ := lookupError(err)
+	return spec.httpStatus
+}
+
+// writeApiResponse レスポンスを返却する
+// エラーの場合はエラーに対応するHTTPステータスを設定し、
+// AcceptヘッダーでRFC 7807の形式が要求されていればapplication/problem+jsonで返却する
+func writeApiResponse(w http.ResponseWriter, r *http.Request, err error, response interface{}) {
+	if err == nil {
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	if acceptsProblem(r) {
+		writeProblem(w, r, err, response)
+		return
+	}
+	w.WriteHeader(errorHTTPStatus(err))
+	json.NewEncoder(w).Encode(response)
+}
+
+// writeErrorResponse 処理に入る前に失敗したリクエストのエラーを返却する
+func writeErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+	writeApiResponse(w, r, err, ApiResponseError{Status: newApiResponseStatus(r, err)})
+}
+
+// writeProblem エラーをapplication/problem+jsonで返却する
+func writeProblem(w http.ResponseWriter, r *http.Request, err error, response interface{}) {
+	status := newApiResponseStatus(r, err)
+	spec, _ := lookupError(err)
+	problem := ApiProblem{
+		Type:     problemTypePrefix + status.ErrorType,
+		Title:    http.StatusText(spec.httpStatus),
+		Status:   spec.httpStatus,
+		Detail:   status.ErrorMessage,
+		Instance: r.URL.Path,
+		Code:     status.ErrorCode,
+	}
+
+	var multiple ErrMultipleCause
+	if errors.As(err, &multiple) {
+		for _, cause := range multiple.errors {
+			if cause == nil {
+				continue
+			}
+			causeStatus := newApiResponseStatus(r, cause)
+			problem.Causes = append(problem.Causes, ApiProblemCause{
+				Type:   problemTypePrefix + causeStatus.ErrorType,
+				Detail: causeStatus.ErrorMessage,
+				Code:   causeStatus.ErrorCode,
+			})
+		}
+	}
+
+	members, mergeErr := problemMembers(problem, response)
+
+	w.Header().Set("Content-Type", problemContentType)
+	w.WriteHeader(problem.Status)
+	if mergeErr != nil {
+		json.NewEncoder(w).Encode(problem)
+		return
+	}
+	json.NewEncoder(w).Encode(members)
+}
+
+// problemMembers 通常のレスポンスのstatus以外の項目を、拡張メンバーとしてproblemに追加する
+func problemMembers(problem ApiProblem, response interface{}) (map[string]json.RawMessage, error) {
+	members := make(map[string]json.RawMessage)
+	if response != nil {
+		data, err := json.Marshal(response)
+		if err != nil {
+			return nil, err
+		}
+		err = json.Unmarshal(data, &members)
+		if err != nil {
+			return nil, err
+		}
+		delete(members, "status")
+	}
+
+	data, err := json.Marshal(problem)
+	if err != nil {
+		return nil, err
+	}
+	standard := make(map[string]json.RawMessage)
+	err = json.Unmarshal(data, &standard)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range standard {
+		members[name] = value
+	}
+	return members, nil
+}
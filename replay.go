@@ -0,0 +1,402 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// replaySessionTimeout 最後の操作からセッションを破棄するまでの時間
+	replaySessionTimeout = 1 * time.Hour
+)
+
+type (
+	// ReplayCandle 時間軸ごとの現在のローソク足
+	ReplayCandle struct {
+		TimeType int    `json:"timeType"`
+		Candle   Candle `json:"candle"`
+	}
+
+	// ReplayState リプレイセッションの現在の状態
+	ReplayState struct {
+		SessionID string         `json:"sessionId"`
+		PairName  string         `json:"pairName"`
+		Time      string         `json:"time"`
+		Position  int            `json:"position"`
+		Length    int            `json:"length"`
+		Candles   []ReplayCandle `json:"candles"`
+		Account   AccountState   `json:"account"`
+	}
+
+	// replaySession 下位足1本ずつ時刻を進める検証用のセッション
+	replaySession struct {
+		mutex      sync.Mutex
+		id         string
+		owner      string // 作成した利用者(認証が無効な場合は空)
+		store      CandleStore
+		pairName   string
+		timeTypes  []TimeType // 昇順(先頭がカーソルの基準となる下位足)
+		length     int        // 作成時点の下位足の本数
+		startTime  string
+		cursor     int                  // カーソル位置の下位足が何本目か(0始まり)
+		fixTime    string               // カーソル位置の下位足の確定時刻
+		candles    map[TimeType]*Candle // カーソル時点で形成中のローソク足
+		account    *tradingAccount
+		lastAccess time.Time
+	}
+
+	// replayManager リプレイセッションを管理する
+	replayManager struct {
+		mutex    sync.Mutex
+		sessions map[string]*replaySession
+	}
+)
+
+// newReplayManager replayManagerをnewする
+func newReplayManager() *replayManager {
+	return &replayManager{sessions: make(map[string]*replaySession)}
+}
+
+// create セッションを作成し、開始時刻以前で最も新しい下位足にカーソルを合わせる
+// セッションはownerの利用者のみ操作でき、storeのデータセットのローソク足を再生する
+// 確定時刻の一覧は保持せず、カーソルを動かすたびに前後のローソク足をstoreから取得する
+func (m *replayManager) create(
+	owner string,
+	store CandleStore,
+	pairName string,
+	startTime string,
+	timeTypes []TimeType) (*replaySession, error) {
+
+	sorted := append([]TimeType{}, timeTypes...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	session := &replaySession{
+		owner:      owner,
+		store:      store,
+		pairName:   pairName,
+		timeTypes:  sorted,
+		account:    newTradingAccount(),
+		lastAccess: time.Now(),
+	}
+
+	length, err := store.countCandles(pairName, session.lowerTimeType(), minFixTime, maxFixTime)
+	if err != nil {
+		return nil, err
+	}
+	session.length = length
+
+	err = session.seek(startTime)
+	if err != nil {
+		return nil, err
+	}
+	session.startTime = session.currentTime()
+
+	id, err := newSessionID()
+	if err != nil {
+		return nil, err
+	}
+	session.id = id
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.removeExpired()
+	m.sessions[id] = session
+	return session, nil
+}
+
+// get セッションIDに対応するセッションを返却する(他の利用者のセッションは存在しないものとして扱う)
+func (m *replayManager) get(id string, owner string) (*replaySession, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	session, ok := m.sessions[id]
+	if !ok || session.owner != owner {
+		return nil, ErrReplaySessionNotFound{}
+	}
+	return session, nil
+}
+
+// remove セッションを破棄する
+func (m *replayManager) remove(id string, owner string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if session, ok := m.sessions[id]; !ok || session.owner != owner {
+		return ErrReplaySessionNotFound{}
+	}
+	delete(m.sessions, id)
+	return nil
+}
+
+// removeExpired 一定時間操作されていないセッションを破棄する
+func (m *replayManager) removeExpired() {
+	for id, session := range m.sessions {
+		session.mutex.Lock()
+		expired := time.Since(session.lastAccess) > replaySessionTimeout
+		session.mutex.Unlock()
+
+		if expired {
+			delete(m.sessions, id)
+		}
+	}
+}
+
+// newSessionID ランダムなセッションIDを生成する
+func newSessionID() (string, error) {
+	buf := make([]byte, 16)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// lowerTimeType カーソルの基準となる下位足の時間軸を返却する
+func (s *replaySession) lowerTimeType() TimeType {
+	return s.timeTypes[0]
+}
+
+// currentTime カーソル位置の下位足の確定時刻を返却する
+func (s *replaySession) currentTime() string {
+	return s.fixTime
+}
+
+// state セッションの現在の状態を返却する
+func (s *replaySession) state() ReplayState {
+	s.lastAccess = time.Now()
+
+	candles := make([]ReplayCandle, 0, len(s.timeTypes))
+	for _, timeType := range s.timeTypes {
+		if c, ok := s.candles[timeType]; ok {
+			candles = append(candles, ReplayCandle{TimeType: timeType.toInt(), Candle: *c})
+		}
+	}
+
+	return ReplayState{
+		SessionID: s.id,
+		PairName:  s.pairName,
+		Time:      s.currentTime(),
+		Position:  s.cursor,
+		Length:    s.length,
+		Candles:   candles,
+		Account:   s.account.state(),
+	}
+}
+
+// currentPrice カーソル位置の下位足の終値を返却する
+func (s *replaySession) currentPrice() float64 {
+	c, ok := s.candles[s.lowerTimeType()]
+	if !ok {
+		return 0
+	}
+	return toPrice(c.Close)
+}
+
+// next カーソルを指定した本数だけ進め、通過した下位足で注文と決済を処理する
+func (s *replaySession) next(steps int) error {
+	if steps < 1 {
+		return ErrReplayOutOfRange{}
+	}
+
+	lowers, err := s.neighborCandles(maxFixTime, false, steps)
+	if err != nil {
+		return err
+	}
+	if len(lowers) < steps {
+		return ErrReplayOutOfRange{}
+	}
+	return s.advance(lowers)
+}
+
+// prev カーソルを指定した本数だけ戻す
+// 取引を開始したセッションでは、約定済みの結果と矛盾するため戻すことはできない
+func (s *replaySession) prev(steps int) error {
+	if steps < 1 {
+		return ErrReplayOutOfRange{}
+	}
+
+	lowers, err := s.neighborCandles(minFixTime, true, steps)
+	if err != nil {
+		return err
+	}
+	if len(lowers) < steps {
+		return ErrReplayOutOfRange{}
+	}
+	if s.account.isActive() {
+		return ErrReplayTradingInProgress{}
+	}
+
+	s.cursor -= steps
+	s.fixTime = lowers[steps-1].Time
+	return s.rebuild()
+}
+
+// seek 指定した時刻以前で最も新しい下位足にカーソルを合わせる
+func (s *replaySession) seek(fixTime string) error {
+	targets, err := s.store.queryCandleRange(s.pairName, s.lowerTimeType(), minFixTime, fixTime, true, 1)
+	if err != nil {
+		return err
+	}
+	if len(targets) == 0 {
+		return ErrReplayOutOfRange{}
+	}
+	target := targets[0].Time
+
+	// 取引を開始したセッションでは、通過する下位足で注文を処理しながら進める
+	if s.account.isActive() {
+		if target < s.currentTime() {
+			return ErrReplayTradingInProgress{}
+		}
+		if target == s.currentTime() {
+			return nil
+		}
+
+		lowers, err := s.store.queryCandles(s.pairName, s.lowerTimeType(), s.currentTime(), target)
+		if err != nil {
+			return err
+		}
+		if len(lowers) > 0 && lowers[0].Time == s.currentTime() {
+			lowers = lowers[1:]
+		}
+		return s.advance(lowers)
+	}
+
+	count, err := s.store.countCandles(s.pairName, s.lowerTimeType(), minFixTime, target)
+	if err != nil {
+		return err
+	}
+	s.cursor = count - 1
+	s.fixTime = target
+	return s.rebuild()
+}
+
+// neighborCandles カーソル位置の下位足を除き、boundまでの間でカーソルに近い順に最大limit本の下位足を取得する
+// descendingがfalseの場合はカーソルより後、trueの場合はカーソルより前の下位足を取得する
+func (s *replaySession) neighborCandles(bound string, descending bool, limit int) ([]Candle, error) {
+	from, to := s.currentTime(), bound
+	if descending {
+		from, to = bound, s.currentTime()
+	}
+
+	// カーソル位置の下位足も範囲に含まれるため、1本多く取得して除く
+	lowers, err := s.store.queryCandleRange(s.pairName, s.lowerTimeType(), from, to, descending, limit+1)
+	if err != nil {
+		return nil, err
+	}
+	if len(lowers) > 0 && lowers[0].Time == s.currentTime() {
+		lowers = lowers[1:]
+	}
+	if len(lowers) > limit {
+		lowers = lowers[:limit]
+	}
+	return lowers, nil
+}
+
+// advance カーソルを昇順に並んだ下位足の最後まで進め、通過した下位足で注文と決済を処理する
+func (s *replaySession) advance(lowers []Candle) error {
+	if len(lowers) == 0 {
+		return ErrInvalidData{}
+	}
+
+	s.cursor += len(lowers)
+	s.fixTime = lowers[len(lowers)-1].Time
+
+	// 1本ずつ進める場合は、新しい下位足を形成中のローソク足に合成するだけで済む
+	var err error
+	if len(lowers) == 1 {
+		err = s.appendLowerCandle(lowers[0])
+	} else {
+		err = s.rebuild()
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, lower := range lowers {
+		s.account.process(lower)
+	}
+	return nil
+}
+
+// upperStart カーソル時点で形成中の上位足の確定時刻を返却する
+func (s *replaySession) upperStart(timeType TimeType) (string, bool, error) {
+	uppers, err := s.store.queryCandleRange(s.pairName, timeType, minFixTime, s.currentTime(), true, 1)
+	if err != nil {
+		return "", false, err
+	}
+	if len(uppers) == 0 {
+		return "", false, nil
+	}
+	return uppers[0].Time, true, nil
+}
+
+// appendLowerCandle カーソル位置の下位足を、各時間軸の形成中のローソク足に合成する
+func (s *replaySession) appendLowerCandle(lower Candle) error {
+	for _, timeType := range s.timeTypes {
+		if timeType == s.lowerTimeType() {
+			c := lower
+			s.candles[timeType] = &c
+			continue
+		}
+
+		start, ok, err := s.upperStart(timeType)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			delete(s.candles, timeType)
+			continue
+		}
+
+		current, ok := s.candles[timeType]
+		if !ok || current.Time != start {
+			c := lower
+			c.Time = start
+			s.candles[timeType] = &c
+			continue
+		}
+
+		mergeCandle(current, lower)
+	}
+	return nil
+}
+
+// rebuild カーソル位置における各時間軸の形成中のローソク足を作り直す
+func (s *replaySession) rebuild() error {
+	s.candles = make(map[TimeType]*Candle)
+
+	for _, timeType := range s.timeTypes {
+		from := s.currentTime()
+		if timeType != s.lowerTimeType() {
+			start, ok, err := s.upperStart(timeType)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+			from = start
+		}
+
+		lowers, err := s.store.queryCandles(s.pairName, s.lowerTimeType(), from, s.currentTime())
+		if err != nil {
+			return err
+		}
+		if len(lowers) == 0 {
+			continue
+		}
+
+		c := lowers[0]
+		c.Time = from
+		for _, lower := range lowers[1:] {
+			mergeCandle(&c, lower)
+		}
+		s.candles[timeType] = &c
+	}
+
+	return nil
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+func writeReplayResponse(w http.ResponseWriter, r *http.Request, err error, state *ReplayState) {
+	status := newApiResponseStatus(r, err)
+	writeApiResponse(w, r, err, ApiResponseReplay{Status: status, Session: state})
+}
+
+// readTimeTypes 時間軸の一覧を読み込む
+// x-time-types(カンマ区切り)、x-time-type-0〜7、x-time-typeの順に参照する(未指定のパラメータは無視する)
+func readTimeTypes(r *http.Request) ([]TimeType, error) {
+	timeTypeNames := make([]string, 0)
+	if value := requestParam(r, "x-time-types"); value != "" {
+		timeTypeNames = strings.Split(value, ",")
+	} else {
+		for i := 0; i < int(NumTimeType); i++ {
+			timeTypeNames = append(timeTypeNames, requestParam(r, fmt.Sprintf("x-time-type-%d", i)))
+		}
+		if value := requestParam(r, "x-time-type"); value != "" {
+			timeTypeNames = append(timeTypeNames, value)
+		}
+	}
+
+	timeTypes := make([]TimeType, 0)
+	for _, timeTypeName := range timeTypeNames {
+		timeTypeName = strings.TrimSpace(timeTypeName)
+		if timeTypeName == "" {
+			continue
+		}
+
+		timeType, err := Utils.getTimeType(timeTypeName)
+		if err != nil {
+			return nil, err
+		}
+		timeTypes = append(timeTypes, timeType)
+	}
+
+	if len(timeTypes) <= 0 {
+		return nil, ErrInvalidTimeType{}
+	}
+	return timeTypes, nil
+}
+
+func (s *server) handleReplay(w http.ResponseWriter, r *http.Request) {
+	supportedParams := []string{"*"}
+	supportedMethods := []string{
+		"POST",
+		"GET",
+		"DELETE",
+		"OPTIONS",
+	}
+	if handleCORS(w, r, supportedParams, supportedMethods) {
+		return
+	}
+
+	switch r.Method {
+	case "POST":
+		s.handleReplayCreate(w, r)
+		break
+
+	case "GET":
+		s.handleReplayStep(w, r, func(session *replaySession) error { return nil })
+		break
+
+	case "DELETE":
+		err := s.replays.remove(requestParam(r, "x-session-id"), ownerOf(r))
+		writeReplayResponse(w, r, err, nil)
+		break
+	}
+}
+
+func (s *server) handleReplayCreate(w http.ResponseWriter, r *http.Request) {
+	pairName := requestParam(r, "x-pair-name")
+	err := Utils.checkPairName(pairName)
+	if err != nil {
+		writeReplayResponse(w, r, err, nil)
+		return
+	}
+
+	startTime := requestParam(r, "x-start-time")
+	err = Utils.checkFixedTime(startTime)
+	if err != nil {
+		writeReplayResponse(w, r, err, nil)
+		return
+	}
+
+	timeTypes, err := readTimeTypes(r)
+	if err != nil {
+		writeReplayResponse(w, r, err, nil)
+		return
+	}
+
+	session, err := s.replays.create(ownerOf(r), s.storeOf(r), pairName, startTime, timeTypes)
+	if err != nil {
+		writeReplayResponse(w, r, err, nil)
+		return
+	}
+
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+
+	state := session.state()
+	writeReplayResponse(w, r, nil, &state)
+}
+
+// handleReplayStep x-session-idヘッダーで指定されたセッションを操作し、操作後の状態を返却する
+func (s *server) handleReplayStep(w http.ResponseWriter, r *http.Request, operation func(session *replaySession) error) {
+	session, err := s.replays.get(requestParam(r, "x-session-id"), ownerOf(r))
+	if err != nil {
+		writeReplayResponse(w, r, err, nil)
+		return
+	}
+
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+
+	err = operation(session)
+	if err != nil {
+		writeReplayResponse(w, r, err, nil)
+		return
+	}
+
+	state := session.state()
+	writeReplayResponse(w, r, nil, &state)
+}
+
+func (s *server) handleReplayNext(w http.ResponseWriter, r *http.Request) {
+	supportedParams := []string{"*"}
+	supportedMethods := []string{
+		"POST",
+		"OPTIONS",
+	}
+	if handleCORS(w, r, supportedParams, supportedMethods) {
+		return
+	}
+
+	steps, err := Utils.checkSteps(requestParam(r, "x-steps"))
+	if err != nil {
+		writeReplayResponse(w, r, err, nil)
+		return
+	}
+
+	s.handleReplayStep(w, r, func(session *replaySession) error {
+		return session.next(steps)
+	})
+}
+
+func (s *server) handleReplayPrev(w http.ResponseWriter, r *http.Request) {
+	supportedParams := []string{"*"}
+	supportedMethods := []string{
+		"POST",
+		"OPTIONS",
+	}
+	if handleCORS(w, r, supportedParams, supportedMethods) {
+		return
+	}
+
+	steps, err := Utils.checkSteps(requestParam(r, "x-steps"))
+	if err != nil {
+		writeReplayResponse(w, r, err, nil)
+		return
+	}
+
+	s.handleReplayStep(w, r, func(session *replaySession) error {
+		return session.prev(steps)
+	})
+}
+
+func (s *server) handleReplaySeek(w http.ResponseWriter, r *http.Request) {
+	supportedParams := []string{"*"}
+	supportedMethods := []string{
+		"POST",
+		"OPTIONS",
+	}
+	if handleCORS(w, r, supportedParams, supportedMethods) {
+		return
+	}
+
+	fixTime := requestParam(r, "x-time")
+	err := Utils.checkFixedTime(fixTime)
+	if err != nil {
+		writeReplayResponse(w, r, err, nil)
+		return
+	}
+
+	s.handleReplayStep(w, r, func(session *replaySession) error {
+		return session.seek(fixTime)
+	})
+}
+
+func (s *server) handleReplayOrders(w http.ResponseWriter, r *http.Request) {
+	supportedParams := []string{"*"}
+	supportedMethods := []string{
+		"POST",
+		"DELETE",
+		"OPTIONS",
+	}
+	if handleCORS(w, r, supportedParams, supportedMethods) {
+		return
+	}
+
+	switch r.Method {
+	case "POST":
+		var payload OrderPayload
+		err := json.NewDecoder(r.Body).Decode(&payload)
+		if err != nil {
+			writeReplayResponse(w, r, ErrInvalidOrder{}, nil)
+			return
+		}
+
+		s.handleReplayStep(w, r, func(session *replaySession) error {
+			return session.account.placeOrder(payload, session.currentPrice(), session.currentTime())
+		})
+		break
+
+	case "DELETE":
+		orderID, err := strconv.Atoi(requestParam(r, "x-order-id"))
+		if err != nil {
+			writeReplayResponse(w, r, ErrOrderNotFound{}, nil)
+			return
+		}
+
+		s.handleReplayStep(w, r, func(session *replaySession) error {
+			return session.account.cancelOrder(orderID)
+		})
+		break
+	}
+}
+
+func (s *server) handleReplayPositions(w http.ResponseWriter, r *http.Request) {
+	supportedParams := []string{"*"}
+	supportedMethods := []string{
+		"PUT",
+		"DELETE",
+		"OPTIONS",
+	}
+	if handleCORS(w, r, supportedParams, supportedMethods) {
+		return
+	}
+
+	switch r.Method {
+	case "PUT":
+		var payload ModifyPositionPayload
+		err := json.NewDecoder(r.Body).Decode(&payload)
+		if err != nil {
+			writeReplayResponse(w, r, ErrInvalidOrder{}, nil)
+			return
+		}
+
+		s.handleReplayStep(w, r, func(session *replaySession) error {
+			return session.account.modifyPosition(payload)
+		})
+		break
+
+	case "DELETE":
+		positionID, err := strconv.Atoi(requestParam(r, "x-position-id"))
+		if err != nil {
+			writeReplayResponse(w, r, ErrPositionNotFound{}, nil)
+			return
+		}
+
+		// 決済数量の指定は任意(未指定の場合は全量を決済する)
+		units := 0.0
+		if value := requestParam(r, "x-units"); value != "" {
+			units, err = strconv.ParseFloat(value, 64)
+			if err != nil {
+				writeReplayResponse(w, r, ErrInvalidOrder{}, nil)
+				return
+			}
+		}
+
+		s.handleReplayStep(w, r, func(session *replaySession) error {
+			return session.account.closePosition(positionID, units, session.currentPrice(), session.currentTime())
+		})
+		break
+	}
+}
+
+func (s *server) handleReplayReport(w http.ResponseWriter, r *http.Request) {
+	supportedParams := []string{"*"}
+	supportedMethods := []string{
+		"GET",
+		"OPTIONS",
+	}
+	if handleCORS(w, r, supportedParams, supportedMethods) {
+		return
+	}
+
+	writeResponse := func(err error, report *BacktestReport) {
+		status := newApiResponseStatus(r, err)
+		writeApiResponse(w, r, err, ApiResponseGetReport{Status: status, Report: report})
+	}
+
+	initialBalance := float64(defaultInitialBalance)
+	if value := requestParam(r, "x-initial-balance"); value != "" {
+		balance, err := strconv.ParseFloat(value, 64)
+		if err != nil || balance <= 0 {
+			writeResponse(ErrInvalidInitialBalance{}, nil)
+			return
+		}
+		initialBalance = balance
+	}
+
+	format := Utils.getStringOrDefault(requestParam(r, "x-format"), "json")
+	if format != "json" && format != "html" && format != "csv" {
+		writeResponse(ErrInvalidReportFormat{}, nil)
+		return
+	}
+
+	session, err := s.replays.get(requestParam(r, "x-session-id"), ownerOf(r))
+	if err != nil {
+		writeResponse(err, nil)
+		return
+	}
+
+	session.mutex.Lock()
+	report := newBacktestReport(session.account.state().Trades, initialBalance, session.startTime)
+	session.mutex.Unlock()
+
+	switch format {
+	case "html":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		err = report.writeHTML(w)
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", "attachment; filename=\"report.csv\"")
+		err = report.writeCSV(w)
+	default:
+		writeResponse(nil, &report)
+	}
+
+	if err != nil {
+		log.Println(errorLogMessage(err))
+	}
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	ReplayControlSubscribe = "subscribe"
+	ReplayControlPlay      = "play"
+	ReplayControlPause     = "pause"
+	ReplayControlSeek      = "seek"
+	ReplayControlSpeed     = "speed"
+
+	ReplayStreamState = "state"
+	ReplayStreamEnd   = "end"
+	ReplayStreamError = "error"
+
+	// ReplaySpeedPerBar 実時間によらず、指定した間隔で下位足を1本ずつ進める
+	ReplaySpeedPerBar = "bar"
+
+	// defaultReplayStreamInterval 下位足1本ごとに進める場合の既定の間隔
+	defaultReplayStreamInterval = 1 * time.Second
+
+	// maxReplaySpeedMultiplier 実時間に対する再生速度の倍率の上限
+	maxReplaySpeedMultiplier = 1000
+)
+
+type (
+	// ReplayControlMessage クライアントから送信される再生の制御メッセージ
+	ReplayControlMessage struct {
+		Type      string   `json:"type"`
+		SessionID string   `json:"sessionId"` // subscribe: 既存のセッションを購読する場合に指定
+		PairName  string   `json:"pairName"`  // subscribe: 新しいセッションを作成する場合に指定
+		StartTime string   `json:"startTime"` // subscribe: 新しいセッションを作成する場合に指定
+		TimeTypes []string `json:"timeTypes"` // subscribe: 新しいセッションを作成する場合に指定
+		Time      string   `json:"time"`      // seek
+		Speed     string   `json:"speed"`     // speed: 1x, 10xなどの倍率(1000xまで)、もしくはbar
+		Interval  int      `json:"interval"`  // speed: barの場合の間隔(ミリ秒)
+	}
+
+	// ReplayStreamMessage サーバーから送信されるメッセージ
+	ReplayStreamMessage struct {
+		Type    string            `json:"type"`
+		Status  ApiResponseStatus `json:"status"`
+		Session *ReplayState      `json:"session"`
+	}
+
+	// replayStream WebSocket接続1本分の再生状態
+	replayStream struct {
+		conn     *websocket.Conn
+		owner    string      // 接続した利用者(認証が無効な場合は空)
+		store    CandleStore // subscribeで新しく作成するセッションのデータセット
+		language string      // エラーメッセージの言語
+		session  *replaySession
+		playing  bool
+		speed    string
+		interval time.Duration
+		ticker   *time.Ticker
+	}
+
+	// allowedOrigins WebSocketの接続を許可する他のオリジン(スキーム://ホスト[:ポート]を小文字で保持する)
+	allowedOrigins map[string]struct{}
+)
+
+// anyOrigin 全てのオリジンからの接続を許可する指定
+const anyOrigin = "*"
+
+// newAllowedOrigins 設定されたオリジンの一覧を検証し、allowedOriginsを作成する
+func newAllowedOrigins(origins []string) (allowedOrigins, error) {
+	allowed := make(allowedOrigins)
+	for _, origin := range origins {
+		origin = strings.ToLower(strings.TrimSpace(origin))
+		if origin == anyOrigin {
+			allowed[origin] = struct{}{}
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil || u.Scheme == "" || u.Host == "" || strings.Trim(u.Path, "/") != "" {
+			return nil, ErrInvalidConfig{problems: []string{"AllowedOrigins: " + origin}}
+		}
+		allowed[u.Scheme+"://"+u.Host] = struct{}{}
+	}
+	return allowed, nil
+}
+
+// check WebSocketの接続を許可するかを返却する
+// Originヘッダーのないブラウザ以外のクライアントと、同一オリジンからの接続は常に許可する
+func (allowed allowedOrigins) check(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if _, ok := allowed[anyOrigin]; ok {
+		return true
+	}
+
+	u, err := url.Parse(strings.ToLower(origin))
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	_, ok := allowed[u.Scheme+"://"+u.Host]
+	return ok
+}
+
+func (s *server) handleReplayStream(w http.ResponseWriter, r *http.Request) {
+	upgrader := websocket.Upgrader{CheckOrigin: s.settings().origins.check}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Println(errorLogMessage(err))
+		return
+	}
+	defer conn.Close()
+
+	// 書き込みはこのゴルーチンのみで行い、読み込みは別のゴルーチンで行う
+	done := make(chan struct{})
+	defer close(done)
+
+	controls := make(chan ReplayControlMessage)
+	go func() {
+		defer close(controls)
+		for {
+			var message ReplayControlMessage
+			err := conn.ReadJSON(&message)
+			if err != nil {
+				return
+			}
+
+			select {
+			case controls <- message:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	stream := &replayStream{
+		conn:     conn,
+		owner:    ownerOf(r),
+		store:    s.storeOf(r),
+		language: languageOf(r),
+		speed:    "1x",
+		interval: defaultReplayStreamInterval,
+	}
+	defer stream.stopTicker()
+
+	for {
+		var tick <-chan time.Time
+		if stream.ticker != nil {
+			tick = stream.ticker.C
+		}
+
+		select {
+		case message, ok := <-controls:
+			if !ok {
+				return
+			}
+			err = stream.control(s.replays, message)
+
+		case <-tick:
+			err = stream.step()
+		}
+
+		if err != nil {
+			log.Println(errorLogMessage(err))
+			return
+		}
+	}
+}
+
+// control 制御メッセージを処理し、処理後の状態を送信する
+func (stream *replayStream) control(replays *replayManager, message ReplayControlMessage) error {
+	if message.Type != ReplayControlSubscribe && stream.session == nil {
+		return stream.send(ReplayStreamError, ErrReplaySessionNotFound{})
+	}
+
+	var err error
+	switch message.Type {
+	case ReplayControlSubscribe:
+		err = stream.subscribe(replays, message)
+
+	case ReplayControlPlay:
+		stream.playing = true
+
+	case ReplayControlPause:
+		stream.playing = false
+
+	case ReplayControlSeek:
+		err = Utils.checkFixedTime(message.Time)
+		if err == nil {
+			stream.session.mutex.Lock()
+			err = stream.session.seek(message.Time)
+			stream.session.mutex.Unlock()
+		}
+
+	case ReplayControlSpeed:
+		err = stream.changeSpeed(message.Speed, message.Interval)
+
+	default:
+		err = ErrInvalidReplayControl{}
+	}
+
+	if err != nil {
+		return stream.send(ReplayStreamError, err)
+	}
+
+	err = stream.resetTicker()
+	if err != nil {
+		return stream.send(ReplayStreamError, err)
+	}
+	return stream.send(ReplayStreamState, nil)
+}
+
+// subscribe 既存のセッション、もしくは新しく作成したセッションを購読する
+func (stream *replayStream) subscribe(replays *replayManager, message ReplayControlMessage) error {
+	if message.SessionID != "" {
+		session, err := replays.get(message.SessionID, stream.owner)
+		if err != nil {
+			return err
+		}
+		stream.session = session
+		return nil
+	}
+
+	err := Utils.checkPairName(message.PairName)
+	if err != nil {
+		return err
+	}
+	err = Utils.checkFixedTime(message.StartTime)
+	if err != nil {
+		return err
+	}
+
+	timeTypes := make([]TimeType, 0, len(message.TimeTypes))
+	for _, timeTypeName := range message.TimeTypes {
+		timeType, err := Utils.getTimeType(timeTypeName)
+		if err != nil {
+			return err
+		}
+		timeTypes = append(timeTypes, timeType)
+	}
+	if len(timeTypes) <= 0 {
+		return ErrInvalidTimeType{}
+	}
+
+	session, err := replays.create(stream.owner, stream.store, message.PairName, message.StartTime, timeTypes)
+	if err != nil {
+		return err
+	}
+	stream.session = session
+	return nil
+}
+
+// changeSpeed 再生速度を変更する
+func (stream *replayStream) changeSpeed(speed string, interval int) error {
+	if speed == ReplaySpeedPerBar {
+		stream.speed = speed
+		stream.interval = defaultReplayStreamInterval
+		if interval > 0 {
+			stream.interval = time.Duration(interval) * time.Millisecond
+		}
+		return nil
+	}
+
+	multiplier, err := strconv.ParseFloat(strings.TrimSuffix(speed, "x"), 64)
+	if err != nil || !strings.HasSuffix(speed, "x") || !(multiplier > 0) || multiplier > maxReplaySpeedMultiplier {
+		return ErrInvalidReplaySpeed{}
+	}
+	stream.speed = speed
+	return nil
+}
+
+// tickInterval 下位足1本を進める間隔を返却する
+func (stream *replayStream) tickInterval() (time.Duration, error) {
+	if stream.speed == ReplaySpeedPerBar {
+		return stream.interval, nil
+	}
+
+	duration, err := stream.session.lowerTimeType().getDuration()
+	if err != nil {
+		return 0, err
+	}
+	multiplier, _ := strconv.ParseFloat(strings.TrimSuffix(stream.speed, "x"), 64)
+	return time.Duration(float64(duration) / multiplier), nil
+}
+
+// resetTicker 再生状態と速度に合わせてタイマーを作り直す
+func (stream *replayStream) resetTicker() error {
+	stream.stopTicker()
+	if !stream.playing || stream.session == nil {
+		return nil
+	}
+
+	interval, err := stream.tickInterval()
+	if err != nil {
+		return err
+	}
+	if interval <= 0 {
+		return ErrInvalidReplaySpeed{}
+	}
+	stream.ticker = time.NewTicker(interval)
+	return nil
+}
+
+// stopTicker タイマーを停止する
+func (stream *replayStream) stopTicker() {
+	if stream.ticker != nil {
+		stream.ticker.Stop()
+		stream.ticker = nil
+	}
+}
+
+// step 下位足を1本進めて状態を送信する。最後まで進んだ場合は再生を停止する
+func (stream *replayStream) step() error {
+	stream.session.mutex.Lock()
+	err := stream.session.next(1)
+	stream.session.mutex.Unlock()
+
+	if errors.Is(err, ErrReplayOutOfRange{}) {
+		stream.playing = false
+		stream.stopTicker()
+		return stream.send(ReplayStreamEnd, nil)
+	}
+	if err != nil {
+		return stream.send(ReplayStreamError, err)
+	}
+	return stream.send(ReplayStreamState, nil)
+}
+
+// send メッセージを送信する。セッションを購読している場合は現在の状態を含める
+func (stream *replayStream) send(messageType string, err error) error {
+	message := ReplayStreamMessage{Type: messageType, Status: newLocalizedStatus(err, stream.language)}
+	if stream.session != nil {
+		stream.session.mutex.Lock()
+		state := stream.session.state()
+		stream.session.mutex.Unlock()
+		message.Session = &state
+	}
+	return stream.conn.WriteJSON(message)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAllowedOriginsCheck(t *testing.T) {
+	tests := []struct {
+		allowed []string
+		origin  string
+		want    bool
+	}{
+		{nil, "", true},
+		{nil, "http://localhost:8080", true},
+		{nil, "http://LOCALHOST:8080", true},
+		{nil, "http://localhost:3000", false},
+		{nil, "https://evil.example", false},
+		{[]string{"https://app.example"}, "https://app.example", true},
+		{[]string{"https://App.Example/"}, "https://app.example", true},
+		{[]string{"https://app.example"}, "http://app.example", false},
+		{[]string{"https://app.example"}, "https://evil.example", false},
+		{[]string{"*"}, "https://evil.example", true},
+	}
+
+	for _, test := range tests {
+		origins, err := newAllowedOrigins(test.allowed)
+		if err != nil {
+			t.Fatalf("newAllowedOrigins(%v) returned %v", test.allowed, err)
+		}
+		r := httptest.NewRequest("GET", "http://localhost:8080/api/replay/stream", nil)
+		if test.origin != "" {
+			r.Header.Set("Origin", test.origin)
+		}
+		if got := origins.check(r); got != test.want {
+			t.Errorf("allowed %v, origin %q: got %v, want %v", test.allowed, test.origin, got, test.want)
+		}
+	}
+}
+
+func TestNewAllowedOriginsRejectsInvalidOrigin(t *testing.T) {
+	for _, origin := range []string{"app.example", "https://app.example/path", "://"} {
+		_, err := newAllowedOrigins([]string{origin})
+		if _, ok := err.(ErrInvalidConfig); !ok {
+			t.Errorf("newAllowedOrigins(%q) returned %v, want ErrInvalidConfig", origin, err)
+		}
+	}
+}
+
+func TestReplayStreamChangeSpeed(t *testing.T) {
+	tests := []struct {
+		speed string
+		valid bool
+	}{
+		{"1x", true},
+		{"0.5x", true},
+		{"1000x", true},
+		{ReplaySpeedPerBar, true},
+		{"1001x", false},
+		{"1e9x", false},
+		{"0x", false},
+		{"-1x", false},
+		{"NaNx", false},
+		{"10", false},
+	}
+
+	for _, test := range tests {
+		stream := &replayStream{}
+		err := stream.changeSpeed(test.speed, 0)
+		if test.valid && err != nil {
+			t.Errorf("changeSpeed(%q) returned %v", test.speed, err)
+		}
+		if !test.valid && err != (ErrInvalidReplaySpeed{}) {
+			t.Errorf("changeSpeed(%q) returned %v, want ErrInvalidReplaySpeed", test.speed, err)
+		}
+	}
+}
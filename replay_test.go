@@ -0,0 +1,150 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// newTestReplayStores 1分足10本(00:00〜00:09)と、5分足2本(00:00, 00:05)を登録したストレージを返却する
+func newTestReplayStores(t *testing.T) map[string]CandleStore {
+	t.Helper()
+	start := time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC)
+	uppers := []Candle{
+		{Time: "2023-01-02 00:00:00", Open: 1.1, High: 1.2, Low: 1.0, Close: 1.15},
+		{Time: "2023-01-02 00:05:00", Open: 1.1, High: 1.2, Low: 1.0, Close: 1.15},
+	}
+
+	stores := map[string]CandleStore{StoreTypeMemory: newMemoryStore(), StoreTypeSQLite: newTestSQLiteDB(t, "EURUSD")}
+	for name, store := range stores {
+		err := store.createDataTable("EURUSD")
+		if err != nil {
+			t.Fatalf("%s: createDataTable returned %v", name, err)
+		}
+		for timeType, candles := range map[TimeType][]Candle{M1: newTestCandles(start, 10), M5: uppers} {
+			_, err = store.registerData("EURUSD", timeType, candles, DuplicatePolicySkip)
+			if err != nil {
+				t.Fatalf("%s: registerData returned %v", name, err)
+			}
+		}
+	}
+	return stores
+}
+
+func TestReplaySessionMove(t *testing.T) {
+	type move struct {
+		action  string // next, prev, seek
+		steps   int
+		fixTime string
+	}
+	tests := []struct {
+		name         string
+		moves        []move
+		wantErr      error
+		wantTime     string
+		wantPosition int
+		wantUpper    string // 形成中の5分足の確定時刻
+		wantVolume   int32  // 形成中の5分足の出来高(下位足の合計)
+	}{
+		{"start", nil, nil, "2023-01-02 00:03:00", 3, "2023-01-02 00:00:00", 0 + 1 + 2 + 3},
+		{"next", []move{{action: "next", steps: 1}}, nil, "2023-01-02 00:04:00", 4, "2023-01-02 00:00:00", 0 + 1 + 2 + 3 + 4},
+		{"next into the next upper", []move{{action: "next", steps: 3}}, nil, "2023-01-02 00:06:00", 6, "2023-01-02 00:05:00", 5 + 6},
+		{"next to the last", []move{{action: "next", steps: 6}}, nil, "2023-01-02 00:09:00", 9, "2023-01-02 00:05:00", 5 + 6 + 7 + 8 + 9},
+		{"next past the last", []move{{action: "next", steps: 7}}, ErrReplayOutOfRange{}, "2023-01-02 00:03:00", 3, "2023-01-02 00:00:00", 0 + 1 + 2 + 3},
+		{"prev", []move{{action: "next", steps: 3}, {action: "prev", steps: 2}}, nil, "2023-01-02 00:04:00", 4, "2023-01-02 00:00:00", 0 + 1 + 2 + 3 + 4},
+		{"prev to the first", []move{{action: "prev", steps: 3}}, nil, "2023-01-02 00:00:00", 0, "2023-01-02 00:00:00", 0},
+		{"prev past the first", []move{{action: "prev", steps: 4}}, ErrReplayOutOfRange{}, "2023-01-02 00:03:00", 3, "2023-01-02 00:00:00", 0 + 1 + 2 + 3},
+		{"zero steps", []move{{action: "next", steps: 0}}, ErrReplayOutOfRange{}, "2023-01-02 00:03:00", 3, "2023-01-02 00:00:00", 0 + 1 + 2 + 3},
+		{"seek", []move{{action: "seek", fixTime: "2023-01-02 00:07:00"}}, nil, "2023-01-02 00:07:00", 7, "2023-01-02 00:05:00", 5 + 6 + 7},
+		{"seek between candles", []move{{action: "seek", fixTime: "2023-01-02 00:01:30"}}, nil, "2023-01-02 00:01:00", 1, "2023-01-02 00:00:00", 0 + 1},
+		{"seek after the last", []move{{action: "seek", fixTime: "2023-01-03 00:00:00"}}, nil, "2023-01-02 00:09:00", 9, "2023-01-02 00:05:00", 5 + 6 + 7 + 8 + 9},
+		{"seek before the first", []move{{action: "seek", fixTime: "2023-01-01 23:59:59"}}, ErrReplayOutOfRange{}, "2023-01-02 00:03:00", 3, "2023-01-02 00:00:00", 0 + 1 + 2 + 3},
+	}
+
+	for storeType, store := range newTestReplayStores(t) {
+		manager := newReplayManager()
+		for _, test := range tests {
+			session, err := manager.create("alice", store, "EURUSD", "2023-01-02 00:03:30", []TimeType{M5, M1})
+			if err != nil {
+				t.Fatalf("%s %s: create returned %v", storeType, test.name, err)
+			}
+
+			for _, m := range test.moves {
+				switch m.action {
+				case "next":
+					err = session.next(m.steps)
+				case "prev":
+					err = session.prev(m.steps)
+				case "seek":
+					err = session.seek(m.fixTime)
+				}
+			}
+			if err != test.wantErr {
+				t.Errorf("%s %s: returned %v, want %v", storeType, test.name, err, test.wantErr)
+			}
+
+			state := session.state()
+			if state.Time != test.wantTime || state.Position != test.wantPosition || state.Length != 10 {
+				t.Errorf("%s %s: time %s, position %d/%d, want %s, %d/10",
+					storeType, test.name, state.Time, state.Position, state.Length, test.wantTime, test.wantPosition)
+			}
+			upper, ok := session.candles[M5]
+			if !ok || upper.Time != test.wantUpper || upper.TickVolume != test.wantVolume {
+				t.Errorf("%s %s: forming M5 candle %+v, want time %s, volume %d",
+					storeType, test.name, upper, test.wantUpper, test.wantVolume)
+			}
+		}
+	}
+}
+
+func TestReplaySessionTradingInProgress(t *testing.T) {
+	for storeType, store := range newTestReplayStores(t) {
+		session, err := newReplayManager().create("alice", store, "EURUSD", "2023-01-02 00:03:00", []TimeType{M1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = session.account.placeOrder(OrderPayload{Side: OrderSideBuy, Type: OrderTypeMarket, Units: 1000},
+			session.currentPrice(), session.currentTime())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// 取引を開始した後は戻せず、先の時刻へのシークは通過する下位足で注文を処理しながら進める
+		if err = session.prev(1); err != (ErrReplayTradingInProgress{}) {
+			t.Errorf("%s: prev returned %v, want ErrReplayTradingInProgress", storeType, err)
+		}
+		if err = session.seek("2023-01-02 00:01:00"); err != (ErrReplayTradingInProgress{}) {
+			t.Errorf("%s: seek backward returned %v, want ErrReplayTradingInProgress", storeType, err)
+		}
+		if err = session.seek("2023-01-02 00:06:00"); err != nil {
+			t.Errorf("%s: seek forward returned %v", storeType, err)
+		}
+		if session.cursor != 6 || session.currentTime() != "2023-01-02 00:06:00" {
+			t.Errorf("%s: cursor %d at %s, want 6 at 2023-01-02 00:06:00", storeType, session.cursor, session.currentTime())
+		}
+	}
+}
+
+func TestReplayManagerOwner(t *testing.T) {
+	manager := newReplayManager()
+	session, err := manager.create("alice", newTestReplayStores(t)[StoreTypeMemory], "EURUSD", "2023-01-02 00:03:00", []TimeType{M1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 他の利用者のセッションは存在しないものとして扱う
+	if _, err = manager.get(session.id, "bob"); err != (ErrReplaySessionNotFound{}) {
+		t.Errorf("get by another user returned %v, want ErrReplaySessionNotFound", err)
+	}
+	if err = manager.remove(session.id, "bob"); err != (ErrReplaySessionNotFound{}) {
+		t.Errorf("remove by another user returned %v, want ErrReplaySessionNotFound", err)
+	}
+	if got, err := manager.get(session.id, "alice"); err != nil || got != session {
+		t.Errorf("get by the owner returned %v, %v", got, err)
+	}
+	if err = manager.remove(session.id, "alice"); err != nil {
+		t.Errorf("remove by the owner returned %v", err)
+	}
+	if _, err = manager.get(session.id, "alice"); err != (ErrReplaySessionNotFound{}) {
+		t.Errorf("get after remove returned %v, want ErrReplaySessionNotFound", err)
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"strconv"
+)
+
+const (
+	// defaultInitialBalance 初期資金が指定されない場合に使用する金額
+	defaultInitialBalance = 1000000
+)
+
+type (
+	// EquityPoint 資産曲線の1点
+	EquityPoint struct {
+		Time   string  `json:"time"`
+		Equity float64 `json:"equity"`
+	}
+
+	// BacktestReport 取引履歴から算出した成績
+	// シャープレシオ・ソルティノレシオは1取引ごとの損益率から算出し、年率換算は行わない
+	BacktestReport struct {
+		InitialBalance     float64       `json:"initialBalance"`
+		FinalBalance       float64       `json:"finalBalance"`
+		NetProfit          float64       `json:"netProfit"`
+		GrossProfit        float64       `json:"grossProfit"`
+		GrossLoss          float64       `json:"grossLoss"`
+		NumTrades          int           `json:"numTrades"`
+		NumWins            int           `json:"numWins"`
+		NumLosses          int           `json:"numLosses"`
+		WinRate            float64       `json:"winRate"`
+		ProfitFactor       float64       `json:"profitFactor"` // 損失がない場合は0
+		Expectancy         float64       `json:"expectancy"`
+		MaxDrawdown        float64       `json:"maxDrawdown"`
+		MaxDrawdownPercent float64       `json:"maxDrawdownPercent"`
+		SharpeRatio        float64       `json:"sharpeRatio"`
+		SortinoRatio       float64       `json:"sortinoRatio"`
+		AverageRMultiple   float64       `json:"averageRMultiple"` // 決済逆指値を設定した取引のみで、最初の決済逆指値を1Rとして算出
+		LongestWinStreak   int           `json:"longestWinStreak"`
+		LongestLossStreak  int           `json:"longestLossStreak"`
+		EquityCurve        []EquityPoint `json:"equityCurve"`
+		Trades             []Trade       `json:"trades"`
+	}
+)
+
+// newBacktestReport 決済順に並んだ取引履歴から成績を算出する
+func newBacktestReport(trades []Trade, initialBalance float64, startTime string) BacktestReport {
+	report := BacktestReport{
+		InitialBalance: initialBalance,
+		FinalBalance:   initialBalance,
+		NumTrades:      len(trades),
+		EquityCurve:    []EquityPoint{{Time: startTime, Equity: initialBalance}},
+		Trades:         trades,
+	}
+
+	equity, peak := initialBalance, initialBalance
+	winStreak, lossStreak := 0, 0
+	returns := make([]float64, 0, len(trades))
+	sumR, numR := 0.0, 0
+
+	for _, t := range trades {
+		if equity != 0 {
+			returns = append(returns, t.Profit/equity)
+		}
+
+		equity += t.Profit
+		report.EquityCurve = append(report.EquityCurve, EquityPoint{Time: t.ClosedAt, Equity: equity})
+
+		if t.Profit > 0 {
+			report.NumWins++
+			report.GrossProfit += t.Profit
+			winStreak, lossStreak = winStreak+1, 0
+		} else if t.Profit < 0 {
+			report.NumLosses++
+			report.GrossLoss += t.Profit
+			winStreak, lossStreak = 0, lossStreak+1
+		} else {
+			winStreak, lossStreak = 0, 0
+		}
+		if report.LongestWinStreak < winStreak {
+			report.LongestWinStreak = winStreak
+		}
+		if report.LongestLossStreak < lossStreak {
+			report.LongestLossStreak = lossStreak
+		}
+
+		if peak < equity {
+			peak = equity
+		}
+		if drawdown := peak - equity; report.MaxDrawdown < drawdown {
+			report.MaxDrawdown = drawdown
+			if peak > 0 {
+				report.MaxDrawdownPercent = drawdown / peak * 100
+			}
+		}
+
+		// 1R = 建値から最初に設定した決済逆指値までの損失額(建値へ移動・追従した決済逆指値は使用しない)
+		if risk := math.Abs(t.EntryPrice-t.InitialStopLoss) * t.Units; t.InitialStopLoss > 0 && risk > 0 {
+			sumR += t.Profit / risk
+			numR++
+		}
+	}
+
+	report.FinalBalance = equity
+	report.NetProfit = report.GrossProfit + report.GrossLoss
+	if report.NumTrades > 0 {
+		report.WinRate = float64(report.NumWins) / float64(report.NumTrades) * 100
+		report.Expectancy = report.NetProfit / float64(report.NumTrades)
+	}
+	if report.GrossLoss < 0 {
+		report.ProfitFactor = report.GrossProfit / -report.GrossLoss
+	}
+	if numR > 0 {
+		report.AverageRMultiple = sumR / float64(numR)
+	}
+	report.SharpeRatio, report.SortinoRatio = riskAdjustedReturns(returns)
+
+	return report
+}
+
+// riskAdjustedReturns 損益率の系列からシャープレシオとソルティノレシオを算出する
+func riskAdjustedReturns(returns []float64) (float64, float64) {
+	if len(returns) < 2 {
+		return 0, 0
+	}
+
+	mean := 0.0
+	for _, r := range returns {
+		mean += r
+	}
+	mean /= float64(len(returns))
+
+	variance, downside := 0.0, 0.0
+	for _, r := range returns {
+		variance += (r - mean) * (r - mean)
+		if r < 0 {
+			downside += r * r
+		}
+	}
+	stddev := math.Sqrt(variance / float64(len(returns)-1))
+	downsideDev := math.Sqrt(downside / float64(len(returns)))
+
+	sharpe, sortino := 0.0, 0.0
+	if stddev > 0 {
+		sharpe = mean / stddev
+	}
+	if downsideDev > 0 {
+		sortino = mean / downsideDev
+	}
+	return sharpe, sortino
+}
+
+// writeCSV 取引履歴と取引ごとの資産をCSV形式で出力する
+func (report BacktestReport) writeCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{
+		"positionId", "side", "units", "entryPrice", "exitPrice", "stopLoss", "initialStopLoss",
+		"openedAt", "closedAt", "profit", "reason", "equity",
+	})
+
+	formatFloat := func(value float64) string { return strconv.FormatFloat(value, 'f', -1, 64) }
+	for i, t := range report.Trades {
+		writer.Write([]string{
+			strconv.Itoa(t.PositionID), t.Side, formatFloat(t.Units),
+			formatFloat(t.EntryPrice), formatFloat(t.ExitPrice), formatFloat(t.StopLoss), formatFloat(t.InitialStopLoss),
+			t.OpenedAt, t.ClosedAt, formatFloat(t.Profit), t.Reason,
+			formatFloat(report.EquityCurve[i+1].Equity),
+		})
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// writeHTML 成績・資産曲線・取引履歴を1枚のHTMLとして出力する
+func (report BacktestReport) writeHTML(w io.Writer) error {
+	return reportTemplate.Execute(w, struct {
+		Report   BacktestReport
+		Polyline string
+	}{Report: report, Polyline: report.equityPolyline(600, 200)})
+}
+
+// equityPolyline 資産曲線をSVGのpolylineの座標列に変換する
+func (report BacktestReport) equityPolyline(width float64, height float64) string {
+	minEquity, maxEquity := math.Inf(1), math.Inf(-1)
+	for _, p := range report.EquityCurve {
+		minEquity = math.Min(minEquity, p.Equity)
+		maxEquity = math.Max(maxEquity, p.Equity)
+	}
+
+	points := ""
+	for i, p := range report.EquityCurve {
+		x := 0.0
+		if len(report.EquityCurve) > 1 {
+			x = width * float64(i) / float64(len(report.EquityCurve)-1)
+		}
+		y := height / 2
+		if maxEquity > minEquity {
+			y = height - height*(p.Equity-minEquity)/(maxEquity-minEquity)
+		}
+		points += fmt.Sprintf("%.1f,%.1f ", x, y)
+	}
+	return points
+}
+
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="ja">
+<head>
+<meta charset="utf-8">
+<title>バックテスト成績</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: right; }
+th { background: #f4f4f4; text-align: left; }
+</style>
+</head>
+<body>
+<h1>バックテスト成績</h1>
+<table>
+<tr><th>初期資金</th><td>{{printf "%.2f" .Report.InitialBalance}}</td></tr>
+<tr><th>最終資金</th><td>{{printf "%.2f" .Report.FinalBalance}}</td></tr>
+<tr><th>純損益</th><td>{{printf "%.2f" .Report.NetProfit}}</td></tr>
+<tr><th>総利益</th><td>{{printf "%.2f" .Report.GrossProfit}}</td></tr>
+<tr><th>総損失</th><td>{{printf "%.2f" .Report.GrossLoss}}</td></tr>
+<tr><th>取引数</th><td>{{.Report.NumTrades}}</td></tr>
+<tr><th>勝率(%)</th><td>{{printf "%.2f" .Report.WinRate}}</td></tr>
+<tr><th>プロフィットファクター</th><td>{{printf "%.2f" .Report.ProfitFactor}}</td></tr>
+<tr><th>期待値</th><td>{{printf "%.2f" .Report.Expectancy}}</td></tr>
+<tr><th>最大ドローダウン</th><td>{{printf "%.2f" .Report.MaxDrawdown}}</td></tr>
+<tr><th>最大ドローダウン(%)</th><td>{{printf "%.2f" .Report.MaxDrawdownPercent}}</td></tr>
+<tr><th>シャープレシオ</th><td>{{printf "%.3f" .Report.SharpeRatio}}</td></tr>
+<tr><th>ソルティノレシオ</th><td>{{printf "%.3f" .Report.SortinoRatio}}</td></tr>
+<tr><th>平均Rマルチプル</th><td>{{printf "%.2f" .Report.AverageRMultiple}}</td></tr>
+<tr><th>最大連勝数</th><td>{{.Report.LongestWinStreak}}</td></tr>
+<tr><th>最大連敗数</th><td>{{.Report.LongestLossStreak}}</td></tr>
+</table>
+<h2>資産曲線</h2>
+<svg width="600" height="200" style="border: 1px solid #ccc; margin-bottom: 2em;">
+<polyline fill="none" stroke="#1f77b4" stroke-width="2" points="{{.Polyline}}" />
+</svg>
+<h2>取引履歴</h2>
+<table>
+<tr><th>ID</th><th>売買</th><th>数量</th><th>建値</th><th>決済値</th><th>建玉時刻</th><th>決済時刻</th><th>損益</th><th>決済理由</th></tr>
+{{range .Report.Trades}}<tr><td>{{.PositionID}}</td><td>{{.Side}}</td><td>{{.Units}}</td><td>{{.EntryPrice}}</td><td>{{.ExitPrice}}</td><td>{{.OpenedAt}}</td><td>{{.ClosedAt}}</td><td>{{printf "%.2f" .Profit}}</td><td>{{.Reason}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
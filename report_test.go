@@ -0,0 +1,101 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNewBacktestReport(t *testing.T) {
+	trade := func(profit float64, stopLoss float64, initialStopLoss float64) Trade {
+		return Trade{Side: OrderSideBuy, Units: 1000, EntryPrice: 1.0, StopLoss: stopLoss, Profit: profit,
+			InitialStopLoss: initialStopLoss}
+	}
+	// 資産: 1000 → 1100 → 1050 → 1000 → 1200 → 1200
+	trades := []Trade{
+		trade(100, 1.0, 0.9),   // 建値へ移動した決済逆指値(1Rは最初の0.9から算出する)
+		trade(-50, 0.95, 0.95), // -1R
+		trade(-50, 0, 0),       // 決済逆指値なし(R倍数の対象外)
+		trade(200, 1.15, 0.9),  // 追従した決済逆指値
+		trade(0, 0, 0),
+	}
+	report := newBacktestReport(trades, 1000, "2023-01-02 00:00:00")
+
+	tests := []struct {
+		name string
+		got  float64
+		want float64
+	}{
+		{"final balance", report.FinalBalance, 1200},
+		{"net profit", report.NetProfit, 200},
+		{"gross profit", report.GrossProfit, 300},
+		{"gross loss", report.GrossLoss, -100},
+		{"wins", float64(report.NumWins), 2},
+		{"losses", float64(report.NumLosses), 2},
+		{"win rate", report.WinRate, 40},
+		{"profit factor", report.ProfitFactor, 3},
+		{"expectancy", report.Expectancy, 40},
+		{"max drawdown", report.MaxDrawdown, 100},
+		{"max drawdown percent", report.MaxDrawdownPercent, 100.0 / 1100 * 100},
+		{"longest win streak", float64(report.LongestWinStreak), 1},
+		{"longest loss streak", float64(report.LongestLossStreak), 2},
+		{"sharpe ratio", report.SharpeRatio, 0.3868882481358954},
+		{"sortino ratio", report.SortinoRatio, 1.4057303574433606},
+		{"average R multiple", report.AverageRMultiple, (1.0 - 1.0 + 2.0) / 3},
+	}
+	for _, test := range tests {
+		if math.Abs(test.got-test.want) > 1e-9 {
+			t.Errorf("%s = %v, want %v", test.name, test.got, test.want)
+		}
+	}
+	if len(report.EquityCurve) != len(trades)+1 {
+		t.Errorf("equity curve has %d points, want %d", len(report.EquityCurve), len(trades)+1)
+	}
+}
+
+func TestNewBacktestReportWithoutTrades(t *testing.T) {
+	tests := []struct {
+		name   string
+		trades []Trade
+	}{
+		{"no trades", []Trade{}},
+		{"only wins", []Trade{{Profit: 10}, {Profit: 20}}},
+	}
+
+	for _, test := range tests {
+		report := newBacktestReport(test.trades, 1000, "2023-01-02 00:00:00")
+		// 損失がない場合の損益率・ドローダウン、1取引以下のシャープレシオは0とする
+		if report.ProfitFactor != 0 || report.MaxDrawdown != 0 || report.SortinoRatio != 0 || report.AverageRMultiple != 0 {
+			t.Errorf("%s: report = %+v, want zero profit factor, drawdown, sortino and R", test.name, report)
+		}
+	}
+}
+
+func TestTradeKeepsInitialStopLoss(t *testing.T) {
+	account := newTradingAccount()
+	err := account.placeOrder(OrderPayload{Side: OrderSideBuy, Type: OrderTypeMarket, Units: 1000, StopLoss: 0.99},
+		1.0, "2023-01-02 00:00:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	positionID := account.positions[0].ID
+
+	// 決済逆指値を建値より上へ移動した後に、その価格で決済される(1Rは最初の決済逆指値までの10)
+	err = account.modifyPosition(ModifyPositionPayload{PositionID: positionID, StopLoss: 1.002})
+	if err != nil {
+		t.Fatal(err)
+	}
+	account.process(Candle{Time: "2023-01-02 00:01:00", Open: 1.005, High: 1.01, Low: 0.995, Close: 1.0})
+
+	if len(account.trades) != 1 {
+		t.Fatalf("%d trades, want 1", len(account.trades))
+	}
+	trade := account.trades[0]
+	if trade.StopLoss != 1.002 || trade.InitialStopLoss != 0.99 {
+		t.Errorf("trade stop loss %v, initial %v, want 1.002, 0.99", trade.StopLoss, trade.InitialStopLoss)
+	}
+
+	report := newBacktestReport(account.trades, 1000, "2023-01-02 00:00:00")
+	if math.Abs(report.AverageRMultiple-0.2) > 1e-9 {
+		t.Errorf("average R multiple = %v, want 0.2", report.AverageRMultiple)
+	}
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+// bucketStart サーバー時間を基準に、確定時刻が属する上位足の開始時刻を返却する
+// 日足・週足の区切りはブローカーのサーバー時間の0時(週足は日曜日0時)とする
+func bucketStart(fixTime time.Time, target TimeType, profile *timezoneProfile) (time.Time, error) {
+	duration, err := target.getDuration()
+	if err != nil {
+		return fixTime, err
+	}
+
+	server := profile.toServerTime(fixTime)
+	midnight := time.Date(server.Year(), server.Month(), server.Day(), 0, 0, 0, 0, time.UTC)
+
+	var start time.Time
+	switch target {
+	case Daily:
+		start = midnight
+	case Weekly:
+		start = midnight.AddDate(0, 0, -int(server.Weekday()))
+	default:
+		elapsed := time.Duration(server.Hour())*time.Hour + time.Duration(server.Minute())*time.Minute
+		start = midnight.Add(elapsed.Truncate(duration))
+	}
+
+	return profile.toStorageTime(start), nil
+}
+
+// nextBucketStart サーバー時間を基準に、startから始まる上位足の次の足の開始時刻を返却する
+func nextBucketStart(start time.Time, target TimeType, profile *timezoneProfile) (time.Time, error) {
+	duration, err := target.getDuration()
+	if err != nil {
+		return start, err
+	}
+
+	server := profile.toServerTime(start)
+	wall := time.Date(server.Year(), server.Month(), server.Day(), server.Hour(), server.Minute(), 0, 0, time.UTC)
+	switch target {
+	case Daily:
+		wall = wall.AddDate(0, 0, 1)
+	case Weekly:
+		wall = wall.AddDate(0, 0, 7)
+	default:
+		wall = wall.Add(duration)
+	}
+	return profile.toStorageTime(wall), nil
+}
+
+// candleAggregator 確定時刻の昇順に渡された下位足から、上位足を1本ずつ生成する
+// 下位足を全件保持しないため、eachCandleから直接渡すことができる
+// flushを指定した場合は、連続する上位足のまとまり(最大batchSize本)ごとにflushへ渡し、保持しない
+type candleAggregator struct {
+	target  TimeType
+	profile *timezoneProfile
+	from    string // 合成する下位足の期間(両端を含む)
+	to      string
+	// flush 生成した上位足と、置き換える期間(両端を含む)を受け取る
+	flush     func(from string, to string, candles []Candle) error
+	batchSize int      // 連続する上位足を1回にflushする最大の本数
+	candles   []Candle // flushしていない上位足(最後の1本は合成中)
+	runFrom   string   // 次にflushする期間の開始(連続する上位足の先頭、もしくは前回flushした足の直後)
+	count     int      // 生成した上位足の本数
+}
+
+// newCandleAggregator 期間内の下位足からtargetの上位足を生成するcandleAggregatorをnewする
+func newCandleAggregator(
+	target TimeType,
+	profile *timezoneProfile,
+	from string,
+	to string,
+	flush func(from string, to string, candles []Candle) error) *candleAggregator {
+
+	return &candleAggregator{
+		target:    target,
+		profile:   profile,
+		from:      from,
+		to:        to,
+		flush:     flush,
+		batchSize: ingestBatchSize,
+		candles:   make([]Candle, 0),
+	}
+}
+
+// add 下位足1本を、属する上位足に合成する
+// 直前の上位足と連続しない(間に下位足が存在しない上位足がある)場合は、それまでの上位足をflushする
+func (a *candleAggregator) add(c Candle) error {
+	if c.Time < a.from || c.Time > a.to {
+		return nil
+	}
+
+	fixTime, err := a.profile.parseFixTime(c.Time)
+	if err != nil {
+		return err
+	}
+
+	start, err := bucketStart(fixTime, a.target, a.profile)
+	if err != nil {
+		return err
+	}
+
+	bucketTime := start.Format(fixTimeLayout)
+	if len(a.candles) > 0 && a.candles[len(a.candles)-1].Time == bucketTime {
+		mergeCandle(&a.candles[len(a.candles)-1], c)
+		return nil
+	}
+
+	if len(a.candles) > 0 {
+		last, err := a.profile.parseFixTime(a.candles[len(a.candles)-1].Time)
+		if err != nil {
+			return err
+		}
+		next, err := nextBucketStart(last, a.target, a.profile)
+		if err != nil {
+			return err
+		}
+
+		if next.Format(fixTimeLayout) != bucketTime {
+			err = a.flushCandles(true)
+		} else if len(a.candles) >= a.batchSize {
+			err = a.flushCandles(false)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if a.runFrom == "" {
+		a.runFrom = bucketTime
+	}
+	a.candles = append(a.candles, Candle{
+		Time:       bucketTime,
+		High:       c.High,
+		Open:       c.Open,
+		Close:      c.Close,
+		Low:        c.Low,
+		TickVolume: c.TickVolume,
+	})
+	a.count++
+	return nil
+}
+
+// flushCandles 保持している上位足をflushに渡す(flushを指定していない場合は保持したままにする)
+// endOfRunがfalseの場合は、連続する上位足の途中のため、次の期間を今回の最後の足の直後から始める
+func (a *candleAggregator) flushCandles(endOfRun bool) error {
+	if a.flush == nil || len(a.candles) == 0 {
+		return nil
+	}
+
+	last := a.candles[len(a.candles)-1].Time
+	err := a.flush(a.runFrom, last, a.candles)
+	if err != nil {
+		return err
+	}
+	a.candles = make([]Candle, 0)
+
+	a.runFrom = ""
+	if !endOfRun {
+		lastTime, err := time.Parse(fixTimeLayout, last)
+		if err != nil {
+			return err
+		}
+		a.runFrom = lastTime.Add(time.Second).Format(fixTimeLayout)
+	}
+	return nil
+}
+
+// finish 合成中の上位足を含めて、残りの上位足をflushする
+func (a *candleAggregator) finish() error {
+	return a.flushCandles(true)
+}
+
+// aggregateCandles 確定時刻の昇順に並んだ下位足から上位足を生成する
+func aggregateCandles(candles []Candle, target TimeType, profile *timezoneProfile) ([]Candle, error) {
+	aggregator := newCandleAggregator(target, profile, minFixTime, maxFixTime, nil)
+	for _, c := range candles {
+		err := aggregator.add(c)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return aggregator.candles, nil
+}
+
+// mergeCandle 集計中の上位足に、それ以降の下位足1本分を合成する
+func mergeCandle(current *Candle, c Candle) {
+	if c.High > current.High {
+		current.High = c.High
+	}
+	if c.Low < current.Low {
+		current.Low = c.Low
+	}
+	current.Close = c.Close
+	current.TickVolume += c.TickVolume
+}
+
+// resampleData 下位足のデータから指定期間に含まれる全ての上位足を再生成する
+// 期間の両端は上位足の区切りまで拡張し、下位足が存在する上位足の区切りの既存の上位足を置き換える
+// 下位足が存在しない区切り(途中の欠損を含む)の上位足は、再生成できないため残しておく
+// 下位足は全ての上位足で1回だけ読み込み、置き換えは連続する上位足(最大ingestBatchSize本)ごとに1つのトランザクションで行う
+func (action) resampleData(
+	store CandleStore,
+	pairName string,
+	source TimeType,
+	from string,
+	to string,
+	profile *timezoneProfile) ([]PairDetail, error) {
+
+	fromTime, err := profile.parseFixTime(from)
+	if err != nil {
+		return nil, err
+	}
+	toTime, err := profile.parseFixTime(to)
+	if err != nil {
+		return nil, err
+	}
+
+	err = store.createDataTable(pairName)
+	if err != nil {
+		return nil, err
+	}
+
+	aggregators := make([]*candleAggregator, 0)
+	sourceFrom, sourceTo := to, from
+	for target := source + 1; target < NumTimeType; target++ {
+		rangeFrom, err := bucketStart(fromTime, target, profile)
+		if err != nil {
+			return nil, err
+		}
+		lastStart, err := bucketStart(toTime, target, profile)
+		if err != nil {
+			return nil, err
+		}
+		duration, err := target.getDuration()
+		if err != nil {
+			return nil, err
+		}
+		rangeTo := lastStart.Add(duration - time.Second)
+		if to == maxFixTime {
+			// 上限を指定しない場合は拡張しない(9999年を超えると文字列での比較ができなくなるため)
+			rangeTo = toTime
+		}
+
+		target := target
+		aggregator := newCandleAggregator(target, profile, rangeFrom.Format(fixTimeLayout), rangeTo.Format(fixTimeLayout),
+			func(from string, to string, candles []Candle) error {
+				return store.replaceDataRange(pairName, target, from, to, candles)
+			})
+		aggregators = append(aggregators, aggregator)
+
+		if aggregator.from < sourceFrom {
+			sourceFrom = aggregator.from
+		}
+		if aggregator.to > sourceTo {
+			sourceTo = aggregator.to
+		}
+	}
+
+	err = store.eachCandle(pairName, source, sourceFrom, sourceTo, func(c Candle) error {
+		for _, aggregator := range aggregators {
+			err := aggregator.add(c)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	details := make([]PairDetail, 0)
+	for _, aggregator := range aggregators {
+		err = aggregator.finish()
+		if err != nil {
+			return nil, err
+		}
+
+		// 下位足が1本もない時間軸は何も変更しない
+		if aggregator.count == 0 {
+			continue
+		}
+		log.Println(logMessage(logResampled, pairName, aggregator.target.toInt(), aggregator.count))
+		details = append(details, PairDetail{TimeType: aggregator.target.toInt(), CountData: aggregator.count})
+	}
+
+	return details, nil
+}
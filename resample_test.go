@@ -0,0 +1,261 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBucketStart(t *testing.T) {
+	registry := newTestTimezoneRegistry(t)
+	tests := []struct {
+		profile string
+		target  TimeType
+		fixTime string
+		want    string
+	}{
+		// 変換しない場合は、保存された時刻をそのまま区切る
+		{rawTimezoneProfile, M5, "2023-01-04 06:59:00", "2023-01-04 06:55:00"},
+		{rawTimezoneProfile, M15, "2023-01-04 10:14:00", "2023-01-04 10:00:00"},
+		{rawTimezoneProfile, H4, "2023-01-04 03:59:00", "2023-01-04 00:00:00"},
+		{rawTimezoneProfile, Daily, "2023-01-04 23:59:00", "2023-01-04 00:00:00"},
+		{rawTimezoneProfile, Weekly, "2023-01-04 12:00:00", "2023-01-01 00:00:00"},
+		{rawTimezoneProfile, Weekly, "2023-01-01 00:00:00", "2023-01-01 00:00:00"},
+		// XM(冬時間GMT+2): サーバー時間の0時は日本時間の7時
+		{"XM", H1, "2023-01-02 07:59:00", "2023-01-02 07:00:00"},
+		{"XM", H4, "2023-01-02 10:59:00", "2023-01-02 07:00:00"},
+		{"XM", H4, "2023-01-02 11:00:00", "2023-01-02 11:00:00"},
+		{"XM", Daily, "2023-01-04 06:59:00", "2023-01-03 07:00:00"},
+		{"XM", Daily, "2023-01-04 07:00:00", "2023-01-04 07:00:00"},
+		{"XM", Weekly, "2023-01-04 12:00:00", "2023-01-01 07:00:00"},
+		// XM(夏時間GMT+3): サーバー時間の0時は日本時間の6時
+		{"XM", Daily, "2023-07-03 05:59:00", "2023-07-02 06:00:00"},
+		{"XM", Daily, "2023-07-03 06:00:00", "2023-07-03 06:00:00"},
+		// 夏時間の開始をまたぐ週足は、週の開始時点(冬時間)の時差で区切る
+		{"XM", Weekly, "2023-03-28 06:00:00", "2023-03-26 07:00:00"},
+	}
+
+	for _, test := range tests {
+		profile := resolveTestProfile(t, registry, test.profile)
+		fixTime, err := profile.parseFixTime(test.fixTime)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		start, err := bucketStart(fixTime, test.target, profile)
+		if err != nil {
+			t.Fatalf("bucketStart returned %v", err)
+		}
+		if got := start.Format(fixTimeLayout); got != test.want {
+			t.Errorf("%s: bucketStart(%s, %d) = %s, want %s",
+				test.profile, test.fixTime, test.target.toInt(), got, test.want)
+		}
+	}
+}
+
+func TestAggregateCandles(t *testing.T) {
+	profile := resolveTestProfile(t, newTestTimezoneRegistry(t), rawTimezoneProfile)
+	candles := []Candle{
+		{Time: "2023-01-02 00:00:00", Open: 1.0, High: 1.2, Low: 0.9, Close: 1.1, TickVolume: 1},
+		{Time: "2023-01-02 00:01:00", Open: 1.1, High: 1.5, Low: 1.0, Close: 1.4, TickVolume: 2},
+		{Time: "2023-01-02 00:04:00", Open: 1.4, High: 1.4, Low: 0.8, Close: 0.9, TickVolume: 3},
+		{Time: "2023-01-02 00:05:00", Open: 0.9, High: 1.0, Low: 0.7, Close: 0.8, TickVolume: 4},
+	}
+
+	got, err := aggregateCandles(candles, M5, profile)
+	if err != nil {
+		t.Fatalf("aggregateCandles returned %v", err)
+	}
+	want := []Candle{
+		{Time: "2023-01-02 00:00:00", Open: 1.0, High: 1.5, Low: 0.8, Close: 0.9, TickVolume: 6},
+		{Time: "2023-01-02 00:05:00", Open: 0.9, High: 1.0, Low: 0.7, Close: 0.8, TickVolume: 4},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("aggregateCandles = %+v, want %+v", got, want)
+	}
+}
+
+func TestResampleDataKeepsCandlesOutsideSource(t *testing.T) {
+	profile := resolveTestProfile(t, newTestTimezoneRegistry(t), rawTimezoneProfile)
+	store := newMemoryStore()
+	err := store.createDataTable("EURUSD")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 下位足より前の上位足と、再生成される上位足(古い値)
+	_, err = store.registerData("EURUSD", H1, []Candle{
+		{Time: "2022-12-30 23:00:00", Open: 2, High: 2, Low: 2, Close: 2, TickVolume: 9},
+		{Time: "2023-01-02 00:00:00", Open: 3, High: 3, Low: 3, Close: 3, TickVolume: 9},
+	}, DuplicatePolicyOverwrite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = store.registerData("EURUSD", M30, []Candle{
+		{Time: "2023-01-02 00:00:00", Open: 1.0, High: 1.2, Low: 0.9, Close: 1.1, TickVolume: 1},
+		{Time: "2023-01-02 00:30:00", Open: 1.1, High: 1.3, Low: 1.0, Close: 1.2, TickVolume: 2},
+	}, DuplicatePolicyOverwrite)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = Action.resampleData(store, "EURUSD", M30, minFixTime, maxFixTime, profile)
+	if err != nil {
+		t.Fatalf("resampleData returned %v", err)
+	}
+
+	got, err := store.queryCandles("EURUSD", H1, minFixTime, maxFixTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Candle{
+		{Time: "2022-12-30 23:00:00", Open: 2, High: 2, Low: 2, Close: 2, TickVolume: 9},
+		{Time: "2023-01-02 00:00:00", Open: 1.0, High: 1.3, Low: 0.9, Close: 1.2, TickVolume: 3},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("H1 after resampleData = %+v, want %+v", got, want)
+	}
+
+	// 下位足が1本もない場合は、上位足を変更しない
+	_, err = Action.resampleData(store, "EURUSD", M1, minFixTime, maxFixTime, profile)
+	if err != nil {
+		t.Fatalf("resampleData returned %v", err)
+	}
+	got, err = store.queryCandles("EURUSD", H1, minFixTime, maxFixTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("H1 after resampleData from empty M1 = %+v, want %+v", got, want)
+	}
+}
+
+func TestResampleDataKeepsCandlesInGaps(t *testing.T) {
+	profile := resolveTestProfile(t, newTestTimezoneRegistry(t), rawTimezoneProfile)
+	stores := []struct {
+		name  string
+		store CandleStore
+	}{
+		{"memory", newMemoryStore()},
+		{"sqlite", newTestSQLiteDB(t, "EURUSD")},
+	}
+
+	for _, test := range stores {
+		err := test.store.createDataTable("EURUSD")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// 01:00台のM30が欠損しており、その区切りの既存のH1は再生成できない
+		_, err = test.store.registerData("EURUSD", H1, []Candle{
+			{Time: "2023-01-02 00:00:00", Open: 3, High: 3, Low: 3, Close: 3, TickVolume: 9},
+			{Time: "2023-01-02 01:00:00", Open: 5, High: 5, Low: 5, Close: 5, TickVolume: 9},
+		}, DuplicatePolicyOverwrite)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = test.store.registerData("EURUSD", M30, []Candle{
+			{Time: "2023-01-02 00:00:00", Open: 1.0, High: 1.2, Low: 0.9, Close: 1.1, TickVolume: 1},
+			{Time: "2023-01-02 00:30:00", Open: 1.1, High: 1.3, Low: 1.0, Close: 1.2, TickVolume: 2},
+			{Time: "2023-01-02 02:00:00", Open: 1.2, High: 1.4, Low: 1.1, Close: 1.3, TickVolume: 3},
+			{Time: "2023-01-02 02:30:00", Open: 1.3, High: 1.5, Low: 1.2, Close: 1.4, TickVolume: 4},
+		}, DuplicatePolicyOverwrite)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		details, err := Action.resampleData(test.store, "EURUSD", M30, minFixTime, maxFixTime, profile)
+		if err != nil {
+			t.Fatalf("%s: resampleData returned %v", test.name, err)
+		}
+		if details[0].TimeType != H1.toInt() || details[0].CountData != 2 {
+			t.Errorf("%s: resampleData details[0] = %+v, want 2 H1 candles", test.name, details[0])
+		}
+
+		got, err := test.store.queryCandles("EURUSD", H1, minFixTime, maxFixTime)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []Candle{
+			{Time: "2023-01-02 00:00:00", Open: 1.0, High: 1.3, Low: 0.9, Close: 1.2, TickVolume: 3},
+			{Time: "2023-01-02 01:00:00", Open: 5, High: 5, Low: 5, Close: 5, TickVolume: 9},
+			{Time: "2023-01-02 02:00:00", Open: 1.2, High: 1.5, Low: 1.1, Close: 1.4, TickVolume: 7},
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: H1 after resampleData = %+v, want %+v", test.name, got, want)
+		}
+	}
+}
+
+func TestCandleAggregatorFlush(t *testing.T) {
+	profile := resolveTestProfile(t, newTestTimezoneRegistry(t), rawTimezoneProfile)
+	type flushed struct {
+		from  string
+		to    string
+		count int
+	}
+	candle := func(fixTime string) Candle { return Candle{Time: fixTime, Open: 1, High: 1, Low: 1, Close: 1} }
+
+	tests := []struct {
+		name      string
+		batchSize int
+		candles   []Candle
+		want      []flushed
+	}{
+		{
+			name:      "contiguous",
+			batchSize: 10,
+			candles:   []Candle{candle("2023-01-02 00:00:00"), candle("2023-01-02 00:30:00"), candle("2023-01-02 01:00:00")},
+			want:      []flushed{{"2023-01-02 00:00:00", "2023-01-02 01:00:00", 2}},
+		},
+		{
+			name:      "gap splits the range",
+			batchSize: 10,
+			candles:   []Candle{candle("2023-01-02 00:00:00"), candle("2023-01-02 03:30:00"), candle("2023-01-02 04:00:00")},
+			want: []flushed{
+				{"2023-01-02 00:00:00", "2023-01-02 00:00:00", 1},
+				{"2023-01-02 03:00:00", "2023-01-02 04:00:00", 2},
+			},
+		},
+		{
+			name:      "batches continue after the last flushed candle",
+			batchSize: 2,
+			candles: []Candle{candle("2023-01-02 00:00:00"), candle("2023-01-02 01:00:00"),
+				candle("2023-01-02 02:00:00"), candle("2023-01-02 03:00:00"), candle("2023-01-02 04:00:00")},
+			want: []flushed{
+				{"2023-01-02 00:00:00", "2023-01-02 01:00:00", 2},
+				{"2023-01-02 01:00:01", "2023-01-02 03:00:00", 2},
+				{"2023-01-02 03:00:01", "2023-01-02 04:00:00", 1},
+			},
+		},
+		{
+			name:      "outside the range",
+			batchSize: 10,
+			candles:   []Candle{candle("2022-12-31 23:00:00"), candle("2023-01-03 00:00:00")},
+			want:      []flushed{},
+		},
+	}
+
+	for _, test := range tests {
+		got := make([]flushed, 0)
+		aggregator := newCandleAggregator(H1, profile, "2023-01-01 00:00:00", "2023-01-02 23:59:59",
+			func(from string, to string, candles []Candle) error {
+				got = append(got, flushed{from, to, len(candles)})
+				return nil
+			})
+		aggregator.batchSize = test.batchSize
+		for _, c := range test.candles {
+			err := aggregator.add(c)
+			if err != nil {
+				t.Fatalf("%s: add returned %v", test.name, err)
+			}
+		}
+		err := aggregator.finish()
+		if err != nil {
+			t.Fatalf("%s: finish returned %v", test.name, err)
+		}
+
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: flushed %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
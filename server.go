@@ -2,23 +2,38 @@ package main
 
 import (
 	"context"
-	"database/sql"
-	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"os"
+	"reflect"
 	"sort"
 	"strings"
+	"sync/atomic"
 )
 
 type (
 	ApiResponseStatus struct {
 		ErrorCode    uint16 `json:"code"`
 		ErrorMessage string `json:"message"`
+		ErrorType    string `json:"type,omitempty"` // エラーの名前(成功した場合は省略する)
 	}
 
 	ApiResponsePostData struct {
-		Status ApiResponseStatus `json:"status"`
+		Status     ApiResponseStatus `json:"status"`
+		CountData  int               `json:"countData"`
+		Inserted   int               `json:"inserted"`
+		Updated    int               `json:"updated"`
+		Unchanged  int               `json:"unchanged"`
+		Diffs      []CandleDiff      `json:"diffs,omitempty"`
+		Validation *ValidationReport `json:"validation,omitempty"`
+		Resampled  []PairDetail      `json:"resampled,omitempty"`
+	}
+
+	ApiResponsePostResample struct {
+		Status    ApiResponseStatus `json:"status"`
+		Resampled []PairDetail      `json:"resampled"`
 	}
 
 	ApiResponseDeleteData struct {
@@ -26,8 +41,9 @@ type (
 	}
 
 	ApiResponseGetDataSummary struct {
-		Status   ApiResponseStatus `json:"status"`
-		FixTimes []string          `json:"fixTimes"`
+		Status      ApiResponseStatus `json:"status"`
+		FixTimes    []string          `json:"fixTimes"`
+		TickVolumes []int32           `json:"tickVolumes"`
 	}
 
 	ApiResponseGetPairList struct {
@@ -45,46 +61,188 @@ type (
 		PairDetails []PairDetail      `json:"details"`
 	}
 
+	ApiResponseReplay struct {
+		Status  ApiResponseStatus `json:"status"`
+		Session *ReplayState      `json:"session"`
+	}
+
+	ApiResponseGetReport struct {
+		Status ApiResponseStatus `json:"status"`
+		Report *BacktestReport   `json:"report"`
+	}
+
+	ApiResponseGetIndicators struct {
+		Status ApiResponseStatus `json:"status"`
+		Times  []string          `json:"times"`
+		Series []IndicatorSeries `json:"series"`
+	}
+
 	ApiResponseGetData struct {
 		Status  ApiResponseStatus `json:"status"`
 		Candles []Candle          `json:"candles"`
 	}
 )
 
-func newApiResponseStatus(err error) ApiResponseStatus {
-	errorCode, errorMessage := getErrorStatus(err)
-	return ApiResponseStatus{ErrorCode: errorCode, ErrorMessage: errorMessage}
+// newApiResponseStatus エラーをリクエストの言語でレスポンスのstatusに変換する
+func newApiResponseStatus(r *http.Request, err error) ApiResponseStatus {
+	return newLocalizedStatus(err, languageOf(r))
+}
+
+// newLocalizedStatus エラーを指定した言語でレスポンスのstatusに変換する
+// 登録されていないエラーは内容をレスポンスに含めず、ログにのみ出力する
+func newLocalizedStatus(err error, language string) ApiResponseStatus {
+	if err == nil {
+		return ApiResponseStatus{ErrorCode: 0, ErrorMessage: "OK"}
+	}
+
+	spec, _ := lookupError(err)
+	if spec == internalErrorSpec {
+		log.Println(errorLogMessage(err))
+	}
+	return ApiResponseStatus{ErrorCode: spec.code, ErrorMessage: localizeError(err, language), ErrorType: spec.name}
 }
 
 type server struct {
-	impl *http.Server
-	db   *db
+	impl      *http.Server
+	store     CandleStore
+	timezones *timezoneRegistry
+	replays   *replayManager
+	uploads   *uploadManager
+	runtime   atomic.Pointer[runtimeSettings]
+}
+
+// runtimeSettings SIGHUPで再読み込みし、実行中に置き換える設定
+// リクエストの処理中に置き換わっても不整合が起きないよう、処理の開始時に一度だけ参照する
+type runtimeSettings struct {
+	holidays marketHolidays
+	auth     *authenticator
+	language string // Accept-Languageで対応する言語が指定されない場合の言語
+	origins  allowedOrigins
+}
+
+// reloadableConfigFields 実行中に変更を反映できる設定の項目
+// それ以外の項目(ポート・ストレージ・タイムゾーンなど)の変更は、再起動するまで反映しない
+var reloadableConfigFields = map[string]bool{
+	"MarketHolidays": true,
+	"APIKeys":        true,
+	"JWTSecret":      true,
+	"JWTSecretFile":  true,
+	"JWTIssuer":      true,
+	"Language":       true,
+	"AllowedOrigins": true,
+}
+
+// newRuntimeSettings 設定から実行中に置き換える設定を生成する
+func newRuntimeSettings(c *config) (*runtimeSettings, error) {
+	holidays, err := newMarketHolidays(c.MarketHolidays)
+	if err != nil {
+		return nil, err
+	}
+
+	auth, err := newAuthenticator(c)
+	if err != nil {
+		return nil, err
+	}
+
+	language, err := checkLanguage(c.Language)
+	if err != nil {
+		return nil, err
+	}
+
+	origins, err := newAllowedOrigins(c.AllowedOrigins)
+	if err != nil {
+		return nil, err
+	}
+
+	return &runtimeSettings{holidays: holidays, auth: auth, language: language, origins: origins}, nil
 }
 
 func newServer(c *config) (*server, error) {
 	log.Printf("use port: %d\n", c.ServerPort)
 
-	db := newDB(c)
-	err := db.open()
+	timezones, err := newTimezoneRegistry(c)
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := newCandleStore(c)
+	if err != nil {
+		return nil, err
+	}
+
+	err = store.open()
+	if err != nil {
+		return nil, err
+	}
+
+	uploads, err := newUploadManager(c.UploadDir)
 	if err != nil {
 		return nil, err
 	}
 
-	return &server{
-		impl: &http.Server{Addr: fmt.Sprintf(":%d", c.ServerPort)},
-		db:   db,
-	}, nil
+	settings, err := newRuntimeSettings(c)
+	if err != nil {
+		return nil, err
+	}
+	if !settings.auth.enabled() {
+		log.Println(logMessage(logAuthDisabled))
+	}
+
+	s := &server{
+		impl:      &http.Server{Addr: fmt.Sprintf(":%d", c.ServerPort)},
+		store:     store,
+		timezones: timezones,
+		replays:   newReplayManager(),
+		uploads:   uploads,
+	}
+	s.runtime.Store(settings)
+	return s, nil
+}
+
+// settings 現在の実行中に置き換える設定を返却する
+func (s *server) settings() *runtimeSettings {
+	return s.runtime.Load()
+}
+
+// reload 再読み込みした設定のうち、実行中に変更できる項目を反映する
+// それ以外の項目は、起動時の設定(started)と異なる場合に警告する
+// 認証の有効・無効はprivateデータセットの扱いが変わるため、再起動するまで切り替えない
+func (s *server) reload(started *config, reloaded *config) error {
+	settings, err := newRuntimeSettings(reloaded)
+	if err != nil {
+		return err
+	}
+	if settings.auth.enabled() != s.settings().auth.enabled() {
+		log.Println(logMessage(logAuthRestartRequired))
+		settings.auth = s.settings().auth
+	}
+
+	before, after := reflect.ValueOf(*started), reflect.ValueOf(*reloaded)
+	for i := 0; i < before.NumField(); i++ {
+		name := before.Type().Field(i).Name
+		if !reloadableConfigFields[name] && !reflect.DeepEqual(before.Field(i).Interface(), after.Field(i).Interface()) {
+			log.Println(logMessage(logRestartRequired, name))
+		}
+	}
+
+	s.runtime.Store(settings)
+	setLogLanguage(settings.language)
+	log.Println(logMessage(logConfigReloaded))
+	return nil
 }
 
 func (s *server) accept() error {
-	http.HandleFunc("/api/data", s.handleData)
-	http.HandleFunc("/api/data_summary", s.handleDataSummary)
-	http.HandleFunc("/api/pair_list", s.handlePairList)
-	http.HandleFunc("/api/pair_detail", s.handlePairDetail)
+	for _, route := range apiV1Routes() {
+		handle := route.handle
+		http.HandleFunc(route.path, s.withLanguage(s.withAuth(route.operationOf, func(w http.ResponseWriter, r *http.Request) {
+			handle(s, w, r)
+		})))
+	}
+	http.HandleFunc(apiV2Prefix+"/", s.withLanguage(s.handleV2))
 
 	err := s.impl.ListenAndServe()
 	if err != nil {
-		log.Println(err)
+		log.Println(errorLogMessage(err))
 		return err
 	}
 	return nil
@@ -95,20 +253,20 @@ func (s *server) shutdown(ctx context.Context) error {
 		return nil
 	}
 
-	log.Println("サーバーをシャットダウン中です")
+	log.Println(logMessage(logServerShutdown))
 	errShutdown := s.impl.Shutdown(ctx)
 
-	if s.db == nil {
+	if s.store == nil {
 		return errShutdown
 	}
 
-	log.Println("データベースをクローズ中です")
-	errDbClose := s.db.close()
+	log.Println(logMessage(logDatabaseClose))
+	errDbClose := s.store.close()
 	if errDbClose != nil {
 		return newErrMultipleCause(errShutdown, errDbClose)
 	}
 
-	log.Println("サーバーリソースの解放に成功しました")
+	log.Println(logMessage(logResourcesReleased))
 	return nil
 }
 
@@ -149,131 +307,190 @@ func (s *server) handleDataSummary(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	writeResponse := func(err error, fixTimes []string) {
-		status := newApiResponseStatus(err)
-		json.NewEncoder(w).Encode(ApiResponseGetDataSummary{Status: status, FixTimes: fixTimes})
+	writeResponse := func(err error, fixTimes []string, tickVolumes []int32) {
+		status := newApiResponseStatus(r, err)
+		writeApiResponse(w, r, err, ApiResponseGetDataSummary{Status: status, FixTimes: fixTimes, TickVolumes: tickVolumes})
 	}
 
-	pairName := r.Header.Get("x-pair-name")
+	pairName := requestParam(r, "x-pair-name")
 	err := Utils.checkPairName(pairName)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		writeResponse(err, []string{})
+		writeResponse(err, []string{}, []int32{})
 		return
 	}
 
-	timeTypeName := r.Header.Get("x-time-type")
+	timeTypeName := requestParam(r, "x-time-type")
 	timeType, err := Utils.getTimeType(timeTypeName)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		writeResponse(err, []string{})
+		writeResponse(err, []string{}, []int32{})
 		return
 	}
 
-	fixTimes, err := s.db.queryDataSummary(pairName, timeType)
+	fixTimes, tickVolumes, err := s.storeOf(r).queryDataSummary(pairName, timeType)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		writeResponse(err, []string{})
+		writeResponse(err, []string{}, []int32{})
 		return
 	}
 
-	writeResponse(nil, fixTimes)
+	writeResponse(nil, fixTimes, tickVolumes)
 }
 
+// handleDataPost リクエストボディを読み込みながら、ingestBatchSize本ずつ登録する
+// x-formatヘッダーでjson(UploadPayload形式), ndjson, csv(MT4/MT5形式)のいずれかを指定する
+// x-duplicate-policyヘッダーで既に存在する確定時刻の扱い(skip, overwrite, fail, report-diff)を指定する
+// x-validationヘッダーで検証モード(strict, lenient)、x-spike-thresholdヘッダーでスパイクとみなす変動率を指定する
 func (s *server) handleDataPost(w http.ResponseWriter, r *http.Request) {
-	writeResponse := func(err error) {
-		status := newApiResponseStatus(err)
-		json.NewEncoder(w).Encode(ApiResponsePostData{Status: status})
-	}
-
-	timeTypeName := r.Header.Get("x-time-type")
+	writeResponse := func(err error, result postDataResult) {
+		status := newApiResponseStatus(r, err)
+		writeApiResponse(w, r, err, ApiResponsePostData{
+			Status:     status,
+			CountData:  result.count,
+			Inserted:   result.registered.inserted,
+			Updated:    result.registered.updated,
+			Unchanged:  result.registered.unchanged,
+			Diffs:      result.registered.diffs,
+			Validation: result.validation.orNil(),
+			Resampled:  result.resampled,
+		})
+	}
+
+	timeTypeName := requestParam(r, "x-time-type")
 	timeType, err := Utils.getTimeType(timeTypeName)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		writeResponse(err)
+		writeResponse(err, postDataResult{})
 		return
 	}
 
-	pairName := r.Header.Get("x-pair-name")
+	pairName := requestParam(r, "x-pair-name")
 	err = Utils.checkPairName(pairName)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		writeResponse(err)
+		writeResponse(err, postDataResult{})
 		return
 	}
 
-	var payload UploadPayload
-	err = json.NewDecoder(r.Body).Decode(&payload)
+	profile, err := s.timezones.resolve(requestParam(r, "x-timezone-profile"))
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		writeResponse(err)
+		writeResponse(err, postDataResult{})
 		return
 	}
 
-	if len(payload.Data) <= 0 {
-		w.WriteHeader(http.StatusBadRequest)
-		writeResponse(ErrEmptyCandles{})
+	policy, err := checkDuplicatePolicy(requestParam(r, "x-duplicate-policy"))
+	if err != nil {
+		writeResponse(err, postDataResult{})
 		return
 	}
 
-	err = Action.postData(s.db, pairName, timeType, payload.Data)
+	validation, err := checkValidationOptions(requestParam(r, "x-validation"), requestParam(r, "x-spike-threshold"))
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		writeResponse(err)
+		writeResponse(err, postDataResult{})
 		return
 	}
 
-	writeResponse(nil)
+	format, err := checkUploadFormat(requestParam(r, "x-format"))
+	if err != nil {
+		writeResponse(err, postDataResult{})
+		return
+	}
+
+	options := postDataOptions{
+		profile:    profile,
+		resample:   requestParam(r, "x-resample") == "true",
+		policy:     policy,
+		validation: validation,
+	}
+
+	body := io.Reader(r.Body)
+	if validation.mode == ValidationModeStrict || policy == DuplicatePolicyFail {
+		// 問題や既存の行との衝突があれば何も登録しないよう、一時ファイルに書き出して全件を検証・比較してから登録する
+		path, err := spoolBody(s.uploads.dir, r.Body)
+		if err != nil {
+			writeResponse(err, postDataResult{})
+			return
+		}
+		defer os.Remove(path)
+
+		if validation.mode == ValidationModeStrict {
+			report, err := Action.validateFile(path, format, timeType, validation)
+			if err != nil {
+				writeResponse(err, postDataResult{validation: report})
+				return
+			}
+		}
+
+		if policy == DuplicatePolicyFail {
+			registered, err := Action.checkDuplicateConflicts(s.storeOf(r), pairName, timeType, path, format, options)
+			if err != nil {
+				writeResponse(err, postDataResult{registered: registered})
+				return
+			}
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			writeResponse(err, postDataResult{})
+			return
+		}
+		defer f.Close()
+		body = f
+	}
+
+	reader, err := newCandleReader(body, format)
+	if err != nil {
+		writeResponse(err, postDataResult{})
+		return
+	}
+
+	result, err := Action.postDataStream(s.storeOf(r), pairName, timeType, reader, options, nil)
+	if err != nil {
+		writeResponse(err, result)
+		return
+	}
+
+	writeResponse(nil, result)
 }
 
 func (s *server) handleDataGet(w http.ResponseWriter, r *http.Request) {
 	writeResponse := func(err error, candles []Candle) {
-		status := newApiResponseStatus(err)
-		json.NewEncoder(w).Encode(ApiResponseGetData{Status: status, Candles: candles})
+		status := newApiResponseStatus(r, err)
+		writeApiResponse(w, r, err, ApiResponseGetData{Status: status, Candles: candles})
 	}
 
-	pairName := r.Header.Get("x-pair-name")
+	pairName := requestParam(r, "x-pair-name")
 	err := Utils.checkPairName(pairName)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
 		writeResponse(err, []Candle{})
 		return
 	}
 
-	lowerTimeTypeName := r.Header.Get("x-lower-time-type")
+	lowerTimeTypeName := requestParam(r, "x-lower-time-type")
 	lowerTimeType, err := Utils.getTimeType(lowerTimeTypeName)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
 		writeResponse(err, []Candle{})
 		return
 	}
 
-	upperTimeTypeName := r.Header.Get("x-upper-time-type")
+	upperTimeTypeName := requestParam(r, "x-upper-time-type")
 	upperTimeType, err := Utils.getTimeType(upperTimeTypeName)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
 		writeResponse(err, []Candle{})
 		return
 	}
 
-	lowerTime := r.Header.Get("x-lower-time")
+	lowerTime := requestParam(r, "x-lower-time")
 	err = Utils.checkFixedTime(lowerTime)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
 		writeResponse(err, []Candle{})
 		return
 	}
 
-	limit, err := Utils.checkLimit(r.Header.Get("x-limit"))
+	limit, err := Utils.checkLimit(requestParam(r, "x-limit"))
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
 		writeResponse(err, []Candle{})
 		return
 	}
 
-	candles, err := s.db.queryData(pairName, lowerTimeType, lowerTime, upperTimeType, limit)
+	candles, err := s.storeOf(r).queryData(pairName, lowerTimeType, lowerTime, upperTimeType, limit)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
 		writeResponse(err, []Candle{})
 		return
 	}
@@ -283,48 +500,26 @@ func (s *server) handleDataGet(w http.ResponseWriter, r *http.Request) {
 
 func (s *server) handleDataDelete(w http.ResponseWriter, r *http.Request) {
 	writeResponse := func(err error) {
-		status := newApiResponseStatus(err)
-		json.NewEncoder(w).Encode(ApiResponseDeleteData{Status: status})
+		status := newApiResponseStatus(r, err)
+		writeApiResponse(w, r, err, ApiResponseDeleteData{Status: status})
 	}
 
-	pairName := r.Header.Get("x-pair-name")
+	pairName := requestParam(r, "x-pair-name")
 	err := Utils.checkPairName(pairName)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
 		writeResponse(err)
 		return
 	}
 
-	timeTypePramas := make([]string, int(NumTimeType))
-	for i := 0; i < int(NumTimeType); i++ {
-		timeTypePramas[i] = fmt.Sprintf("x-time-type-%d", i)
-	}
-
-	timeTypes := make([]TimeType, 0)
-	for _, timeTypeParam := range timeTypePramas {
-		timeTypeName := r.Header.Get(timeTypeParam)
-		timeType, err := Utils.getTimeType(timeTypeName)
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			writeResponse(ErrInvalidTimeType{})
-			return
-		}
-		timeTypes = append(timeTypes, timeType)
-	}
-
-	if len(timeTypes) <= 0 {
-		w.WriteHeader(http.StatusBadRequest)
-		writeResponse(ErrInvalidTimeType{})
+	timeTypes, err := readTimeTypes(r)
+	if err != nil {
+		writeResponse(err)
 		return
 	}
 
-	err = s.db.begin(func(tx *sql.Tx) error {
-		return s.db.deleteData(tx, pairName, timeTypes)
-	})
-
+	err = s.storeOf(r).deleteData(pairName, timeTypes)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		writeResponse(ErrInvalidTimeType{})
+		writeResponse(err)
 		return
 	}
 
@@ -345,13 +540,12 @@ func (s *server) handlePairList(w http.ResponseWriter, r *http.Request) {
 	}
 
 	writeResponse := func(err error, pairNames []string) {
-		status := newApiResponseStatus(err)
-		json.NewEncoder(w).Encode(ApiResponseGetPairList{Status: status, PairNames: pairNames})
+		status := newApiResponseStatus(r, err)
+		writeApiResponse(w, r, err, ApiResponseGetPairList{Status: status, PairNames: pairNames})
 	}
 
-	pairNames, err := s.db.getUploadedPairNames()
+	pairNames, err := s.storeOf(r).getUploadedPairNames()
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
 		writeResponse(err, []string{})
 		return
 	}
@@ -375,26 +569,24 @@ func (s *server) handlePairDetail(w http.ResponseWriter, r *http.Request) {
 	}
 
 	writeResponse := func(err error, countTable map[int]int) {
-		status := newApiResponseStatus(err)
+		status := newApiResponseStatus(r, err)
 		pairDetails := make([]PairDetail, 0)
 		for timeType, countData := range countTable {
 			pairDetails = append(pairDetails, PairDetail{TimeType: timeType, CountData: countData})
 		}
 		sort.Slice(pairDetails, func(i, j int) bool { return pairDetails[i].TimeType < pairDetails[j].TimeType })
-		json.NewEncoder(w).Encode(ApiResponseGetPairDetail{Status: status, PairDetails: pairDetails})
+		writeApiResponse(w, r, err, ApiResponseGetPairDetail{Status: status, PairDetails: pairDetails})
 	}
 
-	pairName := r.Header.Get("x-pair-name")
+	pairName := requestParam(r, "x-pair-name")
 	err := Utils.checkPairName(pairName)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
 		writeResponse(err, make(map[int]int))
 		return
 	}
 
-	countTable, err := s.db.getUploadedPairDetail(pairName)
+	countTable, err := s.storeOf(r).getUploadedPairDetail(pairName)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
 		writeResponse(err, make(map[int]int))
 		return
 	}
@@ -403,6 +595,137 @@ func (s *server) handlePairDetail(w http.ResponseWriter, r *http.Request) {
 
 }
 
+func (s *server) handleResample(w http.ResponseWriter, r *http.Request) {
+	supportedParams := []string{"*"}
+	supportedMethods := []string{
+		"POST",
+		"OPTIONS",
+	}
+	if handleCORS(w, r, supportedParams, supportedMethods) {
+		return
+	}
+
+	writeResponse := func(err error, resampled []PairDetail) {
+		status := newApiResponseStatus(r, err)
+		writeApiResponse(w, r, err, ApiResponsePostResample{Status: status, Resampled: resampled})
+	}
+
+	pairName := requestParam(r, "x-pair-name")
+	err := Utils.checkPairName(pairName)
+	if err != nil {
+		writeResponse(err, []PairDetail{})
+		return
+	}
+
+	timeTypeName := requestParam(r, "x-time-type")
+	timeType, err := Utils.getTimeType(timeTypeName)
+	if err != nil {
+		writeResponse(err, []PairDetail{})
+		return
+	}
+
+	profile, err := s.timezones.resolve(requestParam(r, "x-timezone-profile"))
+	if err != nil {
+		writeResponse(err, []PairDetail{})
+		return
+	}
+
+	// 期間の指定は任意(未指定の場合は全期間を再生成する)
+	from, to := requestParam(r, "x-from"), requestParam(r, "x-to")
+	for _, fixTime := range []string{from, to} {
+		if fixTime == "" {
+			continue
+		}
+		err = Utils.checkFixedTime(fixTime)
+		if err != nil {
+			writeResponse(err, []PairDetail{})
+			return
+		}
+	}
+	from = Utils.getStringOrDefault(from, minFixTime)
+	to = Utils.getStringOrDefault(to, maxFixTime)
+
+	resampled, err := Action.resampleData(s.storeOf(r), pairName, timeType, from, to, profile)
+	if err != nil {
+		writeResponse(err, []PairDetail{})
+		return
+	}
+
+	writeResponse(nil, resampled)
+}
+
+func (s *server) handleIndicators(w http.ResponseWriter, r *http.Request) {
+	supportedParams := []string{"*"}
+	supportedMethods := []string{
+		"GET",
+		"OPTIONS",
+	}
+	if handleCORS(w, r, supportedParams, supportedMethods) {
+		return
+	}
+
+	writeResponse := func(err error, times []string, series []IndicatorSeries) {
+		status := newApiResponseStatus(r, err)
+		writeApiResponse(w, r, err, ApiResponseGetIndicators{Status: status, Times: times, Series: series})
+	}
+
+	pairName := requestParam(r, "x-pair-name")
+	err := Utils.checkPairName(pairName)
+	if err != nil {
+		writeResponse(err, []string{}, []IndicatorSeries{})
+		return
+	}
+
+	timeTypeName := requestParam(r, "x-time-type")
+	timeType, err := Utils.getTimeType(timeTypeName)
+	if err != nil {
+		writeResponse(err, []string{}, []IndicatorSeries{})
+		return
+	}
+
+	specs, err := parseIndicatorSpecs(requestParam(r, "x-indicators"))
+	if err != nil {
+		writeResponse(err, []string{}, []IndicatorSeries{})
+		return
+	}
+
+	from, to := requestParam(r, "x-from"), requestParam(r, "x-to")
+	for _, fixTime := range []string{from, to} {
+		err = Utils.checkFixedTime(fixTime)
+		if err != nil {
+			writeResponse(err, []string{}, []IndicatorSeries{})
+			return
+		}
+	}
+
+	// リプレイ時刻の指定は任意(指定した場合は下位足から形成中の足を合成する)
+	replayTime := requestParam(r, "x-replay-time")
+	lowerTimeType := timeType
+	if replayTime != "" {
+		err = Utils.checkFixedTime(replayTime)
+		if err != nil {
+			writeResponse(err, []string{}, []IndicatorSeries{})
+			return
+		}
+
+		lowerTimeTypeName := requestParam(r, "x-lower-time-type")
+		lowerTimeType, err = Utils.getTimeType(lowerTimeTypeName)
+		if err != nil || timeType < lowerTimeType {
+			writeResponse(ErrInvalidTimeType{}, []string{}, []IndicatorSeries{})
+			return
+		}
+	}
+
+	times, series, err := Action.computeIndicators(
+		s.storeOf(r), pairName, timeType, from, to, specs, lowerTimeType, replayTime)
+	if err != nil {
+		writeResponse(err, []string{}, []IndicatorSeries{})
+		return
+	}
+
+	writeResponse(nil, times, series)
+}
+
 func handleCORS(w http.ResponseWriter, r *http.Request,
 	supportedParams []string, supportedMethods []string) bool {
 
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"database/sql"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const (
+	SQL_SQLITE_DATA_TABLE_ON_CONFLICT = `
+		ON CONFLICT(TIME_TYPE, FIX_TIME) DO NOTHING
+	`
+
+	SQL_SQLITE_QUERY_TABLE_NAMES = `
+		SELECT name FROM sqlite_master
+		WHERE type = 'table'
+		ORDER BY name
+	`
+
+	// sqliteMaxVariables 1つの文に含められるプレースホルダーの最大数(SQLITE_MAX_VARIABLE_NUMBER)
+	sqliteMaxVariables = 32766
+
+	// defaultSQLitePath SQLitePathが未指定の場合に使用するファイル名
+	defaultSQLitePath = "fx_tester.db"
+
+	// sqliteEachCandlePageSize eachCandleで1回のクエリで読み込むローソク足の本数
+	sqliteEachCandlePageSize = 1000
+)
+
+// sqliteDB 組み込みSQLiteによるストレージの実装
+type sqliteDB struct {
+	config   *config
+	impl     *sql.DB
+	migrator *migrator
+}
+
+// newSQLiteDB sqliteDBをnewする
+func newSQLiteDB(config *config) *sqliteDB {
+	return &sqliteDB{config: config}
+}
+
+// open DBファイルを開く
+func (db *sqliteDB) open() error {
+	db.close()
+
+	path := Utils.getStringOrDefault(db.config.SQLitePath, defaultSQLitePath)
+	impl, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return err
+	}
+
+	// SQLiteは同時書き込みができないため接続を1本に制限する
+	impl.SetMaxOpenConns(1)
+
+	err = impl.Ping()
+	if err != nil {
+		impl.Close()
+		return err
+	}
+
+	db.impl = impl
+	db.migrator = newMigrator(impl, StoreTypeSQLite)
+
+	// 既存のデータテーブルを最新のスキーマに更新(migrateコマンドで固定されたデータテーブルを除く)
+	err = db.migrator.prepare()
+	if err != nil {
+		return err
+	}
+	pairNames, err := db.getUploadedPairNames()
+	if err != nil {
+		return err
+	}
+	return db.migrator.upgradeAll(pairNames)
+}
+
+// close DBをクローズする
+func (db *sqliteDB) close() error {
+	if db.impl == nil {
+		return nil
+	}
+
+	err := db.impl.Close()
+	db.impl = nil
+	return err
+}
+
+// begin トランザクションを開始する
+func (db *sqliteDB) begin(transaction func(tx *sql.Tx) error) error {
+	return beginTransaction(db.impl, transaction)
+}
+
+// createDataTable データテーブルを作成する
+func (db *sqliteDB) createDataTable(pairName string) error {
+	return db.migrator.upgrade(pairName)
+}
+
+// migrateTo 全てのデータテーブルを指定したスキーマバージョンへ移行する
+func (db *sqliteDB) migrateTo(targetVersion int) error {
+	pairNames, err := db.getUploadedPairNames()
+	if err != nil {
+		return err
+	}
+	return db.migrator.migrateAll(pairNames, targetVersion)
+}
+
+// registerData データテーブルにデータを挿入する
+func (db *sqliteDB) registerData(pairName string, timeType TimeType, candles []Candle, policy string) (registerResult, error) {
+	if timeType == Unknown {
+		return registerResult{}, ErrInvalidTimeType{}
+	}
+
+	var result registerResult
+	err := db.begin(func(tx *sql.Tx) error {
+		var err error
+		result, err = sqlRegisterData(tx, pairName, timeType, candles, policy, func(inserts []Candle) error {
+			return sqlInsertData(tx, pairName, timeType, inserts, SQL_SQLITE_DATA_TABLE_ON_CONFLICT, db.insertLimit())
+		})
+		return err
+	})
+	return result, err
+}
+
+// insertLimit プレースホルダー数の上限から、1回のINSERT文の上限を返却する
+// SQLiteはサーバーへの送信がないため、バイト数は制限しない
+func (db *sqliteDB) insertLimit() insertBatchLimit {
+	return insertBatchLimit{maxRows: sqliteMaxVariables / insertParamsPerRow}
+}
+
+// getUploadedPairNames データがアップロードされている通貨ペア名の一覧を返却する
+func (db *sqliteDB) getUploadedPairNames() ([]string, error) {
+	res, err := db.impl.Query(SQL_SQLITE_QUERY_TABLE_NAMES)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+
+	pairNames := make([]string, 0)
+	for res.Next() {
+		var tableName string
+		err = res.Scan(&tableName)
+		if err != nil {
+			return nil, err
+		}
+
+		// データテーブルの規則(通貨ペア名、privateデータセットは接頭辞付き)に一致するテーブルのみを対象とする
+		if !isDataTableName(tableName) {
+			continue
+		}
+
+		pairNames = append(pairNames, tableName)
+	}
+
+	return pairNames, nil
+}
+
+func (db *sqliteDB) getUploadedPairDetail(pairName string) (map[int]int, error) {
+	return sqlGetUploadedPairDetail(db.impl, pairName)
+}
+
+func (db *sqliteDB) deleteData(pairName string, timeTypes []TimeType) error {
+	return db.begin(func(tx *sql.Tx) error {
+		return sqlDeleteData(tx, pairName, timeTypes)
+	})
+}
+
+func (db *sqliteDB) deleteDataRange(pairName string, timeType TimeType, from string, to string) error {
+	return db.begin(func(tx *sql.Tx) error {
+		return sqlDeleteDataRange(tx, pairName, timeType, from, to)
+	})
+}
+
+// replaceDataRange 期間内の行の削除とローソク足の登録を、1つのトランザクションで行う
+func (db *sqliteDB) replaceDataRange(pairName string, timeType TimeType, from string, to string, candles []Candle) error {
+	return db.begin(func(tx *sql.Tx) error {
+		return sqlReplaceDataRange(tx, pairName, timeType, from, to, candles, SQL_SQLITE_DATA_TABLE_ON_CONFLICT, db.insertLimit())
+	})
+}
+
+func (db *sqliteDB) queryCandles(pairName string, timeType TimeType, from string, to string) ([]Candle, error) {
+	return sqlQueryCandles(db.impl, pairName, timeType, from, to)
+}
+
+// eachCandle 期間内のローソク足を、sqliteEachCandlePageSize本ずつ読み込んでからfnに渡す
+// 接続は1本に制限しているため、fnの処理中(低速なクライアントへの出力など)に接続を占有しないよう、
+// カーソルを開いたままにせず、前のページの最後の確定時刻から次のページを読み込む
+func (db *sqliteDB) eachCandle(pairName string, timeType TimeType, from string, to string, fn func(c Candle) error) error {
+	last := ""
+	for {
+		page, err := sqlQueryCandleRange(db.impl, pairName, timeType, from, to, false, sqliteEachCandlePageSize)
+		if err != nil {
+			return err
+		}
+
+		for _, c := range page {
+			// 前のページの最後のローソク足は、次のページの先頭にも含まれる
+			if c.Time == last {
+				continue
+			}
+			err = fn(c)
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(page) < sqliteEachCandlePageSize {
+			return nil
+		}
+		last = page[len(page)-1].Time
+		from = last
+	}
+}
+
+func (db *sqliteDB) queryCandleRange(pairName string, timeType TimeType, from string, to string, descending bool, limit int) ([]Candle, error) {
+	return sqlQueryCandleRange(db.impl, pairName, timeType, from, to, descending, limit)
+}
+
+func (db *sqliteDB) queryLatestCandles(pairName string, timeType TimeType, before string, limit int) ([]Candle, error) {
+	return sqlQueryLatestCandles(db.impl, pairName, timeType, before, limit)
+}
+
+func (db *sqliteDB) countCandles(pairName string, timeType TimeType, from string, to string) (int, error) {
+	return sqlCountCandles(db.impl, pairName, timeType, from, to)
+}
+
+func (db *sqliteDB) queryDataSummary(pairName string, timeType TimeType) ([]string, []int32, error) {
+	return sqlQueryDataSummary(db.impl, pairName, timeType)
+}
+
+func (db *sqliteDB) queryData(
+	pairName string,
+	lowerTimeType TimeType,
+	lowerFixTime string,
+	upperTimeType TimeType,
+	limit int) ([]Candle, error) {
+	return sqlQueryData(db.impl, pairName, lowerTimeType, lowerFixTime, upperTimeType, limit)
+}
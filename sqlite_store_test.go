@@ -0,0 +1,124 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTestSQLiteDB 一時ディレクトリにDBファイルを作成し、データテーブルを作成したsqliteDBを返却する
+func newTestSQLiteDB(t *testing.T, pairName string) *sqliteDB {
+	t.Helper()
+	db := newSQLiteDB(&config{SQLitePath: filepath.Join(t.TempDir(), "test.db")})
+	err := db.open()
+	if err != nil {
+		t.Fatalf("open returned %v", err)
+	}
+	t.Cleanup(func() { db.close() })
+
+	err = db.createDataTable(pairName)
+	if err != nil {
+		t.Fatalf("createDataTable returned %v", err)
+	}
+	return db
+}
+
+// newTestCandles startから1分間隔のローソク足をcount本作成する
+func newTestCandles(start time.Time, count int) []Candle {
+	candles := make([]Candle, count)
+	for i := range candles {
+		candles[i] = Candle{
+			Time:       start.Add(time.Duration(i) * time.Minute).Format(fixTimeLayout),
+			Open:       1.1,
+			High:       1.2,
+			Low:        1.0,
+			Close:      1.15,
+			TickVolume: int32(i),
+		}
+	}
+	return candles
+}
+
+func TestSQLiteEachCandlePages(t *testing.T) {
+	start := time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		count int
+		from  string
+		to    string
+		want  int
+	}{
+		{0, minFixTime, maxFixTime, 0},
+		{1, minFixTime, maxFixTime, 1},
+		{sqliteEachCandlePageSize, minFixTime, maxFixTime, sqliteEachCandlePageSize},
+		{sqliteEachCandlePageSize*2 + 1, minFixTime, maxFixTime, sqliteEachCandlePageSize*2 + 1},
+		{sqliteEachCandlePageSize * 2, "2023-01-02 00:10:00", "2023-01-02 20:09:00", sqliteEachCandlePageSize + 200},
+	}
+
+	for _, test := range tests {
+		db := newTestSQLiteDB(t, "EURUSD")
+		candles := newTestCandles(start, test.count)
+		if len(candles) > 0 {
+			_, err := db.registerData("EURUSD", M1, candles, DuplicatePolicyFail)
+			if err != nil {
+				t.Fatalf("registerData returned %v", err)
+			}
+		}
+
+		got := make([]string, 0)
+		err := db.eachCandle("EURUSD", M1, test.from, test.to, func(c Candle) error {
+			got = append(got, c.Time)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("eachCandle returned %v", err)
+		}
+
+		if len(got) != test.want {
+			t.Errorf("count %d, %s - %s: eachCandle returned %d candles, want %d",
+				test.count, test.from, test.to, len(got), test.want)
+		}
+		for i := 1; i < len(got); i++ {
+			if got[i-1] >= got[i] {
+				t.Errorf("count %d: candles are not in ascending order at %d: %s, %s", test.count, i, got[i-1], got[i])
+				break
+			}
+		}
+	}
+}
+
+func TestSQLiteEachCandleReleasesConnection(t *testing.T) {
+	db := newTestSQLiteDB(t, "EURUSD")
+	start := time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC)
+	_, err := db.registerData("EURUSD", M1, newTestCandles(start, sqliteEachCandlePageSize+1), DuplicatePolicyFail)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 出力の途中で他の処理(書き込みを含む)が同じDBを使えること
+	done := make(chan error, 1)
+	go func() {
+		count := 0
+		done <- db.eachCandle("EURUSD", M1, minFixTime, maxFixTime, func(c Candle) error {
+			count++
+			if count%500 != 1 {
+				return nil
+			}
+			_, err := db.getUploadedPairDetail("EURUSD")
+			if err != nil {
+				return err
+			}
+			_, err = db.registerData("EURUSD", H1, []Candle{{Time: c.Time, Open: 1, High: 1, Low: 1, Close: 1}},
+				DuplicatePolicyOverwrite)
+			return err
+		})
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("eachCandle returned %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("eachCandle did not release the connection while calling fn")
+	}
+}
@@ -0,0 +1,428 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+)
+
+const (
+	// minFixTime, maxFixTime 期間を指定しない場合に使用する確定時刻の下限・上限
+	minFixTime = "1970-01-01 00:00:00"
+	maxFixTime = "9999-12-31 23:59:59"
+
+	StoreTypeMySQL  = "mysql"
+	StoreTypeSQLite = "sqlite"
+	StoreTypeMemory = "memory"
+)
+
+// CandleStore ローソク足の永続化先を抽象化するインターフェースです
+// registerDataに渡すローソク足の時刻は、確定時刻(yyyy-MM-dd HH:mm:ss)に変換済みであること
+// 既に存在する確定時刻のローソク足は、policy(DuplicatePolicy*)に従って扱う
+type CandleStore interface {
+	open() error
+	close() error
+	createDataTable(pairName string) error
+	registerData(pairName string, timeType TimeType, candles []Candle, policy string) (registerResult, error)
+	deleteData(pairName string, timeTypes []TimeType) error
+	deleteDataRange(pairName string, timeType TimeType, from string, to string) error
+	replaceDataRange(pairName string, timeType TimeType, from string, to string, candles []Candle) error
+	queryCandles(pairName string, timeType TimeType, from string, to string) ([]Candle, error)
+	eachCandle(pairName string, timeType TimeType, from string, to string, fn func(c Candle) error) error
+	queryCandleRange(pairName string, timeType TimeType, from string, to string, descending bool, limit int) ([]Candle, error)
+	queryLatestCandles(pairName string, timeType TimeType, before string, limit int) ([]Candle, error)
+	countCandles(pairName string, timeType TimeType, from string, to string) (int, error)
+	queryData(pairName string, lowerTimeType TimeType, lowerFixTime string, upperTimeType TimeType, limit int) ([]Candle, error)
+	queryDataSummary(pairName string, timeType TimeType) ([]string, []int32, error)
+	getUploadedPairNames() ([]string, error)
+	getUploadedPairDetail(pairName string) (map[int]int, error)
+}
+
+// sqlQueryer *sql.DBと*sql.Txのどちらからでも読み込めるようにするためのインターフェース
+type sqlQueryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// newCandleStore 設定に応じたストレージの実装を生成する
+func newCandleStore(config *config) (CandleStore, error) {
+	switch Utils.getStringOrDefault(config.StoreType, StoreTypeMySQL) {
+	case StoreTypeMySQL:
+		return newDB(config), nil
+	case StoreTypeSQLite:
+		return newSQLiteDB(config), nil
+	case StoreTypeMemory:
+		return newMemoryStore(), nil
+	}
+	return nil, ErrInvalidStoreType{}
+}
+
+// beginTransaction トランザクションを開始し、処理結果に応じてコミットまたはロールバックする
+func beginTransaction(impl *sql.DB, transaction func(tx *sql.Tx) error) error {
+	log.Println("transaction started..")
+	tx, err := impl.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if res := recover(); res != nil {
+			tx.Rollback()
+			log.Println("transaction failed... ", res)
+		} else if err != nil {
+			tx.Rollback()
+			log.Println("transaction failed... ", errorLogMessage(err))
+		} else {
+			tx.Commit()
+			log.Println("transaction successed!!")
+		}
+	}()
+
+	err = transaction(tx)
+	return err
+}
+
+// sqlGetUploadedPairDetail 時間軸ごとのデータ件数を取得する
+func sqlGetUploadedPairDetail(impl *sql.DB, pairName string) (map[int]int, error) {
+	sql := fmt.Sprintf(SQL_QUERY_UPLOADED_PAIR_DETAIL, pairName)
+	res, err := impl.Query(sql)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+
+	countTable := make(map[int]int)
+	for res.Next() {
+		var timeType int
+		var countData int
+		res.Scan(&timeType, &countData)
+
+		countTable[timeType] = countData
+	}
+
+	return countTable, nil
+}
+
+// sqlDeleteData 指定した時間軸のデータを削除する
+func sqlDeleteData(tx *sql.Tx, pairName string, timeTypes []TimeType) error {
+
+	inStatement := strings.Join(mapArray(timeTypes, func(v TimeType) string {
+		return strconv.FormatInt(int64(v), 10)
+	}), ",")
+
+	deleteDataSql := fmt.Sprintf(SQL_DELETE_DATA, pairName, inStatement)
+	_, err := tx.Exec(deleteDataSql)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// sqlDeleteDataRange 指定した時間軸・期間(両端を含む)のデータを削除する
+func sqlDeleteDataRange(tx *sql.Tx, pairName string, timeType TimeType, from string, to string) error {
+	deleteDataSql := fmt.Sprintf(SQL_DELETE_DATA_RANGE, pairName)
+	_, err := tx.Exec(deleteDataSql, int(timeType), from, to)
+	return err
+}
+
+// sqlReplaceDataRange 期間内の行を削除し、ローソク足を登録する(呼び出し側で同じトランザクションにまとめる)
+func sqlReplaceDataRange(
+	tx *sql.Tx,
+	pairName string,
+	timeType TimeType,
+	from string,
+	to string,
+	candles []Candle,
+	onConflict string,
+	limit insertBatchLimit) error {
+
+	err := sqlDeleteDataRange(tx, pairName, timeType, from, to)
+	if err != nil {
+		return err
+	}
+	if len(candles) == 0 {
+		return nil
+	}
+	return sqlInsertData(tx, pairName, timeType, candles, onConflict, limit)
+}
+
+// sqlQueryCandles 指定した時間軸・期間(両端を含む)のローソク足を確定時刻の昇順で取得する
+func sqlQueryCandles(impl *sql.DB, pairName string, timeType TimeType, from string, to string) ([]Candle, error) {
+	candles := make([]Candle, 0)
+	err := sqlEachCandle(impl, pairName, timeType, from, to, func(c Candle) error {
+		candles = append(candles, c)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return candles, nil
+}
+
+// sqlEachCandle 期間内のローソク足を確定時刻の昇順に1行ずつ読み込み、fnに渡す
+// 全件をメモリに保持しないため、大量のデータの出力に使用する
+func sqlEachCandle(impl sqlQueryer, pairName string, timeType TimeType, from string, to string, fn func(c Candle) error) error {
+	sql := fmt.Sprintf(SQL_QUERY_CANDLES, pairName)
+	rows, err := impl.Query(sql, int(timeType), from, to)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c Candle
+		err = rows.Scan(&c.Time, &c.High, &c.Open, &c.Close, &c.Low, &c.TickVolume)
+		if err != nil {
+			return err
+		}
+		err = fn(c)
+		if err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// sqlQueryCandleRange 指定した時間軸・期間(両端を含む)のローソク足を、確定時刻の昇順(descendingの場合は降順)で最大limit件取得する
+func sqlQueryCandleRange(
+	impl *sql.DB,
+	pairName string,
+	timeType TimeType,
+	from string,
+	to string,
+	descending bool,
+	limit int) ([]Candle, error) {
+
+	order := "ASC"
+	if descending {
+		order = "DESC"
+	}
+
+	candles := make([]Candle, 0)
+	rows, err := impl.Query(fmt.Sprintf(SQL_QUERY_CANDLE_RANGE, pairName, order), int(timeType), from, to, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c Candle
+		err = rows.Scan(&c.Time, &c.High, &c.Open, &c.Close, &c.Low, &c.TickVolume)
+		if err != nil {
+			return nil, err
+		}
+		candles = append(candles, c)
+	}
+
+	return candles, rows.Err()
+}
+
+// sqlQueryLatestCandles 指定した確定時刻より前の直近のローソク足を、確定時刻の昇順で最大limit件取得する
+func sqlQueryLatestCandles(impl *sql.DB, pairName string, timeType TimeType, before string, limit int) ([]Candle, error) {
+	sql := fmt.Sprintf(SQL_QUERY_LATEST_CANDLES, pairName)
+	rows, err := impl.Query(sql, int(timeType), before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	candles := make([]Candle, 0)
+	for rows.Next() {
+		var c Candle
+		err = rows.Scan(&c.Time, &c.High, &c.Open, &c.Close, &c.Low, &c.TickVolume)
+		if err != nil {
+			return nil, err
+		}
+		candles = append(candles, c)
+	}
+
+	for i, j := 0, len(candles)-1; i < j; i, j = i+1, j-1 {
+		candles[i], candles[j] = candles[j], candles[i]
+	}
+
+	return candles, rows.Err()
+}
+
+// sqlCountCandles 指定した時間軸・期間(両端を含む)のローソク足の件数を取得する
+func sqlCountCandles(impl *sql.DB, pairName string, timeType TimeType, from string, to string) (int, error) {
+	var count int
+	err := impl.QueryRow(fmt.Sprintf(SQL_COUNT_CANDLES, pairName), int(timeType), from, to).Scan(&count)
+	return count, err
+}
+
+// sqlQueryDataSummary 指定した時間軸の確定時刻と出来高の一覧を取得する
+func sqlQueryDataSummary(impl *sql.DB, pairName string, timeType TimeType) ([]string, []int32, error) {
+	sql := fmt.Sprintf(SQL_DATA_SUMMARY, pairName)
+	stmt, err := impl.Prepare(sql)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer stmt.Close()
+
+	row, err := stmt.Query(int(timeType))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer row.Close()
+
+	fixTimes := make([]string, 0)
+	tickVolumes := make([]int32, 0)
+	for row.Next() {
+		var fixTime string
+		var tickVolume int32
+		err = row.Scan(&fixTime, &tickVolume)
+		if err != nil {
+			return nil, nil, err
+		}
+		fixTimes = append(fixTimes, fixTime)
+		tickVolumes = append(tickVolumes, tickVolume)
+	}
+
+	return fixTimes, tickVolumes, nil
+}
+
+// sqlQueryData 下位足の時刻を基準に上位足のローソク足を取得する
+func sqlQueryData(
+	impl *sql.DB,
+	pairName string,
+	lowerTimeType TimeType,
+	lowerFixTime string,
+	upperTimeType TimeType,
+	limit int) ([]Candle, error) {
+
+	sql := fmt.Sprintf(SQL_DATA, pairName, pairName)
+
+	stmt, err := impl.Prepare(sql)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+	rows, err := stmt.Query(int(upperTimeType), lowerFixTime, limit, int(lowerTimeType), lowerFixTime)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	candles := make([]Candle, 0)
+	for rows.Next() {
+		var c Candle
+		err := rows.Scan(&c.Time, &c.Low, &c.Open, &c.Close, &c.High, &c.TickVolume)
+		if err != nil {
+			rowId := len(candles)
+			if rowId == 0 {
+				return nil, ErrNoEnoughUpperData{}
+			}
+			return nil, err
+		}
+		candles = append(candles, c)
+	}
+
+	if len(candles) < 2 {
+		return nil, ErrInvalidData{}
+	}
+
+	return candles, nil
+}
+
+// insertBatchLimit 1回のINSERT文に含める行数の上限
+type insertBatchLimit struct {
+	maxBytes int // 1回に送信できるパケットのバイト数(0の場合は制限しない)
+	maxRows  int // 1文に含められる最大行数(プレースホルダーの数の上限から決まる)
+}
+
+const (
+	// insertPlaceholder 1行分のプレースホルダー
+	insertPlaceholder = "(?, ?, ?, ?, ?, ?, ?)"
+
+	// insertParamsPerRow 1行あたりのプレースホルダーの数
+	insertParamsPerRow = 7
+
+	// insertRowFixedBytes 1行分のパラメータのうち、確定時刻以外が占めるバイト数の見積もり
+	// (型情報2バイト×7、TIME_TYPEとTICK_VOLUMEが8バイトずつ、価格が8バイト×4、文字列長1バイト)
+	insertRowFixedBytes = 2*insertParamsPerRow + 8*2 + 8*4 + 1
+)
+
+// nextBatchSize 先頭から何行を1回のINSERT文で登録するかを返却する
+// 文自体とパラメータのどちらのパケットもmaxBytesを超えないように行数を決める
+func (limit insertBatchLimit) nextBatchSize(pairName string, candles []Candle, onDuplicate string) int {
+	numRows := Utils.minInt(limit.maxRows, len(candles))
+	if limit.maxBytes <= 0 {
+		return numRows
+	}
+
+	statementBytes := len(fmt.Sprintf(SQL_INSERT_DATA, pairName)) + len(onDuplicate)
+	paramBytes := 0
+	for i := 0; i < numRows; i++ {
+		statementBytes += len(insertPlaceholder) + 1
+		paramBytes += insertRowFixedBytes + len(candles[i].Time)
+		if statementBytes > limit.maxBytes || paramBytes > limit.maxBytes {
+			// 1行も収まらない場合でも、少なくとも1行は送信する(サーバー側でエラーとなる)
+			return Utils.maxInt(i, 1)
+		}
+	}
+	return numRows
+}
+
+// makeInsertDataStatement 指定した行数分のプレースホルダーを持つ挿入用SQLを作成し返却する
+func makeInsertDataStatement(pairName string, numRows int, onDuplicate string) string {
+	placeholders := make([]string, numRows)
+	for i := range placeholders {
+		placeholders[i] = insertPlaceholder
+	}
+	return fmt.Sprintf(SQL_INSERT_DATA, pairName) + strings.Join(placeholders, ",") + onDuplicate
+}
+
+// makeInsertDataArgs 挿入用SQLのプレースホルダーに渡す値を作成し返却する
+// ローソク足の時刻は確定時刻(保存用タイムゾーン)に変換済みであること
+// 価格はfloat32の丸め誤差を含まないよう、10進数の表記を保ったfloat64で渡す
+func makeInsertDataArgs(timeType TimeType, candles []Candle) []interface{} {
+	args := make([]interface{}, 0, len(candles)*insertParamsPerRow)
+	for _, c := range candles {
+		args = append(args,
+			int(timeType), c.Time, toPrice(c.High), toPrice(c.Open), toPrice(c.Close), toPrice(c.Low), c.TickVolume)
+	}
+	return args
+}
+
+// sqlInsertData プレースホルダーを用いた複数行のINSERT文で、limitに収まる行数ずつ登録する
+// 同じ行数の文は1度だけ準備し、使い回す
+func sqlInsertData(
+	tx *sql.Tx,
+	pairName string,
+	timeType TimeType,
+	candles []Candle,
+	onDuplicate string,
+	limit insertBatchLimit) error {
+
+	statements := make(map[int]*sql.Stmt)
+	defer func() {
+		for _, stmt := range statements {
+			stmt.Close()
+		}
+	}()
+
+	for len(candles) > 0 {
+		numRows := limit.nextBatchSize(pairName, candles, onDuplicate)
+
+		stmt, ok := statements[numRows]
+		if !ok {
+			var err error
+			stmt, err = tx.Prepare(makeInsertDataStatement(pairName, numRows, onDuplicate))
+			if err != nil {
+				return err
+			}
+			statements[numRows] = stmt
+		}
+
+		_, err := stmt.Exec(makeInsertDataArgs(timeType, candles[:numRows])...)
+		if err != nil {
+			return err
+		}
+		candles = candles[numRows:]
+	}
+
+	return nil
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// benchmarkInsertRows 1回の計測で登録するM1の本数
+const benchmarkInsertRows = 10000
+
+func TestInsertBatchLimitNextBatchSize(t *testing.T) {
+	candles := newTestCandles(time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC), 10)
+	rowStatementBytes := len(insertPlaceholder) + 1
+	rowParamBytes := insertRowFixedBytes + len(fixTimeLayout)
+	// 文の長さで行数が決まるよう、長いON DUPLICATE句を付ける
+	longClause := strings.Repeat(" ", 1000)
+	longStatementBytes := len(fmt.Sprintf(SQL_INSERT_DATA, "EURUSD")) + len(longClause)
+
+	tests := []struct {
+		name        string
+		limit       insertBatchLimit
+		onDuplicate string
+		want        int
+	}{
+		{"no byte limit", insertBatchLimit{maxRows: 100}, "", 10},
+		{"row limit", insertBatchLimit{maxRows: 3}, "", 3},
+		{"row limit below byte limit", insertBatchLimit{maxBytes: 1 << 20, maxRows: 5}, "", 5},
+		{"parameters fit 5 rows", insertBatchLimit{maxBytes: rowParamBytes * 5, maxRows: 100}, "", 5},
+		{"parameters fit 5 rows with spare bytes", insertBatchLimit{maxBytes: rowParamBytes*6 - 1, maxRows: 100}, "", 5},
+		{"statement fits 3 rows", insertBatchLimit{maxBytes: longStatementBytes + rowStatementBytes*3, maxRows: 100}, longClause, 3},
+		{"no row fits", insertBatchLimit{maxBytes: 10, maxRows: 100}, "", 1},
+	}
+
+	for _, test := range tests {
+		got := test.limit.nextBatchSize("EURUSD", candles, test.onDuplicate)
+		if got != test.want {
+			t.Errorf("%s: nextBatchSize = %d, want %d", test.name, got, test.want)
+		}
+	}
+}
+
+// testCandleStores CandleStoreの実装ごとに、EURUSDのデータテーブルを作成したストレージを返却する関数
+// MySQLはオフラインで実行できないため含めていない。接続できる環境では、newDBでopenしたストレージを返却する関数を追加すれば同じテストを実行できる
+var testCandleStores = map[string]func(t *testing.T) CandleStore{
+	StoreTypeMemory: func(t *testing.T) CandleStore {
+		store := newMemoryStore()
+		err := store.createDataTable("EURUSD")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return store
+	},
+	StoreTypeSQLite: func(t *testing.T) CandleStore {
+		return newTestSQLiteDB(t, "EURUSD")
+	},
+}
+
+func TestCandleStoreQueries(t *testing.T) {
+	lowers := newTestCandles(time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC), 10)
+	uppers := []Candle{
+		{Time: "2023-01-02 00:00:00", Open: 1.1, High: 1.2, Low: 1.0, Close: 1.15, TickVolume: 100},
+		{Time: "2023-01-02 00:05:00", Open: 1.1, High: 1.25, Low: 1.05, Close: 1.2, TickVolume: 200},
+	}
+	// 形成中の5分足(00:05)に、00:06〜00:07の1分足を合成したもの
+	forming := Candle{Time: "2023-01-02 00:05:00", Open: 1.1, High: 1.25, Low: 1.0, Close: 1.15, TickVolume: 200 + 6 + 7}
+
+	tests := []struct {
+		name  string
+		query func(store CandleStore) (interface{}, error)
+		want  interface{}
+	}{
+		{"queryCandles", func(store CandleStore) (interface{}, error) {
+			return store.queryCandles("EURUSD", M1, minFixTime, maxFixTime)
+		}, lowers},
+		{"queryCandles period", func(store CandleStore) (interface{}, error) {
+			return store.queryCandles("EURUSD", M1, "2023-01-02 00:02:00", "2023-01-02 00:04:00")
+		}, lowers[2:5]},
+		{"eachCandle", func(store CandleStore) (interface{}, error) {
+			candles := make([]Candle, 0)
+			err := store.eachCandle("EURUSD", M1, minFixTime, maxFixTime, func(c Candle) error {
+				candles = append(candles, c)
+				return nil
+			})
+			return candles, err
+		}, lowers},
+		{"queryCandleRange desc", func(store CandleStore) (interface{}, error) {
+			return store.queryCandleRange("EURUSD", M1, minFixTime, "2023-01-02 00:08:00", true, 2)
+		}, []Candle{lowers[8], lowers[7]}},
+		{"queryLatestCandles", func(store CandleStore) (interface{}, error) {
+			return store.queryLatestCandles("EURUSD", M1, "2023-01-02 00:05:00", 2)
+		}, lowers[3:5]},
+		{"countCandles", func(store CandleStore) (interface{}, error) {
+			return store.countCandles("EURUSD", M1, "2023-01-02 00:02:00", "2023-01-02 00:04:30")
+		}, 3},
+		{"queryDataSummary", func(store CandleStore) (interface{}, error) {
+			fixTimes, tickVolumes, err := store.queryDataSummary("EURUSD", M5)
+			return []interface{}{fixTimes, tickVolumes}, err
+		}, []interface{}{[]string{"2023-01-02 00:00:00", "2023-01-02 00:05:00"}, []int32{100, 200}}},
+		{"queryData", func(store CandleStore) (interface{}, error) {
+			return store.queryData("EURUSD", M1, "2023-01-02 00:07:00", M5, 2)
+		}, []Candle{forming, uppers[0]}},
+		{"queryData without enough uppers", func(store CandleStore) (interface{}, error) {
+			return store.queryData("EURUSD", M1, "2023-01-02 00:04:00", M5, 2)
+		}, ErrInvalidData{}},
+		{"getUploadedPairNames", func(store CandleStore) (interface{}, error) {
+			return store.getUploadedPairNames()
+		}, []string{"EURUSD"}},
+		{"getUploadedPairDetail", func(store CandleStore) (interface{}, error) {
+			return store.getUploadedPairDetail("EURUSD")
+		}, map[int]int{int(M1): 10, int(M5): 2}},
+	}
+
+	for storeType, newStore := range testCandleStores {
+		store := newStore(t)
+		for timeType, candles := range map[TimeType][]Candle{M1: lowers, M5: uppers} {
+			_, err := store.registerData("EURUSD", timeType, candles, DuplicatePolicyFail)
+			if err != nil {
+				t.Fatalf("%s: registerData returned %v", storeType, err)
+			}
+		}
+
+		for _, test := range tests {
+			got, err := test.query(store)
+			if wantErr, ok := test.want.(error); ok {
+				if err != wantErr {
+					t.Errorf("%s %s: returned %v, want %v", storeType, test.name, err, wantErr)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("%s %s: returned %v", storeType, test.name, err)
+				continue
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("%s %s: returned %+v, want %+v", storeType, test.name, got, test.want)
+			}
+		}
+	}
+}
+
+func TestCandleStoreRegisterTickVolume(t *testing.T) {
+	registered := Candle{Time: "2023-01-02 00:00:00", Open: 1.1, High: 1.2, Low: 1.0, Close: 1.15, TickVolume: 42}
+	changed := registered
+	changed.TickVolume = 43
+
+	tests := []struct {
+		policy     string
+		want       registerResult
+		wantVolume int32
+	}{
+		{DuplicatePolicySkip, registerResult{unchanged: 1}, 42},
+		{DuplicatePolicyOverwrite, registerResult{updated: 1}, 43},
+	}
+
+	for storeType, newStore := range testCandleStores {
+		for _, test := range tests {
+			store := newStore(t)
+			_, err := store.registerData("EURUSD", M1, []Candle{registered}, DuplicatePolicyFail)
+			if err != nil {
+				t.Fatalf("%s: registerData returned %v", storeType, err)
+			}
+
+			// 出来高だけが異なる場合も、既存の行と異なるローソク足として扱う
+			result, err := store.registerData("EURUSD", M1, []Candle{changed}, test.policy)
+			if err != nil {
+				t.Errorf("%s %s: registerData returned %v", storeType, test.policy, err)
+				continue
+			}
+			if result.inserted != test.want.inserted || result.updated != test.want.updated {
+				t.Errorf("%s %s: registerData returned %+v, want %+v", storeType, test.policy, result, test.want)
+			}
+
+			candles, err := store.queryCandles("EURUSD", M1, minFixTime, maxFixTime)
+			if err != nil {
+				t.Fatalf("%s: queryCandles returned %v", storeType, err)
+			}
+			if len(candles) != 1 || candles[0].TickVolume != test.wantVolume {
+				t.Errorf("%s %s: queryCandles returned %+v, want volume %d", storeType, test.policy, candles, test.wantVolume)
+			}
+		}
+	}
+}
+
+// benchmarkInsert 計測のたびにデータを削除したうえで、insertでbenchmarkInsertRows本を登録する時間を計測する
+func benchmarkInsert(b *testing.B, store CandleStore, insert func(candles []Candle) error) {
+	b.Helper()
+	candles := newTestCandles(time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC), benchmarkInsertRows)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		err := store.deleteData("EURUSD", []TimeType{M1})
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.StartTimer()
+
+		err = insert(candles)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// newBenchmarkSQLiteDB 一時ディレクトリのDBファイルにデータテーブルを作成する(計測後にディレクトリごと削除される)
+func newBenchmarkSQLiteDB(b *testing.B) *sqliteDB {
+	b.Helper()
+	db := newSQLiteDB(&config{SQLitePath: filepath.Join(b.TempDir(), "bench.db")})
+	err := db.open()
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { db.close() })
+
+	err = db.createDataTable("EURUSD")
+	if err != nil {
+		b.Fatal(err)
+	}
+	return db
+}
+
+func BenchmarkInsertMemory(b *testing.B) {
+	store := newMemoryStore()
+	err := store.createDataTable("EURUSD")
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	benchmarkInsert(b, store, func(candles []Candle) error {
+		_, err := store.registerData("EURUSD", M1, candles, DuplicatePolicySkip)
+		return err
+	})
+}
+
+func BenchmarkInsertSQLiteLegacy(b *testing.B) {
+	db := newBenchmarkSQLiteDB(b)
+	benchmarkInsert(b, db, func(candles []Candle) error {
+		return db.begin(func(tx *sql.Tx) error {
+			return legacyInsertData(tx, "EURUSD", M1, candles, SQL_SQLITE_DATA_TABLE_ON_CONFLICT, 1000)
+		})
+	})
+}
+
+func BenchmarkInsertSQLitePrepared(b *testing.B) {
+	db := newBenchmarkSQLiteDB(b)
+	benchmarkInsert(b, db, func(candles []Candle) error {
+		return db.begin(func(tx *sql.Tx) error {
+			return sqlInsertData(tx, "EURUSD", M1, candles, SQL_SQLITE_DATA_TABLE_ON_CONFLICT, db.insertLimit())
+		})
+	})
+}
+
+func BenchmarkInsertSQLiteRegister(b *testing.B) {
+	db := newBenchmarkSQLiteDB(b)
+	benchmarkInsert(b, db, func(candles []Candle) error {
+		_, err := db.registerData("EURUSD", M1, candles, DuplicatePolicySkip)
+		return err
+	})
+}
+
+// legacyInsertData 値をSQLに埋め込み、batchSize行ずつ登録する(sqlInsertDataとの比較用の従来の方式)
+func legacyInsertData(
+	tx *sql.Tx,
+	pairName string,
+	timeType TimeType,
+	candles []Candle,
+	onDuplicate string,
+	batchSize int) error {
+
+	for i := 0; i < len(candles); i += batchSize {
+		slice := candles[i : i+Utils.minInt(batchSize, len(candles)-i)]
+
+		values := make([]string, len(slice))
+		for k, c := range slice {
+			values[k] = fmt.Sprintf(
+				"(%d, '%s', %f, %f, %f, %f, %d)",
+				int(timeType),
+				c.Time, c.High, c.Open, c.Close, c.Low, c.TickVolume)
+		}
+
+		_, err := tx.Exec(fmt.Sprintf(SQL_INSERT_DATA, pairName) + strings.Join(values, ",") + onDuplicate)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
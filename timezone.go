@@ -0,0 +1,172 @@
+package main
+
+import (
+	"time"
+	_ "time/tzdata"
+)
+
+const (
+	// DSTRuleNone サマータイムなし
+	DSTRuleNone = "none"
+	// DSTRuleEU 欧州式(3月最終日曜日〜10月最終日曜日)
+	DSTRuleEU = "eu"
+	// DSTRuleUS 米国式(3月第2日曜日〜11月第1日曜日)
+	DSTRuleUS = "us"
+
+	// rawTimezoneProfile サーバー時間を変換せずに保存するプロファイル名
+	rawTimezoneProfile = "RAW"
+	// defaultTimezoneProfile DefaultTimezoneProfileが未指定の場合に使用するプロファイル名
+	// 変換の導入前に登録したデータ(サーバー時間のまま)と混在しないよう、変換しないプロファイルを既定とする
+	// ブローカーのサーバー時間を変換する場合は、DefaultTimezoneProfileかx-timezone-profileで明示的に指定する
+	defaultTimezoneProfile = rawTimezoneProfile
+	// defaultStorageTimezone StorageTimezoneが未指定の場合に使用するタイムゾーン
+	defaultStorageTimezone = "Asia/Tokyo"
+)
+
+type (
+	// timezoneProfile ブローカーのサーバー時間の仕様
+	timezoneProfile struct {
+		Name         string // ブローカー名
+		SourceOffset int    // 冬時間におけるGMTからの時差(時間)
+		DSTRule      string // none, eu, usのいずれか
+		Raw          bool   // trueの場合、サーバー時間を変換せずに保存用タイムゾーンの時刻とみなす(SourceOffset, DSTRuleは使用しない)
+
+		dstLocation *time.Location
+		storage     *time.Location
+	}
+
+	// timezoneRegistry 利用可能なタイムゾーンプロファイルを管理する
+	timezoneRegistry struct {
+		profiles    map[string]*timezoneProfile
+		defaultName string
+	}
+)
+
+// builtinTimezoneProfiles 設定ファイルでプロファイルが指定されない場合に使用するプロファイル
+var builtinTimezoneProfiles = []timezoneProfile{
+	{Name: rawTimezoneProfile, Raw: true},
+	{Name: "XM", SourceOffset: 2, DSTRule: DSTRuleEU},
+	{Name: "OANDA", SourceOffset: 2, DSTRule: DSTRuleUS},
+	{Name: "UTC", SourceOffset: 0, DSTRule: DSTRuleNone},
+}
+
+// newTimezoneRegistry 設定ファイルの内容からtimezoneRegistryを生成する
+func newTimezoneRegistry(config *config) (*timezoneRegistry, error) {
+	storage, err := time.LoadLocation(Utils.getStringOrDefault(config.StorageTimezone, defaultStorageTimezone))
+	if err != nil {
+		return nil, ErrInvalidTimezoneProfile{}
+	}
+
+	profiles := config.TimezoneProfiles
+	if len(profiles) == 0 {
+		profiles = builtinTimezoneProfiles
+	}
+
+	registry := &timezoneRegistry{
+		profiles:    make(map[string]*timezoneProfile),
+		defaultName: Utils.getStringOrDefault(config.DefaultTimezoneProfile, defaultTimezoneProfile),
+	}
+
+	for _, p := range profiles {
+		profile := p
+		if profile.Raw && profile.Name != "" {
+			profile.storage = storage
+			registry.profiles[profile.Name] = &profile
+			continue
+		}
+		if profile.Name == "" || profile.SourceOffset < -12 || 14 < profile.SourceOffset {
+			return nil, ErrInvalidTimezoneProfile{}
+		}
+
+		switch Utils.getStringOrDefault(profile.DSTRule, DSTRuleNone) {
+		case DSTRuleNone:
+			profile.dstLocation = nil
+		case DSTRuleEU:
+			profile.dstLocation, err = time.LoadLocation("Europe/London")
+		case DSTRuleUS:
+			profile.dstLocation, err = time.LoadLocation("America/New_York")
+		default:
+			return nil, ErrInvalidTimezoneProfile{}
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		profile.storage = storage
+		registry.profiles[profile.Name] = &profile
+	}
+
+	// 設定ファイルでプロファイルを指定した場合も、変換しないプロファイルは常に使用できるようにする
+	if _, ok := registry.profiles[rawTimezoneProfile]; !ok {
+		registry.profiles[rawTimezoneProfile] = &timezoneProfile{Name: rawTimezoneProfile, Raw: true, storage: storage}
+	}
+
+	if _, ok := registry.profiles[registry.defaultName]; !ok {
+		return nil, ErrUnknownTimezoneProfile{}
+	}
+
+	return registry, nil
+}
+
+// resolve プロファイル名に対応するプロファイルを返却する(空文字の場合は既定のプロファイル)
+func (r *timezoneRegistry) resolve(name string) (*timezoneProfile, error) {
+	profile, ok := r.profiles[Utils.getStringOrDefault(name, r.defaultName)]
+	if !ok {
+		return nil, ErrUnknownTimezoneProfile{}
+	}
+	return profile, nil
+}
+
+// inSummerTime サーバー時間がサマータイム中かを返却する
+func (p *timezoneProfile) inSummerTime(serverTime time.Time) bool {
+	if p.Raw || p.dstLocation == nil {
+		return false
+	}
+
+	// 冬時間の時差でUTCに変換し、基準地域のサマータイム期間に含まれるかを判定する
+	utc := serverTime.Add(-time.Duration(p.SourceOffset) * time.Hour)
+	return time.Date(utc.Year(), utc.Month(), utc.Day(), utc.Hour(), utc.Minute(), 0, 0, time.UTC).
+		In(p.dstLocation).IsDST()
+}
+
+// toStorageTime サーバー時間(壁時計の時刻)を保存用タイムゾーンの時刻に変換する
+func (p *timezoneProfile) toStorageTime(serverTime time.Time) time.Time {
+	if p.Raw {
+		return time.Date(
+			serverTime.Year(), serverTime.Month(), serverTime.Day(),
+			serverTime.Hour(), serverTime.Minute(), serverTime.Second(), 0, p.storage)
+	}
+
+	offset := p.SourceOffset
+	if p.inSummerTime(serverTime) {
+		offset++
+	}
+
+	source := time.FixedZone(p.Name, offset*60*60)
+	t := time.Date(
+		serverTime.Year(), serverTime.Month(), serverTime.Day(),
+		serverTime.Hour(), serverTime.Minute(), serverTime.Second(), 0, source)
+	return t.In(p.storage)
+}
+
+// toServerTime 保存用タイムゾーンの時刻をブローカーのサーバー時間に変換する
+func (p *timezoneProfile) toServerTime(storageTime time.Time) time.Time {
+	if p.Raw {
+		return storageTime.In(p.storage)
+	}
+
+	offset := p.SourceOffset
+	if p.dstLocation != nil && storageTime.In(p.dstLocation).IsDST() {
+		offset++
+	}
+	return storageTime.In(time.FixedZone(p.Name, offset*60*60))
+}
+
+// parseFixTime 確定時刻の文字列を保存用タイムゾーンの時刻として解析する
+func (p *timezoneProfile) parseFixTime(fixTime string) (time.Time, error) {
+	t, err := time.ParseInLocation(fixTimeLayout, fixTime, p.storage)
+	if err != nil {
+		return t, ErrInvalidFixTime{}
+	}
+	return t, nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// newTestTimezoneRegistry 組み込みのプロファイルと、保存用タイムゾーンAsia/TokyoのtimezoneRegistryを作成する
+func newTestTimezoneRegistry(t *testing.T) *timezoneRegistry {
+	t.Helper()
+	registry, err := newTimezoneRegistry(&config{StorageTimezone: "Asia/Tokyo"})
+	if err != nil {
+		t.Fatalf("newTimezoneRegistry returned %v", err)
+	}
+	return registry
+}
+
+// resolveTestProfile プロファイル名に対応するプロファイルを返却する
+func resolveTestProfile(t *testing.T, registry *timezoneRegistry, name string) *timezoneProfile {
+	t.Helper()
+	profile, err := registry.resolve(name)
+	if err != nil {
+		t.Fatalf("resolve(%q) returned %v", name, err)
+	}
+	return profile
+}
+
+func TestTimezoneProfileToStorageTime(t *testing.T) {
+	registry := newTestTimezoneRegistry(t)
+	tests := []struct {
+		profile string
+		server  string
+		storage string
+	}{
+		// 欧州式: 冬時間GMT+2、夏時間GMT+3
+		{"XM", "2023-01-02 00:00:00", "2023-01-02 07:00:00"},
+		{"XM", "2023-07-03 00:00:00", "2023-07-03 06:00:00"},
+		// 欧州の夏時間開始(2023-03-26 01:00 UTC)の前後
+		{"XM", "2023-03-26 02:00:00", "2023-03-26 09:00:00"},
+		{"XM", "2023-03-26 04:00:00", "2023-03-26 10:00:00"},
+		// 欧州の夏時間終了(2023-10-29 01:00 UTC)の前後
+		{"XM", "2023-10-29 02:00:00", "2023-10-29 08:00:00"},
+		{"XM", "2023-10-29 04:00:00", "2023-10-29 11:00:00"},
+		// 米国式: 米国のみ夏時間の期間(2023-03-12〜2023-03-26)は欧州式と1時間ずれる
+		{"OANDA", "2023-03-20 00:00:00", "2023-03-20 06:00:00"},
+		{"XM", "2023-03-20 00:00:00", "2023-03-20 07:00:00"},
+		{"OANDA", "2023-11-06 00:00:00", "2023-11-06 07:00:00"},
+		// サマータイムなし
+		{"UTC", "2023-07-03 00:00:00", "2023-07-03 09:00:00"},
+		// 変換しない
+		{rawTimezoneProfile, "2023-07-03 00:00:00", "2023-07-03 00:00:00"},
+		{"", "2023-01-02 00:00:00", "2023-01-02 00:00:00"},
+	}
+
+	for _, test := range tests {
+		profile := resolveTestProfile(t, registry, test.profile)
+		server, err := time.Parse(fixTimeLayout, test.server)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		storage := profile.toStorageTime(server)
+		if got := storage.Format(fixTimeLayout); got != test.storage {
+			t.Errorf("%s: toStorageTime(%s) = %s, want %s", test.profile, test.server, got, test.storage)
+		}
+		if got := profile.toServerTime(storage).Format(fixTimeLayout); got != test.server {
+			t.Errorf("%s: toServerTime(%s) = %s, want %s", test.profile, test.storage, got, test.server)
+		}
+	}
+}
+
+func TestTimezoneProfileInSummerTime(t *testing.T) {
+	registry := newTestTimezoneRegistry(t)
+	tests := []struct {
+		profile string
+		server  string
+		want    bool
+	}{
+		{"XM", "2023-03-26 02:59:00", false},
+		{"XM", "2023-03-26 04:00:00", true},
+		{"XM", "2023-10-29 02:59:00", true},
+		{"XM", "2023-10-29 04:00:00", false},
+		{"OANDA", "2023-03-12 08:00:00", false},
+		{"OANDA", "2023-03-12 10:00:00", true},
+		{"OANDA", "2023-11-05 07:00:00", true},
+		{"OANDA", "2023-11-05 09:00:00", false},
+		{"UTC", "2023-07-03 00:00:00", false},
+		{rawTimezoneProfile, "2023-07-03 00:00:00", false},
+	}
+
+	for _, test := range tests {
+		profile := resolveTestProfile(t, registry, test.profile)
+		server, err := time.Parse(fixTimeLayout, test.server)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := profile.inSummerTime(server); got != test.want {
+			t.Errorf("%s: inSummerTime(%s) = %v, want %v", test.profile, test.server, got, test.want)
+		}
+	}
+}
+
+func TestNewTimezoneRegistry(t *testing.T) {
+	tests := []struct {
+		name   string
+		config config
+		valid  bool
+	}{
+		{"builtin", config{}, true},
+		{"configured default", config{DefaultTimezoneProfile: "XM"}, true},
+		{"unknown default", config{DefaultTimezoneProfile: "NONE"}, false},
+		{"raw is always available", config{
+			TimezoneProfiles:       []timezoneProfile{{Name: "A", SourceOffset: 3}},
+			DefaultTimezoneProfile: rawTimezoneProfile,
+		}, true},
+		{"offset out of range", config{TimezoneProfiles: []timezoneProfile{{Name: "A", SourceOffset: 15}}}, false},
+		{"unknown dst rule", config{TimezoneProfiles: []timezoneProfile{{Name: "A", DSTRule: "jp"}}}, false},
+		{"unknown storage timezone", config{StorageTimezone: "Mars/Olympus"}, false},
+	}
+
+	for _, test := range tests {
+		_, err := newTimezoneRegistry(&test.config)
+		if test.valid && err != nil {
+			t.Errorf("%s: newTimezoneRegistry returned %v", test.name, err)
+		}
+		if !test.valid && err == nil {
+			t.Errorf("%s: newTimezoneRegistry succeeded, want an error", test.name)
+		}
+	}
+}
@@ -0,0 +1,398 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"strconv"
+)
+
+const (
+	OrderSideBuy  = "buy"
+	OrderSideSell = "sell"
+
+	OrderTypeMarket = "market"
+	OrderTypeLimit  = "limit"
+	OrderTypeStop   = "stop"
+
+	CloseReasonManual     = "manual"
+	CloseReasonStopLoss   = "stopLoss"
+	CloseReasonTakeProfit = "takeProfit"
+)
+
+type (
+	// OrderPayload 注文時に送信されるデータ
+	OrderPayload struct {
+		Side       string  `json:"side"`
+		Type       string  `json:"type"`
+		Units      float64 `json:"units"`
+		Price      float64 `json:"price"`
+		StopLoss   float64 `json:"stopLoss"`
+		TakeProfit float64 `json:"takeProfit"`
+	}
+
+	// ModifyPositionPayload ポジションの決済逆指値・指値を変更する際に送信されるデータ
+	ModifyPositionPayload struct {
+		PositionID int     `json:"positionId"`
+		StopLoss   float64 `json:"stopLoss"`
+		TakeProfit float64 `json:"takeProfit"`
+	}
+
+	// Order 約定待ちの注文
+	Order struct {
+		ID         int     `json:"id"`
+		Side       string  `json:"side"`
+		Type       string  `json:"type"`
+		Units      float64 `json:"units"`
+		Price      float64 `json:"price"`
+		StopLoss   float64 `json:"stopLoss"`
+		TakeProfit float64 `json:"takeProfit"`
+		CreatedAt  string  `json:"createdAt"`
+	}
+
+	// Position 保有中のポジション
+	Position struct {
+		ID         int     `json:"id"`
+		Side       string  `json:"side"`
+		Units      float64 `json:"units"`
+		EntryPrice float64 `json:"entryPrice"`
+		StopLoss   float64 `json:"stopLoss"`
+		TakeProfit float64 `json:"takeProfit"`
+		OpenedAt   string  `json:"openedAt"`
+		// InitialStopLoss 最初に設定した決済逆指値(変更されても更新しない。R倍数の1Rの算出に使用する)
+		InitialStopLoss float64 `json:"initialStopLoss"`
+	}
+
+	// Trade 決済済みの取引
+	Trade struct {
+		PositionID int     `json:"positionId"`
+		Side       string  `json:"side"`
+		Units      float64 `json:"units"`
+		EntryPrice float64 `json:"entryPrice"`
+		ExitPrice  float64 `json:"exitPrice"`
+		StopLoss   float64 `json:"stopLoss"` // 決済時の決済逆指値
+		OpenedAt   string  `json:"openedAt"`
+		ClosedAt   string  `json:"closedAt"`
+		Profit     float64 `json:"profit"`
+		Reason     string  `json:"reason"`
+		// InitialStopLoss 最初に設定した決済逆指値
+		InitialStopLoss float64 `json:"initialStopLoss"`
+	}
+
+	// AccountState 口座の現在の状態
+	AccountState struct {
+		Orders         []Order    `json:"orders"`
+		Positions      []Position `json:"positions"`
+		Trades         []Trade    `json:"trades"`
+		RealizedProfit float64    `json:"realizedProfit"`
+	}
+
+	// tradingAccount リプレイセッションごとの注文・ポジション・取引履歴を管理する
+	// 損益は通貨単位数×価格差(決済通貨建て)で計算し、スプレッドは考慮しない
+	tradingAccount struct {
+		lastID    int
+		orders    []*Order
+		positions []*Position
+		trades    []Trade
+	}
+
+	// tradeEvent 価格の経路上で発生する約定・決済の候補
+	tradeEvent struct {
+		price    float64
+		priority int
+		apply    func(price float64, fixTime string)
+	}
+)
+
+// newTradingAccount tradingAccountをnewする
+func newTradingAccount() *tradingAccount {
+	return &tradingAccount{
+		orders:    make([]*Order, 0),
+		positions: make([]*Position, 0),
+		trades:    make([]Trade, 0),
+	}
+}
+
+// isActive 注文・ポジション・取引履歴のいずれかが存在するかを返却する
+func (a *tradingAccount) isActive() bool {
+	return len(a.orders) > 0 || len(a.positions) > 0 || len(a.trades) > 0
+}
+
+// state 口座の現在の状態を返却する
+func (a *tradingAccount) state() AccountState {
+	orders := make([]Order, 0, len(a.orders))
+	for _, o := range a.orders {
+		orders = append(orders, *o)
+	}
+
+	positions := make([]Position, 0, len(a.positions))
+	for _, p := range a.positions {
+		positions = append(positions, *p)
+	}
+
+	realizedProfit := 0.0
+	for _, t := range a.trades {
+		realizedProfit += t.Profit
+	}
+
+	return AccountState{
+		Orders:         orders,
+		Positions:      positions,
+		Trades:         append([]Trade{}, a.trades...),
+		RealizedProfit: realizedProfit,
+	}
+}
+
+// placeOrder 注文を受け付ける。成行注文は現在値で即時に約定する
+func (a *tradingAccount) placeOrder(payload OrderPayload, currentPrice float64, fixTime string) error {
+	if payload.Side != OrderSideBuy && payload.Side != OrderSideSell {
+		return ErrInvalidOrder{}
+	}
+	if payload.Units <= 0 || payload.StopLoss < 0 || payload.TakeProfit < 0 {
+		return ErrInvalidOrder{}
+	}
+
+	switch payload.Type {
+	case OrderTypeMarket:
+	case OrderTypeLimit, OrderTypeStop:
+		if payload.Price <= 0 {
+			return ErrInvalidOrder{}
+		}
+	default:
+		return ErrInvalidOrder{}
+	}
+
+	// 不正な注文で欠番が生じないよう、検証を終えてから採番する
+	a.lastID++
+	order := &Order{
+		ID:         a.lastID,
+		Side:       payload.Side,
+		Type:       payload.Type,
+		Units:      payload.Units,
+		Price:      payload.Price,
+		StopLoss:   payload.StopLoss,
+		TakeProfit: payload.TakeProfit,
+		CreatedAt:  fixTime,
+	}
+
+	if payload.Type == OrderTypeMarket {
+		a.fill(order, currentPrice, fixTime)
+	} else {
+		a.orders = append(a.orders, order)
+	}
+	return nil
+}
+
+// cancelOrder 約定待ちの注文を取り消す
+func (a *tradingAccount) cancelOrder(orderID int) error {
+	for i, o := range a.orders {
+		if o.ID == orderID {
+			a.orders = append(a.orders[:i], a.orders[i+1:]...)
+			return nil
+		}
+	}
+	return ErrOrderNotFound{}
+}
+
+// modifyPosition ポジションの決済逆指値・指値を変更する(0の場合は解除)
+// 決済逆指値なしで約定したポジションは、最初に設定した決済逆指値をInitialStopLossとする
+func (a *tradingAccount) modifyPosition(payload ModifyPositionPayload) error {
+	if payload.StopLoss < 0 || payload.TakeProfit < 0 {
+		return ErrInvalidOrder{}
+	}
+
+	for _, p := range a.positions {
+		if p.ID == payload.PositionID {
+			if p.InitialStopLoss == 0 {
+				p.InitialStopLoss = payload.StopLoss
+			}
+			p.StopLoss = payload.StopLoss
+			p.TakeProfit = payload.TakeProfit
+			return nil
+		}
+	}
+	return ErrPositionNotFound{}
+}
+
+// closePosition ポジションを現在値で決済する。unitsが0の場合は全量を決済する
+func (a *tradingAccount) closePosition(positionID int, units float64, currentPrice float64, fixTime string) error {
+	for _, p := range a.positions {
+		if p.ID != positionID {
+			continue
+		}
+
+		if units < 0 || p.Units < units {
+			return ErrInvalidOrder{}
+		}
+		if units == 0 {
+			units = p.Units
+		}
+
+		a.close(p, units, currentPrice, fixTime, CloseReasonManual)
+		return nil
+	}
+	return ErrPositionNotFound{}
+}
+
+// process 下位足1本分の値動きに沿って、約定待ちの注文と決済逆指値・指値を処理する
+func (a *tradingAccount) process(c Candle) {
+	path := intrabarPath(c)
+	for i := 1; i < len(path); i++ {
+		a.processSegment(path[i-1], path[i], c.Time)
+	}
+}
+
+// processSegment 価格がfromからtoへ動く間に発生する約定・決済を、発生順に処理する
+func (a *tradingAccount) processSegment(from float64, to float64, fixTime string) {
+	for {
+		events := a.collectEvents(from, to)
+		if len(events) == 0 {
+			return
+		}
+
+		// 始点に近い価格で発生するものから処理する(同じ価格の場合は損切りを優先する)
+		sort.SliceStable(events, func(i, j int) bool {
+			di, dj := math.Abs(events[i].price-from), math.Abs(events[j].price-from)
+			if di != dj {
+				return di < dj
+			}
+			return events[i].priority < events[j].priority
+		})
+
+		event := events[0]
+		event.apply(event.price, fixTime)
+		from = event.price
+	}
+}
+
+// collectEvents 価格がfromからtoへ動く間に発生する約定・決済の候補を列挙する
+func (a *tradingAccount) collectEvents(from float64, to float64) []tradeEvent {
+	events := make([]tradeEvent, 0)
+
+	for _, p := range a.positions {
+		position := p
+		stopLoss, takeProfit := reachBelow, reachAbove
+		if position.Side == OrderSideSell {
+			stopLoss, takeProfit = reachAbove, reachBelow
+		}
+
+		if price, ok := stopLoss(from, to, position.StopLoss); ok && position.StopLoss > 0 {
+			events = append(events, tradeEvent{price: price, priority: 0, apply: func(price float64, fixTime string) {
+				a.close(position, position.Units, price, fixTime, CloseReasonStopLoss)
+			}})
+		}
+		if price, ok := takeProfit(from, to, position.TakeProfit); ok && position.TakeProfit > 0 {
+			events = append(events, tradeEvent{price: price, priority: 1, apply: func(price float64, fixTime string) {
+				a.close(position, position.Units, price, fixTime, CloseReasonTakeProfit)
+			}})
+		}
+	}
+
+	for _, o := range a.orders {
+		order := o
+		trigger := reachBelow
+		if (order.Side == OrderSideBuy) == (order.Type == OrderTypeStop) {
+			trigger = reachAbove
+		}
+
+		if price, ok := trigger(from, to, order.Price); ok {
+			events = append(events, tradeEvent{price: price, priority: 2, apply: func(price float64, fixTime string) {
+				a.cancelOrder(order.ID)
+				a.fill(order, price, fixTime)
+			}})
+		}
+	}
+
+	return events
+}
+
+// fill 注文を約定させ、ポジションを作成する
+func (a *tradingAccount) fill(order *Order, price float64, fixTime string) {
+	a.positions = append(a.positions, &Position{
+		ID:         order.ID,
+		Side:       order.Side,
+		Units:      order.Units,
+		EntryPrice: price,
+		StopLoss:   order.StopLoss,
+		TakeProfit: order.TakeProfit,
+		OpenedAt:   fixTime,
+
+		InitialStopLoss: order.StopLoss,
+	})
+}
+
+// close ポジションを指定した数量だけ決済し、取引履歴に記録する
+func (a *tradingAccount) close(position *Position, units float64, price float64, fixTime string, reason string) {
+	direction := 1.0
+	if position.Side == OrderSideSell {
+		direction = -1.0
+	}
+
+	a.trades = append(a.trades, Trade{
+		PositionID: position.ID,
+		Side:       position.Side,
+		Units:      units,
+		EntryPrice: position.EntryPrice,
+		ExitPrice:  price,
+		StopLoss:   position.StopLoss,
+		OpenedAt:   position.OpenedAt,
+		ClosedAt:   fixTime,
+		Profit:     (price - position.EntryPrice) * units * direction,
+		Reason:     reason,
+
+		InitialStopLoss: position.InitialStopLoss,
+	})
+
+	position.Units -= units
+	if position.Units > 0 {
+		return
+	}
+
+	for i, p := range a.positions {
+		if p == position {
+			a.positions = append(a.positions[:i], a.positions[i+1:]...)
+			return
+		}
+	}
+}
+
+// intrabarPath ローソク足の形状から足中の値動きを推定する
+// 陽線は始値→安値→高値→終値、陰線は始値→高値→安値→終値の順に動いたものとする
+func intrabarPath(c Candle) []float64 {
+	if c.Close >= c.Open {
+		return []float64{toPrice(c.Open), toPrice(c.Low), toPrice(c.High), toPrice(c.Close)}
+	}
+	return []float64{toPrice(c.Open), toPrice(c.High), toPrice(c.Low), toPrice(c.Close)}
+}
+
+// toPrice float32の価格を、10進数での表記を保ったままfloat64に変換する
+func toPrice(value float32) float64 {
+	price, _ := strconv.ParseFloat(formatPrice(value), 64)
+	return price
+}
+
+// formatPrice float32の価格を、丸め誤差を含まない10進数の文字列に変換する
+func formatPrice(value float32) string {
+	return strconv.FormatFloat(float64(value), 'f', -1, 32)
+}
+
+// reachBelow 価格がfromからtoへ動く間にprice以下となる場合、その時点の価格を返却する
+func reachBelow(from float64, to float64, price float64) (float64, bool) {
+	if from <= price {
+		return from, true
+	}
+	if to <= price {
+		return price, true
+	}
+	return 0, false
+}
+
+// reachAbove 価格がfromからtoへ動く間にprice以上となる場合、その時点の価格を返却する
+func reachAbove(from float64, to float64, price float64) (float64, bool) {
+	if from >= price {
+		return from, true
+	}
+	if to >= price {
+		return price, true
+	}
+	return 0, false
+}
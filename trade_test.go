@@ -0,0 +1,138 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIntrabarPath(t *testing.T) {
+	tests := []struct {
+		name   string
+		candle Candle
+		want   []float64
+	}{
+		{"bullish", Candle{Open: 1.1, High: 1.3, Low: 1.0, Close: 1.2}, []float64{1.1, 1.0, 1.3, 1.2}},
+		{"bearish", Candle{Open: 1.2, High: 1.3, Low: 1.0, Close: 1.1}, []float64{1.2, 1.3, 1.0, 1.1}},
+		{"doji", Candle{Open: 1.1, High: 1.3, Low: 1.0, Close: 1.1}, []float64{1.1, 1.0, 1.3, 1.1}},
+	}
+
+	for _, test := range tests {
+		if got := intrabarPath(test.candle); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: intrabarPath = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestTradingAccountProcessFillOrder(t *testing.T) {
+	const fixTime = "2023-01-02 00:01:00"
+
+	type closed struct {
+		entry  float64
+		exit   float64
+		reason string
+	}
+	tests := []struct {
+		name   string
+		order  OrderPayload
+		candle Candle
+		want   []closed
+	}{
+		{
+			// 陽線は安値を先に付けるため、決済逆指値が先に約定する
+			name:   "bullish bar reaches stop loss first",
+			order:  OrderPayload{Side: OrderSideBuy, Type: OrderTypeMarket, Units: 1000, StopLoss: 1.09, TakeProfit: 1.12},
+			candle: Candle{Time: fixTime, Open: 1.1, Low: 1.085, High: 1.125, Close: 1.12},
+			want:   []closed{{1.1, 1.09, CloseReasonStopLoss}},
+		},
+		{
+			// 陰線は高値を先に付けるため、決済指値が先に約定する
+			name:   "bearish bar reaches take profit first",
+			order:  OrderPayload{Side: OrderSideBuy, Type: OrderTypeMarket, Units: 1000, StopLoss: 1.09, TakeProfit: 1.12},
+			candle: Candle{Time: fixTime, Open: 1.1, High: 1.125, Low: 1.085, Close: 1.09},
+			want:   []closed{{1.1, 1.12, CloseReasonTakeProfit}},
+		},
+		{
+			// 売りポジションは逆向きに判定する
+			name:   "sell position on bullish bar",
+			order:  OrderPayload{Side: OrderSideSell, Type: OrderTypeMarket, Units: 1000, StopLoss: 1.12, TakeProfit: 1.09},
+			candle: Candle{Time: fixTime, Open: 1.1, Low: 1.085, High: 1.125, Close: 1.12},
+			want:   []closed{{1.1, 1.09, CloseReasonTakeProfit}},
+		},
+		{
+			// 始値が決済逆指値を越えて始まった場合は、始値で約定する
+			name:   "gap through stop loss fills at open",
+			order:  OrderPayload{Side: OrderSideBuy, Type: OrderTypeMarket, Units: 1000, StopLoss: 1.09},
+			candle: Candle{Time: fixTime, Open: 1.08, Low: 1.07, High: 1.085, Close: 1.08},
+			want:   []closed{{1.1, 1.08, CloseReasonStopLoss}},
+		},
+		{
+			// 同じ区間で指値注文が約定した後、その先の決済逆指値も約定する
+			name:   "limit fill then stop loss within one segment",
+			order:  OrderPayload{Side: OrderSideBuy, Type: OrderTypeLimit, Units: 1000, Price: 1.095, StopLoss: 1.09, TakeProfit: 1.11},
+			candle: Candle{Time: fixTime, Open: 1.1, Low: 1.085, High: 1.115, Close: 1.11},
+			want:   []closed{{1.095, 1.09, CloseReasonStopLoss}},
+		},
+		{
+			// 逆指値注文は安値の後の上昇で約定し、同じ区間で決済指値に達する
+			name:   "stop fill after the low then take profit",
+			order:  OrderPayload{Side: OrderSideBuy, Type: OrderTypeStop, Units: 1000, Price: 1.105, StopLoss: 1.09, TakeProfit: 1.115},
+			candle: Candle{Time: fixTime, Open: 1.1, Low: 1.095, High: 1.12, Close: 1.115},
+			want:   []closed{{1.105, 1.115, CloseReasonTakeProfit}},
+		},
+		{
+			name:   "untouched levels stay open",
+			order:  OrderPayload{Side: OrderSideBuy, Type: OrderTypeMarket, Units: 1000, StopLoss: 1.09, TakeProfit: 1.12},
+			candle: Candle{Time: fixTime, Open: 1.1, Low: 1.095, High: 1.11, Close: 1.105},
+			want:   []closed{},
+		},
+	}
+
+	for _, test := range tests {
+		account := newTradingAccount()
+		err := account.placeOrder(test.order, 1.1, "2023-01-02 00:00:00")
+		if err != nil {
+			t.Fatalf("%s: placeOrder returned %v", test.name, err)
+		}
+
+		account.process(test.candle)
+
+		got := make([]closed, 0)
+		for _, trade := range account.state().Trades {
+			got = append(got, closed{trade.EntryPrice, trade.ExitPrice, trade.Reason})
+			if trade.ClosedAt != fixTime {
+				t.Errorf("%s: ClosedAt = %s, want %s", test.name, trade.ClosedAt, fixTime)
+			}
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: trades = %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestTradingAccountPlaceOrderKeepsIDsOnError(t *testing.T) {
+	const fixTime = "2023-01-02 00:00:00"
+	account := newTradingAccount()
+
+	orders := []struct {
+		payload OrderPayload
+		wantErr error
+	}{
+		{OrderPayload{Side: OrderSideBuy, Type: "trailing", Units: 1000}, ErrInvalidOrder{}},
+		{OrderPayload{Side: OrderSideBuy, Type: OrderTypeLimit, Units: 1000}, ErrInvalidOrder{}},
+		{OrderPayload{Side: "hold", Type: OrderTypeMarket, Units: 1000}, ErrInvalidOrder{}},
+		{OrderPayload{Side: OrderSideBuy, Type: OrderTypeLimit, Units: 1000, Price: 1.09}, nil},
+		{OrderPayload{Side: OrderSideSell, Type: OrderTypeStop, Units: 1000, Price: 0}, ErrInvalidOrder{}},
+		{OrderPayload{Side: OrderSideSell, Type: OrderTypeStop, Units: 1000, Price: 1.08}, nil},
+	}
+	for i, order := range orders {
+		err := account.placeOrder(order.payload, 1.1, fixTime)
+		if err != order.wantErr {
+			t.Errorf("order %d: placeOrder returned %v, want %v", i, err, order.wantErr)
+		}
+	}
+
+	// 不正な注文は採番しない
+	if len(account.orders) != 2 || account.orders[0].ID != 1 || account.orders[1].ID != 2 {
+		t.Errorf("orders %+v, want IDs 1 and 2", account.orders)
+	}
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	UploadStateReceiving = "receiving"
+	UploadStateIngesting = "ingesting"
+	UploadStateCompleted = "completed"
+	UploadStateFailed    = "failed"
+
+	// uploadSessionTimeout 最後の操作からアップロードセッションを破棄するまでの時間
+	uploadSessionTimeout = 24 * time.Hour
+)
+
+type (
+	// UploadState アップロードセッションの現在の状態
+	UploadState struct {
+		UploadID      string            `json:"uploadId"`
+		PairName      string            `json:"pairName"`
+		TimeType      int               `json:"timeType"`
+		Format        string            `json:"format"`
+		State         string            `json:"state"`
+		ReceivedBytes int64             `json:"receivedBytes"` // 次のチャンクはこの位置から送信する
+		InsertedRows  int               `json:"insertedRows"`  // 読み込み済みの行数
+		Inserted      int               `json:"inserted"`
+		Updated       int               `json:"updated"`
+		Unchanged     int               `json:"unchanged"`
+		Diffs         []CandleDiff      `json:"diffs,omitempty"`
+		Validation    *ValidationReport `json:"validation,omitempty"`
+		Resampled     []PairDetail      `json:"resampled,omitempty"`
+		Error         string            `json:"error,omitempty"`
+	}
+
+	// uploadSession 分割して送信されるファイルを一時ファイルに書き足し、完了後に取り込むセッション
+	// 送信が中断した場合でも、受信済みの位置から再開できる
+	uploadSession struct {
+		mutex      sync.Mutex
+		id         string
+		owner      string // 作成した利用者(認証が無効な場合は空)
+		store      CandleStore
+		pairName   string
+		timeType   TimeType
+		format     string
+		options    postDataOptions
+		path       string
+		received   int64
+		status     string
+		inserted   int
+		registered registerResult
+		validation ValidationReport
+		resampled  []PairDetail
+		err        error
+		lastAccess time.Time
+	}
+
+	// uploadManager アップロードセッションを管理する
+	uploadManager struct {
+		mutex    sync.Mutex
+		dir      string
+		sessions map[string]*uploadSession
+	}
+)
+
+// newUploadManager uploadManagerをnewする
+func newUploadManager(dir string) (*uploadManager, error) {
+	dir = Utils.getStringOrDefault(dir, filepath.Join(os.TempDir(), "fx-tester-uploads"))
+	err := os.MkdirAll(dir, 0o700)
+	if err != nil {
+		return nil, err
+	}
+	return &uploadManager{dir: dir, sessions: make(map[string]*uploadSession)}, nil
+}
+
+// create アップロードセッションを作成する
+// セッションはownerの利用者のみ操作でき、完了後にstoreのデータセットへ取り込む
+func (m *uploadManager) create(
+	owner string,
+	store CandleStore,
+	pairName string,
+	timeType TimeType,
+	format string,
+	options postDataOptions) (*uploadSession, error) {
+
+	format, err := checkUploadFormat(format)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := newSessionID()
+	if err != nil {
+		return nil, err
+	}
+
+	session := &uploadSession{
+		id:         id,
+		owner:      owner,
+		store:      store,
+		pairName:   pairName,
+		timeType:   timeType,
+		format:     format,
+		options:    options,
+		path:       filepath.Join(m.dir, id),
+		status:     UploadStateReceiving,
+		lastAccess: time.Now(),
+	}
+
+	f, err := os.Create(session.path)
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.removeExpired()
+	m.sessions[id] = session
+	return session, nil
+}
+
+// get アップロードIDに対応するセッションを返却する(他の利用者のセッションは存在しないものとして扱う)
+func (m *uploadManager) get(id string, owner string) (*uploadSession, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	session, ok := m.sessions[id]
+	if !ok || session.owner != owner {
+		return nil, ErrUploadSessionNotFound{}
+	}
+	return session, nil
+}
+
+// remove セッションと一時ファイルを破棄する(取り込み中のセッションは破棄できない)
+func (m *uploadManager) remove(id string, owner string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	session, ok := m.sessions[id]
+	if !ok || session.owner != owner {
+		return ErrUploadSessionNotFound{}
+	}
+
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+
+	if session.status == UploadStateIngesting {
+		return ErrUploadInProgress{}
+	}
+	delete(m.sessions, id)
+	return os.Remove(session.path)
+}
+
+// removeExpired 一定時間操作されていないセッションを破棄する
+func (m *uploadManager) removeExpired() {
+	for id, session := range m.sessions {
+		session.mutex.Lock()
+		expired := session.status != UploadStateIngesting && time.Since(session.lastAccess) > uploadSessionTimeout
+		session.mutex.Unlock()
+
+		if expired {
+			delete(m.sessions, id)
+			os.Remove(session.path)
+		}
+	}
+}
+
+// state セッションの現在の状態を返却する
+func (s *uploadSession) state() UploadState {
+	s.lastAccess = time.Now()
+
+	state := UploadState{
+		UploadID:      s.id,
+		PairName:      s.pairName,
+		TimeType:      s.timeType.toInt(),
+		Format:        s.format,
+		State:         s.status,
+		ReceivedBytes: s.received,
+		InsertedRows:  s.inserted,
+		Inserted:      s.registered.inserted,
+		Updated:       s.registered.updated,
+		Unchanged:     s.registered.unchanged,
+		Diffs:         s.registered.diffs,
+		Validation:    s.validation.orNil(),
+		Resampled:     s.resampled,
+	}
+	if s.err != nil {
+		state.Error = s.err.Error()
+	}
+	return state
+}
+
+// appendChunk 受信済みの位置(offset)から始まるチャンクを一時ファイルに書き足す
+// 受信の途中で切断された場合も、書き込めた分までを受信済みとする
+func (s *uploadSession) appendChunk(offset int64, chunk io.Reader) error {
+	if s.status != UploadStateReceiving {
+		return ErrUploadInProgress{}
+	}
+	if offset != s.received {
+		return ErrUploadOffsetMismatch{}
+	}
+
+	f, err := os.OpenFile(s.path, os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// 書き込みに失敗した残骸が残っている場合に備え、受信済みの位置以降を切り捨てる
+	err = f.Truncate(s.received)
+	if err != nil {
+		return err
+	}
+	_, err = f.Seek(s.received, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	written, err := io.Copy(f, chunk)
+	s.received += written
+	return err
+}
+
+// complete 受信を終了し、バックグラウンドで一時ファイルの取り込みを開始する
+func (s *uploadSession) complete() error {
+	if s.status != UploadStateReceiving {
+		return ErrUploadInProgress{}
+	}
+	s.status = UploadStateIngesting
+
+	go func() {
+		result, err := s.ingest(s.store)
+
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+
+		s.registered = result.registered
+		s.validation = result.validation
+		s.resampled = result.resampled
+		s.err = err
+		s.status = UploadStateCompleted
+		if err != nil {
+			log.Println(errorLogMessage(err))
+			s.status = UploadStateFailed
+		}
+	}()
+	return nil
+}
+
+// ingest 一時ファイルを読み込み、バッチごとに登録する
+// strictモード・fail指定の場合は、問題や既存の行との衝突があれば何も登録しないよう全件を検証・比較してから登録する
+func (s *uploadSession) ingest(store CandleStore) (postDataResult, error) {
+	if s.options.validation.mode == ValidationModeStrict {
+		report, err := Action.validateFile(s.path, s.format, s.timeType, s.options.validation)
+		if err != nil {
+			return postDataResult{validation: report}, err
+		}
+	}
+
+	if s.options.policy == DuplicatePolicyFail {
+		registered, err := Action.checkDuplicateConflicts(store, s.pairName, s.timeType, s.path, s.format, s.options)
+		if err != nil {
+			return postDataResult{registered: registered}, err
+		}
+	}
+
+	f, err := os.Open(s.path)
+	if err != nil {
+		return postDataResult{}, err
+	}
+	defer f.Close()
+
+	reader, err := newCandleReader(f, s.format)
+	if err != nil {
+		return postDataResult{}, err
+	}
+
+	return Action.postDataStream(store, s.pairName, s.timeType, reader, s.options, func(count int) {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		s.inserted = count
+	})
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+)
+
+type ApiResponseUpload struct {
+	Status ApiResponseStatus `json:"status"`
+	Upload *UploadState      `json:"upload"`
+}
+
+func writeUploadResponse(w http.ResponseWriter, r *http.Request, err error, state *UploadState) {
+	status := newApiResponseStatus(r, err)
+	writeApiResponse(w, r, err, ApiResponseUpload{Status: status, Upload: state})
+}
+
+func (s *server) handleUpload(w http.ResponseWriter, r *http.Request) {
+	supportedParams := []string{"*"}
+	supportedMethods := []string{
+		"POST",
+		"PUT",
+		"GET",
+		"DELETE",
+		"OPTIONS",
+	}
+	if handleCORS(w, r, supportedParams, supportedMethods) {
+		return
+	}
+
+	switch r.Method {
+	case "POST":
+		s.handleUploadCreate(w, r)
+		break
+
+	case "PUT":
+		offset, err := strconv.ParseInt(requestParam(r, "x-offset"), 10, 64)
+		if err != nil {
+			writeUploadResponse(w, r, ErrUploadOffsetMismatch{}, nil)
+			return
+		}
+
+		s.handleUploadStep(w, r, func(session *uploadSession) error {
+			return session.appendChunk(offset, r.Body)
+		})
+		break
+
+	case "GET":
+		s.handleUploadStep(w, r, func(session *uploadSession) error { return nil })
+		break
+
+	case "DELETE":
+		err := s.uploads.remove(requestParam(r, "x-upload-id"), ownerOf(r))
+		writeUploadResponse(w, r, err, nil)
+		break
+	}
+}
+
+func (s *server) handleUploadCreate(w http.ResponseWriter, r *http.Request) {
+	pairName := requestParam(r, "x-pair-name")
+	err := Utils.checkPairName(pairName)
+	if err != nil {
+		writeUploadResponse(w, r, err, nil)
+		return
+	}
+
+	timeTypeName := requestParam(r, "x-time-type")
+	timeType, err := Utils.getTimeType(timeTypeName)
+	if err != nil {
+		writeUploadResponse(w, r, err, nil)
+		return
+	}
+
+	profile, err := s.timezones.resolve(requestParam(r, "x-timezone-profile"))
+	if err != nil {
+		writeUploadResponse(w, r, err, nil)
+		return
+	}
+
+	policy, err := checkDuplicatePolicy(requestParam(r, "x-duplicate-policy"))
+	if err != nil {
+		writeUploadResponse(w, r, err, nil)
+		return
+	}
+
+	validation, err := checkValidationOptions(requestParam(r, "x-validation"), requestParam(r, "x-spike-threshold"))
+	if err != nil {
+		writeUploadResponse(w, r, err, nil)
+		return
+	}
+
+	options := postDataOptions{
+		profile:    profile,
+		resample:   requestParam(r, "x-resample") == "true",
+		policy:     policy,
+		validation: validation,
+	}
+	session, err := s.uploads.create(ownerOf(r), s.storeOf(r), pairName, timeType, requestParam(r, "x-format"), options)
+	if err != nil {
+		writeUploadResponse(w, r, err, nil)
+		return
+	}
+
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+
+	state := session.state()
+	writeUploadResponse(w, r, nil, &state)
+}
+
+// handleUploadStep x-upload-idヘッダーで指定されたセッションを操作し、操作後の状態を返却する
+// 操作に失敗した場合も、再開位置を知らせるためにセッションの状態を返却する
+func (s *server) handleUploadStep(w http.ResponseWriter, r *http.Request, operation func(session *uploadSession) error) {
+	session, err := s.uploads.get(requestParam(r, "x-upload-id"), ownerOf(r))
+	if err != nil {
+		writeUploadResponse(w, r, err, nil)
+		return
+	}
+
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+
+	err = operation(session)
+
+	state := session.state()
+	writeUploadResponse(w, r, err, &state)
+}
+
+func (s *server) handleUploadComplete(w http.ResponseWriter, r *http.Request) {
+	supportedParams := []string{"*"}
+	supportedMethods := []string{
+		"POST",
+		"OPTIONS",
+	}
+	if handleCORS(w, r, supportedParams, supportedMethods) {
+		return
+	}
+
+	s.handleUploadStep(w, r, func(session *uploadSession) error {
+		return session.complete()
+	})
+}
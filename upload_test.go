@@ -0,0 +1,159 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// interruptedReader nバイトを返却した後に、切断されたものとしてエラーを返却する
+type interruptedReader struct {
+	data string
+	n    int
+}
+
+func (r *interruptedReader) Read(p []byte) (int, error) {
+	if r.n <= 0 {
+		return 0, errors.New("connection reset")
+	}
+	n := copy(p, r.data[:r.n])
+	r.data, r.n = r.data[n:], r.n-n
+	return n, nil
+}
+
+func newTestUploadSession(t *testing.T, store CandleStore, format string) *uploadSession {
+	t.Helper()
+	manager, err := newUploadManager(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	profile := resolveTestProfile(t, newTestTimezoneRegistry(t), rawTimezoneProfile)
+	options := postDataOptions{
+		profile:    profile,
+		policy:     DuplicatePolicySkip,
+		validation: validationOptions{mode: ValidationModeLenient},
+	}
+	session, err := manager.create("", store, "EURUSD", M1, format, options)
+	if err != nil {
+		t.Fatalf("create returned %v", err)
+	}
+	return session
+}
+
+func TestUploadSessionAppendChunkResume(t *testing.T) {
+	session := newTestUploadSession(t, newMemoryStore(), UploadFormatNDJSON)
+	steps := []struct {
+		name         string
+		offset       int64
+		chunk        io.Reader
+		wantErr      error
+		wantReceived int64
+	}{
+		{"first chunk", 0, strings.NewReader("hello "), nil, 6},
+		{"resent first chunk", 0, strings.NewReader("hello "), ErrUploadOffsetMismatch{}, 6},
+		{"offset beyond received", 10, strings.NewReader("x"), ErrUploadOffsetMismatch{}, 6},
+		{"interrupted chunk keeps written bytes", 6, &interruptedReader{data: "world, again", n: 5}, errors.New("connection reset"), 11},
+		{"resume from received bytes", 11, strings.NewReader(", again"), nil, 18},
+		{"empty chunk", 18, strings.NewReader(""), nil, 18},
+	}
+
+	for _, step := range steps {
+		err := session.appendChunk(step.offset, step.chunk)
+		if (err == nil) != (step.wantErr == nil) || (err != nil && err.Error() != step.wantErr.Error()) {
+			t.Errorf("%s: appendChunk returned %v, want %v", step.name, err, step.wantErr)
+		}
+		if session.received != step.wantReceived {
+			t.Errorf("%s: received = %d, want %d", step.name, session.received, step.wantReceived)
+		}
+	}
+
+	data, err := os.ReadFile(session.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "hello world, again" {
+		t.Errorf("uploaded file = %q, want %q", data, "hello world, again")
+	}
+}
+
+func TestUploadSessionTruncatesPartialWrite(t *testing.T) {
+	session := newTestUploadSession(t, newMemoryStore(), UploadFormatNDJSON)
+	err := session.appendChunk(0, strings.NewReader("abc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 受信済みとして記録されていない残骸は、次のチャンクで上書きする
+	err = os.WriteFile(session.path, []byte("abcGARBAGE"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = session.appendChunk(3, strings.NewReader("def"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(session.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "abcdef" {
+		t.Errorf("uploaded file = %q, want %q", data, "abcdef")
+	}
+}
+
+func TestUploadSessionCompleteIngestsChunks(t *testing.T) {
+	store := newMemoryStore()
+	session := newTestUploadSession(t, store, UploadFormatNDJSON)
+
+	// 行の途中で分割したチャンク
+	chunks := []string{
+		`{"time":"2023.01.02 00:00","open":1.1,"high":1.2,"low":1.0,"close":1.15,"tickVolume":1}` + "\n" + `{"time":"2023.01.02 00:`,
+		`01","open":1.15,"high":1.25,"low":1.1,"close":1.2,"tickVolume":2}` + "\n",
+	}
+	for _, chunk := range chunks {
+		err := session.appendChunk(session.received, strings.NewReader(chunk))
+		if err != nil {
+			t.Fatalf("appendChunk returned %v", err)
+		}
+	}
+
+	session.mutex.Lock()
+	err := session.complete()
+	if err == nil {
+		err = session.appendChunk(session.received, strings.NewReader("x"))
+		if err != (ErrUploadInProgress{}) {
+			t.Errorf("appendChunk after complete returned %v, want ErrUploadInProgress", err)
+		}
+		err = nil
+	}
+	session.mutex.Unlock()
+	if err != nil {
+		t.Fatalf("complete returned %v", err)
+	}
+
+	var state UploadState
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		session.mutex.Lock()
+		state = session.state()
+		session.mutex.Unlock()
+		if state.State != UploadStateIngesting {
+			break
+		}
+	}
+
+	if state.State != UploadStateCompleted || state.Inserted != 2 {
+		t.Fatalf("state = %s, inserted %d (%s), want completed with 2 rows", state.State, state.Inserted, state.Error)
+	}
+	candles, err := store.queryCandles("EURUSD", M1, minFixTime, maxFixTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(candles) != 2 || candles[0].Time != "2023-01-02 00:00:00" || candles[1].Time != "2023-01-02 00:01:00" {
+		t.Errorf("stored candles = %+v", candles)
+	}
+}
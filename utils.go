@@ -7,6 +7,9 @@ import (
 	"time"
 )
 
+// fixTimeLayout データテーブルに保存する確定時刻の書式
+const fixTimeLayout = "2006-01-02 15:04:05"
+
 type utils struct{}
 
 var Utils utils
@@ -19,6 +22,14 @@ func (utils) minInt(a int, b int) int {
 	}
 }
 
+func (utils) maxInt(a int, b int) int {
+	if a >= b {
+		return a
+	} else {
+		return b
+	}
+}
+
 func (utils) getStringOrDefault(str string, def string) string {
 	if str == "" {
 		return def
@@ -26,7 +37,8 @@ func (utils) getStringOrDefault(str string, def string) string {
 	return str
 }
 
-func (utils) convXMTimeToJpTime(dateTime string) (time.Time, error) {
+// parseServerTime ブローカーのサーバー時間(yyyy.MM.dd HH:mm形式)を解析する
+func (utils) parseServerTime(dateTime string) (time.Time, error) {
 	rep := regexp.MustCompile(`(\d{4})\.(0[1-9]|1[0-2])\.(0[1-9]|1[0-9]|2[0-9]|3[0-1])(\s+([0-1][0-9]|2[0-3]):([0-5]\d)|\b)$`)
 
 	group := rep.FindStringSubmatch(dateTime)
@@ -41,89 +53,17 @@ func (utils) convXMTimeToJpTime(dateTime string) (time.Time, error) {
 	min := Utils.getStringOrDefault(group[6], "00")
 
 	return time.Parse(
-		"2006-01-02 15:04:05",
+		fixTimeLayout,
 		fmt.Sprintf("%s-%s-%s %s:%s:00", year, month, day, hour, min))
-
-	// if err != nil {
-	// 	return nil, ErrInvalidDateTimeFormat{}
-	// }
-
-	// convJpTime := func(t time.Time) time.Time {
-	// 	// XMのサーバー時間を日本時間に変換
-	// 	if isSummerTime := Utils.inSummerTime(t); isSummerTime {
-	// 		// サマータイムの場合
-	// 		jpTime := t.Add(time.Duration(6 * time.Hour))
-	// 		return jpTime
-	// 	} else {
-	// 		// サマータイム以外の場合
-	// 		jpTime := t.Add(time.Duration(7 * time.Hour))
-	// 		return jpTime
-	// 	}
-	// }
-
-	// // XMの時刻を日本時間を取得
-	// jpTime := convJpTime(t)
-	// return &jpTime, nil
 }
 
-func (utils) getCandleFixTime(dateTime string, timeType TimeType) (string, error) {
-	t, err := Utils.convXMTimeToJpTime(dateTime)
+// getCandleFixTime サーバー時間を保存用タイムゾーンの確定時刻に変換する
+func (utils) getCandleFixTime(dateTime string, profile *timezoneProfile) (string, error) {
+	t, err := Utils.parseServerTime(dateTime)
 	if err != nil {
 		return "", err
 	}
-	return t.Format("2006-01-02 15:04:05"), nil
-
-	// duration, err := timeType.getDuration()
-	// if err != nil {
-	// 	return "", err
-	// }
-
-	// deltaTime := t.Add(duration)
-
-	// return deltaTime.Format("2006-01-02 15:04:05"), nil
-}
-
-func (utils) inSummerTime(t time.Time) bool {
-	/*
-	* XMのサマータイムの仕様
-	* 夏時間　3月最終の日曜日午前1時〜10月最終の日曜日午前1時 => GMT+2
-	* 冬時間　10月最終の日曜日午前1時〜3月最終の日曜日午前1時 => GMT+3
-	 */
-
-	switch t.Month() {
-	// 4月、5月、6月、7月、8月、9月の場合
-	case 4, 5, 6, 7, 8, 9:
-		return true // サマータイム
-
-	// 10月の場合
-	case 10:
-		isPassedLastSunday := 31-t.Day()+int(t.Weekday())/7 == 0 // 最終日曜日、または過ぎたか
-		if isPassedLastSunday {
-			// 10月最終日曜日を過ぎた場合
-			if t.Weekday() == time.Sunday && t.Hour() < 1 {
-				// 10月最終日曜日かつ午前1時前
-				return true // サマータイム中
-			}
-			return false // サマータイムではない
-		}
-		return true // サマータイム中
-
-	// 3月の場合
-	case 3:
-		isPassedLastSunday := 31-t.Day()+int(t.Weekday())/7 == 0 // 最終日曜日、または過ぎたか
-		if isPassedLastSunday {
-			// 3月最終日曜日以降
-			if t.Weekday() == time.Sunday && t.Hour() < 1 {
-				// 10月最終日曜日かつ午前1時前
-				return false // サマータイムではない
-			}
-			return true // サマータイム中
-		}
-		return false // サマータイムではない
-
-	default:
-		return false
-	}
+	return profile.toStorageTime(t).Format(fixTimeLayout), nil
 }
 
 func (utils) checkPairName(pairName string) error {
@@ -154,7 +94,7 @@ func (utils) checkLimit(limit string) (int, error) {
 
 	ret, err := strconv.ParseInt(limit, 10, 32)
 	if err != nil {
-		return 0, ErrInvalidData{}
+		return 0, ErrInvalidLimit{}
 	}
 
 	if ret < 1 || 100 < ret {
@@ -163,8 +103,21 @@ func (utils) checkLimit(limit string) (int, error) {
 	return int(ret), nil
 }
 
+// checkSteps リプレイで進める・戻す本数を検証する(未指定の場合は1本)
+func (utils) checkSteps(steps string) (int, error) {
+	if steps == "" {
+		return 1, nil
+	}
+
+	ret, err := strconv.ParseInt(steps, 10, 32)
+	if err != nil || ret < 1 {
+		return 0, ErrInvalidSteps{}
+	}
+	return int(ret), nil
+}
+
 func (utils) checkFixedTime(fixedTime string) error {
-	rep := regexp.MustCompile(`^\d{4}-(?:0[1-9]|1[0-2])-(?:0[1-9]|[1-2]\d|3[0-1])\s(?:0[1-9]|1\d|2[0-3]):(?:[0-5]\d):00$`)
+	rep := regexp.MustCompile(`^\d{4}-(?:0[1-9]|1[0-2])-(?:0[1-9]|[1-2]\d|3[0-1])\s(?:[0-1]\d|2[0-3]):(?:[0-5]\d):00$`)
 	if !rep.MatchString(fixedTime) {
 		return ErrInvalidFixTime{}
 	}
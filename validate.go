@@ -0,0 +1,320 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	// ValidationModeLenient 不正なローソク足を除外して登録する(既定値)
+	ValidationModeLenient = "lenient"
+	// ValidationModeStrict 問題が1件でもあれば、何も登録せずに失敗する
+	ValidationModeStrict = "strict"
+
+	// ValidationSeverityError 不正なローソク足(lenientでは除外する)
+	ValidationSeverityError = "error"
+	// ValidationSeverityWarning 疑わしいローソク足(lenientでは登録する)
+	ValidationSeverityWarning = "warning"
+
+	ValidationRuleInvalidTime      = "invalid-time"
+	ValidationRuleNonPositivePrice = "non-positive-price"
+	ValidationRuleHighBelowBody    = "high-below-body"
+	ValidationRuleLowAboveBody     = "low-above-body"
+	ValidationRuleMisalignedTime   = "misaligned-time"
+	ValidationRuleDuplicateTime    = "duplicate-time"
+	ValidationRuleOutOfOrder       = "out-of-order"
+	ValidationRuleSpike            = "spike"
+
+	// defaultSpikeThreshold 直前の終値からの変動率がこれを超えた場合にスパイクとみなす
+	defaultSpikeThreshold = 0.05
+
+	// maxReportedIssues レスポンスに含める問題の最大件数
+	maxReportedIssues = 1000
+
+	// duplicateWindowSize 重複の検出のために保持する、直近に受け付けたローソク足の時刻の数
+	// これより前に受け付けたローソク足と同じ時刻は、順序の警告(out-of-order)としてのみ検出する
+	duplicateWindowSize = 10000
+)
+
+type (
+	// ValidationIssue 1本のローソク足で検出した問題
+	ValidationIssue struct {
+		Index    int    `json:"index"` // アップロードしたデータ内での位置(0始まり)
+		Time     string `json:"time"`  // サーバー時間
+		Rule     string `json:"rule"`
+		Severity string `json:"severity"`
+		Message  string `json:"message"`
+	}
+
+	// ValidationReport アップロードしたデータの品質レポート
+	ValidationReport struct {
+		Mode       string            `json:"mode"`
+		Checked    int               `json:"checked"`    // 検証した本数
+		Invalid    int               `json:"invalid"`    // errorを含む本数(lenientでは登録しない)
+		Warned     int               `json:"warned"`     // warningのみを含む本数
+		RuleCounts map[string]int    `json:"ruleCounts"` // ルールごとの検出件数
+		Issues     []ValidationIssue `json:"issues"`     // 最大maxReportedIssues件
+		Truncated  bool              `json:"truncated"`  // 件数の上限によりIssuesを省略した場合はtrue
+	}
+
+	// validationOptions 検証の動作を指定する
+	validationOptions struct {
+		mode           string
+		spikeThreshold float64 // 0の場合はスパイクを検出しない
+	}
+
+	// candleValidator アップロードされたローソク足を順に検証する
+	// 重複・順序・スパイクの検出のため、バッチをまたいで状態を保持する
+	// 重複の検出に使う時刻はduplicateWindowSize件までに限り、件数の多いアップロードでもメモリ使用量を一定に保つ
+	candleValidator struct {
+		options  validationOptions
+		timeType TimeType
+		seen     map[string]struct{} // windowに含まれる時刻
+		window   []string            // 直近に受け付けたローソク足の時刻(古いものから上書きするリングバッファ)
+		next     int                 // windowで次に上書きする位置
+		last     time.Time
+		previous *Candle
+		index    int
+		report   ValidationReport
+	}
+)
+
+// orNil 検証を行った場合はレポートを、行っていない場合はnilを返却する(レスポンスでの省略用)
+func (r ValidationReport) orNil() *ValidationReport {
+	if r.Mode == "" {
+		return nil
+	}
+	return &r
+}
+
+// checkValidationOptions 検証モードとスパイクの閾値を検証する(未指定の場合はlenient, 0.05)
+func checkValidationOptions(mode string, spikeThreshold string) (validationOptions, error) {
+	mode = Utils.getStringOrDefault(mode, ValidationModeLenient)
+	if mode != ValidationModeLenient && mode != ValidationModeStrict {
+		return validationOptions{}, ErrInvalidValidationMode{}
+	}
+
+	threshold := defaultSpikeThreshold
+	if spikeThreshold != "" {
+		var err error
+		threshold, err = strconv.ParseFloat(spikeThreshold, 64)
+		if err != nil || threshold < 0 || math.IsNaN(threshold) {
+			return validationOptions{}, ErrInvalidSpikeThreshold{}
+		}
+	}
+
+	return validationOptions{mode: mode, spikeThreshold: threshold}, nil
+}
+
+// newCandleValidator candleValidatorをnewする
+func newCandleValidator(timeType TimeType, options validationOptions) *candleValidator {
+	return &candleValidator{
+		options:  options,
+		timeType: timeType,
+		seen:     make(map[string]struct{}),
+		window:   make([]string, 0),
+		report: ValidationReport{
+			Mode:       options.mode,
+			RuleCounts: make(map[string]int),
+			Issues:     make([]ValidationIssue, 0),
+		},
+	}
+}
+
+// failed strictモードで問題を検出したかを返却する
+func (v *candleValidator) failed() bool {
+	return v.options.mode == ValidationModeStrict && v.report.Invalid+v.report.Warned > 0
+}
+
+// validate ローソク足を検証し、登録するローソク足を返却する
+// lenientではerrorを含むローソク足を除外する(strictでは除外せず、failedで判定する)
+func (v *candleValidator) validate(candles []Candle) []Candle {
+	accepted := make([]Candle, 0, len(candles))
+	for _, c := range candles {
+		issues := v.check(c)
+		v.index++
+		v.report.Checked++
+
+		invalid := false
+		for _, issue := range issues {
+			v.report.RuleCounts[issue.Rule]++
+			if len(v.report.Issues) < maxReportedIssues {
+				v.report.Issues = append(v.report.Issues, issue)
+			} else {
+				v.report.Truncated = true
+			}
+			if issue.Severity == ValidationSeverityError {
+				invalid = true
+			}
+		}
+
+		switch {
+		case invalid:
+			v.report.Invalid++
+			if v.options.mode == ValidationModeStrict {
+				accepted = append(accepted, c)
+			}
+		case len(issues) > 0:
+			v.report.Warned++
+			fallthrough
+		default:
+			accepted = append(accepted, c)
+			previous := c
+			v.previous = &previous
+		}
+	}
+	return accepted
+}
+
+// check 1本のローソク足に含まれる問題を返却する
+func (v *candleValidator) check(c Candle) []ValidationIssue {
+	issues := make([]ValidationIssue, 0)
+	add := func(rule string, severity string, format string, args ...interface{}) {
+		issues = append(issues, ValidationIssue{
+			Index:    v.index,
+			Time:     c.Time,
+			Rule:     rule,
+			Severity: severity,
+			Message:  fmt.Sprintf(format, args...),
+		})
+	}
+
+	if c.Open <= 0 || c.High <= 0 || c.Low <= 0 || c.Close <= 0 {
+		add(ValidationRuleNonPositivePrice, ValidationSeverityError, "価格に0以下の値が含まれています")
+	}
+	if c.High < c.Open || c.High < c.Close {
+		add(ValidationRuleHighBelowBody, ValidationSeverityError,
+			"高値(%s)が始値(%s)・終値(%s)より低くなっています", formatPrice(c.High), formatPrice(c.Open), formatPrice(c.Close))
+	}
+	if c.Low > c.Open || c.Low > c.Close {
+		add(ValidationRuleLowAboveBody, ValidationSeverityError,
+			"安値(%s)が始値(%s)・終値(%s)より高くなっています", formatPrice(c.Low), formatPrice(c.Open), formatPrice(c.Close))
+	}
+
+	serverTime, err := Utils.parseServerTime(c.Time)
+	if err != nil {
+		add(ValidationRuleInvalidTime, ValidationSeverityError, "時刻の形式が不正です")
+		return issues
+	}
+
+	if !isAlignedServerTime(serverTime, v.timeType) {
+		add(ValidationRuleMisalignedTime, ValidationSeverityError, "時刻が時間軸の区切りと一致していません")
+	}
+
+	key := serverTime.Format(fixTimeLayout)
+	if _, ok := v.seen[key]; ok {
+		add(ValidationRuleDuplicateTime, ValidationSeverityError, "同じ時刻のローソク足が既に含まれています")
+		return issues
+	}
+	if len(issues) > 0 {
+		// 不正なローソク足は登録しないため、以降の重複・順序・スパイクの判定の基準にしない
+		return issues
+	}
+	v.remember(key)
+
+	if !v.last.IsZero() && serverTime.Before(v.last) {
+		add(ValidationRuleOutOfOrder, ValidationSeverityWarning, "時刻が直前のローソク足(%s)より前になっています",
+			v.last.Format(serverTimeLayout))
+	}
+	if serverTime.After(v.last) {
+		v.last = serverTime
+	}
+
+	if v.options.spikeThreshold > 0 && v.previous != nil && v.previous.Close > 0 {
+		base := float64(v.previous.Close)
+		change := math.Max(math.Abs(float64(c.High)-base), math.Abs(base-float64(c.Low))) / base
+		if change > v.options.spikeThreshold {
+			add(ValidationRuleSpike, ValidationSeverityWarning, "直前の終値(%s)から%.2f%%変動しています",
+				formatPrice(v.previous.Close), change*100)
+		}
+	}
+
+	return issues
+}
+
+// remember 受け付けたローソク足の時刻を保持する(duplicateWindowSize件を超えた場合は最も古い時刻を破棄する)
+func (v *candleValidator) remember(key string) {
+	if len(v.window) < duplicateWindowSize {
+		v.window = append(v.window, key)
+	} else {
+		delete(v.seen, v.window[v.next])
+		v.window[v.next] = key
+		v.next = (v.next + 1) % duplicateWindowSize
+	}
+	v.seen[key] = struct{}{}
+}
+
+// isAlignedServerTime サーバー時間が時間軸の区切り(足の開始時刻)と一致しているかを返却する
+// 日足・週足の区切りはresampleと同様に、サーバー時間の0時(週足は日曜日0時)とする
+func isAlignedServerTime(serverTime time.Time, timeType TimeType) bool {
+	duration, err := timeType.getDuration()
+	if err != nil {
+		return false
+	}
+
+	midnight := time.Date(serverTime.Year(), serverTime.Month(), serverTime.Day(), 0, 0, 0, 0, time.UTC)
+	switch timeType {
+	case Daily:
+		return serverTime.Equal(midnight)
+	case Weekly:
+		return serverTime.Equal(midnight) && serverTime.Weekday() == time.Sunday
+	}
+	return serverTime.Sub(midnight)%duration == 0
+}
+
+// validateStream readerの全てのローソク足を検証し、品質レポートを返却する(登録は行わない)
+// strictモードで問題を検出した場合はErrValidationFailedを返却する
+func (action) validateStream(reader candleReader, timeType TimeType, options validationOptions) (ValidationReport, error) {
+	validator := newCandleValidator(timeType, options)
+	for {
+		candles, err := readCandleBatch(reader, ingestBatchSize)
+		if err != nil {
+			return validator.report, err
+		}
+		if len(candles) == 0 {
+			break
+		}
+		validator.validate(candles)
+	}
+
+	if validator.failed() {
+		return validator.report, ErrValidationFailed{}
+	}
+	return validator.report, nil
+}
+
+// validateFile ファイルの全てのローソク足を検証し、品質レポートを返却する(登録は行わない)
+func (action) validateFile(path string, format string, timeType TimeType, options validationOptions) (ValidationReport, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return ValidationReport{}, err
+	}
+	defer f.Close()
+
+	reader, err := newCandleReader(f, format)
+	if err != nil {
+		return ValidationReport{}, err
+	}
+	return Action.validateStream(reader, timeType, options)
+}
+
+// spoolBody リクエストボディを一時ファイルに書き出し、そのパスを返却する
+// strictモードで、登録前に全件を検証するために使用する
+func spoolBody(dir string, body io.Reader) (string, error) {
+	f, err := os.CreateTemp(dir, "post-*")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(f, body)
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
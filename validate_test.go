@@ -0,0 +1,87 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newTestServerCandles startから1分間隔の、サーバー時間の書式のローソク足をcount本作成する
+func newTestServerCandles(start time.Time, count int) []Candle {
+	candles := newTestCandles(start, count)
+	for i := range candles {
+		candles[i].Time = start.Add(time.Duration(i) * time.Minute).Format(serverTimeLayout)
+	}
+	return candles
+}
+
+func TestCandleValidatorRules(t *testing.T) {
+	valid := Candle{Time: "2023.01.02 00:00", Open: 1.1, High: 1.101, Low: 1.099, Close: 1.1005}
+	with := func(update func(c *Candle)) Candle {
+		c := valid
+		update(&c)
+		return c
+	}
+
+	tests := []struct {
+		name     string
+		timeType TimeType
+		candles  []Candle
+		want     []string // 最後のローソク足で検出するルール
+	}{
+		{"valid", M1, []Candle{valid}, []string{}},
+		{"non-positive price", M1, []Candle{with(func(c *Candle) { c.Low = 0 })}, []string{ValidationRuleNonPositivePrice}},
+		{"high below body", M1, []Candle{with(func(c *Candle) { c.High = 1.1001 })}, []string{ValidationRuleHighBelowBody}},
+		{"low above body", M1, []Candle{with(func(c *Candle) { c.Low = 1.1001 })}, []string{ValidationRuleLowAboveBody}},
+		{"invalid time", M1, []Candle{with(func(c *Candle) { c.Time = "2023-13-02" })}, []string{ValidationRuleInvalidTime}},
+		{"misaligned time", M5, []Candle{with(func(c *Candle) { c.Time = "2023.01.02 00:03" })}, []string{ValidationRuleMisalignedTime}},
+		{"duplicate time", M1, []Candle{valid, valid}, []string{ValidationRuleDuplicateTime}},
+		{"out of order", M1, []Candle{with(func(c *Candle) { c.Time = "2023.01.02 00:05" }), valid},
+			[]string{ValidationRuleOutOfOrder}},
+		{"spike", M1, []Candle{valid, with(func(c *Candle) { c.Time = "2023.01.02 00:01"; c.High = 1.2 })},
+			[]string{ValidationRuleSpike}},
+		{"invalid candle is not a duplicate base", M1, []Candle{with(func(c *Candle) { c.Open = 0 }), valid}, []string{}},
+	}
+
+	for _, test := range tests {
+		validator := newCandleValidator(test.timeType, validationOptions{mode: ValidationModeLenient, spikeThreshold: defaultSpikeThreshold})
+		validator.validate(test.candles[:len(test.candles)-1])
+
+		got := make([]string, 0)
+		for _, issue := range validator.check(test.candles[len(test.candles)-1]) {
+			got = append(got, issue.Rule)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: check = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestCandleValidatorDuplicateWindowIsBounded(t *testing.T) {
+	start := time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC)
+	candles := newTestServerCandles(start, duplicateWindowSize+100)
+	validator := newCandleValidator(M1, validationOptions{mode: ValidationModeLenient})
+	for i := 0; i < len(candles); i += ingestBatchSize {
+		validator.validate(candles[i:Utils.minInt(i+ingestBatchSize, len(candles))])
+	}
+
+	if len(validator.seen) != duplicateWindowSize || len(validator.window) != duplicateWindowSize {
+		t.Fatalf("validator keeps %d times (window %d), want %d", len(validator.seen), len(validator.window), duplicateWindowSize)
+	}
+
+	tests := []struct {
+		name   string
+		candle Candle
+		want   string
+	}{
+		{"latest", candles[len(candles)-1], ValidationRuleDuplicateTime},
+		{"oldest in the window", candles[100], ValidationRuleDuplicateTime},
+		{"evicted from the window", candles[99], ValidationRuleOutOfOrder},
+	}
+	for _, test := range tests {
+		issues := validator.check(test.candle)
+		if len(issues) != 1 || issues[0].Rule != test.want {
+			t.Errorf("%s: check = %+v, want %s", test.name, issues, test.want)
+		}
+	}
+}